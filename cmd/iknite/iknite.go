@@ -24,10 +24,15 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/kaweezle/iknite/pkg/cmd"
+	"github.com/kaweezle/iknite/pkg/cmd/util"
 )
 
 func main() { // nocov -- tested by integration tests
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-	defer cancel()
-	cobra.CheckErr(cmd.NewRootCmd(nil).ExecuteContext(ctx))
+	err := cmd.NewRootCmd(nil).ExecuteContext(ctx)
+	cancel()
+	if code := util.ExitCode(err); code != 1 {
+		os.Exit(code) //nolint:gocritic // cancel already called
+	}
+	cobra.CheckErr(err)
 }
@@ -5,7 +5,9 @@ package alpine
 import (
 	"fmt"
 	"log/slog"
+	"maps"
 	"net"
+	"slices"
 
 	"github.com/txn2/txeh"
 
@@ -36,6 +38,19 @@ func AddIpAddress(exec host.Executor, iface string, address net.IP, logger *slog
 	return nil
 }
 
+// RemoveIpAddress removes the IP address added with AddIpAddress from the interface iface.
+func RemoveIpAddress(exec host.Executor, iface string, address net.IP, logger *slog.Logger) error {
+	ones, _ := address.DefaultMask().Size()
+	ipWithMask := fmt.Sprintf("%v/%d", address, ones)
+
+	logger.Debug("Removing IP address", "ip", ipWithMask, "iface", iface)
+
+	if out, err := exec.Run(true, "/sbin/ip", "addr", "del", ipWithMask, "dev", iface); err != nil {
+		return fmt.Errorf("%s: %w", string(out), err)
+	}
+	return nil
+}
+
 func removeIpAddresses(hosts *txeh.Hosts, toRemove []net.IP) {
 	if len(toRemove) > 0 {
 		ips := make([]string, len(toRemove))
@@ -74,3 +89,32 @@ func AddIpMapping(
 	}
 	return nil
 }
+
+// SetHostsBlock replaces the entries of the hosts file commented with comment by the mappings of hosts. The entries
+// are appended at the end of the file, sorted by hostname, so that they form a block delimited by the comment. The
+// hostnames already mapped outside of the block, like the cluster domain name, are skipped with a warning so that
+// their mapping is kept.
+func SetHostsBlock(
+	hostsConfig *txeh.HostsConfig,
+	comment string,
+	hosts map[string]net.IP,
+	logger *slog.Logger,
+) error {
+	hostsFile, err := txeh.NewHosts(hostsConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create hosts file handler: %w", err)
+	}
+	hostsFile.RemoveByComment(comment)
+	for _, hostname := range slices.Sorted(maps.Keys(hosts)) {
+		if existing := hostsFile.ListAddressesByHost(hostname, true); len(existing) > 0 {
+			logger.Warn("Hostname already mapped in the hosts file, skipping it", "hostname", hostname,
+				"address", existing[0][0])
+			continue
+		}
+		hostsFile.AddHostWithComment(hosts[hostname].String(), hostname, comment)
+	}
+	if err = hostsFile.Save(); err != nil {
+		return fmt.Errorf("failed to save hosts file: %w", err)
+	}
+	return nil
+}
@@ -51,6 +51,22 @@ func TestAddIpAddress(t *testing.T) {
 	mockExec.AssertExpectations(t)
 }
 
+func TestRemoveIpAddress(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	mockExec := mockHost.NewMockExecutor(t)
+	mockExec.On("Run", true, "/sbin/ip", []string{"addr", "del", "192.168.99.16/24", "dev", "eth0"}).
+		Return([]byte(""), nil).Once()
+	mockExec.On("Run", true, "/sbin/ip", []string{"addr", "del", "192.168.99.17/24", "dev", "eth0"}).
+		Return([]byte("RTNETLINK answers: Cannot assign requested address"), new(exec.ExitError)).Once()
+
+	logger := testutil.TestLogger(t)
+	req.NoError(alpine.RemoveIpAddress(mockExec, "eth0", net.ParseIP("192.168.99.16"), logger))
+	err := alpine.RemoveIpAddress(mockExec, "eth0", net.ParseIP("192.168.99.17"), logger)
+	req.ErrorContains(err, "Cannot assign requested address")
+}
+
 func TestAddIpMapping(t *testing.T) {
 	t.Parallel()
 	req := require.New(t)
@@ -101,3 +117,46 @@ func TestAddIpMapping(t *testing.T) {
 	found = re2.Find(changed)
 	req.Nil(found, "Shouldn't contain old IP")
 }
+
+func TestSetHostsBlock(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	hostsFile := t.TempDir() + "/hosts"
+	req.NoError(os.WriteFile(hostsFile, []byte("127.0.0.1 localhost\n192.168.99.2 iknite.local\n"), 0o600))
+	config := &txeh.HostsConfig{ReadFilePath: hostsFile, WriteFilePath: hostsFile}
+
+	logger := testutil.TestLogger(t)
+
+	err := alpine.SetHostsBlock(config, "iknite-routes", map[string]net.IP{
+		"b.iknite.local": net.ParseIP("192.168.99.17"),
+		"a.iknite.local": net.ParseIP("192.168.99.16"),
+	}, logger)
+	req.NoError(err)
+	content, err := os.ReadFile(hostsFile)
+	req.NoError(err)
+	req.Regexp(`(?s)iknite\.local\n192\.168\.99\.16\s+a\.iknite\.local # iknite-routes\n`+
+		`192\.168\.99\.17\s+b\.iknite\.local # iknite-routes\n$`, string(content))
+
+	err = alpine.SetHostsBlock(config, "iknite-routes", map[string]net.IP{
+		"b.iknite.local": net.ParseIP("192.168.99.16"),
+	}, logger)
+	req.NoError(err)
+	content, err = os.ReadFile(hostsFile)
+	req.NoError(err)
+	req.NotContains(string(content), "a.iknite.local")
+	req.NotContains(string(content), "192.168.99.17")
+	req.Regexp(`192\.168\.99\.2\s+iknite\.local\n`, string(content))
+
+	// A route for the cluster domain name doesn't steal its mapping
+	err = alpine.SetHostsBlock(config, "iknite-routes", map[string]net.IP{
+		"iknite.local":   net.ParseIP("192.168.99.18"),
+		"c.iknite.local": net.ParseIP("192.168.99.19"),
+	}, logger)
+	req.NoError(err)
+	content, err = os.ReadFile(hostsFile)
+	req.NoError(err)
+	req.Regexp(`192\.168\.99\.2\s+iknite\.local\n`, string(content))
+	req.NotContains(string(content), "192.168.99.18")
+	req.Regexp(`192\.168\.99\.19\s+c\.iknite\.local # iknite-routes\n$`, string(content))
+}
@@ -35,6 +35,8 @@ type IkniteClusterSpec struct {
 	ClusterName                     string `json:"clusterName,omitempty"                     protobuf:"bytes,7,opt,name=clusterName"                       mapstructure:"cluster_name"`
 	Kustomization                   string `json:"kustomization,omitempty"                   protobuf:"bytes,8,opt,name=kustomization"`
 	APIBackendDatabaseDirectory     string `json:"apiBackendDatabaseDirectory,omitempty"     protobuf:"bytes,10,opt,name=apiBackendDatabaseDirectory"      mapstructure:"api_backend_database_directory"`
+	LoadBalancerIPPool              string `json:"loadBalancerIPPool,omitempty"              protobuf:"bytes,16,opt,name=loadBalancerIPPool"               mapstructure:"load_balancer_ip_pool"`
+	MDNSConflictPolicy              string `json:"mdnsConflictPolicy,omitempty"              protobuf:"bytes,17,opt,name=mdnsConflictPolicy"               mapstructure:"mdns_conflict_policy"`
 	Ip                              net.IP `json:"ip,omitempty"                              protobuf:"bytes,1,opt,name=ip"                                mapstructure:"ip"`
 	StatusServerPort                int    `json:"statusServerPort,omitempty"                protobuf:"varint,11,opt,name=statusServerPort"                mapstructure:"status_server_port"`
 	StatusUpdateIntervalSeconds     int    `json:"statusUpdateIntervalSeconds,omitempty"     protobuf:"varint,12,opt,name=statusUpdateIntervalSeconds"     mapstructure:"status_update_interval_seconds"`
@@ -42,6 +44,50 @@ type IkniteClusterSpec struct {
 	CreateIp                        bool   `json:"createIp,omitempty"                        protobuf:"bytes,4,opt,name=createIp"                          mapstructure:"create_ip"`
 	EnableMDNS                      bool   `json:"enableMDNS,omitempty"                      protobuf:"bytes,6,opt,name=enableMDNS"                        mapstructure:"enable_mdns"`
 	UseEtcd                         bool   `json:"useEtcd,omitempty"                         protobuf:"bytes,9,opt,name=useEtcd"                           mapstructure:"use_etcd"`
+	AirGapped                       bool   `json:"airGapped,omitempty"                       protobuf:"bytes,14,opt,name=airGapped"                        mapstructure:"air_gapped"`
+	ReconcileKustomization          bool   `json:"reconcileKustomization,omitempty"          protobuf:"bytes,15,opt,name=reconcileKustomization"           mapstructure:"reconcile_kustomization"`
+	// +optional
+	Forwards []ForwardRule `json:"forwards,omitempty" protobuf:"bytes,18,rep,name=forwards" mapstructure:"forwards"`
+	// +optional
+	Notifiers []NotifierConfig `json:"notifiers,omitempty" protobuf:"bytes,19,rep,name=notifiers" mapstructure:"notifiers"`
+}
+
+// ForwardRule forwards the TCP connections received on ListenAddress:Port to Target.
+//
+//nolint:lll // long struct tags
+type ForwardRule struct {
+	// Name identifies the rule. It defaults to the port.
+	Name string `json:"name,omitempty"          protobuf:"bytes,1,opt,name=name"          mapstructure:"name"`
+	// ListenAddress is the IP address to listen on. It defaults to the outbound IP address of the host.
+	ListenAddress string `json:"listenAddress,omitempty" protobuf:"bytes,2,opt,name=listenAddress" mapstructure:"listen_address"`
+	// Target is the host or host:port the connections are forwarded to. The port defaults to Port and the host to the
+	// cluster IP address.
+	Target string `json:"target,omitempty"        protobuf:"bytes,3,opt,name=target"        mapstructure:"target"`
+	Port   int    `json:"port"                    protobuf:"varint,4,opt,name=port"         mapstructure:"port"`
+}
+
+// NotifierConfig sends the lifecycle events of the cluster to a webhook or to a local command.
+//
+//nolint:lll // long struct tags
+type NotifierConfig struct {
+	// Name identifies the notifier. It defaults to the URL or the command.
+	Name string `json:"name,omitempty"                 protobuf:"bytes,1,opt,name=name"                  mapstructure:"name"`
+	// URL is the webhook URL the events are posted to as JSON.
+	URL string `json:"url,omitempty"                  protobuf:"bytes,2,opt,name=url"                   mapstructure:"url"`
+	// Headers are added to the webhook requests.
+	Headers map[string]string `json:"headers,omitempty"              protobuf:"bytes,3,rep,name=headers"               mapstructure:"headers"`
+	// Command is the command run for each event, with its arguments. The event is given as JSON on its standard input.
+	Command []string `json:"command,omitempty"              protobuf:"bytes,4,rep,name=command"               mapstructure:"command"`
+	// Events are the types of events sent by the notifier. It defaults to all of them.
+	Events []string `json:"events,omitempty"               protobuf:"bytes,5,rep,name=events"                mapstructure:"events"`
+	// Retries is the number of retries of a failed notification. It defaults to 3 when not set. 0 disables them.
+	Retries *int `json:"retries,omitempty"              protobuf:"varint,6,opt,name=retries"              mapstructure:"retries"`
+	// RetryIntervalSeconds is the delay before the first retry. It doubles at each retry and defaults to 5.
+	RetryIntervalSeconds int `json:"retryIntervalSeconds,omitempty" protobuf:"varint,7,opt,name=retryIntervalSeconds" mapstructure:"retry_interval_seconds"`
+	// MinIntervalSeconds is the minimum delay between two notifications. It defaults to 1.
+	MinIntervalSeconds int `json:"minIntervalSeconds,omitempty"   protobuf:"varint,8,opt,name=minIntervalSeconds"   mapstructure:"min_interval_seconds"`
+	// TimeoutSeconds is the timeout of a notification attempt. It defaults to 10.
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"       protobuf:"varint,9,opt,name=timeoutSeconds"       mapstructure:"timeout_seconds"`
 }
 
 func (c *IkniteClusterSpec) GetApiEndPoint() string {
@@ -56,6 +102,63 @@ type IkniteClusterStatus struct {
 	CurrentPhase        string                 `json:"currentPhase"        protobuf:"bytes,2,opt,name=currentPhase"`
 	WorkloadsState      ClusterWorkloadsState  `json:"workloadsState"      protobuf:"bytes,3,opt,name=workloadsState"`
 	State               ikniteApi.ClusterState `json:"state"               protobuf:"bytes,1,opt,name=state"`
+	// +optional
+	Kustomization KustomizationState `json:"kustomization,omitempty" protobuf:"bytes,4,opt,name=kustomization"`
+	// +optional
+	MDNS MDNSState `json:"mdns,omitempty" protobuf:"bytes,5,opt,name=mdns"`
+	// +optional
+	LoadBalancer LoadBalancerState `json:"loadBalancer,omitempty" protobuf:"bytes,6,opt,name=loadBalancer"`
+}
+
+// LoadBalancerState is the health of the controller setting the ingress IPs of the LoadBalancer services.
+//
+//nolint:lll // long struct tags
+type LoadBalancerState struct {
+	// OutboundIP is the outbound IP address of the host the services are patched with.
+	OutboundIP string `json:"outboundIP,omitempty"      protobuf:"bytes,1,opt,name=outboundIP"`
+	// LastError is the last error of the controller.
+	LastError string `json:"lastError,omitempty"       protobuf:"bytes,2,opt,name=lastError"`
+	// FailingServices are the namespace/name keys of the services that could not be patched.
+	FailingServices []string `json:"failingServices,omitempty" protobuf:"bytes,3,rep,name=failingServices"`
+	// Services is the number of LoadBalancer services.
+	Services int `json:"services"                  protobuf:"varint,4,opt,name=services"`
+	// Synced is true once the services have been listed.
+	Synced bool `json:"synced"                    protobuf:"varint,5,opt,name=synced"`
+	// Healthy is true when the controller is synced and all the services are patched.
+	Healthy bool `json:"healthy"                   protobuf:"varint,6,opt,name=healthy"`
+}
+
+const (
+	// MDNSConflictRename renames the published mDNS name when it is used by another host. It is the default.
+	MDNSConflictRename = "rename"
+	// MDNSConflictFail fails when the mDNS name is used by another host.
+	MDNSConflictFail = "fail"
+)
+
+// MDNSState is the outcome of the publication of the cluster domain name with mDNS.
+type MDNSState struct {
+	// RequestedName is the configured domain name.
+	RequestedName string `json:"requestedName,omitempty" protobuf:"bytes,1,opt,name=requestedName"`
+	// Name is the published name. It differs from RequestedName when the name has been renamed after a conflict.
+	Name string `json:"name,omitempty" protobuf:"bytes,2,opt,name=name"`
+	// Error is the reason why the name is not published, if any.
+	Error string `json:"error,omitempty" protobuf:"bytes,3,opt,name=error"`
+	// Conflict is true when another host on the network answered for the requested name.
+	Conflict bool `json:"conflict,omitempty" protobuf:"varint,4,opt,name=conflict"`
+}
+
+// KustomizationState is the state of the reconciliation of the cluster kustomization.
+type KustomizationState struct {
+	LastAppliedTime metaV1.Time `json:"lastAppliedTime,omitempty" protobuf:"bytes,1,opt,name=lastAppliedTime"`
+	// AppliedHash is the hash of the last applied rendered kustomization.
+	AppliedHash string `json:"appliedHash,omitempty" protobuf:"bytes,2,opt,name=appliedHash"`
+	// DesiredHash is the hash of the current rendered kustomization.
+	DesiredHash string `json:"desiredHash,omitempty" protobuf:"bytes,3,opt,name=desiredHash"`
+	// Error is the error of the last reconciliation, if any.
+	Error string `json:"error,omitempty" protobuf:"bytes,4,opt,name=error"`
+	// Drifted is true when the live objects differ from the rendered kustomization, either because it has not been
+	// applied or because the objects have been modified since.
+	Drifted bool `json:"drifted" protobuf:"varint,5,opt,name=drifted"`
 }
 
 type ClusterWorkloadsState struct {
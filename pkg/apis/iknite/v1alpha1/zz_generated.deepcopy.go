@@ -65,6 +65,22 @@ func (in *ClusterWorkloadsState) DeepCopy() *ClusterWorkloadsState {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ForwardRule) DeepCopyInto(out *ForwardRule) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ForwardRule.
+func (in *ForwardRule) DeepCopy() *ForwardRule {
+	if in == nil {
+		return nil
+	}
+	out := new(ForwardRule)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IkniteCluster) DeepCopyInto(out *IkniteCluster) {
 	*out = *in
@@ -100,6 +116,18 @@ func (in *IkniteClusterSpec) DeepCopyInto(out *IkniteClusterSpec) {
 		*out = make(net.IP, len(*in))
 		copy(*out, *in)
 	}
+	if in.Forwards != nil {
+		in, out := &in.Forwards, &out.Forwards
+		*out = make([]ForwardRule, len(*in))
+		copy(*out, *in)
+	}
+	if in.Notifiers != nil {
+		in, out := &in.Notifiers, &out.Notifiers
+		*out = make([]NotifierConfig, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -118,6 +146,9 @@ func (in *IkniteClusterStatus) DeepCopyInto(out *IkniteClusterStatus) {
 	*out = *in
 	in.LastUpdateTimeStamp.DeepCopyInto(&out.LastUpdateTimeStamp)
 	in.WorkloadsState.DeepCopyInto(&out.WorkloadsState)
+	in.Kustomization.DeepCopyInto(&out.Kustomization)
+	out.MDNS = in.MDNS
+	in.LoadBalancer.DeepCopyInto(&out.LoadBalancer)
 	return
 }
 
@@ -131,6 +162,98 @@ func (in *IkniteClusterStatus) DeepCopy() *IkniteClusterStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KustomizationState) DeepCopyInto(out *KustomizationState) {
+	*out = *in
+	in.LastAppliedTime.DeepCopyInto(&out.LastAppliedTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KustomizationState.
+func (in *KustomizationState) DeepCopy() *KustomizationState {
+	if in == nil {
+		return nil
+	}
+	out := new(KustomizationState)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LoadBalancerState) DeepCopyInto(out *LoadBalancerState) {
+	*out = *in
+	if in.FailingServices != nil {
+		in, out := &in.FailingServices, &out.FailingServices
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LoadBalancerState.
+func (in *LoadBalancerState) DeepCopy() *LoadBalancerState {
+	if in == nil {
+		return nil
+	}
+	out := new(LoadBalancerState)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MDNSState) DeepCopyInto(out *MDNSState) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MDNSState.
+func (in *MDNSState) DeepCopy() *MDNSState {
+	if in == nil {
+		return nil
+	}
+	out := new(MDNSState)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NotifierConfig) DeepCopyInto(out *NotifierConfig) {
+	*out = *in
+	if in.Headers != nil {
+		in, out := &in.Headers, &out.Headers
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Command != nil {
+		in, out := &in.Command, &out.Command
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Events != nil {
+		in, out := &in.Events, &out.Events
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Retries != nil {
+		in, out := &in.Retries, &out.Retries
+		*out = new(int)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NotifierConfig.
+func (in *NotifierConfig) DeepCopy() *NotifierConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(NotifierConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *WorkloadState) DeepCopyInto(out *WorkloadState) {
 	*out = *in
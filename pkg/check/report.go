@@ -0,0 +1,300 @@
+package check
+
+// cSpell: words testsuites testsuite testcase classname
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	ReportFormatJSON  = "json"
+	ReportFormatYAML  = "yaml"
+	ReportFormatJUnit = "junit"
+	ReportFormatText  = "text"
+)
+
+// ReportFormats are the formats a Report can be written in.
+var ReportFormats = []string{ReportFormatJSON, ReportFormatYAML, ReportFormatJUnit, ReportFormatText}
+
+// FixReport is the outcome of the fix of a failed check.
+type FixReport struct {
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ResultReport is the machine readable state of a check result and of its sub results.
+type ResultReport struct {
+	Fix             *FixReport      `json:"fix,omitempty"`
+	Name            string          `json:"name"`
+	Description     string          `json:"description,omitempty"`
+	Status          string          `json:"status"`
+	Message         string          `json:"message,omitempty"`
+	Error           string          `json:"error,omitempty"`
+	DependsOn       []string        `json:"dependsOn,omitempty"`
+	Checks          []*ResultReport `json:"checks,omitempty"`
+	DurationSeconds float64         `json:"durationSeconds"`
+}
+
+// ReportSummary counts the checks without sub checks by status. The checks that are still pending or running when
+// the report is made are incomplete.
+type ReportSummary struct {
+	Total      int `json:"total"`
+	Succeeded  int `json:"succeeded"`
+	Failed     int `json:"failed"`
+	Skipped    int `json:"skipped"`
+	Incomplete int `json:"incomplete"`
+	Fixed      int `json:"fixed"`
+}
+
+// Report is the machine readable outcome of a run of checks.
+type Report struct {
+	Checks  []*ResultReport `json:"checks"`
+	Summary ReportSummary   `json:"summary"`
+	Success bool            `json:"success"`
+}
+
+// Report returns the machine readable state of the result and of its sub results.
+func (r *CheckResult) Report() *ResultReport {
+	r.mu.RLock()
+	report := &ResultReport{
+		Name:            r.Check.Name,
+		Description:     r.Check.Description,
+		Status:          r.Status.String(),
+		Message:         r.Message,
+		DependsOn:       r.Check.DependsOn,
+		DurationSeconds: r.Duration.Seconds(),
+	}
+	if r.Error != nil {
+		report.Error = strings.TrimSpace(r.Error.Error())
+	}
+	if r.Fixed || r.FixError != nil {
+		report.Fix = &FixReport{Message: r.FixMessage}
+		if r.FixError != nil {
+			report.Fix.Error = r.FixError.Error()
+		}
+	}
+	r.mu.RUnlock()
+
+	for _, subResult := range r.SubResults {
+		report.Checks = append(report.Checks, subResult.Report())
+	}
+	return report
+}
+
+func (s *ReportSummary) add(report *ResultReport) {
+	if len(report.Checks) > 0 {
+		for _, sub := range report.Checks {
+			s.add(sub)
+		}
+		return
+	}
+	s.Total++
+	if report.Fix != nil && report.Fix.Error == "" {
+		s.Fixed++
+	}
+	switch report.Status {
+	case StatusSuccess.String():
+		s.Succeeded++
+	case StatusFailed.String():
+		s.Failed++
+	case StatusSkipped.String():
+		s.Skipped++
+	default:
+		s.Incomplete++
+	}
+}
+
+// NewReport creates the report of results. The run is successful if no check has failed or is incomplete.
+func NewReport(results []*CheckResult) *Report {
+	report := &Report{Checks: make([]*ResultReport, 0, len(results))}
+	for _, result := range results {
+		resultReport := result.Report()
+		report.Summary.add(resultReport)
+		report.Checks = append(report.Checks, resultReport)
+	}
+	report.Success = report.Summary.Failed == 0 && report.Summary.Incomplete == 0
+	return report
+}
+
+// Write writes the report to w in format, one of ReportFormats.
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case ReportFormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(r); err != nil {
+			return fmt.Errorf("while writing the JSON report: %w", err)
+		}
+	case ReportFormatYAML:
+		out, err := yaml.Marshal(r)
+		if err != nil { // nocov -- the report is always serializable
+			return fmt.Errorf("while serializing the YAML report: %w", err)
+		}
+		if _, err = w.Write(out); err != nil {
+			return fmt.Errorf("while writing the YAML report: %w", err)
+		}
+	case ReportFormatJUnit:
+		return r.writeJUnit(w)
+	case ReportFormatText:
+		var output strings.Builder
+		for _, check := range r.Checks {
+			writeTextReport(&output, check, "")
+		}
+		fmt.Fprintf(&output, "%d checks: %d succeeded, %d failed, %d skipped, %d incomplete, %d fixed\n",
+			r.Summary.Total, r.Summary.Succeeded, r.Summary.Failed, r.Summary.Skipped, r.Summary.Incomplete,
+			r.Summary.Fixed)
+		if _, err := io.WriteString(w, output.String()); err != nil {
+			return fmt.Errorf("while writing the text report: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown report format %q, expected one of %s", format, strings.Join(ReportFormats, ", "))
+	}
+	return nil
+}
+
+var statusSymbols = map[string]string{
+	StatusPending.String(): "⋯",
+	StatusRunning.String(): "…",
+	StatusSkipped.String(): "⊝",
+	StatusSuccess.String(): "✓",
+	StatusFailed.String():  "✗",
+}
+
+func writeTextReport(output *strings.Builder, report *ResultReport, prefix string) {
+	description := report.Description
+	if description == "" {
+		description = report.Name
+	}
+	fmt.Fprintf(output, "%s%s %s", prefix, statusSymbols[report.Status], description)
+	switch {
+	case report.Error != "":
+		fmt.Fprintf(output, " - %s", report.Error)
+	case report.Message != "":
+		fmt.Fprintf(output, " - %s", report.Message)
+	}
+	fmt.Fprintf(output, " (%.2fs)", report.DurationSeconds)
+	if len(report.DependsOn) > 0 {
+		fmt.Fprintf(output, " [after %s]", strings.Join(report.DependsOn, ", "))
+	}
+	if report.Fix != nil {
+		fmt.Fprintf(output, " [%s]", report.Fix)
+	}
+	output.WriteString("\n")
+	for _, sub := range report.Checks {
+		writeTextReport(output, sub, prefix+"  ")
+	}
+}
+
+func (f *FixReport) String() string {
+	if f.Error != "" {
+		return "fix failed: " + f.Error
+	}
+	return "fixed: " + f.Message
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr,omitempty"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr,omitempty"`
+}
+
+type junitTestCase struct {
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	SystemOut string        `xml:"system-out,omitempty"`
+	Time      float64       `xml:"time,attr"`
+}
+
+type junitTestSuite struct {
+	XMLName   xml.Name         `xml:"testsuite"`
+	Name      string           `xml:"name,attr"`
+	TestCases []*junitTestCase `xml:"testcase"`
+	Tests     int              `xml:"tests,attr"`
+	Failures  int              `xml:"failures,attr"`
+	Errors    int              `xml:"errors,attr"`
+	Skipped   int              `xml:"skipped,attr"`
+	Time      float64          `xml:"time,attr"`
+}
+
+type junitTestSuites struct {
+	XMLName    xml.Name          `xml:"testsuites"`
+	Name       string            `xml:"name,attr"`
+	TestSuites []*junitTestSuite `xml:"testsuite"`
+	Tests      int               `xml:"tests,attr"`
+	Failures   int               `xml:"failures,attr"`
+	Errors     int               `xml:"errors,attr"`
+	Skipped    int               `xml:"skipped,attr"`
+	Time       float64           `xml:"time,attr"`
+}
+
+// addTestCases adds to suite a test case for each check without sub checks of report.
+func (suite *junitTestSuite) addTestCases(report *ResultReport, className string) {
+	if len(report.Checks) > 0 {
+		for _, sub := range report.Checks {
+			suite.addTestCases(sub, className+"."+report.Name)
+		}
+		return
+	}
+	testCase := &junitTestCase{
+		Name:      report.Name,
+		ClassName: className,
+		Time:      report.DurationSeconds,
+		SystemOut: report.Message,
+	}
+	if report.Fix != nil {
+		testCase.SystemOut = strings.TrimSpace(testCase.SystemOut + "\n" + report.Fix.String())
+	}
+	suite.Tests++
+	switch report.Status {
+	case StatusSuccess.String():
+	case StatusFailed.String():
+		suite.Failures++
+		testCase.Failure = &junitFailure{Message: report.Description, Type: "failed", Text: report.Error}
+	case StatusSkipped.String():
+		suite.Skipped++
+		testCase.Skipped = &junitSkipped{Message: report.Message}
+		testCase.SystemOut = ""
+	default:
+		suite.Errors++
+		testCase.Failure = &junitFailure{Message: report.Description, Type: "incomplete", Text: "the check did not complete"}
+	}
+	suite.TestCases = append(suite.TestCases, testCase)
+}
+
+func (r *Report) writeJUnit(w io.Writer) error {
+	suites := &junitTestSuites{Name: "iknite status"}
+	for _, check := range r.Checks {
+		suite := &junitTestSuite{Name: check.Name, Time: check.DurationSeconds}
+		suite.addTestCases(check, "iknite")
+		suites.TestSuites = append(suites.TestSuites, suite)
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Errors += suite.Errors
+		suites.Skipped += suite.Skipped
+		suites.Time += suite.Time
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return fmt.Errorf("while writing the JUnit report: %w", err)
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return fmt.Errorf("while writing the JUnit report: %w", err)
+	}
+	if _, err := io.WriteString(w, "\n"); err != nil {
+		return fmt.Errorf("while writing the JUnit report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+// cSpell: words testsuites testsuite testcase classname
+package check_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kaweezle/iknite/pkg/check"
+)
+
+func runReportChecks(t *testing.T) *check.Report {
+	t.Helper()
+	executor := check.NewCheckExecutor()
+	executor.AddCheck(
+		check.NewPhase("host", "Host checks",
+			&check.Check{
+				Name:        "kubelet",
+				Description: "Kubelet is running",
+				CheckFn: func(_ context.Context, _ check.CheckData) (bool, string, error) {
+					return true, "pid 42", nil
+				},
+			},
+			&check.Check{
+				Name:        "apiserver",
+				Description: "API server is healthy",
+				DependsOn:   []string{"kubelet"},
+				CheckFn: func(_ context.Context, _ check.CheckData) (bool, string, error) {
+					return false, "", errors.New("connection refused")
+				},
+			},
+		),
+		&check.Check{
+			Name:        "workloads",
+			Description: "Workloads are ready",
+			DependsOn:   []string{"apiserver"},
+			CheckFn: func(_ context.Context, _ check.CheckData) (bool, string, error) {
+				return true, "", nil
+			},
+		},
+	)
+	executor.PrepareRun()
+	executor.Run(t.Context(), nil)
+	return check.NewReport(executor.Results)
+}
+
+func TestNewReport(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	report := runReportChecks(t)
+	req.False(report.Success)
+	req.Equal(check.ReportSummary{Total: 3, Succeeded: 1, Failed: 1, Skipped: 1}, report.Summary)
+
+	req.Len(report.Checks, 2)
+	host := report.Checks[0]
+	req.Equal("host", host.Name)
+	req.Equal("failed", host.Status)
+	req.Len(host.Checks, 2)
+	req.Equal("success", host.Checks[0].Status)
+	req.Equal("pid 42", host.Checks[0].Message)
+	req.Equal("failed", host.Checks[1].Status)
+	req.Equal("connection refused", host.Checks[1].Error)
+	req.Equal([]string{"kubelet"}, host.Checks[1].DependsOn)
+
+	workloads := report.Checks[1]
+	req.Equal("skipped", workloads.Status)
+	req.Equal([]string{"apiserver"}, workloads.DependsOn)
+	req.Zero(workloads.DurationSeconds)
+}
+
+func TestReport_Write(t *testing.T) {
+	t.Parallel()
+	report := runReportChecks(t)
+
+	t.Run("json", func(t *testing.T) {
+		t.Parallel()
+		req := require.New(t)
+		var out bytes.Buffer
+		req.NoError(report.Write(&out, check.ReportFormatJSON))
+		var decoded check.Report
+		req.NoError(json.Unmarshal(out.Bytes(), &decoded))
+		req.Equal(report, &decoded)
+	})
+
+	t.Run("yaml", func(t *testing.T) {
+		t.Parallel()
+		req := require.New(t)
+		var out bytes.Buffer
+		req.NoError(report.Write(&out, check.ReportFormatYAML))
+		req.Contains(out.String(), "success: false\n")
+		req.Contains(out.String(), "error: connection refused\n")
+	})
+
+	t.Run("junit", func(t *testing.T) {
+		t.Parallel()
+		req := require.New(t)
+		var out bytes.Buffer
+		req.NoError(report.Write(&out, check.ReportFormatJUnit))
+
+		var suites struct {
+			Suites []struct {
+				Name      string `xml:"name,attr"`
+				TestCases []struct {
+					Failure *struct {
+						Text string `xml:",chardata"`
+					} `xml:"failure"`
+					Skipped   *struct{} `xml:"skipped"`
+					Name      string    `xml:"name,attr"`
+					ClassName string    `xml:"classname,attr"`
+				} `xml:"testcase"`
+				Tests    int `xml:"tests,attr"`
+				Failures int `xml:"failures,attr"`
+				Skipped  int `xml:"skipped,attr"`
+			} `xml:"testsuite"`
+			Tests    int `xml:"tests,attr"`
+			Failures int `xml:"failures,attr"`
+		}
+		req.NoError(xml.Unmarshal(out.Bytes(), &suites))
+		req.Equal(3, suites.Tests)
+		req.Equal(1, suites.Failures)
+		req.Len(suites.Suites, 2)
+		req.Equal("host", suites.Suites[0].Name)
+		req.Equal(2, suites.Suites[0].Tests)
+		req.Equal(1, suites.Suites[0].Failures)
+		req.Equal("iknite.host", suites.Suites[0].TestCases[1].ClassName)
+		req.Equal("apiserver", suites.Suites[0].TestCases[1].Name)
+		req.NotNil(suites.Suites[0].TestCases[1].Failure)
+		req.Equal("connection refused", suites.Suites[0].TestCases[1].Failure.Text)
+		req.Equal(1, suites.Suites[1].Skipped)
+		req.NotNil(suites.Suites[1].TestCases[0].Skipped)
+	})
+
+	t.Run("text", func(t *testing.T) {
+		t.Parallel()
+		req := require.New(t)
+		var out bytes.Buffer
+		req.NoError(report.Write(&out, check.ReportFormatText))
+		req.Contains(out.String(), "✗ Host checks")
+		req.Contains(out.String(), "\n  ✓ Kubelet is running - pid 42 (")
+		req.Contains(out.String(), "\n  ✗ API server is healthy - connection refused (")
+		req.Contains(out.String(), "[after kubelet]\n")
+		req.Contains(out.String(), "3 checks: 1 succeeded, 1 failed, 1 skipped, 0 incomplete, 0 fixed\n")
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		t.Parallel()
+		req := require.New(t)
+		req.ErrorContains(report.Write(&bytes.Buffer{}, "csv"), `unknown report format "csv"`)
+	})
+}
+
+func TestNewReport_Incomplete(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	result := (&check.Check{Name: "pending"}).NewResult()
+	report := check.NewReport([]*check.CheckResult{result})
+	req.False(report.Success)
+	req.Equal(check.ReportSummary{Total: 1, Incomplete: 1}, report.Summary)
+
+	var out bytes.Buffer
+	req.NoError(report.Write(&out, check.ReportFormatJUnit))
+	req.Contains(out.String(), `type="incomplete"`)
+}
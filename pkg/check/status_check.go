@@ -4,9 +4,11 @@ package check
 // cSpell: disable
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/charmbracelet/lipgloss"
 )
@@ -46,33 +48,53 @@ type CheckDataBuilder func() CheckData
 
 type CheckFn func(ctx context.Context, data CheckData) (bool, string, error)
 
+// FixFn repairs what makes a check fail. It returns a message describing what has been changed.
+type FixFn func(ctx context.Context, data CheckData) (string, error)
+
 type CustomResultPrinter func(result *CheckResult, data CheckData, prefix string, spinView string) string
 
 type Check struct {
 	CheckFn       CheckFn
+	FixFn         FixFn
 	CustomPrinter CustomResultPrinter
 	Name          string
 	Description   string
 	Message       string
 	DependsOn     []string
 	SubChecks     []*Check
+	// Timeout bounds each attempt of CheckFn. No timeout is applied if zero.
+	Timeout time.Duration
+	// RetryInterval is the time waited between two attempts of CheckFn.
+	RetryInterval time.Duration
+	// Retries is the number of times CheckFn is attempted again after a failure.
+	Retries int
 }
 
 type CheckResult struct {
+	StartTime     time.Time
 	Error         error
+	FixError      error
 	Check         *Check
 	Done          chan struct{}
+	limiter       chan struct{}
 	Message       string
+	FixMessage    string
 	SubResults    []*CheckResult
 	ParentResults []*CheckResult
 	Status        CheckStatus
-	mu            sync.RWMutex
+	Duration      time.Duration
+	Fixed         bool
+	// cannotRun is set when the dependencies of the check are unknown or form a cycle.
+	cannotRun bool
+	mu        sync.RWMutex
 }
 
 type CheckExecutor struct {
 	resultNameMap map[string]*CheckResult
 	Checks        []*Check
 	Results       []*CheckResult
+	// MaxParallelism is the maximum number of check functions running at the same time. Unlimited if zero.
+	MaxParallelism int
 }
 
 func (c *Check) NewResult() *CheckResult {
@@ -88,6 +110,12 @@ func (c *Check) NewResult() *CheckResult {
 	}
 }
 
+// WithFix sets the function repairing the failures of the check.
+func (c *Check) WithFix(fixFn FixFn) *Check {
+	c.FixFn = fixFn
+	return c
+}
+
 func (r *CheckResult) Name() string {
 	return r.Check.Name
 }
@@ -118,9 +146,18 @@ func (r *CheckResult) FillDependencies(resultNameMap map[string]*CheckResult) {
 	}
 }
 
+// CheckFn runs the check function, attempting it again on failure as many times as the retries of the check allow.
 func (c *CheckResult) CheckFn(ctx context.Context, checkData CheckData) *CheckResult {
 	if c.Check.CheckFn != nil {
-		success, message, err := c.Check.CheckFn(ctx, checkData)
+		var success bool
+		var message string
+		var err error
+		for attempt := 0; ; attempt++ {
+			success, message, err = c.attempt(ctx, checkData)
+			if success || attempt >= c.Check.Retries || !waitRetryInterval(ctx, c.Check.RetryInterval) {
+				break
+			}
+		}
 		c.mu.Lock()
 		defer c.mu.Unlock()
 		c.Message = message
@@ -142,6 +179,68 @@ func (c *CheckResult) CheckFn(ctx context.Context, checkData CheckData) *CheckRe
 	return c
 }
 
+type checkOutcome struct {
+	err     error
+	message string
+	success bool
+}
+
+// attempt runs the check function once. With a timeout, the check fails when the timeout expires even if the check
+// function does not honor the cancellation of its context.
+func (c *CheckResult) attempt(ctx context.Context, checkData CheckData) (bool, string, error) {
+	if c.Check.Timeout <= 0 {
+		return c.Check.CheckFn(ctx, checkData)
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.Check.Timeout)
+	defer cancel()
+	outcome := make(chan checkOutcome, 1)
+	go func() {
+		success, message, err := c.Check.CheckFn(ctx, checkData)
+		outcome <- checkOutcome{success: success, message: message, err: err}
+	}()
+	select {
+	case result := <-outcome:
+		return result.success, result.message, result.err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return false, "", fmt.Errorf("timed out after %s", c.Check.Timeout)
+		}
+		return false, "", fmt.Errorf("interrupted: %w", ctx.Err())
+	}
+}
+
+// waitRetryInterval waits for interval before the next attempt of a check. It returns false if ctx is done before.
+func waitRetryInterval(ctx context.Context, interval time.Duration) bool {
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// acquire waits for a slot among the check functions allowed to run at the same time. It returns false if ctx is done
+// before.
+func (c *CheckResult) acquire(ctx context.Context) bool {
+	if c.limiter == nil {
+		return true
+	}
+	select {
+	case c.limiter <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (c *CheckResult) release() {
+	if c.limiter != nil {
+		<-c.limiter
+	}
+}
+
 func (c *CheckResult) waitForDependencies(ctx context.Context) bool {
 	for _, parent := range c.ParentResults {
 		select {
@@ -186,7 +285,14 @@ func (c *CheckResult) waitForSubChecks(ctx context.Context) bool {
 	return result
 }
 
+// Run runs the check in the background. Nothing is done if the check has already completed, so that running again
+// the checks only runs the ones reset by CheckExecutor.Fix.
 func (c *CheckResult) Run(ctx context.Context, checkData CheckData) {
+	select {
+	case <-c.Done:
+		return
+	default:
+	}
 	go func() {
 		defer close(c.Done)
 
@@ -196,12 +302,27 @@ func (c *CheckResult) Run(ctx context.Context, checkData CheckData) {
 
 		// Wait for dependencies
 		if !c.waitForDependencies(ctx) {
+			if ctx.Err() == nil {
+				c.skipSubResults()
+			}
 			return
 		}
+		if len(c.SubResults) == 0 {
+			if !c.acquire(ctx) {
+				return
+			}
+			defer c.release()
+		}
 
 		c.mu.Lock()
 		c.Status = StatusRunning
+		c.StartTime = time.Now()
 		c.mu.Unlock()
+		defer func() {
+			c.mu.Lock()
+			c.Duration = time.Since(c.StartTime)
+			c.mu.Unlock()
+		}()
 
 		// If check has subChecks, run them all concurrently
 		if len(c.SubResults) > 0 {
@@ -226,7 +347,8 @@ func NewPhase(name, description string, subChecks ...*Check) *Check {
 	}
 }
 
-// FillResultNameMap fills a map with check results by name.
+// FillResultNameMap fills a map with check results by name. When several results have the same name, the first one
+// is kept.
 func FillResultNameMap(
 	results []*CheckResult,
 	resultNameMap map[string]*CheckResult,
@@ -235,7 +357,9 @@ func FillResultNameMap(
 		resultNameMap = make(map[string]*CheckResult)
 	}
 	for _, result := range results {
-		resultNameMap[result.Name()] = result
+		if _, ok := resultNameMap[result.Name()]; !ok {
+			resultNameMap[result.Name()] = result
+		}
 		if len(result.SubResults) > 0 {
 			FillResultNameMap(result.SubResults, resultNameMap)
 		}
@@ -271,11 +395,146 @@ func NewCheckExecutor() *CheckExecutor {
 	return &CheckExecutor{}
 }
 
+// PrepareRun prepares the results of the checks. The checks whose dependencies are unknown or form a cycle would
+// wait forever. They are failed up front, along with the checks depending on them being skipped when running.
 func (e *CheckExecutor) PrepareRun() {
 	e.Results = PrepareChecks(e.Checks)
-	e.resultNameMap = FillResultNameMap(e.Results, e.resultNameMap)
-	for _, result := range e.Results {
-		result.FillDependencies(e.resultNameMap)
+	e.resultNameMap = FillResultNameMap(e.Results, nil)
+	dependencyErrs := dependencyErrors(e.Results, e.resultNameMap)
+	for result, err := range dependencyErrs {
+		result.complete(StatusFailed, err, "")
+	}
+	for result := range dependencyErrs {
+		result.skipSubResults()
+	}
+}
+
+// Validate returns the dependency errors of the checks, i.e. duplicate names, unknown dependencies and dependency
+// cycles.
+func (e *CheckExecutor) Validate() error {
+	results := PrepareChecks(e.Checks)
+	dependencyErrs := dependencyErrors(results, FillResultNameMap(results, nil))
+	errs := make([]error, 0, len(dependencyErrs))
+	var walk func(results []*CheckResult)
+	walk = func(results []*CheckResult) {
+		for _, result := range results {
+			if err, ok := dependencyErrs[result]; ok {
+				errs = append(errs, fmt.Errorf("check %s: %w", result.Name(), err))
+			}
+			walk(result.SubResults)
+		}
+	}
+	walk(results)
+	return errors.Join(errs...)
+}
+
+// complete sets the final status of a result that cannot run because of dependency errors so that it is never run.
+func (c *CheckResult) complete(status CheckStatus, err error, message string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Status = status
+	c.Error = err
+	c.Message = message
+	c.cannotRun = true
+	close(c.Done)
+}
+
+// skipSubResults skips the sub results of a phase that does not run, so that the checks depending on them do not wait
+// forever.
+func (c *CheckResult) skipSubResults() {
+	for _, subResult := range c.SubResults {
+		select {
+		case <-subResult.Done:
+			continue
+		default:
+		}
+		subResult.mu.Lock()
+		subResult.Status = StatusSkipped
+		subResult.Message = fmt.Sprintf("Skipped due to failure of %s", c.Name())
+		subResult.cannotRun = c.cannotRun
+		subResult.mu.Unlock()
+		close(subResult.Done)
+		subResult.skipSubResults()
+	}
+}
+
+// dependencyErrors finds the results whose name is already used by a previous result, the ones with unknown
+// dependencies and the ones belonging to a dependency cycle. A result waits for its dependencies, a phase waits for
+// its sub results and a sub result only starts once the dependencies of the phases containing it have completed.
+func dependencyErrors(results []*CheckResult, resultNameMap map[string]*CheckResult) map[*CheckResult]error {
+	errs := make(map[*CheckResult]error)
+	waitsFor := make(map[*CheckResult][]*CheckResult)
+	var walk func(results []*CheckResult, inherited []*CheckResult)
+	walk = func(results []*CheckResult, inherited []*CheckResult) {
+		for _, result := range results {
+			for _, depName := range result.Check.DependsOn {
+				if _, ok := resultNameMap[depName]; !ok {
+					errs[result] = fmt.Errorf("unknown dependency %q", depName)
+				}
+			}
+			if resultNameMap[result.Name()] != result {
+				errs[result] = errors.New("name already used by another check")
+			}
+			waitsFor[result] = append(append(waitsFor[result], inherited...), result.ParentResults...)
+			waitsFor[result] = append(waitsFor[result], result.SubResults...)
+			walk(result.SubResults, append(inherited[:len(inherited):len(inherited)], result.ParentResults...))
+		}
+	}
+	walk(results, nil)
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[*CheckResult]int)
+	var path []*CheckResult
+	var visit func(result *CheckResult)
+	visit = func(result *CheckResult) {
+		state[result] = visiting
+		path = append(path, result)
+		for _, next := range waitsFor[result] {
+			switch state[next] {
+			case unvisited:
+				visit(next)
+			case visiting:
+				start := len(path) - 1
+				for path[start] != next {
+					start--
+				}
+				names := make([]string, 0, len(path)-start+1)
+				for _, member := range path[start:] {
+					names = append(names, member.Name())
+				}
+				err := fmt.Errorf("dependency cycle: %s", strings.Join(append(names, next.Name()), " -> "))
+				for _, member := range path[start:] {
+					if _, ok := errs[member]; !ok {
+						errs[member] = err
+					}
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[result] = visited
+	}
+	var visitAll func(results []*CheckResult)
+	visitAll = func(results []*CheckResult) {
+		for _, result := range results {
+			if state[result] == unvisited {
+				visit(result)
+			}
+			visitAll(result.SubResults)
+		}
+	}
+	visitAll(results)
+	return errs
+}
+
+// setLimiter sets the channel limiting the number of check functions running at the same time.
+func setLimiter(results []*CheckResult, limiter chan struct{}) {
+	for _, result := range results {
+		result.limiter = limiter
+		setLimiter(result.SubResults, limiter)
 	}
 }
 
@@ -283,6 +542,107 @@ func (e *CheckExecutor) AddCheck(check ...*Check) {
 	e.Checks = append(e.Checks, check...)
 }
 
+// applyFix applies the fix of the result if it has failed and has one. It returns true if the fix has been applied.
+func (c *CheckResult) applyFix(ctx context.Context, checkData CheckData) bool {
+	if c.Check.FixFn == nil || len(c.SubResults) > 0 || !c.Failed() {
+		return false
+	}
+	message, err := c.Check.FixFn(ctx, checkData)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Fixed = err == nil
+	c.FixMessage = message
+	c.FixError = err
+	return true
+}
+
+// reset makes the result pending again so that the next run runs the check again. Results that cannot run because of
+// dependency errors are kept as they are.
+func (c *CheckResult) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cannotRun {
+		return
+	}
+	c.Status = StatusPending
+	c.Message = ""
+	c.Error = nil
+	c.StartTime = time.Time{}
+	c.Duration = 0
+	c.Done = make(chan struct{})
+}
+
+// affectedResults computes the results to run again after the fixed results have been fixed: the fixed results, the
+// phases containing them and the results depending on any of them, with all their sub results.
+func affectedResults(results, fixed []*CheckResult) map[*CheckResult]bool {
+	phases := make(map[*CheckResult]*CheckResult)
+	dependents := make(map[*CheckResult][]*CheckResult)
+	var walk func(results []*CheckResult)
+	walk = func(results []*CheckResult) {
+		for _, result := range results {
+			for _, parent := range result.ParentResults {
+				dependents[parent] = append(dependents[parent], result)
+			}
+			for _, subResult := range result.SubResults {
+				phases[subResult] = result
+			}
+			walk(result.SubResults)
+		}
+	}
+	walk(results)
+
+	affected := make(map[*CheckResult]bool)
+	descended := make(map[*CheckResult]bool)
+	var mark func(result *CheckResult, descend bool)
+	mark = func(result *CheckResult, descend bool) {
+		if descend && !descended[result] {
+			descended[result] = true
+			for _, subResult := range result.SubResults {
+				mark(subResult, true)
+			}
+		}
+		if affected[result] {
+			return
+		}
+		affected[result] = true
+		for _, dependent := range dependents[result] {
+			mark(dependent, true)
+		}
+		if phase, ok := phases[result]; ok {
+			mark(phase, false)
+		}
+	}
+	for _, result := range fixed {
+		mark(result, false)
+	}
+	return affected
+}
+
+// Fix applies the fixes of the failed checks that have one. The fixed checks, the phases containing them and the
+// checks depending on them are reset so that the next call to Run runs them again. Fix must be called after Run has
+// completed. It returns the results whose fix has been applied, successfully or not.
+func (e *CheckExecutor) Fix(ctx context.Context, checkData CheckData) []*CheckResult {
+	var applied, fixed []*CheckResult
+	var walk func(results []*CheckResult)
+	walk = func(results []*CheckResult) {
+		for _, result := range results {
+			if result.applyFix(ctx, checkData) {
+				applied = append(applied, result)
+				if result.Fixed {
+					fixed = append(fixed, result)
+				}
+			}
+			walk(result.SubResults)
+		}
+	}
+	walk(e.Results)
+
+	for result := range affectedResults(e.Results, fixed) {
+		result.reset()
+	}
+	return applied
+}
+
 var (
 	SuccessStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("46"))  // Green
 	ErrorStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("196")) // Red
@@ -351,8 +711,14 @@ func (result *CheckResult) Format(prefix string, checkData CheckData, spinView s
 	return result.FormatResult(prefix, checkData, spinView)
 }
 
-// Run runs the checks.
+// Run runs the checks. No more than MaxParallelism check functions run at the same time if it is set.
 func (e *CheckExecutor) Run(ctx context.Context, checkData CheckData) []*CheckResult {
+	var limiter chan struct{}
+	if e.MaxParallelism > 0 {
+		limiter = make(chan struct{}, e.MaxParallelism)
+	}
+	setLimiter(e.Results, limiter)
+
 	// Start all top-level checks
 	for _, result := range e.Results {
 		result.Run(ctx, checkData)
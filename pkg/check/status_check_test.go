@@ -4,6 +4,9 @@ package check_test
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -412,3 +415,301 @@ func TestCheckExecutor_Run(t *testing.T) {
 		req.Equal(check.StatusSuccess, result.Status)
 	}
 }
+
+func TestCheckExecutor_Fix(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	var broken, repairable atomic.Bool
+	broken.Store(true)
+	repairable.Store(true)
+	var runs sync.Map
+	counted := func(name string, fn func() (bool, string, error)) check.CheckFn {
+		return func(_ context.Context, _ check.CheckData) (bool, string, error) {
+			count, _ := runs.LoadOrStore(name, new(atomic.Int32))
+			count.(*atomic.Int32).Add(1) //nolint:forcetypeassert // only counters are stored
+			return fn()
+		}
+	}
+	ok := func() (bool, string, error) { return true, "", nil }
+
+	executor := check.NewCheckExecutor()
+	executor.AddCheck(
+		check.NewPhase("environment", "Environment",
+			&check.Check{Name: "stable", CheckFn: counted("stable", ok)},
+			(&check.Check{
+				Name: "broken",
+				CheckFn: counted("broken", func() (bool, string, error) {
+					return !broken.Load(), "", nil
+				}),
+			}).WithFix(func(_ context.Context, _ check.CheckData) (string, error) {
+				broken.Store(false)
+				return "repaired", nil
+			}),
+			(&check.Check{
+				Name:    "unrepairable",
+				CheckFn: counted("unrepairable", func() (bool, string, error) { return false, "", nil }),
+			}).WithFix(func(_ context.Context, _ check.CheckData) (string, error) {
+				return "", errors.New("cannot repair")
+			}),
+		),
+		check.NewPhase("runtime", "Runtime",
+			&check.Check{Name: "service", DependsOn: []string{"broken"}, CheckFn: counted("service", ok)},
+		),
+		&check.Check{Name: "independent", CheckFn: counted("independent", ok)},
+	)
+	executor.PrepareRun()
+	executor.Run(t.Context(), nil)
+
+	applied := executor.Fix(t.Context(), nil)
+	req.Len(applied, 2)
+	req.Equal("broken", applied[0].Name())
+	req.True(applied[0].Fixed)
+	req.Equal("repaired", applied[0].FixMessage)
+	req.Equal("unrepairable", applied[1].Name())
+	req.False(applied[1].Fixed)
+	req.EqualError(applied[1].FixError, "cannot repair")
+
+	executor.Run(t.Context(), nil)
+	environment, runtime := executor.Results[0], executor.Results[1]
+	req.True(environment.SubResults[1].Success())
+	req.True(runtime.SubResults[0].Success())
+	req.True(runtime.Success())
+	// The phase still fails because of the unrepairable check
+	req.True(environment.Failed())
+
+	runCount := func(name string) int32 {
+		count, found := runs.Load(name)
+		if !found {
+			return 0
+		}
+		return count.(*atomic.Int32).Load() //nolint:forcetypeassert // only counters are stored
+	}
+	req.Equal(int32(2), runCount("broken"))
+	req.Equal(int32(1), runCount("service"), "skipped in the first run")
+	req.Equal(int32(1), runCount("stable"))
+	req.Equal(int32(1), runCount("unrepairable"))
+	req.Equal(int32(1), runCount("independent"))
+}
+
+func TestCheckResult_TimeoutAndRetries(t *testing.T) {
+	t.Parallel()
+
+	t.Run("timeout", func(t *testing.T) {
+		t.Parallel()
+		req := require.New(t)
+		result := (&check.Check{
+			Name:    "hanging",
+			Timeout: 20 * time.Millisecond,
+			CheckFn: func(_ context.Context, _ check.CheckData) (bool, string, error) {
+				// Ignores the cancellation of its context
+				time.Sleep(time.Second)
+				return true, "", nil
+			},
+		}).NewResult()
+		result.Run(t.Context(), nil)
+		<-result.Done
+		req.Equal(check.StatusFailed, result.Status)
+		req.EqualError(result.Error, "timed out after 20ms")
+		req.Less(result.Duration, time.Second)
+	})
+
+	t.Run("retries", func(t *testing.T) {
+		t.Parallel()
+		req := require.New(t)
+		var attempts atomic.Int32
+		result := (&check.Check{
+			Name:          "flaky",
+			Retries:       2,
+			RetryInterval: time.Millisecond,
+			CheckFn: func(_ context.Context, _ check.CheckData) (bool, string, error) {
+				if attempts.Add(1) < 3 {
+					return false, "", errors.New("not yet")
+				}
+				return true, "ready", nil
+			},
+		}).NewResult()
+		result.Run(t.Context(), nil)
+		<-result.Done
+		req.Equal(check.StatusSuccess, result.Status)
+		req.NoError(result.Error)
+		req.Equal("ready", result.Message)
+		req.Equal(int32(3), attempts.Load())
+	})
+
+	t.Run("retries exhausted", func(t *testing.T) {
+		t.Parallel()
+		req := require.New(t)
+		var attempts atomic.Int32
+		result := (&check.Check{
+			Name:    "broken",
+			Retries: 1,
+			CheckFn: func(_ context.Context, _ check.CheckData) (bool, string, error) {
+				return false, "", fmt.Errorf("attempt %d failed", attempts.Add(1))
+			},
+		}).NewResult()
+		result.Run(t.Context(), nil)
+		<-result.Done
+		req.Equal(check.StatusFailed, result.Status)
+		req.EqualError(result.Error, "attempt 2 failed")
+	})
+
+	t.Run("retry interrupted", func(t *testing.T) {
+		t.Parallel()
+		req := require.New(t)
+		ctx, cancel := context.WithCancel(t.Context())
+		var attempts atomic.Int32
+		result := (&check.Check{
+			Name:          "interrupted",
+			Retries:       5,
+			RetryInterval: time.Hour,
+			CheckFn: func(_ context.Context, _ check.CheckData) (bool, string, error) {
+				attempts.Add(1)
+				cancel()
+				return false, "", errors.New("failed")
+			},
+		}).NewResult()
+		result.Run(ctx, nil)
+		<-result.Done
+		req.Equal(check.StatusFailed, result.Status)
+		req.Equal(int32(1), attempts.Load())
+	})
+}
+
+func TestCheckExecutor_MaxParallelism(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	var running, maxRunning atomic.Int32
+	checkFn := func(_ context.Context, _ check.CheckData) (bool, string, error) {
+		current := running.Add(1)
+		defer running.Add(-1)
+		for {
+			observed := maxRunning.Load()
+			if current <= observed || maxRunning.CompareAndSwap(observed, current) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		return true, "", nil
+	}
+	checks := make([]*check.Check, 0, 6)
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		checks = append(checks, &check.Check{Name: name, CheckFn: checkFn})
+	}
+
+	executor := check.NewCheckExecutor()
+	executor.MaxParallelism = 2
+	executor.AddCheck(check.NewPhase("phase", "Phase", checks[:4]...), checks[4], checks[5])
+	executor.PrepareRun()
+	executor.Run(t.Context(), nil)
+
+	for _, result := range executor.Results {
+		req.True(result.Success())
+	}
+	req.Equal(int32(2), maxRunning.Load())
+}
+
+func TestCheckExecutor_DependencyErrors(t *testing.T) {
+	t.Parallel()
+	ok := func(_ context.Context, _ check.CheckData) (bool, string, error) { return true, "", nil }
+
+	t.Run("unknown dependency", func(t *testing.T) {
+		t.Parallel()
+		req := require.New(t)
+		executor := check.NewCheckExecutor()
+		executor.AddCheck(
+			&check.Check{Name: "a", DependsOn: []string{"missing"}, CheckFn: ok},
+			&check.Check{Name: "b", DependsOn: []string{"a"}, CheckFn: ok},
+			&check.Check{Name: "c", CheckFn: ok},
+		)
+		req.EqualError(executor.Validate(), `check a: unknown dependency "missing"`)
+
+		executor.PrepareRun()
+		executor.Run(t.Context(), nil)
+		req.Equal(check.StatusFailed, executor.Results[0].Status)
+		req.EqualError(executor.Results[0].Error, `unknown dependency "missing"`)
+		req.Equal(check.StatusSkipped, executor.Results[1].Status)
+		req.Equal(check.StatusSuccess, executor.Results[2].Status)
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		t.Parallel()
+		req := require.New(t)
+		executor := check.NewCheckExecutor()
+		executor.AddCheck(
+			&check.Check{Name: "a", DependsOn: []string{"c"}, CheckFn: ok},
+			&check.Check{Name: "b", DependsOn: []string{"a"}, CheckFn: ok},
+			&check.Check{Name: "c", DependsOn: []string{"b"}, CheckFn: ok},
+			&check.Check{Name: "d", DependsOn: []string{"c"}, CheckFn: ok},
+		)
+		err := executor.Validate()
+		req.ErrorContains(err, "check a: dependency cycle: a -> c -> b -> a")
+		req.ErrorContains(err, "check c: dependency cycle: a -> c -> b -> a")
+
+		executor.PrepareRun()
+		executor.Run(t.Context(), nil)
+		for _, result := range executor.Results[:3] {
+			req.Equal(check.StatusFailed, result.Status)
+		}
+		req.Equal(check.StatusSkipped, executor.Results[3].Status)
+	})
+
+	t.Run("phase depending on its sub check", func(t *testing.T) {
+		t.Parallel()
+		req := require.New(t)
+		phase := check.NewPhase("phase", "Phase",
+			&check.Check{Name: "leaf", CheckFn: ok},
+			&check.Check{Name: "other", CheckFn: ok},
+		)
+		phase.DependsOn = []string{"leaf"}
+		executor := check.NewCheckExecutor()
+		executor.AddCheck(phase, &check.Check{Name: "after", DependsOn: []string{"other"}, CheckFn: ok})
+		// The sub checks of the phase only start once the phase dependencies have completed
+		req.EqualError(executor.Validate(), "check leaf: dependency cycle: leaf -> leaf")
+
+		executor.PrepareRun()
+		executor.Run(t.Context(), nil)
+		req.Equal(check.StatusSkipped, executor.Results[0].Status)
+		req.True(executor.Results[0].SubResults[0].Failed())
+		req.Equal(check.StatusSkipped, executor.Results[0].SubResults[1].Status)
+		req.Equal(check.StatusSkipped, executor.Results[1].Status)
+	})
+
+	t.Run("duplicate name", func(t *testing.T) {
+		t.Parallel()
+		req := require.New(t)
+		called := false
+		executor := check.NewCheckExecutor()
+		executor.AddCheck(
+			check.NewPhase("runtime", "Runtime", &check.Check{Name: "kubelet", CheckFn: ok}),
+			check.NewPhase("user", "User", &check.Check{
+				Name: "kubelet",
+				CheckFn: func(_ context.Context, _ check.CheckData) (bool, string, error) {
+					called = true
+					return true, "", nil
+				},
+			}),
+			&check.Check{Name: "after", DependsOn: []string{"kubelet"}, CheckFn: ok},
+		)
+		req.EqualError(executor.Validate(), "check kubelet: name already used by another check")
+
+		executor.PrepareRun()
+		executor.Run(t.Context(), nil)
+		req.Equal(check.StatusSuccess, executor.Results[0].SubResults[0].Status)
+		req.Equal(check.StatusFailed, executor.Results[1].SubResults[0].Status)
+		req.False(called)
+		// The dependency is resolved to the first check
+		req.Equal(check.StatusSuccess, executor.Results[2].Status)
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		t.Parallel()
+		executor := check.NewCheckExecutor()
+		executor.AddCheck(
+			check.NewPhase("phase", "Phase", &check.Check{Name: "leaf", CheckFn: ok}),
+			&check.Check{Name: "after", DependsOn: []string{"phase"}, CheckFn: ok},
+		)
+		require.NoError(t, executor.Validate())
+	})
+}
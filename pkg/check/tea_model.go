@@ -25,8 +25,12 @@ type CheckModel struct {
 	spinner   spinner.Model
 }
 
+// Init starts the checks. They are prepared unless they already are, in which case only the checks that have not
+// completed are run. This allows displaying the run following CheckExecutor.Fix.
 func (m *CheckModel) Init() tea.Cmd {
-	m.executor.PrepareRun()
+	if m.executor.Results == nil {
+		m.executor.PrepareRun()
+	}
 	go m.executor.Run(m.ctx, m.checkData)
 
 	return tea.Batch(
@@ -140,6 +140,72 @@ func ServiceCheck(name, serviceName string, serviceType ServiceType, parents ...
 	}
 }
 
+// HostFix returns a check fix calling fn with the host and the logger of the check data.
+func HostFix(fn func(ctx context.Context, h host.Host, logger *slog.Logger) (string, error)) check.FixFn {
+	return func(ctx context.Context, checkData check.CheckData) (string, error) {
+		data, ok := checkData.(serviceCheckData)
+		if !ok {
+			return "", fmt.Errorf("invalid check data type")
+		}
+		return fn(ctx, data.Host(), data.Logger())
+	}
+}
+
+// enableKernelParameter enables the kernel parameter at path.
+func enableKernelParameter(fs host.FileSystem, path string) (string, error) {
+	if err := fs.WriteFile(path, []byte("1\n"), os.FileMode(int(0o644))); err != nil {
+		return "", fmt.Errorf("failed to enable %s: %w", path, err)
+	}
+	return fmt.Sprintf("Enabled %s", path), nil
+}
+
+// KernelParameterFix returns a fix enabling the kernel parameter at path.
+func KernelParameterFix(path string) check.FixFn {
+	return HostFix(func(_ context.Context, h host.Host, _ *slog.Logger) (string, error) {
+		return enableKernelParameter(h, path)
+	})
+}
+
+// BridgeNetFilterFix returns a fix loading the bridge netfilter module before enabling the kernel parameter at path.
+func BridgeNetFilterFix(path string) check.FixFn {
+	return HostFix(func(_ context.Context, h host.Host, logger *slog.Logger) (string, error) {
+		if err := alpine.EnsureNetFilter(h, logger); err != nil {
+			return "", err //nolint:wrapcheck // already wrapped
+		}
+		return enableKernelParameter(h, path)
+	})
+}
+
+// MachineIDFix returns a fix generating the machine id.
+func MachineIDFix() check.FixFn {
+	return HostFix(func(_ context.Context, h host.Host, logger *slog.Logger) (string, error) {
+		if err := alpine.EnsureMachineID(h, logger); err != nil {
+			return "", err //nolint:wrapcheck // already wrapped
+		}
+		return "Generated the machine id", nil
+	})
+}
+
+// CrictlConfigurationFix returns a fix creating the crictl configuration.
+func CrictlConfigurationFix() check.FixFn {
+	return HostFix(func(_ context.Context, h host.Host, _ *slog.Logger) (string, error) {
+		if err := k8s.EnsureCrictlConfiguration(h); err != nil {
+			return "", err //nolint:wrapcheck // already wrapped
+		}
+		return fmt.Sprintf("Created %s", constants.CrictlYaml), nil
+	})
+}
+
+// EnabledServiceFix returns a fix enabling the OpenRC service named serviceName on the default runlevel.
+func EnabledServiceFix(serviceName string) check.FixFn {
+	return HostFix(func(_ context.Context, h host.Host, _ *slog.Logger) (string, error) {
+		if err := alpine.EnableService(h, serviceName); err != nil {
+			return "", err //nolint:wrapcheck // already wrapped
+		}
+		return fmt.Sprintf("Enabled %s on the default runlevel", serviceName), nil
+	})
+}
+
 // SimpleFileCheck checks if a file exists.
 func SimpleFileCheck(name, path string) *check.Check {
 	return &check.Check{
@@ -641,6 +707,56 @@ func DomainNameCheck(domainName string, ip net.IP) *check.Check {
 			}
 			return checkDomainName(ctx, data.Host(), domainName, ip)
 		},
+		FixFn: HostFix(func(ctx context.Context, h host.Host, _ *slog.Logger) (string, error) {
+			return fixDomainName(ctx, h, domainName, ip)
+		}),
+	}
+}
+
+// fixDomainName maps the given domain name to the given IP address in the hosts file.
+func fixDomainName(ctx context.Context, nh host.NetworkHost, domainName string, ip net.IP) (string, error) {
+	_, ips := nh.IsHostMapped(ctx, ip, domainName)
+	if err := alpine.AddIpMapping(nh.GetHostsConfig(), ip, domainName, ips); err != nil {
+		return "", fmt.Errorf("failed to map %s to %s: %w", domainName, ip, err)
+	}
+	return fmt.Sprintf("Mapped %s to %s in the hosts file", domainName, ip), nil
+}
+
+// NewMDNSCheck checks the outcome of the publication of the domain name with mDNS recorded in the cluster status.
+func NewMDNSCheck() *check.Check {
+	return &check.Check{
+		Name:        "mdns_name",
+		Description: "Check the domain name is published with mDNS",
+		DependsOn:   []string{"iknite_running"},
+		CheckFn: func(_ context.Context, checkData check.CheckData) (bool, string, error) {
+			data, ok := checkData.(CheckWorkloadData)
+			if !ok {
+				return false, "", fmt.Errorf("invalid check data type")
+			}
+			return checkMDNSName(data.Host(), data.IkniteClusterSpec())
+		},
+	}
+}
+
+func checkMDNSName(fs host.FileSystem, clusterConfig *v1alpha1.IkniteClusterSpec) (bool, string, error) {
+	if !clusterConfig.EnableMDNS {
+		return true, "mDNS is disabled", nil
+	}
+	cluster, err := v1alpha1.LoadIkniteCluster(fs)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to load the cluster status: %w", err)
+	}
+	state := cluster.Status.MDNS
+	switch {
+	case state.Error != "":
+		return false, "", fmt.Errorf("%s is not published: %s", state.RequestedName, state.Error)
+	case state.Name == "":
+		return false, "the domain name has not been published yet", nil
+	case state.Conflict:
+		return true, fmt.Sprintf("%s is used by another host, published as %s", state.RequestedName, state.Name),
+			nil
+	default:
+		return true, fmt.Sprintf("%s is published", state.Name), nil
 	}
 }
 
@@ -655,6 +771,12 @@ func NewPreventedServiceCheck(serviceName string) *check.Check {
 			}
 			return checkServiceIsNotRunnable(data.Host(), constants.RcConfFile, serviceName)
 		},
+		FixFn: HostFix(func(_ context.Context, h host.Host, logger *slog.Logger) (string, error) {
+			if err := k8s.PreventServiceFromStarting(h, constants.RcConfFile, serviceName, logger); err != nil {
+				return "", fmt.Errorf("failed to prevent %s service from starting: %w", serviceName, err)
+			}
+			return fmt.Sprintf("Prevented %s from being started by OpenRC in %s", serviceName, constants.RcConfFile), nil
+		}),
 	}
 }
 
@@ -899,3 +899,110 @@ func TestNewIkniteServerHealthCheck(t *testing.T) {
 	req.False(ok)
 	req.ErrorContains(err, "invalid check data type")
 }
+
+func Test_checkMDNSName(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	fs := host.NewMemMapFS()
+	clusterConfig := &v1alpha1.IkniteClusterSpec{}
+	ok, message, err := checkMDNSName(fs, clusterConfig)
+	req.NoError(err)
+	req.True(ok)
+	req.Contains(message, "disabled")
+
+	clusterConfig.EnableMDNS = true
+	_, _, err = checkMDNSName(fs, clusterConfig)
+	req.ErrorContains(err, "failed to load the cluster status")
+
+	cluster := v1alpha1.NewDefaultIkniteCluster()
+	cluster.Persist(fs, slog.Default())
+	ok, message, err = checkMDNSName(fs, clusterConfig)
+	req.NoError(err)
+	req.False(ok)
+	req.Contains(message, "not been published yet")
+
+	cluster.Status.MDNS = v1alpha1.MDNSState{RequestedName: "iknite.local", Name: "iknite-2.local", Conflict: true}
+	cluster.Persist(fs, slog.Default())
+	ok, message, err = checkMDNSName(fs, clusterConfig)
+	req.NoError(err)
+	req.True(ok)
+	req.Contains(message, "published as iknite-2.local")
+
+	cluster.Status.MDNS = v1alpha1.MDNSState{RequestedName: "iknite.local", Name: "iknite.local"}
+	cluster.Persist(fs, slog.Default())
+	ok, message, err = checkMDNSName(fs, clusterConfig)
+	req.NoError(err)
+	req.True(ok)
+	req.Equal("iknite.local is published", message)
+
+	cluster.Status.MDNS = v1alpha1.MDNSState{RequestedName: "iknite.local", Conflict: true, Error: "already used"}
+	cluster.Persist(fs, slog.Default())
+	ok, _, err = checkMDNSName(fs, clusterConfig)
+	req.ErrorContains(err, "already used")
+	req.False(ok)
+}
+
+func TestEnvironmentCheckPhase_Fix(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	fs := host.NewMemMapFS()
+	req.NoError(fs.MkdirAll("/proc/sys/net/bridge", 0o755))
+	req.NoError(fs.WriteFile("/proc/sys/net/ipv4/ip_forward", []byte("0\n"), 0o644))
+	req.NoError(fs.WriteFile(constants.RcConfFile, []byte("rc_sys=\"\"\n"), 0o644))
+	h, err := testutil.NewDummyHost(fs, &testutil.DummyHostOptions{})
+	req.NoError(err)
+	data := CreateCheckWorkloadData(&v1alpha1.IkniteClusterSpec{}, utils.NewWaitOptions(), h, testutil.TestLogger(t))
+
+	executor := check.NewCheckExecutor()
+	executor.AddCheck(NewEnvironmentCheckPhase(&v1alpha1.IkniteClusterSpec{}))
+	executor.PrepareRun()
+	executor.Run(t.Context(), data)
+	req.True(executor.Results[0].Failed())
+
+	fixes := map[string]*check.CheckResult{}
+	for _, result := range executor.Fix(t.Context(), data) {
+		fixes[result.Name()] = result
+	}
+	req.Len(fixes, 6)
+	for _, name := range []string{
+		"ip_forward", "bridge_nf_call_iptables", "machine_id", "crictl_yaml", "prevented_service_kubelet",
+	} {
+		req.True(fixes[name].Fixed, "%s: %v", name, fixes[name].FixError)
+	}
+	// The memory file system does not support symbolic links
+	req.False(fixes["iknite_service"].Fixed)
+	req.ErrorContains(fixes["iknite_service"].FixError, "failed to enable service iknite")
+
+	executor.Run(t.Context(), data)
+	for _, result := range executor.Results[0].SubResults {
+		req.Equal(result.Name() != "iknite_service", result.Success(), result.Name())
+	}
+	content, err := fs.ReadFile(constants.CrictlYaml)
+	req.NoError(err)
+	req.Contains(string(content), "runtime-endpoint: unix://")
+	runnable, err := k8s.IsServiceRunnable(fs, constants.RcConfFile, k8s.KubeletName)
+	req.NoError(err)
+	req.False(runnable)
+
+	_, err = KernelParameterFix("/proc/sys/net/ipv4/ip_forward")(t.Context(), "bad-data")
+	req.ErrorContains(err, "invalid check data type")
+}
+
+func Test_fixDomainName(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	nh, err := testutil.NewDummyNetworkHost(nil, map[string][]string{"10.0.0.1": {"iknite.local"}})
+	req.NoError(err)
+	t.Cleanup(func() { req.NoError(nh.Cleanup()) })
+
+	message, err := fixDomainName(t.Context(), nh, "iknite.local", net.ParseIP("192.168.99.2"))
+	req.NoError(err)
+	req.Equal("Mapped iknite.local to 192.168.99.2 in the hosts file", message)
+	content, err := os.ReadFile(nh.GetHostsConfig().ReadFilePath)
+	req.NoError(err)
+	req.Contains(string(content), "192.168.99.2")
+	req.NotContains(string(content), "10.0.0.1")
+}
@@ -18,21 +18,22 @@ func NewEnvironmentCheckPhase(ikniteConfig *v1alpha1.IkniteClusterSpec) *check.C
 			"Check IP forwarding is enabled",
 			"/proc/sys/net/ipv4/ip_forward",
 			"1\n",
-		),
+		).WithFix(KernelParameterFix("/proc/sys/net/ipv4/ip_forward")),
 		FileCheck("bridge_nf_call_iptables", "Check IP Tables is active for bridges",
-			"/proc/sys/net/bridge/bridge-nf-call-iptables", "1\n"),
-		FileCheck("machine_id", "Check machine id is defined", "/etc/machine-id", ""),
+			"/proc/sys/net/bridge/bridge-nf-call-iptables", "1\n").
+			WithFix(BridgeNetFilterFix("/proc/sys/net/bridge/bridge-nf-call-iptables")),
+		FileCheck("machine_id", "Check machine id is defined", "/etc/machine-id", "").WithFix(MachineIDFix()),
 		FileCheck(
 			"crictl_yaml",
 			"Check crictl configuration is defined",
-			"/etc/crictl.yaml",
+			constants.CrictlYaml,
 			"",
-		),
+		).WithFix(CrictlConfigurationFix()),
 		//   - Check if the kubelet service is not runnable
 		NewPreventedServiceCheck(k8s.KubeletName),
 		//   - Check if the iknite service is set to run in default mode
 		FileCheck("iknite_service", "Check if iknite is active on default runlevel",
-			"/etc/runlevels/default/iknite", ""),
+			"/etc/runlevels/default/iknite", "").WithFix(EnabledServiceFix(constants.IkniteService)),
 		//   - Check if the IP address we are targeting is bound to an interface
 		NewIpBoundCheck(),
 		//   - Check if the domain name is set
@@ -124,6 +125,8 @@ func NewRuntimeCheckPhase(waitOptions *utils.WaitOptions) *check.Check {
 		NewApiServerHealthCheck(waitOptions.CheckTimeout),
 		//   - Check if the iknite status server is healthy
 		NewIkniteServerHealthCheck(),
+		//   - Check if the domain name is published with mDNS without conflict
+		NewMDNSCheck(),
 	)
 }
 
@@ -146,4 +149,7 @@ func ConfigureIkniteClusterChecker(
 	executor.AddCheck(NewConfigurationCheckPhase(ikniteConfig))
 	executor.AddCheck(NewRuntimeCheckPhase(waitOptions))
 	executor.AddCheck(NewWorkloadStatusCheck())
+	if userChecks := NewUserChecksPhase(loadUserChecksFn()); userChecks != nil {
+		executor.AddCheck(userChecks)
+	}
 }
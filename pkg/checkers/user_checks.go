@@ -0,0 +1,359 @@
+package checkers
+
+// cSpell: words kstatus
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/cli-runtime/pkg/resource"
+	kstatus "sigs.k8s.io/cli-utils/pkg/kstatus/status"
+	"sigs.k8s.io/yaml"
+
+	"github.com/kaweezle/iknite/pkg/check"
+	"github.com/kaweezle/iknite/pkg/constants"
+	"github.com/kaweezle/iknite/pkg/host"
+	"github.com/kaweezle/iknite/pkg/k8s"
+)
+
+// The types of the user defined checks.
+const (
+	UserCheckFile        = "file"
+	UserCheckService     = "service"
+	UserCheckHTTP        = "http"
+	UserCheckTCP         = "tcp"
+	UserCheckCommand     = "command"
+	UserCheckK8sResource = "k8s-resource"
+)
+
+const (
+	userChecksPhaseName       = "user_checks"
+	defaultUserCheckTimeout   = 5 * time.Second
+	defaultK8sResourceParents = "apiserver_health"
+)
+
+// UserCheckSpec is the declaration of a user defined check. The fields used depend on the type of the check.
+type UserCheckSpec struct {
+	// Name is the unique name of the check. It cannot be the name of a built-in check. Other checks refer to it in
+	// their DependsOn.
+	Name string `json:"name"`
+	// Description is displayed instead of the name.
+	Description string `json:"description,omitempty"`
+	// Type is one of file, service, http, tcp, command and k8s-resource.
+	Type string `json:"type"`
+	// Path is the file that must exist (file).
+	Path string `json:"path,omitempty"`
+	// Content is the expected content of the file, if not empty (file).
+	Content string `json:"content,omitempty"`
+	// Service is the OpenRC service that must be started (service).
+	Service string `json:"service,omitempty"`
+	// URL is requested with a GET (http).
+	URL string `json:"url,omitempty"`
+	// Address is the host:port that must accept connections (tcp).
+	Address string `json:"address,omitempty"`
+	// Resource is the object that must be ready, as type/name, for instance namespace/apps (k8s-resource).
+	Resource string `json:"resource,omitempty"`
+	// Namespace is the namespace of the resource, default if empty (k8s-resource).
+	Namespace string `json:"namespace,omitempty"`
+	// DependsOn are the names of the checks that must succeed before this one runs.
+	DependsOn []string `json:"dependsOn,omitempty"`
+	// Command is the command line that must exit with status 0 (command).
+	Command []string `json:"command,omitempty"`
+	// ExpectedStatus is the expected HTTP status code. Any 2xx code is accepted if 0 (http).
+	ExpectedStatus int `json:"expectedStatus,omitempty"`
+	// TimeoutSeconds bounds each attempt of the check. Defaults to 5 seconds for the request or the connection (http,
+	// tcp) and to no timeout for the other types.
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+	// Retries is the number of times the check is attempted again after a failure.
+	Retries int `json:"retries,omitempty"`
+	// RetryIntervalSeconds is the time waited between two attempts of the check.
+	RetryIntervalSeconds int `json:"retryIntervalSeconds,omitempty"`
+	// InsecureSkipVerify disables the verification of the server certificate (http).
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+}
+
+// UserChecksFile is the content of a user defined checks file.
+type UserChecksFile struct {
+	Checks []UserCheckSpec `json:"checks"`
+}
+
+func (s *UserCheckSpec) timeout() time.Duration {
+	if s.TimeoutSeconds > 0 {
+		return time.Duration(s.TimeoutSeconds) * time.Second
+	}
+	return defaultUserCheckTimeout
+}
+
+// validate checks that the fields required by the type of the check are set.
+func (s *UserCheckSpec) validate() error {
+	if s.Name == "" {
+		return errors.New("check without name")
+	}
+	var missing string
+	switch s.Type {
+	case UserCheckFile:
+		if s.Path == "" {
+			missing = "path"
+		}
+	case UserCheckService:
+		if s.Service == "" {
+			missing = "service"
+		}
+	case UserCheckHTTP:
+		if s.URL == "" {
+			missing = "url"
+		}
+	case UserCheckTCP:
+		if s.Address == "" {
+			missing = "address"
+		}
+	case UserCheckCommand:
+		if len(s.Command) == 0 {
+			missing = "command"
+		}
+	case UserCheckK8sResource:
+		if s.Resource == "" {
+			missing = "resource"
+		}
+	default:
+		return fmt.Errorf("check %s has an unknown type %q", s.Name, s.Type)
+	}
+	if missing != "" {
+		return fmt.Errorf("%s check %s has no %s", s.Type, s.Name, missing)
+	}
+	if s.TimeoutSeconds < 0 || s.Retries < 0 || s.RetryIntervalSeconds < 0 {
+		return fmt.Errorf("check %s has a negative timeout, retries or retry interval", s.Name)
+	}
+	return nil
+}
+
+// NewUserCheck compiles the user defined check spec into a check.
+func NewUserCheck(spec *UserCheckSpec) (*check.Check, error) {
+	if err := spec.validate(); err != nil {
+		return nil, err
+	}
+	description := spec.Description
+	var result *check.Check
+	switch spec.Type {
+	case UserCheckFile:
+		if description == "" {
+			description = fmt.Sprintf("Check %s", spec.Path)
+		}
+		result = FileCheck(spec.Name, description, spec.Path, spec.Content)
+	case UserCheckService:
+		result = ServiceCheck(spec.Name, spec.Service, ServiceTypeOpenRC)
+	case UserCheckHTTP:
+		result = &check.Check{
+			Description: fmt.Sprintf("Check %s answers", spec.URL),
+			CheckFn: func(ctx context.Context, _ check.CheckData) (bool, string, error) {
+				return checkHTTP(ctx, spec.URL, spec.ExpectedStatus, spec.InsecureSkipVerify, spec.timeout())
+			},
+		}
+	case UserCheckTCP:
+		result = &check.Check{
+			Description: fmt.Sprintf("Check %s accepts connections", spec.Address),
+			CheckFn: func(ctx context.Context, _ check.CheckData) (bool, string, error) {
+				return checkTCP(ctx, spec.Address, spec.timeout())
+			},
+		}
+	case UserCheckCommand:
+		result = &check.Check{
+			Description: fmt.Sprintf("Check %s succeeds", strings.Join(spec.Command, " ")),
+			CheckFn: func(_ context.Context, checkData check.CheckData) (bool, string, error) {
+				data, ok := checkData.(host.HostProvider)
+				if !ok {
+					return false, "", fmt.Errorf("invalid check data type")
+				}
+				return checkCommand(data.Host(), spec.Command)
+			},
+		}
+	case UserCheckK8sResource:
+		result = &check.Check{
+			Description: fmt.Sprintf("Check %s is ready", spec.Resource),
+			DependsOn:   []string{defaultK8sResourceParents},
+			CheckFn: func(_ context.Context, checkData check.CheckData) (bool, string, error) {
+				data, ok := checkData.(host.HostProvider)
+				if !ok {
+					return false, "", fmt.Errorf("invalid check data type")
+				}
+				kubeClient, err := k8s.NewDefaultClient(data.Host())
+				if err != nil {
+					return false, "", fmt.Errorf("while loading local cluster configuration: %w", err)
+				}
+				return checkResource(kubeClient, spec.Namespace, spec.Resource)
+			},
+		}
+	}
+	result.Name = spec.Name
+	if description != "" {
+		result.Description = description
+	}
+	if spec.DependsOn != nil {
+		result.DependsOn = spec.DependsOn
+	}
+	if spec.TimeoutSeconds > 0 {
+		result.Timeout = time.Duration(spec.TimeoutSeconds) * time.Second
+	}
+	result.Retries = spec.Retries
+	result.RetryInterval = time.Duration(spec.RetryIntervalSeconds) * time.Second
+	return result, nil
+}
+
+// LoadUserChecks loads the checks declared in the YAML files of dir. The checks are returned in the order of the
+// files names, then in the order of their declaration. A missing directory declares no check.
+func LoadUserChecks(fs host.FileSystem, dir string) ([]*check.Check, error) {
+	var files []string
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		matches, err := fs.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, fmt.Errorf("while listing the checks files of %s: %w", dir, err)
+		}
+		files = append(files, matches...)
+	}
+	slices.Sort(files)
+
+	var checks []*check.Check
+	names := make(map[string]string)
+	for _, file := range files {
+		content, err := fs.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("while reading the checks file %s: %w", file, err)
+		}
+		var checksFile UserChecksFile
+		if err = yaml.UnmarshalStrict(content, &checksFile); err != nil {
+			return nil, fmt.Errorf("while parsing the checks file %s: %w", file, err)
+		}
+		for i := range checksFile.Checks {
+			spec := &checksFile.Checks[i]
+			if other, ok := names[spec.Name]; ok {
+				return nil, fmt.Errorf("check %s of %s is already declared in %s", spec.Name, file, other)
+			}
+			names[spec.Name] = file
+			userCheck, err := NewUserCheck(spec)
+			if err != nil {
+				return nil, fmt.Errorf("in the checks file %s: %w", file, err)
+			}
+			checks = append(checks, userCheck)
+		}
+	}
+	return checks, nil
+}
+
+// NewUserChecksPhase returns the phase containing the user defined checks. An invalid configuration gives a phase
+// with a single failing check reporting the error. Nil is returned if there is no user defined check.
+func NewUserChecksPhase(checks []*check.Check, err error) *check.Check {
+	if err != nil {
+		checks = []*check.Check{{
+			Name:        "user_checks_configuration",
+			Description: "Check the user defined checks configuration",
+			CheckFn: func(_ context.Context, _ check.CheckData) (bool, string, error) {
+				return false, "", err
+			},
+		}}
+	}
+	if len(checks) == 0 {
+		return nil
+	}
+	return check.NewPhase(userChecksPhaseName, "User defined checks", checks...)
+}
+
+var loadUserChecksFn = func() ([]*check.Check, error) {
+	return LoadUserChecks(host.NewOsFS(), constants.UserChecksDirectory)
+}
+
+func checkHTTP(
+	ctx context.Context,
+	url string,
+	expectedStatus int,
+	insecureSkipVerify bool,
+	timeout time.Duration,
+) (bool, string, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert // always a transport
+	if insecureSkipVerify {
+		//nolint:gosec // explicitly requested by the check declaration
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	client := &http.Client{Timeout: timeout, Transport: transport}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return false, "", fmt.Errorf("invalid request to %s: %w", url, err)
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to request %s: %w", url, err)
+	}
+	defer response.Body.Close() //nolint:errcheck // nothing is read from the body
+
+	ok := response.StatusCode == expectedStatus
+	if expectedStatus == 0 {
+		ok = response.StatusCode >= http.StatusOK && response.StatusCode < http.StatusMultipleChoices
+	}
+	if !ok {
+		return false, "", fmt.Errorf("%s answered with status %s", url, response.Status)
+	}
+	return true, fmt.Sprintf("%s answered with status %s", url, response.Status), nil
+}
+
+func checkTCP(ctx context.Context, address string, timeout time.Duration) (bool, string, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to connect to %s: %w", address, err)
+	}
+	_ = conn.Close() //nolint:errcheck // the connection is only tested
+	return true, fmt.Sprintf("%s accepts connections", address), nil
+}
+
+func checkCommand(exec host.Executor, command []string) (bool, string, error) {
+	out, err := exec.Run(true, command[0], command[1:]...)
+	output := strings.TrimSpace(string(out))
+	if err != nil {
+		if output != "" {
+			return false, "", fmt.Errorf("%s failed: %s: %w", command[0], output, err)
+		}
+		return false, "", fmt.Errorf("%s failed: %w", command[0], err)
+	}
+	if output == "" {
+		return true, fmt.Sprintf("%s succeeded", command[0]), nil
+	}
+	lines := strings.Split(output, "\n")
+	return true, lines[len(lines)-1], nil
+}
+
+// checkResource checks that the object designated by ref, as type/name, is ready according to its kstatus status.
+func checkResource(client resource.RESTClientGetter, namespace, ref string) (bool, string, error) {
+	infos, err := resource.NewBuilder(client).
+		Unstructured().
+		NamespaceParam(namespace).
+		DefaultNamespace().
+		ResourceTypeOrNameArgs(false, ref).
+		Flatten().
+		Do().
+		Infos()
+	if err != nil {
+		return false, "", fmt.Errorf("failed to get %s: %w", ref, err)
+	}
+	if len(infos) != 1 {
+		return false, "", fmt.Errorf("expected a single object for %s, got %d", ref, len(infos))
+	}
+	obj, ok := infos[0].Object.(*unstructured.Unstructured)
+	if !ok {
+		return false, "", fmt.Errorf("unexpected object type %T for %s", infos[0].Object, ref)
+	}
+	status, message, err := k8s.ComputeStatus(obj)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to compute the status of %s: %w", ref, err)
+	}
+	if status != kstatus.CurrentStatus {
+		return false, fmt.Sprintf("%s is %s: %s", ref, status, message), nil
+	}
+	return true, fmt.Sprintf("%s is ready", ref), nil
+}
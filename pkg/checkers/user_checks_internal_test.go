@@ -0,0 +1,250 @@
+// cSpell: words testutil httptest mountpoint nfsclient
+package checkers
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kaweezle/iknite/pkg/check"
+	"github.com/kaweezle/iknite/pkg/host"
+	"github.com/kaweezle/iknite/pkg/testutil"
+)
+
+const siteChecks = `checks:
+  - name: nfs_data
+    description: NFS data is mounted
+    type: file
+    path: /mnt/data/.mounted
+  - name: nfs_client
+    type: service
+    service: nfsclient
+  - name: registry
+    type: http
+    url: https://registry.local/v2/
+    dependsOn: [nfs_data]
+  - name: apps_namespace
+    type: k8s-resource
+    resource: namespace/apps
+`
+
+const portChecks = `checks:
+  - name: ssh
+    type: tcp
+    address: 127.0.0.1:22
+    timeoutSeconds: 1
+    retries: 2
+    retryIntervalSeconds: 3
+  - name: mounted
+    type: command
+    command: [mountpoint, /mnt/data]
+`
+
+func TestLoadUserChecks(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	fs := host.NewMemMapFS()
+	checks, err := LoadUserChecks(fs, "/etc/iknite.d/checks")
+	req.NoError(err)
+	req.Empty(checks)
+	req.Nil(NewUserChecksPhase(checks, err))
+
+	req.NoError(fs.WriteFile("/etc/iknite.d/checks/20-site.yaml", []byte(siteChecks), 0o644))
+	req.NoError(fs.WriteFile("/etc/iknite.d/checks/10-ports.yml", []byte(portChecks), 0o644))
+	req.NoError(fs.WriteFile("/etc/iknite.d/checks/README.md", []byte("not a check"), 0o644))
+	checks, err = LoadUserChecks(fs, "/etc/iknite.d/checks")
+	req.NoError(err)
+
+	names := make([]string, 0, len(checks))
+	for _, c := range checks {
+		names = append(names, c.Name)
+		req.NotNil(c.CheckFn)
+	}
+	req.Equal([]string{"ssh", "mounted", "nfs_data", "nfs_client", "registry", "apps_namespace"}, names)
+	req.Equal("Check 127.0.0.1:22 accepts connections", checks[0].Description)
+	req.Equal(time.Second, checks[0].Timeout)
+	req.Equal(2, checks[0].Retries)
+	req.Equal(3*time.Second, checks[0].RetryInterval)
+	req.Zero(checks[1].Timeout)
+	req.Equal("NFS data is mounted", checks[2].Description)
+	req.Equal([]string{"openrc"}, checks[3].DependsOn)
+	req.Equal([]string{"nfs_data"}, checks[4].DependsOn)
+	req.Equal([]string{"apiserver_health"}, checks[5].DependsOn)
+
+	phase := NewUserChecksPhase(checks, nil)
+	req.Equal("user_checks", phase.Name)
+	req.Len(phase.SubChecks, 6)
+}
+
+func TestLoadUserChecks_Errors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "invalid yaml", content: "checks: [", wantErr: "while parsing the checks file /checks/checks.yaml"},
+		{name: "unknown field", content: "checks:\n  - name: a\n    type: file\n    file: /a\n", wantErr: "unknown field"},
+		{name: "no name", content: "checks:\n  - type: file\n", wantErr: "check without name"},
+		{name: "unknown type", content: "checks:\n  - name: a\n    type: dns\n", wantErr: `unknown type "dns"`},
+		{name: "missing field", content: "checks:\n  - name: a\n    type: tcp\n", wantErr: "tcp check a has no address"},
+		{
+			name:    "negative retries",
+			content: "checks:\n  - name: a\n    type: file\n    path: /a\n    retries: -1\n",
+			wantErr: "check a has a negative timeout, retries or retry interval",
+		},
+		{
+			name:    "duplicate",
+			content: "checks:\n  - name: a\n    type: file\n    path: /a\n  - name: a\n    type: file\n    path: /b\n",
+			wantErr: "check a of /checks/checks.yaml is already declared",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			req := require.New(t)
+			fs := host.NewMemMapFS()
+			req.NoError(fs.WriteFile("/checks/checks.yaml", []byte(tt.content), 0o644))
+			checks, err := LoadUserChecks(fs, "/checks")
+			req.ErrorContains(err, tt.wantErr)
+
+			// The configuration error is reported by a failing check
+			phase := NewUserChecksPhase(checks, err)
+			req.Len(phase.SubChecks, 1)
+			ok, _, checkErr := phase.SubChecks[0].CheckFn(t.Context(), nil)
+			req.False(ok)
+			req.ErrorIs(checkErr, err)
+		})
+	}
+}
+
+func TestUserChecks_HTTPAndTCP(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	httpCheck := func(path string, expectedStatus int) *check.Check {
+		c, err := NewUserCheck(&UserCheckSpec{
+			Name: "web", Type: UserCheckHTTP, URL: server.URL + path, ExpectedStatus: expectedStatus,
+		})
+		req.NoError(err)
+		return c
+	}
+	ok, message, err := httpCheck("/", 0).CheckFn(t.Context(), nil)
+	req.NoError(err)
+	req.True(ok)
+	req.Contains(message, "answered with status 200 OK")
+
+	ok, _, err = httpCheck("/missing", 0).CheckFn(t.Context(), nil)
+	req.ErrorContains(err, "answered with status 404 Not Found")
+	req.False(ok)
+
+	ok, _, err = httpCheck("/missing", http.StatusNotFound).CheckFn(t.Context(), nil)
+	req.NoError(err)
+	req.True(ok)
+
+	tcpCheck, err := NewUserCheck(&UserCheckSpec{
+		Name: "port", Type: UserCheckTCP, Address: server.Listener.Addr().String(),
+	})
+	req.NoError(err)
+	ok, _, err = tcpCheck.CheckFn(t.Context(), nil)
+	req.NoError(err)
+	req.True(ok)
+
+	// A closed port refuses the connection
+	listener, err := (&net.ListenConfig{}).Listen(t.Context(), "tcp", "127.0.0.1:0")
+	req.NoError(err)
+	address := listener.Addr().String()
+	req.NoError(listener.Close())
+	ok, _, err = checkTCP(t.Context(), address, time.Second)
+	req.ErrorContains(err, "failed to connect to "+address)
+	req.False(ok)
+}
+
+func TestUserChecks_Command(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	h, err := testutil.NewDummyHost(host.NewMemMapFS(), &testutil.DummyHostOptions{
+		FakeOutputs: map[string]*testutil.FakeProcessOutput{
+			"mountpoint /mnt/data": testutil.FakeExec("/mnt/data is a mountpoint\n", 0),
+			"mountpoint /mnt/none": testutil.FakeExec("/mnt/none is not a mountpoint\n", 1),
+		},
+	})
+	req.NoError(err)
+	data := CreateCheckWorkloadData(nil, nil, h, testutil.TestLogger(t))
+
+	commandCheck, err := NewUserCheck(&UserCheckSpec{
+		Name: "mounted", Type: UserCheckCommand, Command: []string{"mountpoint", "/mnt/data"},
+	})
+	req.NoError(err)
+	ok, message, err := commandCheck.CheckFn(t.Context(), data)
+	req.NoError(err)
+	req.True(ok)
+	req.Equal("/mnt/data is a mountpoint", message)
+
+	ok, _, err = checkCommand(h, []string{"mountpoint", "/mnt/none"})
+	req.ErrorContains(err, "mountpoint failed: /mnt/none is not a mountpoint")
+	req.False(ok)
+
+	ok, _, err = commandCheck.CheckFn(t.Context(), "bad-data")
+	req.ErrorContains(err, "invalid check data type")
+	req.False(ok)
+}
+
+func TestUserChecks_K8sResource(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	client := testutil.CreateClientGetterWithTestServer(t, testutil.NewRESTMapper(),
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.URL.Path {
+			case "/api/v1/namespaces/apps":
+				_, _ = w.Write([]byte(`{"apiVersion":"v1","kind":"Namespace","metadata":{"name":"apps"},` +
+					`"status":{"phase":"Active"}}`))
+			case "/apis/apps/v1/namespaces/registry/deployments/registry":
+				_, _ = w.Write([]byte(`{"apiVersion":"apps/v1","kind":"Deployment",` +
+					`"metadata":{"name":"registry","namespace":"registry","generation":1},` +
+					`"spec":{"replicas":1},"status":{"observedGeneration":1,"replicas":1}}`))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound",` +
+					`"code":404}`))
+			}
+		})
+
+	ok, message, err := checkResource(client, "", "namespace/apps")
+	req.NoError(err)
+	req.True(ok)
+	req.Equal("namespace/apps is ready", message)
+
+	ok, message, err = checkResource(client, "registry", "deployment/registry")
+	req.NoError(err)
+	req.False(ok)
+	req.Contains(message, "deployment/registry is InProgress")
+
+	ok, _, err = checkResource(client, "", "namespace/missing")
+	req.ErrorContains(err, "failed to get namespace/missing")
+	req.False(ok)
+
+	resourceCheck, err := NewUserCheck(&UserCheckSpec{Name: "apps", Type: UserCheckK8sResource, Resource: "ns/apps"})
+	req.NoError(err)
+	h, err := testutil.NewDummyHost(host.NewMemMapFS(), &testutil.DummyHostOptions{})
+	req.NoError(err)
+	ok, _, err = resourceCheck.CheckFn(t.Context(), CreateCheckWorkloadData(nil, nil, h, testutil.TestLogger(t)))
+	req.ErrorContains(err, "while loading local cluster configuration")
+	req.False(ok)
+}
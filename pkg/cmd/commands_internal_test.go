@@ -51,6 +51,7 @@ func TestCommandConstructors(t *testing.T) {
 		"start",
 		"status",
 		"info",
+		"images",
 	}
 	for _, name := range expectedSubcommands {
 		t.Run("root has "+name, func(t *testing.T) {
@@ -70,7 +71,7 @@ func TestCommandConstructors(t *testing.T) {
 		{name: "status", fn: func() *cobra.Command { return NewStatusCmd(spec, nil, nil, nil) }},
 		{name: "prepare", fn: func() *cobra.Command { return NewPrepareCommand(spec) }},
 		{name: "kubelet", fn: func() *cobra.Command { return NewKubeletCmd(spec, nil, nil) }},
-		{name: "mdns", fn: func() *cobra.Command { return NewMdnsCmd(spec) }},
+		{name: "mdns", fn: func() *cobra.Command { return NewMdnsCmd(spec, nil) }},
 		{name: "info", fn: func() *cobra.Command { return NewInfoCmd(spec) }},
 		{name: "kustomize", fn: func() *cobra.Command { return NewKustomizeCmd(nil, nil, nil) }},
 		{
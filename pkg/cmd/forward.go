@@ -0,0 +1,176 @@
+/*
+Copyright © 2021 Antoine Martin <antoine@openance.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/rest"
+
+	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
+	"github.com/kaweezle/iknite/pkg/cmd/options"
+	"github.com/kaweezle/iknite/pkg/forward"
+	"github.com/kaweezle/iknite/pkg/host"
+	"github.com/kaweezle/iknite/pkg/k8s"
+)
+
+const forwardsPath = "/forwards"
+
+// NewForwardCmd returns the "forward" command managing the port forwarding
+// rules of the running iknite daemon through its status server.
+func NewForwardCmd(fs host.FileSystem) *cobra.Command {
+	var configPath string
+	if fs == nil {
+		fs = host.NewOsFS()
+	}
+
+	forwardCmd := &cobra.Command{
+		Use:   "forward",
+		Short: "Manage the TCP port forwarding rules of the running cluster",
+		Long: `Manages the TCP port forwarding rules of the running iknite daemon.
+
+The rules of the cluster configuration (cluster.forwards) are started by the
+daemon. This command adds, lists and removes rules at runtime through the
+iknite status server. The rules added at runtime are only recorded in the
+cluster status (/run/iknite/status.json), that is lost on reboot. They are kept
+when the configuration is reloaded but not when the daemon restarts. To make a
+rule permanent, add it to cluster.forwards in the configuration file and send
+SIGHUP to the daemon (rc-service iknite reload).
+
+The command uses the iknite client configuration file generated at
+/etc/kubernetes/iknite.conf (see iknite info status).`,
+	}
+	forwardCmd.PersistentFlags().StringVar(
+		&configPath,
+		ikniteConfigFlag,
+		defaultIkniteConf(),
+		"Path to the iknite client configuration file (default: $HOME/.kube/iknite.conf)",
+	)
+
+	var rule v1alpha1.ForwardRule
+	addCmd := &cobra.Command{
+		Use:   "add [name]",
+		Short: "Add a forwarding rule",
+		Long: `Forwards the TCP connections received on the listen address and port to the
+target. The listen address defaults to the outbound IP address of the host and
+the target to the cluster IP address on the same port. The name defaults to the
+port.`,
+		Example: `> iknite forward add web --port 8080 --target 10.0.0.5:80`,
+		Args:    cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 0 {
+				rule.Name = args[0]
+			}
+			return withIkniteRESTClient(fs, configPath, func(client rest.Interface) error {
+				return performForwardAdd(cmd.Context(), client, rule)
+			})
+		},
+	}
+	addCmd.Flags().IntVar(&rule.Port, options.ForwardPort, 0, "Port to listen on")
+	addCmd.Flags().StringVar(&rule.ListenAddress, options.ForwardListenAddress, "",
+		"IP address to listen on (default: outbound IP address)")
+	addCmd.Flags().StringVar(&rule.Target, options.ForwardTarget, "",
+		"Target host or host:port (default: cluster IP address and same port)")
+	addCmd.MarkFlagRequired(options.ForwardPort) //nolint:errcheck,gosec // flag exists
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the forwarding rules with their connection metrics",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return withIkniteRESTClient(fs, configPath, func(client rest.Interface) error {
+				return performForwardList(cmd.Context(), client, cmd.OutOrStdout())
+			})
+		},
+	}
+
+	removeCmd := &cobra.Command{
+		Use:     "remove name",
+		Aliases: []string{"rm"},
+		Short:   "Remove a forwarding rule",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withIkniteRESTClient(fs, configPath, func(client rest.Interface) error {
+				return performForwardRemove(cmd.Context(), client, args[0])
+			})
+		},
+	}
+
+	forwardCmd.AddCommand(addCmd, listCmd, removeCmd)
+	return forwardCmd
+}
+
+// withIkniteRESTClient calls fn with a REST client for the iknite status
+// server configured from configPath.
+func withIkniteRESTClient(fs host.FileSystem, configPath string, fn func(rest.Interface) error) error {
+	kubeClient, err := k8s.NewClientFromFile(fs, configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load iknite config from %s: %w", configPath, err)
+	}
+
+	restClient, err := k8s.RESTClient(kubeClient)
+	if err != nil {
+		return fmt.Errorf("failed to create REST client: %w", err)
+	}
+	return fn(restClient)
+}
+
+func performForwardAdd(ctx context.Context, client rest.Interface, rule v1alpha1.ForwardRule) error {
+	body, err := json.Marshal(rule)
+	if err != nil {
+		return fmt.Errorf("failed to serialize the forward rule: %w", err)
+	}
+	if _, err = client.Post().AbsPath(forwardsPath).SetHeader("Content-Type", "application/json").
+		Body(body).DoRaw(ctx); err != nil {
+		return fmt.Errorf("failed to add the forward rule: %w", err)
+	}
+	return nil
+}
+
+func performForwardRemove(ctx context.Context, client rest.Interface, name string) error {
+	if _, err := client.Delete().AbsPath(forwardsPath, name).DoRaw(ctx); err != nil {
+		return fmt.Errorf("failed to remove the forward rule %s: %w", name, err)
+	}
+	return nil
+}
+
+func performForwardList(ctx context.Context, client rest.Interface, out io.Writer) error {
+	body, err := client.Get().AbsPath(forwardsPath).DoRaw(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list the forward rules: %w", err)
+	}
+	var statuses []forward.RuleStatus
+	if err = json.Unmarshal(body, &statuses); err != nil {
+		return fmt.Errorf("failed to parse the forward rules: %w", err)
+	}
+
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0) //nolint:mnd // padding
+	fmt.Fprintln(writer, "NAME\tLISTEN\tTARGET\tACTIVE\tTOTAL\tFAILED\tIN\tOUT\tERROR")
+	for _, status := range statuses {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\t%s\n", status.Name, status.ListenAddr, status.TargetAddr,
+			status.ActiveConnections, status.TotalConnections, status.FailedConnections, status.BytesIn,
+			status.BytesOut, status.Error)
+	}
+	if err = writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write the forward rules: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
+	"github.com/kaweezle/iknite/pkg/forward"
+	"github.com/kaweezle/iknite/pkg/host"
+)
+
+// startForwardsServer starts a fake iknite status server serving /forwards and
+// returns the path of a client configuration file pointing to it.
+func startForwardsServer(t *testing.T, fs host.FileSystem) string {
+	t.Helper()
+	var mu sync.Mutex
+	rules := []v1alpha1.ForwardRule{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == forwardsPath:
+			statuses := make([]forward.RuleStatus, 0, len(rules))
+			for _, rule := range rules {
+				statuses = append(statuses, forward.RuleStatus{
+					ForwardRule: rule, ListenAddr: fmt.Sprintf("0.0.0.0:%d", rule.Port), TargetAddr: rule.Target,
+					TotalConnections: 3, BytesIn: 10, BytesOut: 20,
+				})
+			}
+			json.NewEncoder(w).Encode(statuses) //nolint:errcheck,gosec // test server
+		case r.Method == http.MethodPost && r.URL.Path == forwardsPath:
+			var rule v1alpha1.ForwardRule
+			if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			rules = append(rules, rule)
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, forwardsPath+"/"):
+			name := strings.TrimPrefix(r.URL.Path, forwardsPath+"/")
+			for i, rule := range rules {
+				if rule.Name == name {
+					rules = append(rules[:i], rules[i+1:]...)
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+			}
+			http.Error(w, "forward rule not found", http.StatusNotFound)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	config := fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: iknite
+  cluster:
+    server: %s
+users:
+- name: iknite
+  user: {}
+contexts:
+- name: iknite@iknite
+  context:
+    cluster: iknite
+    user: iknite
+current-context: iknite@iknite
+`, srv.URL)
+	require.NoError(t, fs.WriteFile("/iknite.conf", []byte(config), 0o600))
+	return "/iknite.conf"
+}
+
+func TestForwardCmd(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	fs := host.NewMemMapFS()
+	configPath := startForwardsServer(t, fs)
+
+	run := func(args ...string) (string, error) {
+		cmd := NewForwardCmd(fs)
+		var out bytes.Buffer
+		cmd.SetOut(&out)
+		cmd.SetErr(&out)
+		cmd.SetArgs(append(args, "--"+ikniteConfigFlag, configPath))
+		err := cmd.Execute()
+		return out.String(), err
+	}
+
+	_, err := run("add", "web", "--port", "8080", "--target", "10.0.0.5:80")
+	req.NoError(err)
+
+	out, err := run("list")
+	req.NoError(err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	req.Len(lines, 2)
+	req.Equal([]string{"NAME", "LISTEN", "TARGET", "ACTIVE", "TOTAL", "FAILED", "IN", "OUT", "ERROR"},
+		strings.Fields(lines[0]))
+	req.Equal([]string{"web", "0.0.0.0:8080", "10.0.0.5:80", "0", "3", "0", "10", "20"}, strings.Fields(lines[1]))
+
+	_, err = run("remove", "web")
+	req.NoError(err)
+	_, err = run("rm", "web")
+	req.ErrorContains(err, "failed to remove the forward rule web")
+
+	_, err = run("add", "web")
+	req.ErrorContains(err, "port")
+
+	cmd := NewForwardCmd(fs)
+	cmd.SetOut(&bytes.Buffer{})
+	cmd.SetArgs([]string{"list", "--" + ikniteConfigFlag, "/missing.conf"})
+	req.ErrorContains(cmd.Execute(), "failed to load iknite config")
+}
@@ -0,0 +1,194 @@
+/*
+Copyright © 2021 Antoine Martin <antoine@openance.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+// cSpell: words containerd tarball
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
+	"github.com/kaweezle/iknite/pkg/cmd/util"
+	"github.com/kaweezle/iknite/pkg/config"
+	"github.com/kaweezle/iknite/pkg/cri"
+	"github.com/kaweezle/iknite/pkg/host"
+	"github.com/kaweezle/iknite/pkg/utils"
+)
+
+// getIkniteImagesFn returns the list of images needed by iknite. It is replaced in tests.
+var getIkniteImagesFn = config.GetIkniteImages
+
+func NewContainerImagesCmd(ikniteConfig *v1alpha1.IkniteClusterSpec, alpineHost host.Host) *cobra.Command {
+	if alpineHost == nil {
+		alpineHost = host.NewDefaultHost()
+	}
+	kustomizeOptions := utils.NewKustomizeOptions()
+
+	imagesCmd := &cobra.Command{
+		Use:   "images",
+		Short: "Manage the container images used by iknite",
+		Long: `Manages the container images needed by iknite in the local containerd store.
+
+The list of images contains the control plane images for the configured
+Kubernetes version and the images referenced by the kustomization. It is the
+same list as the one displayed by 'iknite info images'.
+
+Exported images are stored in an OCI tarball that can be imported on machines
+that don't have access to the container registries.`,
+	}
+	flags := imagesCmd.PersistentFlags()
+	config.AddIkniteClusterFlags(flags, ikniteConfig)
+	utils.AddKustomizeOptionsFlags(flags, kustomizeOptions)
+
+	imagesCmd.AddCommand(&cobra.Command{
+		Use:     "pull",
+		Short:   "Pull the container images used by iknite",
+		Long:    `Pulls all the container images used by iknite into the local containerd store.`,
+		Example: `> iknite images pull`,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return performImagesPull(alpineHost, ikniteConfig, kustomizeOptions, util.LoggerFromCommand(cmd))
+		},
+	})
+
+	imagesCmd.AddCommand(&cobra.Command{
+		Use:     "export <file>",
+		Short:   "Export the container images used by iknite to an OCI tarball",
+		Long:    `Exports all the container images used by iknite from the local containerd store to an OCI tarball.`,
+		Example: `> iknite images export /tmp/iknite-images.tar`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return performImagesExport(alpineHost, ikniteConfig, kustomizeOptions, args[0], util.LoggerFromCommand(cmd))
+		},
+	})
+
+	imagesCmd.AddCommand(&cobra.Command{
+		Use:     "import <file>",
+		Short:   "Import container images from an OCI tarball",
+		Long:    `Imports the container images contained in an OCI tarball into the local containerd store.`,
+		Example: `> iknite images import /tmp/iknite-images.tar`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return performImagesImport(alpineHost, args[0], util.LoggerFromCommand(cmd))
+		},
+	})
+
+	imagesCmd.AddCommand(&cobra.Command{
+		Use:   "verify",
+		Short: "Verify that the container images used by iknite are present",
+		Long: `Verifies that all the container images used by iknite are present in the
+local containerd store. The missing images are displayed and the command fails
+if any image is missing.`,
+		Example: `> iknite images verify`,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return performImagesVerify(
+				cmd.OutOrStdout(),
+				alpineHost,
+				ikniteConfig,
+				kustomizeOptions,
+				util.LoggerFromCommand(cmd),
+			)
+		},
+	})
+
+	return imagesCmd
+}
+
+func performImagesPull(
+	alpineHost host.Host,
+	ikniteConfig *v1alpha1.IkniteClusterSpec,
+	kustomizeOptions *utils.KustomizeOptions,
+	logger *slog.Logger,
+) error {
+	containerImages, err := getIkniteImagesFn(alpineHost, ikniteConfig, kustomizeOptions.ForceEmbedded, logger)
+	if err != nil {
+		return fmt.Errorf("while getting iknite images: %w", err)
+	}
+	if err = cri.PullImages(alpineHost, containerImages, logger); err != nil {
+		return fmt.Errorf("while pulling images: %w", err)
+	}
+	logger.Info("Images pulled", "count", len(containerImages))
+	return nil
+}
+
+func performImagesExport(
+	alpineHost host.Host,
+	ikniteConfig *v1alpha1.IkniteClusterSpec,
+	kustomizeOptions *utils.KustomizeOptions,
+	path string,
+	logger *slog.Logger,
+) error {
+	containerImages, err := getIkniteImagesFn(alpineHost, ikniteConfig, kustomizeOptions.ForceEmbedded, logger)
+	if err != nil {
+		return fmt.Errorf("while getting iknite images: %w", err)
+	}
+	missing, err := cri.MissingImages(alpineHost, containerImages)
+	if err != nil {
+		return fmt.Errorf("while checking local images: %w", err)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("cannot export, %d images are missing locally (run iknite images pull): %v",
+			len(missing), missing)
+	}
+	if err = cri.ExportImages(alpineHost, path, containerImages, logger); err != nil {
+		return fmt.Errorf("while exporting images: %w", err)
+	}
+	return nil
+}
+
+func performImagesImport(alpineHost host.Host, path string, logger *slog.Logger) error {
+	exists, err := alpineHost.Exists(path)
+	if err != nil {
+		return fmt.Errorf("while checking %s: %w", path, err)
+	}
+	if !exists {
+		return fmt.Errorf("images archive %s does not exist", path)
+	}
+	if err = cri.ImportImages(alpineHost, path, logger); err != nil {
+		return fmt.Errorf("while importing images: %w", err)
+	}
+	return nil
+}
+
+func performImagesVerify(
+	out io.Writer,
+	alpineHost host.Host,
+	ikniteConfig *v1alpha1.IkniteClusterSpec,
+	kustomizeOptions *utils.KustomizeOptions,
+	logger *slog.Logger,
+) error {
+	containerImages, err := getIkniteImagesFn(alpineHost, ikniteConfig, kustomizeOptions.ForceEmbedded, logger)
+	if err != nil {
+		return fmt.Errorf("while getting iknite images: %w", err)
+	}
+	missing, err := cri.MissingImages(alpineHost, containerImages)
+	if err != nil {
+		return fmt.Errorf("while checking local images: %w", err)
+	}
+	for _, image := range missing {
+		fmt.Fprintf(out, "missing: %s\n", image)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%d of %d images are missing", len(missing), len(containerImages))
+	}
+	fmt.Fprintf(out, "All %d images are present\n", len(containerImages))
+	return nil
+}
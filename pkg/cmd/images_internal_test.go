@@ -0,0 +1,122 @@
+// cSpell: words paralleltest crictl containerd
+//
+//nolint:paralleltest // These tests modify global state and cannot be run in parallel
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	mockHost "github.com/kaweezle/iknite/mocks/pkg/host"
+	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
+	"github.com/kaweezle/iknite/pkg/config"
+	"github.com/kaweezle/iknite/pkg/constants"
+	"github.com/kaweezle/iknite/pkg/cri"
+	"github.com/kaweezle/iknite/pkg/host"
+	"github.com/kaweezle/iknite/pkg/testutil"
+	"github.com/kaweezle/iknite/pkg/utils"
+)
+
+var testCrictlImagesArgs = []string{
+	"--runtime-endpoint", "unix://" + constants.ContainerServiceSock, "images", "--output", "json",
+}
+
+func setTestIkniteImages(t *testing.T, images []string, err error) {
+	t.Helper()
+	getIkniteImagesFn = func(_ host.FileSystem, _ *v1alpha1.IkniteClusterSpec, _ bool, _ *slog.Logger) ([]string, error) {
+		return images, err
+	}
+	t.Cleanup(func() {
+		getIkniteImagesFn = config.GetIkniteImages
+	})
+}
+
+func TestNewContainerImagesCmd(t *testing.T) {
+	req := require.New(t)
+	imagesCmd := NewContainerImagesCmd(&v1alpha1.IkniteClusterSpec{}, mockHost.NewMockHost(t))
+	for _, name := range []string{"pull", "export", "import", "verify"} {
+		cmd, _, err := imagesCmd.Find([]string{name})
+		req.NoError(err)
+		req.Equal(name, cmd.Name())
+	}
+	req.NotNil(imagesCmd.PersistentFlags().Lookup("kustomization"))
+}
+
+func TestPerformImagesPull(t *testing.T) {
+	req := require.New(t)
+	logger := testutil.TestLogger(t)
+	mockH := mockHost.NewMockHost(t)
+
+	setTestIkniteImages(t, nil, errors.New("kustomization error"))
+	err := performImagesPull(mockH, &v1alpha1.IkniteClusterSpec{}, utils.NewKustomizeOptions(), logger)
+	req.ErrorContains(err, "kustomization error")
+
+	setTestIkniteImages(t, []string{"registry.k8s.io/pause:3.10"}, nil)
+	mockH.EXPECT().Run(true, "/usr/bin/crictl", []string{
+		"--runtime-endpoint", "unix://" + constants.ContainerServiceSock, "pull", "registry.k8s.io/pause:3.10",
+	}).Return(nil, nil).Once()
+	req.NoError(performImagesPull(mockH, &v1alpha1.IkniteClusterSpec{}, utils.NewKustomizeOptions(), logger))
+}
+
+func TestPerformImagesVerify(t *testing.T) {
+	req := require.New(t)
+	logger := testutil.TestLogger(t)
+	mockH := mockHost.NewMockHost(t)
+	setTestIkniteImages(t, []string{"registry.k8s.io/pause:3.10", "registry.k8s.io/kube-apiserver:v1.36.1"}, nil)
+
+	mockH.EXPECT().Run(false, "/usr/bin/crictl", testCrictlImagesArgs).
+		Return([]byte(`{"images":[{"id":"1","repoTags":["registry.k8s.io/pause:3.10"]}]}`), nil).Once()
+	var out bytes.Buffer
+	err := performImagesVerify(&out, mockH, &v1alpha1.IkniteClusterSpec{}, utils.NewKustomizeOptions(), logger)
+	req.ErrorContains(err, "1 of 2 images are missing")
+	req.Equal("missing: registry.k8s.io/kube-apiserver:v1.36.1\n", out.String())
+
+	mockH.EXPECT().Run(false, "/usr/bin/crictl", testCrictlImagesArgs).
+		Return([]byte(`{"images":[{"id":"1","repoTags":["registry.k8s.io/pause:3.10"]},`+
+			`{"id":"2","repoTags":["registry.k8s.io/kube-apiserver:v1.36.1"]}]}`), nil).Once()
+	out.Reset()
+	req.NoError(performImagesVerify(&out, mockH, &v1alpha1.IkniteClusterSpec{}, utils.NewKustomizeOptions(), logger))
+	req.Equal("All 2 images are present\n", out.String())
+}
+
+func TestPerformImagesExport(t *testing.T) {
+	req := require.New(t)
+	logger := testutil.TestLogger(t)
+	mockH := mockHost.NewMockHost(t)
+	setTestIkniteImages(t, []string{"registry.k8s.io/pause:3.10", "registry.k8s.io/kube-apiserver:v1.36.1"}, nil)
+
+	mockH.EXPECT().Run(false, "/usr/bin/crictl", testCrictlImagesArgs).
+		Return([]byte(`{"images":[{"id":"1","repoTags":["registry.k8s.io/pause:3.10"]}]}`), nil).Once()
+	err := performImagesExport(mockH, &v1alpha1.IkniteClusterSpec{}, utils.NewKustomizeOptions(), "/tmp/i.tar", logger)
+	req.ErrorContains(err, "1 images are missing locally")
+
+	mockH.EXPECT().Run(false, "/usr/bin/crictl", testCrictlImagesArgs).
+		Return([]byte(`{"images":[{"id":"1","repoTags":["registry.k8s.io/pause:3.10"]},`+
+			`{"id":"2","repoTags":["registry.k8s.io/kube-apiserver:v1.36.1"]}]}`), nil).Once()
+	mockH.EXPECT().Run(true, "/usr/bin/ctr", []string{
+		"--address", constants.ContainerServiceSock, "--namespace", cri.ContainerdNamespace,
+		"images", "export", "/tmp/i.tar", "registry.k8s.io/pause:3.10", "registry.k8s.io/kube-apiserver:v1.36.1",
+	}).Return(nil, nil).Once()
+	req.NoError(
+		performImagesExport(mockH, &v1alpha1.IkniteClusterSpec{}, utils.NewKustomizeOptions(), "/tmp/i.tar", logger))
+}
+
+func TestPerformImagesImport(t *testing.T) {
+	req := require.New(t)
+	logger := testutil.TestLogger(t)
+	mockH := mockHost.NewMockHost(t)
+
+	mockH.EXPECT().Exists("/tmp/missing.tar").Return(false, nil).Once()
+	req.ErrorContains(performImagesImport(mockH, "/tmp/missing.tar", logger), "does not exist")
+
+	mockH.EXPECT().Exists("/tmp/i.tar").Return(true, nil).Once()
+	mockH.EXPECT().Run(true, "/usr/bin/ctr", []string{
+		"--address", constants.ContainerServiceSock, "--namespace", cri.ContainerdNamespace,
+		"images", "import", "/tmp/i.tar",
+	}).Return([]byte("done"), nil).Once()
+	req.NoError(performImagesImport(mockH, "/tmp/i.tar", logger))
+}
@@ -111,6 +111,8 @@ func AddInitOtherFlags(flagSet *flag.FlagSet, initOptions *initOptions)
 // addInitWorkflowPhases adds to the workflow runner the list of phases that should be executed when running kubeadm
 // init.
 func addInitWorkflowPhases(initRunner *workflow.Runner) {
+	initRunner.AppendPhase(WrapPhase(iknitePhase.NewNotifyPhase(), ikniteApi.Started, nil))
+	initRunner.AppendPhase(WrapPhase(iknitePhase.NewAirGappedPreflightPhase(), ikniteApi.Started, nil))
 	initRunner.AppendPhase(WrapPhase(iknitePhase.NewPrepareHostPhase(), ikniteApi.Started, nil))
 	initRunner.AppendPhase(WrapPhase(iknitePhase.NewPreCleanHostPhase(), ikniteApi.Started, nil))
 	initRunner.AppendPhase(WrapPhase(phases.NewPreflightPhase(), ikniteApi.Initializing, nil))
@@ -141,11 +143,12 @@ func addInitWorkflowPhases(initRunner *workflow.Runner) {
 	initRunner.AppendPhase(
 		WrapPhase(iknitePhase.NewKustomizeClusterPhase(), ikniteApi.Stabilizing, nil),
 	)
+	initRunner.AppendPhase(WrapPhase(iknitePhase.NewForwardPhase(), ikniteApi.Stabilizing, nil))
 	initRunner.AppendPhase(WrapPhase(iknitePhase.NewServePhase(), ikniteApi.Stabilizing, nil))
-	//nolint:gocritic // Keep the following for reference
-	// initRunner.AppendPhase(WrapPhase(iknitePhase.NewProxyAPIPhase(), ikniteApi.Stabilizing, nil))
 	initRunner.AppendPhase(WrapPhase(iknitePhase.NewSetLBIPPhase(), ikniteApi.Stabilizing, nil))
 	initRunner.AppendPhase(WrapPhase(iknitePhase.NewWorkloadsPhase(), ikniteApi.Stabilizing, nil))
+	initRunner.AppendPhase(WrapPhase(iknitePhase.NewPublishHostsPhase(), ikniteApi.Stabilizing, nil))
+	initRunner.AppendPhase(WrapPhase(iknitePhase.NewKustomizeReconcilePhase(), ikniteApi.Stabilizing, nil))
 	initRunner.AppendPhase(WrapPhase(iknitePhase.NewDaemonizePhase(), ikniteApi.Stabilizing, nil))
 	//nolint:gocritic // standalone node
 	// initRunner.AppendPhase(phases.NewShowJoinCommandPhase())
@@ -189,7 +192,11 @@ func newCmdInit(
 
 			data.Logger().Info("Kubernetes version", "phase", "init", "version", data.cfg.KubernetesVersion)
 
-			return initRunner.Run(args)
+			if err = initRunner.Run(args); err != nil {
+				failWorkflow(data, err)
+				return err //nolint:wrapcheck // already wrapped by the phase
+			}
+			return nil
 		},
 		Args: cobra.NoArgs,
 		PostRunE: func(_ *cobra.Command, args []string) error {
@@ -201,32 +208,7 @@ func newCmdInit(
 			if !ok {
 				return errors.New("invalid data struct")
 			}
-			// Stop the status server if it was started
-			if shutdownErr := data.RunShutdownHooks(); shutdownErr != nil {
-				data.Logger().Warn("Failed to stop iknite status server", utils.ErrorKey, shutdownErr)
-			}
-			// Stop the kubelet process if it was started
-			kubeletProcess := data.KubeletProcess()
-			if kubeletProcess != nil {
-				err = kubeletProcess.Signal(syscall.SIGTERM)
-				if err != nil {
-					return fmt.Errorf(
-						"failed to terminate the kubelet process %d: %w",
-						kubeletProcess.Pid(),
-						err,
-					)
-				}
-				if err = kubeletProcess.Wait(); err != nil {
-					return fmt.Errorf(
-						"kubelet process %d exited with error: %w",
-						kubeletProcess.Pid(),
-						err,
-					)
-				}
-			}
-			alpine.RemovePidFile(alpineHost, k8s.KubeletName, data.Logger())
-
-			return nil
+			return stopWorkflow(data, alpineHost)
 		},
 	}
 
@@ -312,6 +294,53 @@ func newCmdInit(
 	return cmd
 }
 
+// workflowShutdownData is the data needed to clean up after the init or join workflow has run.
+type workflowShutdownData interface {
+	iknitePhase.ShutdownHookRunner
+	iknitePhase.KubeletProcessProvider
+	utils.LoggerProvider
+}
+
+// failWorkflow marks the cluster as failed and runs the shutdown hooks, so that the notifiers can report the failure
+// before the process exits.
+func failWorkflow(data *initData, err error) {
+	data.Logger().Error("Init workflow failed", utils.ErrorKey, err)
+	data.UpdateIkniteCluster(ikniteApi.Failed, data.IkniteCluster().Status.CurrentPhase, nil, nil)
+	if shutdownErr := data.RunShutdownHooks(); shutdownErr != nil {
+		data.Logger().Warn("Failed to run the shutdown hooks", utils.ErrorKey, shutdownErr)
+	}
+}
+
+// stopWorkflow runs the shutdown hooks and stops the kubelet process if it was started by the workflow.
+func stopWorkflow(data workflowShutdownData, alpineHost host.Host) error {
+	// Stop the status server if it was started
+	if shutdownErr := data.RunShutdownHooks(); shutdownErr != nil {
+		data.Logger().Warn("Failed to stop iknite status server", utils.ErrorKey, shutdownErr)
+	}
+	// Stop the kubelet process if it was started
+	kubeletProcess := data.KubeletProcess()
+	if kubeletProcess != nil {
+		err := kubeletProcess.Signal(syscall.SIGTERM)
+		if err != nil {
+			return fmt.Errorf(
+				"failed to terminate the kubelet process %d: %w",
+				kubeletProcess.Pid(),
+				err,
+			)
+		}
+		if err = kubeletProcess.Wait(); err != nil {
+			return fmt.Errorf(
+				"kubelet process %d exited with error: %w",
+				kubeletProcess.Pid(),
+				err,
+			)
+		}
+	}
+	alpine.RemovePidFile(alpineHost, k8s.KubeletName, data.Logger())
+
+	return nil
+}
+
 // skipPhaseIfExists checks if a phase with the given name exists in the list of phases and if it does, it adds it to
 // the list of phases to skip and returns true. Otherwise, it returns false.
 func skipPhaseIfExists(initPhases []workflow.Phase, skipPhases *[]string, phaseName, prefix string) bool {
@@ -544,6 +573,7 @@ func newInitData(
 		externalIP = ip.String()
 	}
 	cfg.APIServer.CertSANs = append(cfg.APIServer.CertSANs, externalIP)
+	initOptions.kustomizeOptions.Variables = config.SubstitutionVariables(&ikniteCluster.Spec, ip)
 
 	return &initData{
 		cfg:                     cfg,
@@ -616,6 +646,13 @@ func PhaseName(
 	return fmt.Sprintf("%s/%s", PhaseName(parentPhaseName, &grandParentPhases), p.Name)
 }
 
+// wrappedPhaseData is the data needed by the phases wrapped with WrapPhase. It is implemented by both the init and
+// join workflow data.
+type wrappedPhaseData interface {
+	iknitePhase.IkniteClusterUpdater
+	utils.LoggerProvider
+}
+
 //nolint:gocritic // matching kubeadm style
 func WrapPhase(
 	p workflow.Phase,
@@ -632,7 +669,7 @@ func WrapPhase(
 		oldRun := p.Run
 		newRun = func(c workflow.RunData) error {
 			// Cast the data to the expected type
-			data, ok := c.(*initData)
+			data, ok := c.(wrappedPhaseData)
 			if !ok {
 				return fmt.Errorf("phase %q invoked with an invalid data struct", p.Name)
 			}
@@ -9,6 +9,7 @@ import (
 	"net"
 	"path/filepath"
 	"strconv"
+	"sync"
 	_ "unsafe"
 
 	"github.com/spf13/viper"
@@ -24,6 +25,8 @@ import (
 
 	ikniteApi "github.com/kaweezle/iknite/pkg/apis/iknite"
 	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
+	"github.com/kaweezle/iknite/pkg/config"
+	"github.com/kaweezle/iknite/pkg/forward"
 	"github.com/kaweezle/iknite/pkg/host"
 	"github.com/kaweezle/iknite/pkg/k8s"
 	iknitePhase "github.com/kaweezle/iknite/pkg/k8s/phases/init"
@@ -61,6 +64,8 @@ type initData struct {
 	errGroup                    errgroup.Group
 	hookManager                 *utils.HookManager
 	clusterUpdateBus            utils.Bus[*v1alpha1.IkniteCluster]
+	forwardManager              *forward.Manager
+	statusMutex                 sync.Mutex
 	logger                      *slog.Logger
 	viper                       *viper.Viper
 }
@@ -351,12 +356,69 @@ func (d *initData) UpdateIkniteCluster(
 	phase string,
 	ready, unready []*v1alpha1.WorkloadState,
 ) {
+	d.statusMutex.Lock()
+	defer d.statusMutex.Unlock()
 	d.ikniteCluster.Update(state, phase, ready, unready)
 	d.ikniteCluster.Persist(d.Host(), d.Logger())
 	clusterCopy := d.ikniteCluster.DeepCopy()
 	d.clusterUpdateBus.Publish(clusterCopy)
 }
 
+// UpdateKustomizationState implements [init.KustomizationStateUpdater].
+func (d *initData) UpdateKustomizationState(state *v1alpha1.KustomizationState) {
+	d.statusMutex.Lock()
+	defer d.statusMutex.Unlock()
+	d.ikniteCluster.Status.Kustomization = *state
+	d.ikniteCluster.Persist(d.Host(), d.Logger())
+	clusterCopy := d.ikniteCluster.DeepCopy()
+	d.clusterUpdateBus.Publish(clusterCopy)
+}
+
+// UpdateMDNSState implements [init.MDNSStateUpdater].
+func (d *initData) UpdateMDNSState(state *v1alpha1.MDNSState) {
+	d.statusMutex.Lock()
+	defer d.statusMutex.Unlock()
+	d.ikniteCluster.Status.MDNS = *state
+	d.ikniteCluster.Persist(d.Host(), d.Logger())
+	clusterCopy := d.ikniteCluster.DeepCopy()
+	d.clusterUpdateBus.Publish(clusterCopy)
+}
+
+// UpdateLoadBalancerState implements [init.LoadBalancerStateUpdater].
+func (d *initData) UpdateLoadBalancerState(state *v1alpha1.LoadBalancerState) {
+	d.statusMutex.Lock()
+	defer d.statusMutex.Unlock()
+	state.DeepCopyInto(&d.ikniteCluster.Status.LoadBalancer)
+	d.ikniteCluster.Persist(d.Host(), d.Logger())
+	clusterCopy := d.ikniteCluster.DeepCopy()
+	d.clusterUpdateBus.Publish(clusterCopy)
+}
+
+// UpdateForwardRules implements [init.ForwardRulesUpdater].
+func (d *initData) UpdateForwardRules(rules []v1alpha1.ForwardRule) {
+	d.statusMutex.Lock()
+	defer d.statusMutex.Unlock()
+	d.ikniteCluster.Spec.Forwards = rules
+	d.ikniteCluster.Persist(d.Host(), d.Logger())
+	clusterCopy := d.ikniteCluster.DeepCopy()
+	d.clusterUpdateBus.Publish(clusterCopy)
+}
+
+// LoadIkniteClusterSpec implements [init.IkniteClusterSpecLoader]. It reads the configuration file again.
+func (d *initData) LoadIkniteClusterSpec() (*v1alpha1.IkniteClusterSpec, error) {
+	return config.LoadIkniteConfig(d.viper) //nolint:wrapcheck // already wrapped
+}
+
+// ForwardManager implements [init.ForwardManagerProvider].
+func (d *initData) ForwardManager() *forward.Manager {
+	return d.forwardManager
+}
+
+// SetForwardManager implements [init.ForwardManagerHolder].
+func (d *initData) SetForwardManager(manager *forward.Manager) {
+	d.forwardManager = manager
+}
+
 func (d *initData) ErrGroup() *errgroup.Group {
 	return &d.errGroup
 }
@@ -369,9 +431,13 @@ func (d *initData) RunShutdownHooks() error {
 	return d.hookManager.Run() //nolint:wrapcheck // on-purpose
 }
 
+// clusterListenerBuffer is the number of cluster updates a listener can be late of before missing some. The
+// notifiers need all the state changes.
+const clusterListenerBuffer = 16
+
 // RegisterIkniteClusterListener implements [init.IkniteInitData].
 func (d *initData) RegisterIkniteClusterListener() (<-chan *v1alpha1.IkniteCluster, func()) {
-	return d.clusterUpdateBus.Subscribe(1)
+	return d.clusterUpdateBus.Subscribe(clusterListenerBuffer)
 }
 
 func (d *initData) Logger() *slog.Logger {
@@ -369,7 +369,7 @@ func TestRunInitCmd_Success(t *testing.T) {
 	req.NoError(err)
 }
 
-func TestAddInitWorkflowPhases_RegistersProxyAPI(t *testing.T) {
+func TestAddInitWorkflowPhases_RegistersForward(t *testing.T) {
 	t.Parallel()
 	req := require.New(t)
 
@@ -381,16 +381,13 @@ func TestAddInitWorkflowPhases_RegistersProxyAPI(t *testing.T) {
 		phaseNames = append(phaseNames, phase.Name)
 	}
 
+	forwardIndex := slices.Index(phaseNames, "forward")
 	serveIndex := slices.Index(phaseNames, "serve")
-	proxyIndex := slices.Index(phaseNames, "proxy-api")
-	workloadsIndex := slices.Index(phaseNames, "workloads")
 
-	req.NotEqual(-1, serveIndex)
-	req.Equal(-1, proxyIndex)
-	req.NotEqual(-1, workloadsIndex)
-	//nolint:gocritic // Currently not implemented
-	// req.Equal(serveIndex+1, proxyIndex)
-	// req.Equal(proxyIndex+1, workloadsIndex)
+	req.NotEqual(-1, forwardIndex)
+	req.Equal(-1, slices.Index(phaseNames, "proxy-api"))
+	// The forward manager must exist when the status server starts
+	req.Equal(forwardIndex+1, serveIndex)
 }
 
 func TestAddInitWorkflowPhases_RegistersSetLBIP(t *testing.T) {
@@ -415,3 +412,17 @@ func TestAddInitWorkflowPhases_RegistersSetLBIP(t *testing.T) {
 	req.Equal(serveIndex+1, setLBIPIndex)
 	req.Equal(setLBIPIndex+1, workloadsIndex)
 }
+
+func TestAddInitWorkflowPhases_RegistersAirGappedPreflight(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	initRunner := workflow.NewRunner()
+	addInitWorkflowPhases(initRunner)
+
+	req.NotEmpty(initRunner.Phases)
+	// The notifiers are started first to report the failures of all the phases
+	req.Equal("notify", initRunner.Phases[0].Name)
+	req.Equal("air-gapped-preflight", initRunner.Phases[1].Name)
+	req.Equal("prepare-host", initRunner.Phases[2].Name)
+}
@@ -0,0 +1,380 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+// cSpell:words kubeadmapiv1 apimachinery
+// cSpell: disable
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	kubeadmScheme "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/scheme"
+	kubeadmApiV1 "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/v1beta4"
+	"k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm/validation"
+	"k8s.io/kubernetes/cmd/kubeadm/app/cmd/options"
+	phases "k8s.io/kubernetes/cmd/kubeadm/app/cmd/phases/join"
+	"k8s.io/kubernetes/cmd/kubeadm/app/cmd/phases/workflow"
+	cmdUtil "k8s.io/kubernetes/cmd/kubeadm/app/cmd/util"
+	kubeadmConstants "k8s.io/kubernetes/cmd/kubeadm/app/constants"
+	configUtil "k8s.io/kubernetes/cmd/kubeadm/app/util/config"
+
+	ikniteApi "github.com/kaweezle/iknite/pkg/apis/iknite"
+	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
+	"github.com/kaweezle/iknite/pkg/cmd/util"
+	"github.com/kaweezle/iknite/pkg/config"
+	"github.com/kaweezle/iknite/pkg/host"
+	iknitePhase "github.com/kaweezle/iknite/pkg/k8s/phases/init"
+	ikniteJoinPhase "github.com/kaweezle/iknite/pkg/k8s/phases/join"
+	"github.com/kaweezle/iknite/pkg/utils"
+)
+
+// cSpell: enable
+
+// joinOptions defines all the options exposed via flags by iknite join. Only worker nodes can join an iknite
+// cluster, so the control plane related options of kubeadm join are not exposed.
+//
+//nolint:govet // Data structure alignment matches kubeadm
+type joinOptions struct {
+	cfgPath               string
+	token                 string
+	ignorePreflightErrors []string
+	externalCfg           *kubeadmApiV1.JoinConfiguration
+	patchesDir            string
+	dryRun                bool
+	skipCRIDetect         bool
+	ikniteCfg             *v1alpha1.IkniteClusterSpec
+}
+
+// function hook used for testing purposes to mock the addition of phases to the workflow runner in join command.
+var addJoinWorkflowPhasesFn = addJoinWorkflowPhases
+
+// addJoinWorkflowPhases adds to the workflow runner the list of phases that should be executed when joining a
+// worker node.
+func addJoinWorkflowPhases(joinRunner *workflow.Runner) {
+	joinRunner.AppendPhase(WrapPhase(iknitePhase.NewPrepareHostPhase(), ikniteApi.Started, nil))
+	joinRunner.AppendPhase(WrapPhase(iknitePhase.NewPreCleanHostPhase(), ikniteApi.Started, nil))
+	joinRunner.AppendPhase(WrapPhase(phases.NewPreflightPhase(), ikniteApi.Initializing, nil))
+	joinRunner.AppendPhase(WrapPhase(ikniteJoinPhase.NewKubeletStartPhase(), ikniteApi.Initializing, nil))
+	joinRunner.AppendPhase(WrapPhase(phases.NewKubeletWaitBootstrapPhase(), ikniteApi.Initializing, nil))
+	joinRunner.AppendPhase(WrapPhase(iknitePhase.NewDaemonizePhase(), ikniteApi.Running, nil))
+}
+
+// addJoinFlags adds the worker node join flags to the specified flagset.
+func addJoinFlags(flagSet *flag.FlagSet, joinOptions *joinOptions) {
+	cfg := joinOptions.externalCfg
+	flagSet.StringVar(
+		&cfg.NodeRegistration.Name, options.NodeName, cfg.NodeRegistration.Name,
+		`Specify the node name.`,
+	)
+	// adds bootstrap token specific discovery flags to the specified flagset
+	flagSet.StringVar(
+		&cfg.Discovery.BootstrapToken.Token, options.TokenDiscovery, "",
+		"For token-based discovery, the token used to validate cluster information fetched from the API server.",
+	)
+	flagSet.StringSliceVar(
+		&cfg.Discovery.BootstrapToken.CACertHashes, options.TokenDiscoveryCAHash, []string{},
+		"For token-based discovery, validate that the root CA public key matches this hash (format: \"<type>:<value>\").",
+	)
+	flagSet.BoolVar(
+		&cfg.Discovery.BootstrapToken.UnsafeSkipCAVerification, options.TokenDiscoverySkipCAHash, false,
+		"For token-based discovery, allow joining without --discovery-token-ca-cert-hash pinning.",
+	)
+	// discovery via kube config file flag
+	flagSet.StringVar(
+		&cfg.Discovery.File.KubeConfigPath, options.FileDiscovery, "",
+		"For file-based discovery, a file or URL from which to load cluster information.",
+	)
+	flagSet.StringVar(
+		&cfg.Discovery.TLSBootstrapToken, options.TLSBootstrapToken, cfg.Discovery.TLSBootstrapToken,
+		`Specify the token used to temporarily authenticate with the Kubernetes Control Plane while joining the node.`,
+	)
+	cmdUtil.AddCRISocketFlag(flagSet, &cfg.NodeRegistration.CRISocket)
+
+	options.AddConfigFlag(flagSet, &joinOptions.cfgPath)
+	options.AddIgnorePreflightErrorsFlag(flagSet, &joinOptions.ignorePreflightErrors)
+	flagSet.StringVar(
+		&joinOptions.token, options.TokenStr, "",
+		"Use this token for both discovery-token and tls-bootstrap-token when those values are not provided.",
+	)
+	flagSet.BoolVar(
+		&joinOptions.dryRun, options.DryRun, joinOptions.dryRun,
+		"Don't apply any changes; just output what would be done.",
+	)
+	options.AddPatchesFlag(flagSet, &joinOptions.patchesDir)
+}
+
+// newJoinOptions returns a struct ready for being used for creating cmd join flags.
+func newJoinOptions() *joinOptions {
+	// initialize the public kubeadm config API by applying defaults
+	externalCfg := &kubeadmApiV1.JoinConfiguration{}
+
+	// Add optional config objects to host flags.
+	// un-set objects will be cleaned up afterwards (into newJoinData func)
+	externalCfg.Discovery.File = &kubeadmApiV1.FileDiscovery{}
+	externalCfg.Discovery.BootstrapToken = &kubeadmApiV1.BootstrapTokenDiscovery{}
+
+	// Apply defaults
+	kubeadmScheme.Scheme.Default(externalCfg)
+
+	ikniteConfig := &v1alpha1.IkniteClusterSpec{}
+	v1alpha1.SetDefaults_IkniteClusterSpec(ikniteConfig)
+
+	return &joinOptions{
+		externalCfg:           externalCfg,
+		ikniteCfg:             ikniteConfig,
+		ignorePreflightErrors: []string{"all"}, // Iknite: the host is prepared by the prepare-host phase
+	}
+}
+
+// newJoinData returns a new joinData struct to be used for the execution of the iknite join workflow.
+//
+// This func takes care of validating joinOptions passed to the command, and then it converts options into the
+// internal JoinConfiguration type that is used as input all the phases in the iknite join workflow.
+//
+//nolint:gocyclo // This comes from kubeadm
+func newJoinData(
+	cmd *cobra.Command,
+	args []string,
+	opt *joinOptions,
+	out io.Writer,
+	alpineHost host.Host,
+) (*joinData, error) {
+	// Validate the mixed arguments with --config and return early on errors
+	if err := validation.ValidateMixedArguments(cmd.Flags()); err != nil {
+		return nil, fmt.Errorf("failed to validate mixed arguments: %w", err)
+	}
+
+	// Retrieve information from environment variables and apply them to the configuration
+	if err := config.DecodeIkniteConfig(opt.ikniteCfg); err != nil {
+		return nil, fmt.Errorf("failed to decode iknite config: %w", err)
+	}
+
+	ikniteCluster := &v1alpha1.IkniteCluster{}
+	ikniteCluster.TypeMeta = metaV1.TypeMeta{
+		Kind:       ikniteApi.IkniteClusterKind,
+		APIVersion: v1alpha1.SchemeGroupVersion.String(),
+	}
+	kubeadmScheme.Scheme.Default(ikniteCluster)
+	ikniteCluster.Spec = *opt.ikniteCfg
+
+	// Re-apply defaults to the public kubeadm API (this will set only values not exposed/not set as a flags)
+	kubeadmScheme.Scheme.Default(opt.externalCfg)
+
+	// if a token is provided, use this value for both discovery-token and tls-bootstrap-token when those values are
+	// not provided
+	if opt.token != "" {
+		if opt.externalCfg.Discovery.TLSBootstrapToken == "" {
+			opt.externalCfg.Discovery.TLSBootstrapToken = opt.token
+		}
+		if opt.externalCfg.Discovery.BootstrapToken.Token == "" {
+			opt.externalCfg.Discovery.BootstrapToken.Token = opt.token
+		}
+	}
+
+	// if a file or URL from which to load cluster information was not provided, unset the Discovery.File object
+	if opt.externalCfg.Discovery.File != nil && opt.externalCfg.Discovery.File.KubeConfigPath == "" {
+		opt.externalCfg.Discovery.File = nil
+	}
+
+	// if an APIServerEndpoint from which to retrieve cluster information was not provided, unset the
+	// Discovery.BootstrapToken object
+	if len(args) == 0 {
+		opt.externalCfg.Discovery.BootstrapToken = nil
+	} else if opt.externalCfg.Discovery.BootstrapToken != nil {
+		opt.externalCfg.Discovery.BootstrapToken.APIServerEndpoint = args[0]
+	}
+
+	// in case the command doesn't have flags for discovery (phases subcommands), use the admin.conf of the node if
+	// present.
+	adminKubeConfigPath := kubeadmConstants.GetAdminKubeConfigPath()
+	if cmd.Flags().Lookup(options.FileDiscovery) == nil {
+		if _, err := os.Stat(adminKubeConfigPath); os.IsNotExist(err) {
+			return nil, fmt.Errorf("file %s does not exist. Please run the phase from 'iknite join'", adminKubeConfigPath)
+		}
+		opt.externalCfg.Discovery.File = &kubeadmApiV1.FileDiscovery{KubeConfigPath: adminKubeConfigPath}
+		opt.externalCfg.Discovery.BootstrapToken = nil
+	}
+
+	cfg, err := configUtil.LoadOrDefaultJoinConfiguration(
+		opt.cfgPath,
+		opt.externalCfg,
+		configUtil.LoadOrDefaultConfigurationOptions{
+			SkipCRIDetect: opt.skipCRIDetect,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load or default join configuration: %w", err)
+	}
+	if cfg.ControlPlane != nil {
+		return nil, errors.New("iknite only supports joining worker nodes")
+	}
+
+	ignorePreflightErrorsSet, err := validation.ValidateIgnorePreflightErrors(
+		opt.ignorePreflightErrors,
+		cfg.NodeRegistration.IgnorePreflightErrors,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate ignore preflight errors: %w", err)
+	}
+	// Also set the union of pre-flight errors to JoinConfiguration, to provide a consistent view of the runtime
+	// configuration:
+	cfg.NodeRegistration.IgnorePreflightErrors = sets.List(ignorePreflightErrorsSet)
+
+	// override node name and CRI socket from the command line opt
+	if opt.externalCfg.NodeRegistration.Name != "" {
+		cfg.NodeRegistration.Name = opt.externalCfg.NodeRegistration.Name
+	}
+	if opt.externalCfg.NodeRegistration.CRISocket != "" {
+		cfg.NodeRegistration.CRISocket = opt.externalCfg.NodeRegistration.CRISocket
+	}
+
+	// Apply ikniteCluster spec to the internal JoinConfiguration
+	config.ApplyIkniteClusterSpecToJoinConfiguration(&ikniteCluster.Spec, cfg)
+
+	// If dry running creates a temporary directory for saving kubeadm generated files.
+	dryRunDir := ""
+	if opt.dryRun || cfg.DryRun {
+		if dryRunDir, err = kubeadmConstants.CreateTempDir(os.Getenv(kubeadmConstants.EnvVarJoinDryRunDir),
+			"iknite-join-dryrun"); err != nil {
+			return nil, fmt.Errorf("couldn't create a temporary directory: %w", err)
+		}
+	}
+
+	ctx := cmd.Context()
+	if ctx == nil {
+		return nil, errors.New("command context is nil")
+	}
+	logger := util.LoggerFromContext(ctx)
+
+	return &joinData{
+		cfg: cfg,
+		dryRun: cmdUtil.ValueFromFlagsOrConfig( //nolint:errcheck,forcetypeassert // default value is false
+			cmd.Flags(), options.DryRun, cfg.DryRun, opt.dryRun).(bool),
+		ignorePreflightErrors: ignorePreflightErrorsSet,
+		outputWriter:          out,
+		patchesDir:            opt.patchesDir,
+		dryRunDir:             dryRunDir,
+		ikniteCluster:         ikniteCluster,
+		ctx:                   ctx,
+		alpineHost:            alpineHost,
+		hookManager:           utils.NewHookManager(logger),
+		logger:                logger,
+	}, nil
+}
+
+// newCmdJoin returns the "iknite join" command.
+//
+// NB. joinOptions is exposed as parameter for allowing unit testing of the newJoinData method, that implements all
+// the command options validation logic.
+func newCmdJoin(
+	out io.Writer,
+	joinOptions *joinOptions,
+	joinRunner *workflow.Runner,
+	alpineHost host.Host,
+) *cobra.Command {
+	if alpineHost == nil {
+		alpineHost = host.NewDefaultHost()
+	}
+	if joinOptions == nil {
+		joinOptions = newJoinOptions()
+	}
+	if joinRunner == nil {
+		joinRunner = workflow.NewRunner()
+	}
+
+	cmd := &cobra.Command{
+		Use:   "join [api-server-endpoint]",
+		Short: "Run this on any Alpine machine you wish to join to an existing iknite cluster as a worker",
+		Long: `Joins this machine to an existing iknite cluster as a worker node.
+
+The command prepares the host, performs the kubeadm discovery and TLS bootstrap,
+and then keeps the kubelet running in the foreground, like 'iknite init' does
+for the control plane. The state of the worker is kept in its own status file.
+
+The join command can be obtained on the control plane with 'iknite token create'.
+Make sure the worker uses its own IP address (--ip) and domain name.`,
+		Example: `> iknite join iknite.local:6443 --token abcdef.0123456789abcdef \
+    --discovery-token-ca-cert-hash sha256:1234..cdef --ip 192.168.99.3`,
+		RunE: func(_ *cobra.Command, args []string) error {
+			c, err := joinRunner.InitData(args)
+			if err != nil {
+				return fmt.Errorf("failed to initialize join data: %w", err)
+			}
+
+			data, ok := c.(*joinData)
+			if !ok {
+				return errors.New("invalid data struct")
+			}
+
+			data.Logger().Info("Joining the cluster as a worker node", "phase", "join")
+
+			return joinRunner.Run(args)
+		},
+		// We accept the control-plane location as an optional positional argument
+		Args: cobra.MaximumNArgs(1),
+		PostRunE: func(_ *cobra.Command, args []string) error {
+			c, err := joinRunner.InitData(args)
+			if err != nil {
+				return fmt.Errorf("failed to initialize join data in post-run: %w", err)
+			}
+			data, ok := c.(*joinData)
+			if !ok {
+				return errors.New("invalid data struct")
+			}
+			return stopWorkflow(data, alpineHost)
+		},
+	}
+
+	addJoinFlags(cmd.Flags(), joinOptions)
+	config.AddIkniteClusterFlags(cmd.Flags(), joinOptions.ikniteCfg)
+
+	// initialize the workflow runner with the list of phases
+	addJoinWorkflowPhasesFn(joinRunner)
+
+	// sets the data builder function, that will be used by the runner
+	// both when running the entire workflow or single phases
+	joinRunner.SetDataInitializer(
+		func(cmd *cobra.Command, args []string) (workflow.RunData, error) {
+			if cmd.Flags().Lookup(options.NodeCRISocket) == nil {
+				// skip CRI detection
+				// assume that the command execution does not depend on CRISocket when --cri-socket flag is not set
+				joinOptions.skipCRIDetect = true
+			}
+			data, err := newJoinData(cmd, args, joinOptions, out, alpineHost)
+			if err != nil {
+				return nil, err
+			}
+			// If the flag for skipping phases was empty, use the values from config
+			if len(joinRunner.Options.SkipPhases) == 0 {
+				joinRunner.Options.SkipPhases = data.cfg.SkipPhases
+			}
+			return data, nil
+		},
+	)
+
+	// binds the Runner to iknite join command by altering
+	// command help, adding --skip-phases flag and by adding phases subcommands
+	joinRunner.BindToCommand(cmd)
+
+	return cmd
+}
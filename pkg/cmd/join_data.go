@@ -0,0 +1,271 @@
+// cSpell: words clientcmdapi clientcmd apimachinery wrapcheck kubeconfigutil
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	_ "unsafe"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	clientset "k8s.io/client-go/kubernetes"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	kubeadmApi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
+	kubeadmConstants "k8s.io/kubernetes/cmd/kubeadm/app/constants"
+	"k8s.io/kubernetes/cmd/kubeadm/app/discovery"
+	"k8s.io/kubernetes/cmd/kubeadm/app/util/apiclient"
+
+	ikniteApi "github.com/kaweezle/iknite/pkg/apis/iknite"
+	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
+	"github.com/kaweezle/iknite/pkg/host"
+	"github.com/kaweezle/iknite/pkg/k8s"
+	ikniteJoinPhase "github.com/kaweezle/iknite/pkg/k8s/phases/join"
+	"github.com/kaweezle/iknite/pkg/utils"
+)
+
+// joinData defines all the runtime information used when running the iknite join workflow;
+// this data is shared across all the phases that are included in the workflow.
+//
+//nolint:govet // Data structure alignment matches kubeadm
+type joinData struct {
+	cfg                   *kubeadmApi.JoinConfiguration
+	initCfg               *kubeadmApi.InitConfiguration
+	tlsBootstrapCfg       *clientcmdapi.Config
+	client                clientset.Interface
+	ignorePreflightErrors sets.Set[string]
+	outputWriter          io.Writer
+	patchesDir            string
+	dryRun                bool
+	dryRunDir             string
+	ikniteCluster         *v1alpha1.IkniteCluster
+	kubeletProcess        host.Process
+	ctx                   context.Context //nolint:containedctx // passed around but not stored
+	alpineHost            host.Host
+	hookManager           *utils.HookManager
+	clusterUpdateBus      utils.Bus[*v1alpha1.IkniteCluster]
+	logger                *slog.Logger
+}
+
+// compile-time assert that the local data object satisfies the phases data interface.
+var _ ikniteJoinPhase.IkniteJoinData = (*joinData)(nil)
+
+// testHooks wrap external dependency calls so tests can inject failures and success paths.
+var (
+	discoverTLSBootstrapCfg = discovery.For
+)
+
+//go:linkname fetchInitConfigurationFromJoinConfiguration k8s.io/kubernetes/cmd/kubeadm/app/cmd.fetchInitConfigurationFromJoinConfiguration
+func fetchInitConfigurationFromJoinConfiguration(
+	cfg *kubeadmApi.JoinConfiguration,
+	client clientset.Interface,
+	tlsBootstrapCfg *clientcmdapi.Config,
+) (*kubeadmApi.InitConfiguration, error)
+
+// CertificateKey returns the key used to encrypt the certs. Worker nodes don't download certificates.
+func (j *joinData) CertificateKey() string {
+	return ""
+}
+
+// Cfg returns the JoinConfiguration.
+func (j *joinData) Cfg() *kubeadmApi.JoinConfiguration {
+	return j.cfg
+}
+
+// DryRun returns the DryRun flag.
+func (j *joinData) DryRun() bool {
+	return j.dryRun
+}
+
+// KubeConfigDir returns the Kubernetes configuration directory or the temporary directory if DryRun is true.
+func (j *joinData) KubeConfigDir() string {
+	if j.dryRun {
+		return j.dryRunDir
+	}
+	return kubeadmConstants.KubernetesDir
+}
+
+// KubeletDir returns the kubelet configuration directory or the temporary directory if DryRun is true.
+func (j *joinData) KubeletDir() string {
+	if j.dryRun {
+		return j.dryRunDir
+	}
+	return kubeadmConstants.KubeletRunDirectory
+}
+
+// ManifestDir returns the path where manifest should be stored or the temporary directory if DryRun is true.
+func (j *joinData) ManifestDir() string {
+	if j.dryRun {
+		return j.dryRunDir
+	}
+	return kubeadmConstants.GetStaticPodDirectory()
+}
+
+// CertificateWriteDir returns the path where certs should be stored or the temporary directory if DryRun is true.
+func (j *joinData) CertificateWriteDir() string {
+	if j.dryRun {
+		return j.dryRunDir
+	}
+	return filepath.Dir(j.cfg.CACertPath)
+}
+
+// TLSBootstrapCfg returns the cluster-info (kubeconfig).
+func (j *joinData) TLSBootstrapCfg() (*clientcmdapi.Config, error) {
+	if j.tlsBootstrapCfg != nil {
+		return j.tlsBootstrapCfg, nil
+	}
+
+	var client clientset.Interface
+	if j.dryRun {
+		var err error
+		client, err = j.Client()
+		if err != nil {
+			return nil, fmt.Errorf("could not create a client for TLS bootstrap: %w", err)
+		}
+	}
+	j.logger.Debug("Discovering cluster-info", "phase", "preflight")
+	tlsBootstrapCfg, err := discoverTLSBootstrapCfg(client, j.cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover cluster-info: %w", err)
+	}
+	j.tlsBootstrapCfg = tlsBootstrapCfg
+	return tlsBootstrapCfg, nil
+}
+
+// InitCfg returns the InitConfiguration.
+func (j *joinData) InitCfg() (*kubeadmApi.InitConfiguration, error) {
+	if j.initCfg != nil {
+		return j.initCfg, nil
+	}
+	if _, err := j.TLSBootstrapCfg(); err != nil {
+		return nil, err
+	}
+	j.logger.Debug("Fetching init configuration", "phase", "preflight")
+	var client clientset.Interface
+	if j.dryRun {
+		var err error
+		client, err = j.Client()
+		if err != nil {
+			return nil, fmt.Errorf("could not get dry-run client for fetching InitConfiguration: %w", err)
+		}
+	}
+	initCfg, err := fetchInitConfigurationFromJoinConfiguration(j.cfg, client, j.tlsBootstrapCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the init configuration: %w", err)
+	}
+	j.initCfg = initCfg
+	return initCfg, nil
+}
+
+// Client returns the Client for accessing the cluster with the identity defined in admin.conf.
+func (j *joinData) Client() (clientset.Interface, error) {
+	if j.client != nil {
+		return j.client, nil
+	}
+	pathAdmin := filepath.Join(j.KubeConfigDir(), kubeadmConstants.AdminKubeConfigFileName)
+
+	if j.dryRun {
+		dryRun := apiclient.NewDryRun()
+		if j.tlsBootstrapCfg != nil {
+			if err := dryRun.WithKubeConfig(j.tlsBootstrapCfg); err != nil {
+				return nil, fmt.Errorf("failed to create dry-run client: %w", err)
+			}
+		}
+		dryRun.WithDefaultMarshalFunction().
+			WithWriter(os.Stdout).
+			AppendReactor(dryRun.GetClusterInfoReactor()).
+			AppendReactor(dryRun.GetKubeadmConfigReactor()).
+			AppendReactor(dryRun.GetKubeProxyConfigReactor()).
+			AppendReactor(dryRun.GetKubeletConfigReactor()).
+			AppendReactor(dryRun.GetNodeReactor()).
+			AppendReactor(dryRun.PatchNodeReactor())
+
+		j.client = dryRun.FakeClient()
+		return j.client, nil
+	}
+
+	client, err := k8s.ClientSetFromFile(j.Host(), pathAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create Kubernetes client: %w", err)
+	}
+	j.client = client
+	return client, nil
+}
+
+// WaitControlPlaneClient is only relevant when joining a control plane node, which iknite doesn't support.
+func (j *joinData) WaitControlPlaneClient() (clientset.Interface, error) {
+	return nil, errors.New("iknite only supports joining worker nodes")
+}
+
+// IgnorePreflightErrors returns the list of preflight errors to ignore.
+func (j *joinData) IgnorePreflightErrors() sets.Set[string] {
+	return j.ignorePreflightErrors
+}
+
+// OutputWriter returns the io.Writer used to write messages such as the "join done" message.
+func (j *joinData) OutputWriter() io.Writer {
+	return j.outputWriter
+}
+
+// PatchesDir returns the folder where patches for components are stored.
+func (j *joinData) PatchesDir() string {
+	// If provided, make the flag value override the one in config.
+	if j.patchesDir != "" {
+		return j.patchesDir
+	}
+	if j.cfg.Patches != nil {
+		return j.cfg.Patches.Directory
+	}
+	return ""
+}
+
+func (j *joinData) IkniteCluster() *v1alpha1.IkniteCluster {
+	return j.ikniteCluster
+}
+
+func (j *joinData) UpdateIkniteCluster(
+	state ikniteApi.ClusterState,
+	phase string,
+	ready, unready []*v1alpha1.WorkloadState,
+) {
+	j.ikniteCluster.Update(state, phase, ready, unready)
+	j.ikniteCluster.Persist(j.Host(), j.Logger())
+	clusterCopy := j.ikniteCluster.DeepCopy()
+	j.clusterUpdateBus.Publish(clusterCopy)
+}
+
+// RegisterIkniteClusterListener implements [join.IkniteJoinData].
+func (j *joinData) RegisterIkniteClusterListener() (<-chan *v1alpha1.IkniteCluster, func()) {
+	return j.clusterUpdateBus.Subscribe(1)
+}
+
+func (j *joinData) KubeletProcess() host.Process {
+	return j.kubeletProcess
+}
+
+func (j *joinData) SetKubeletProcess(process host.Process) {
+	j.kubeletProcess = process
+}
+
+func (j *joinData) Context() context.Context {
+	return j.ctx
+}
+
+func (j *joinData) Host() host.Host {
+	return j.alpineHost
+}
+
+func (j *joinData) RegisterShutdownHook(name string, fn func() error) {
+	j.hookManager.Register(name, fn)
+}
+
+func (j *joinData) RunShutdownHooks() error {
+	return j.hookManager.Run() //nolint:wrapcheck // on-purpose
+}
+
+func (j *joinData) Logger() *slog.Logger {
+	return j.logger
+}
@@ -0,0 +1,240 @@
+// cSpell: words paralleltest clientcmdapi
+//
+//nolint:paralleltest // These tests modify global state and cannot be run in parallel
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"syscall"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/sets"
+	clientset "k8s.io/client-go/kubernetes"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	kubeadmApi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
+	"k8s.io/kubernetes/cmd/kubeadm/app/cmd/options"
+	"k8s.io/kubernetes/cmd/kubeadm/app/cmd/phases/workflow"
+	kubeadmConstants "k8s.io/kubernetes/cmd/kubeadm/app/constants"
+	"k8s.io/kubernetes/cmd/kubeadm/app/discovery"
+
+	mockHost "github.com/kaweezle/iknite/mocks/pkg/host"
+	ikniteApi "github.com/kaweezle/iknite/pkg/apis/iknite"
+	"github.com/kaweezle/iknite/pkg/cmd/util"
+	"github.com/kaweezle/iknite/pkg/host"
+	k8sJoin "github.com/kaweezle/iknite/pkg/k8s/phases/join"
+	"github.com/kaweezle/iknite/pkg/testutil"
+)
+
+func TestNewJoinData(t *testing.T) {
+	tests := []struct {
+		customizeOptions func(t *testing.T, cmd *cobra.Command, opts *joinOptions)
+		expectations     func(req *require.Assertions, data *joinData)
+		name             string
+		wantErr          string
+		args             []string
+	}{
+		{
+			name: "token discovery",
+			args: []string{"iknite.local:6443"},
+			customizeOptions: func(t *testing.T, cmd *cobra.Command, _ *joinOptions) {
+				t.Helper()
+				flags := cmd.Flags()
+				require.NoError(t, flags.Set(options.TokenStr, "abcdef.0123456789abcdef"))
+				require.NoError(t, flags.Set(options.TokenDiscoverySkipCAHash, "true"))
+				require.NoError(t, flags.Set(options.NodeName, "worker"))
+				require.NoError(t, flags.Set("ip", "192.168.99.3"))
+			},
+			expectations: func(req *require.Assertions, data *joinData) {
+				req.NotNil(data)
+				req.NotNil(data.Host())
+				req.False(data.DryRun())
+				req.Empty(data.CertificateKey())
+				req.Equal(sets.New("all"), data.IgnorePreflightErrors())
+				cfg := data.Cfg()
+				req.Nil(cfg.ControlPlane, "only worker nodes can join")
+				req.Equal("worker", cfg.NodeRegistration.Name)
+				req.Equal("abcdef.0123456789abcdef", cfg.Discovery.TLSBootstrapToken)
+				req.NotNil(cfg.Discovery.BootstrapToken)
+				req.Equal("iknite.local:6443", cfg.Discovery.BootstrapToken.APIServerEndpoint)
+				req.Equal("abcdef.0123456789abcdef", cfg.Discovery.BootstrapToken.Token)
+				req.Nil(cfg.Discovery.File)
+				req.Contains(cfg.NodeRegistration.KubeletExtraArgs[len(cfg.NodeRegistration.KubeletExtraArgs)-1].Value,
+					"192.168.99.3")
+				req.Equal("192.168.99.3", data.IkniteCluster().Spec.Ip.String())
+				req.Equal(kubeadmConstants.KubernetesDir, data.KubeConfigDir())
+				req.Equal(kubeadmConstants.KubeletRunDirectory, data.KubeletDir())
+				req.Equal(kubeadmConstants.GetStaticPodDirectory(), data.ManifestDir())
+				req.Empty(data.PatchesDir())
+				_, err := data.WaitControlPlaneClient()
+				req.Error(err)
+			},
+		},
+		{
+			name: "dry run",
+			args: []string{"iknite.local:6443"},
+			customizeOptions: func(t *testing.T, cmd *cobra.Command, _ *joinOptions) {
+				t.Helper()
+				flags := cmd.Flags()
+				require.NoError(t, flags.Set(options.TokenStr, "abcdef.0123456789abcdef"))
+				require.NoError(t, flags.Set(options.TokenDiscoverySkipCAHash, "true"))
+				require.NoError(t, flags.Set(options.DryRun, "true"))
+				require.NoError(t, flags.Set(options.Patches, "/tmp/patches"))
+				t.Setenv(kubeadmConstants.EnvVarJoinDryRunDir, t.TempDir())
+			},
+			expectations: func(req *require.Assertions, data *joinData) {
+				req.True(data.DryRun())
+				req.NotEmpty(data.dryRunDir)
+				req.Equal(data.dryRunDir, data.KubeConfigDir())
+				req.Equal(data.dryRunDir, data.KubeletDir())
+				req.Equal(data.dryRunDir, data.ManifestDir())
+				req.Equal(data.dryRunDir, data.CertificateWriteDir())
+				req.Equal("/tmp/patches", data.PatchesDir())
+				client, err := data.Client()
+				req.NoError(err)
+				req.NotNil(client)
+			},
+		},
+		{
+			name:    "no discovery",
+			wantErr: "failed to load or default join configuration",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := require.New(t)
+			opts := newJoinOptions()
+			joinRunner := workflow.NewRunner()
+			var output bytes.Buffer
+
+			cmd := newCmdJoin(&output, opts, joinRunner, host.NewDefaultHost())
+			cmd.SetContext(util.WithCmdInterface(t.Context(), util.NewCmdInterface(nil)))
+			if tt.customizeOptions != nil {
+				tt.customizeOptions(t, cmd, opts)
+			}
+
+			d, err := joinRunner.InitData(tt.args)
+
+			if tt.wantErr != "" {
+				req.Error(err)
+				req.Contains(err.Error(), tt.wantErr)
+				return
+			}
+			req.NoError(err)
+			data, ok := d.(*joinData)
+			req.True(ok, "InitData should be of type *joinData")
+			if tt.expectations != nil {
+				tt.expectations(req, data)
+			}
+		})
+	}
+}
+
+func TestJoinDataInitCfg_DiscoveryError(t *testing.T) {
+	req := require.New(t)
+
+	discoverTLSBootstrapCfg = func(
+		_ clientset.Interface,
+		_ *kubeadmApi.JoinConfiguration,
+	) (*clientcmdapi.Config, error) {
+		return nil, errors.New("discovery error")
+	}
+	defer func() {
+		discoverTLSBootstrapCfg = discovery.For
+	}()
+
+	data := &joinData{
+		cfg:    &kubeadmApi.JoinConfiguration{},
+		logger: testutil.TestLogger(t),
+	}
+	_, err := data.InitCfg()
+	req.Error(err)
+	req.Contains(err.Error(), "discovery error")
+}
+
+// newDummyJoinPhase performs a simple dummy phase to test the whole join workflow.
+func newDummyJoinPhase(t *testing.T) workflow.Phase {
+	t.Helper()
+	req := require.New(t)
+	return workflow.Phase{
+		Name:  "dummy-phase",
+		Short: "Test the join workflow.",
+		Run: func(c workflow.RunData) error {
+			data, ok := c.(k8sJoin.IkniteJoinData)
+			if !ok {
+				return fmt.Errorf("dummy phase invoked with an invalid data struct")
+			}
+			req.NotNil(data.IkniteCluster())
+			req.NotNil(data.Host())
+			req.Equal(ikniteApi.Running, data.IkniteCluster().Status.State)
+			req.Equal("dummy-phase", data.IkniteCluster().Status.CurrentPhase)
+
+			// Set a mock kubelet process in the state
+			mockProcess := mockHost.NewMockProcess(t)
+			mockProcess.EXPECT().Signal(syscall.SIGTERM).Return(nil).Once()
+			mockProcess.EXPECT().Wait().Return(nil).Once()
+			data.SetKubeletProcess(mockProcess)
+
+			return nil
+		},
+	}
+}
+
+func TestRunJoinCmd_Success(t *testing.T) {
+	req := require.New(t)
+	joinOptions := newJoinOptions()
+	joinRunner := workflow.NewRunner()
+	mockH := mockHost.NewMockHost(t)
+
+	addJoinWorkflowPhasesFn = func(joinRunner *workflow.Runner) {
+		joinRunner.AppendPhase(WrapPhase(newDummyJoinPhase(t), ikniteApi.Running, nil))
+	}
+	defer func() {
+		addJoinWorkflowPhasesFn = addJoinWorkflowPhases
+	}()
+
+	// The worker writes its own status
+	mockH.EXPECT().MkdirAll("/run/iknite", os.FileMode(0o755)).Return(nil).Once()
+	mockH.EXPECT().WriteFile("/run/iknite/status.json", mock.Anything, os.FileMode(0o644)).Return(nil).Once()
+	// Remove the kubelet pid file at the end of the workflow
+	mockH.EXPECT().Remove("/run/kubelet.pid").Return(nil).Once()
+
+	var output bytes.Buffer
+	cmd := newCmdJoin(&output, joinOptions, joinRunner, mockH)
+	cmd.SetArgs([]string{
+		"iknite.local:6443",
+		"--token", "abcdef.0123456789abcdef",
+		"--discovery-token-unsafe-skip-ca-verification",
+	})
+	err := cmd.Execute()
+	req.NoError(err)
+}
+
+func TestAddJoinWorkflowPhases(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	joinRunner := workflow.NewRunner()
+	addJoinWorkflowPhases(joinRunner)
+
+	phaseNames := make([]string, 0, len(joinRunner.Phases))
+	for _, phase := range joinRunner.Phases {
+		phaseNames = append(phaseNames, phase.Name)
+	}
+
+	req.Equal([]string{
+		"prepare-host",
+		"pre-clean-host",
+		"preflight [api-server-endpoint]",
+		"kubelet-start [api-server-endpoint]",
+		"kubelet-wait-bootstrap",
+		"daemonize",
+	}, phaseNames)
+	req.Equal(-1, slices.IndexFunc(joinRunner.Phases, func(p workflow.Phase) bool { return p.Run == nil }))
+}
@@ -61,6 +61,7 @@ func performKubelet(
 		return fmt.Errorf("failed to prepare Kubernetes environment: %w", err)
 	}
 
+	setSubstitutionVariables(kustomizeOptions, ikniteConfig, alpineHost, util.LoggerFromContext(ctx))
 	runtime := k8s.NewKubeletRuntime(alpineHost, kubeClient, util.LoggerFromContext(ctx))
 	err = k8s.StartAndConfigureKubelet(ctx, runtime, kustomizeOptions)
 	if err != nil {
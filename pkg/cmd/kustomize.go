@@ -18,14 +18,22 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"path/filepath"
+	"slices"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/cli-runtime/pkg/resource"
 
+	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
 	"github.com/kaweezle/iknite/pkg/cmd/options"
 	"github.com/kaweezle/iknite/pkg/cmd/util"
 	"github.com/kaweezle/iknite/pkg/config"
@@ -37,10 +45,14 @@ import (
 	"github.com/kaweezle/iknite/pkg/utils"
 )
 
+// vendorHTTPClient is the client used to download the remote resources. It is replaced in tests.
+var vendorHTTPClient = http.DefaultClient
+
 func NewPrintKustomizeCmd(
 	fs host.FileSystem,
 	kustomizeOptions *utils.KustomizeOptions,
 ) *cobra.Command {
+	showVariables := false
 	printKustomizeCmd := &cobra.Command{
 		Use:   "print",
 		Short: "Print the kustomize configuration",
@@ -54,8 +66,14 @@ prints the Embedded configuration that installs the following components:
 - Local-path provisioner to make PVCs available.
 - metrics-server to make resources work on payloads.
 
+The ${IKNITE_*} variables are substituted in the printed resources. Use
+--show-variables to print their values instead.
 `,
 		RunE: func(cmd *cobra.Command, _ []string) error {
+			if showVariables {
+				printSubstitutionVariables(kustomizeOptions, cmd.OutOrStdout())
+				return nil
+			}
 			err := performPrintKustomize(fs, kustomizeOptions, cmd.OutOrStdout(), util.LoggerFromCommand(cmd))
 			if err != nil {
 				return fmt.Errorf("failed to print kustomize configuration: %w", err)
@@ -63,6 +81,8 @@ prints the Embedded configuration that installs the following components:
 			return nil
 		},
 	}
+	printKustomizeCmd.Flags().BoolVar(&showVariables, options.ShowVariables, showVariables,
+		"Print the variables substituted in the kustomization instead of the resources")
 	return printKustomizeCmd
 }
 
@@ -83,6 +103,7 @@ func NewKustomizeCmd(
 	if fs == nil {
 		fs = host.NewOsFS()
 	}
+	dryRun := false
 	kustomizeCmd := &cobra.Command{
 		Use:   "kustomize",
 		Short: "Kustomize the cluster",
@@ -97,8 +118,52 @@ applies the Embedded configuration that installs the following components:
 - Local-path provisioner to make PVCs available.
 - metrics-server to make resources work on payloads.
 
+The kustomization can also be an OCI artifact (oci://registry/repository:tag)
+or a git repository (git+https://host/repository.git//directory?ref=commit).
+They are fetched into /var/cache/iknite/kustomizations, in a directory named
+after the manifest digest or the commit hash, and their content is verified.
+Sources pinned by digest or commit are used from the cache without network
+access.
+
+The helmCharts of the kustomization are rendered without the helm command when
+the charts are available locally, as directories or .tgz archives, in the chart
+home (charts by default) or in /var/cache/iknite/charts. Only the charts that
+are not found locally and have a repository are rendered with helm.
+
+The resources applied are recorded in an inventory stored in the iknite-config
+ConfigMap. With --prune, the resources of the previous inventory that are not
+rendered anymore are deleted, unless they are annotated with
+config.iknite.app/prune: disabled. With --dry-run, nothing is applied and the
+resources that would be pruned are listed.
+
+Before being applied, the ${VAR} placeholders of the rendered resources are
+replaced by the values of the variables computed from the cluster
+configuration: IKNITE_IP, IKNITE_DOMAIN, IKNITE_CLUSTER_NAME,
+IKNITE_API_ENDPOINT, IKNITE_KUBERNETES_VERSION, IKNITE_NETWORK_INTERFACE and
+IKNITE_OUTBOUND_IP. As with Flux, ${VAR:=default} provides a default value and
+$${VAR} is not substituted. Only the variables matching --substitute-allow are
+replaced. Undefined variables are replaced by an empty string, unless
+--substitute-strict is specified. The resources annotated with
+config.iknite.app/substitute: disabled are left untouched.
 `,
+		PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
+			ikniteConfig := &v1alpha1.IkniteClusterSpec{}
+			v1alpha1.SetDefaults_IkniteClusterSpec(ikniteConfig)
+			if err := config.DecodeIkniteConfig(ikniteConfig); err != nil {
+				return fmt.Errorf("while decoding iknite config: %w", err)
+			}
+			networkHost, _ := fs.(host.NetworkHost) //nolint:errcheck // no outbound IP in tests
+			setSubstitutionVariables(kustomizeOptions, ikniteConfig, networkHost, util.LoggerFromCommand(cmd))
+			return nil
+		},
 		RunE: func(cmd *cobra.Command, _ []string) error {
+			if dryRun {
+				err := performPrunePlan(cmd.Context(), fs, kustomizeOptions, cmd.OutOrStdout())
+				if err != nil {
+					return fmt.Errorf("failed to list resources to prune: %w", err)
+				}
+				return nil
+			}
 			err := performKustomize(
 				cmd.Context(),
 				fs,
@@ -121,13 +186,134 @@ applies the Embedded configuration that installs the following components:
 	}
 
 	utils.AddKustomizeOptionsFlags(kustomizeCmd.Flags(), kustomizeOptions)
+	kustomizeCmd.Flags().BoolVar(&dryRun, options.DryRun, dryRun,
+		"Don't apply anything, only list the resources that would be pruned")
 
 	printCmd := NewPrintKustomizeCmd(fs, kustomizeOptions)
-	inheritsFlags(kustomizeCmd.Flags(), printCmd.Flags(), options.Kustomization)
+	inheritsFlags(kustomizeCmd.Flags(), printCmd.Flags(), options.Kustomization, options.SubstituteAllow,
+		options.SubstituteStrict)
 	kustomizeCmd.AddCommand(printCmd)
+
+	diffCmd := NewDiffKustomizeCmd(fs, kustomizeOptions)
+	inheritsFlags(kustomizeCmd.Flags(), diffCmd.Flags(), options.Kustomization, options.ForceEmbedded,
+		options.SubstituteAllow, options.SubstituteStrict)
+	kustomizeCmd.AddCommand(diffCmd)
+
+	vendorCmd := NewVendorKustomizeCmd(fs, kustomizeOptions)
+	inheritsFlags(kustomizeCmd.Flags(), vendorCmd.Flags(), options.Kustomization, options.ForceEmbedded)
+	kustomizeCmd.AddCommand(vendorCmd)
 	return kustomizeCmd
 }
 
+func NewDiffKustomizeCmd(
+	fs host.FileSystem,
+	kustomizeOptions *utils.KustomizeOptions,
+) *cobra.Command {
+	diffKustomizeCmd := &cobra.Command{
+		Use:   "diff",
+		Short: "Show the changes the kustomization would make to the cluster",
+		Long: `Compares the kustomization with the live cluster.
+
+Each rendered object is applied with a server-side dry run and the result is
+compared with the live object. A unified diff is printed for each created or
+changed object. The objects of the inventory of the last apply that are not
+rendered anymore are reported as pruned.
+
+The exit status is 0 if there is no difference, 1 if there are differences
+and 2 if an error occurred.
+`,
+		Example:      `> iknite kustomize diff --kustomization /etc/iknite.d`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			kubeClient, err := k8s.NewClientFromFile(fs, constants.KubernetesRootConfig)
+			if err != nil {
+				return util.NewExitError(diffErrorExitCode,
+					fmt.Errorf("while loading local cluster configuration: %w", err))
+			}
+			return performDiffKustomize(cmd.Context(), kubeClient, fs, kustomizeOptions, cmd.OutOrStdout())
+		},
+	}
+	return diffKustomizeCmd
+}
+
+const (
+	diffChangesExitCode = 1
+	diffErrorExitCode   = 2
+)
+
+func performDiffKustomize(
+	ctx context.Context,
+	kubeClient resource.RESTClientGetter,
+	fs host.FileSystem,
+	kustomizeOptions *utils.KustomizeOptions,
+	out io.Writer,
+) error {
+	result, err := k8s.DiffKustomization(ctx, kubeClient, fs, kustomizeOptions)
+	if err != nil {
+		return util.NewExitError(diffErrorExitCode, fmt.Errorf("failed to diff kustomization: %w", err))
+	}
+	for _, object := range result.Objects {
+		switch object.Status {
+		case k8s.DiffUnchanged:
+			continue
+		case k8s.DiffPruned:
+			fmt.Fprintf(out, "pruned: %s\n", object.Name)
+		default:
+			fmt.Fprint(out, object.Diff)
+		}
+	}
+	fmt.Fprintln(out, result.Summary())
+	if result.HasChanges() {
+		return util.NewExitError(diffChangesExitCode, errors.New("the kustomization differs from the cluster"))
+	}
+	return nil
+}
+
+func NewVendorKustomizeCmd(
+	fs host.FileSystem,
+	kustomizeOptions *utils.KustomizeOptions,
+) *cobra.Command {
+	vendorKustomizeCmd := &cobra.Command{
+		Use:   "vendor [dir]",
+		Short: "Vendor the remote resources of the kustomization",
+		Long: `Downloads the remote resources referenced by the kustomization located in
+dir (by default the kustomization directory) into its vendor sub directory and
+rewrites the kustomization to point to the local copies.
+
+The sha256 digests of the downloaded resources are recorded in the
+iknite-vendor.lock.yaml file. They are verified each time the kustomization is
+built, making the builds reproducible and usable offline.
+
+Only the http(s) URLs of manifests are vendored. The git repositories are left
+unchanged with a warning.
+
+If dir doesn't contain a kustomization or if --force-embedded is specified,
+the embedded kustomization is first written into dir.
+`,
+		Example: `> iknite kustomize vendor /etc/iknite.d`,
+		Args:    cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dirname := kustomizeOptions.Kustomization
+			if len(args) > 0 {
+				dirname = args[0]
+			}
+			err := performVendorKustomize(
+				cmd.Context(),
+				fs,
+				dirname,
+				kustomizeOptions.ForceEmbedded,
+				cmd.OutOrStdout(),
+				util.LoggerFromCommand(cmd),
+			)
+			if err != nil {
+				return fmt.Errorf("failed to vendor kustomization: %w", err)
+			}
+			return nil
+		},
+	}
+	return vendorKustomizeCmd
+}
+
 func performKustomize(
 	ctx context.Context,
 	fs host.FileSystem,
@@ -174,6 +360,87 @@ func performKustomize(
 	return nil
 }
 
+func performPrunePlan(
+	ctx context.Context,
+	fs host.FileSystem,
+	kustomizeOptions *utils.KustomizeOptions,
+	out io.Writer,
+) error {
+	kubeClient, err := k8s.NewClientFromFile(fs, constants.KubernetesRootConfig)
+	if err != nil {
+		return fmt.Errorf("while loading local cluster configuration: %w", err)
+	}
+
+	result, err := k8s.PlanPrune(ctx, kubeClient, fs, kustomizeOptions)
+	if err != nil {
+		return fmt.Errorf("while computing resources to prune: %w", err)
+	}
+	for _, id := range result.Pruned {
+		fmt.Fprintf(out, "prune: %s\n", id)
+	}
+	for _, id := range result.Protected {
+		fmt.Fprintf(out, "protected: %s\n", id)
+	}
+	fmt.Fprintf(out, "%d resources would be pruned, %d protected\n",
+		len(result.Pruned), len(result.Protected))
+	return nil
+}
+
+func performVendorKustomize(
+	ctx context.Context,
+	fs host.FileSystem,
+	dirname string,
+	forceEmbedded bool,
+	out io.Writer,
+	logger *slog.Logger,
+) error {
+	exists, err := fs.Exists(filepath.Join(dirname, "kustomization.yaml"))
+	if err != nil {
+		return fmt.Errorf("while checking for kustomization in %s: %w", dirname, err)
+	}
+	if !exists || forceEmbedded {
+		logger.Info("Writing embedded kustomization", "directory", dirname)
+		if err = provision.WriteEmbeddedKustomization(fs, dirname, logger); err != nil {
+			return fmt.Errorf("while writing embedded kustomization: %w", err)
+		}
+	}
+
+	lock, err := provision.VendorKustomization(ctx, fs, dirname, vendorHTTPClient, logger)
+	if err != nil {
+		return fmt.Errorf("while vendoring %s: %w", dirname, err)
+	}
+	for _, resource := range lock.Resources {
+		fmt.Fprintf(out, "%s sha256:%s\n", resource.Path, resource.Sha256)
+	}
+	return nil
+}
+
+// setSubstitutionVariables sets the variables substituted in the kustomization from ikniteConfig and the outbound IP
+// address of networkHost, if not nil.
+func setSubstitutionVariables(
+	kustomizeOptions *utils.KustomizeOptions,
+	ikniteConfig *v1alpha1.IkniteClusterSpec,
+	networkHost host.NetworkHost,
+	logger *slog.Logger,
+) {
+	var outboundIP net.IP
+	if networkHost != nil {
+		ip, err := networkHost.GetOutboundIP()
+		if err != nil {
+			logger.Warn("Failed to get outbound IP address, IKNITE_OUTBOUND_IP is not defined", utils.ErrorKey, err)
+		} else {
+			outboundIP = ip
+		}
+	}
+	kustomizeOptions.Variables = config.SubstitutionVariables(ikniteConfig, outboundIP)
+}
+
+func printSubstitutionVariables(kustomizeOptions *utils.KustomizeOptions, out io.Writer) {
+	for _, name := range slices.Sorted(maps.Keys(kustomizeOptions.Variables)) {
+		fmt.Fprintf(out, "%s=%s\n", name, kustomizeOptions.Variables[name])
+	}
+}
+
 func performPrintKustomize(
 	fs host.FileSystem,
 	kustomizeOptions *utils.KustomizeOptions,
@@ -184,6 +451,7 @@ func performPrintKustomize(
 		fs,
 		kustomizeOptions.Kustomization,
 		kustomizeOptions.ForceEmbedded,
+		k8s.NewSubstituteOptions(kustomizeOptions),
 		logger,
 	)
 	if err != nil {
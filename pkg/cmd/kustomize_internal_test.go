@@ -5,8 +5,12 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"net/http"
+	"net/http/httptest"
+	"path"
 	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -14,8 +18,10 @@ import (
 	"github.com/stretchr/testify/require"
 	"k8s.io/client-go/tools/clientcmd"
 
+	"github.com/kaweezle/iknite/pkg/cmd/util"
 	"github.com/kaweezle/iknite/pkg/constants"
 	"github.com/kaweezle/iknite/pkg/host"
+	"github.com/kaweezle/iknite/pkg/provision"
 	"github.com/kaweezle/iknite/pkg/testutil"
 	"github.com/kaweezle/iknite/pkg/utils"
 )
@@ -167,6 +173,7 @@ func Test_performKustomize(t *testing.T) {
 					return fmt.Errorf("failed to create basic kustomization: %w", err)
 				}
 				kOpts.Kustomization = baseKustomizationDir
+				kOpts.ApplyRetries = 1
 				sOpts.Overrides = map[string]testutil.HandlerOverrideFunc{
 					"/api/v1/namespaces/kube-system/configmaps/test-config": testutil.FailOverrideHandler,
 				}
@@ -330,3 +337,127 @@ func TestKustomizeCmd(t *testing.T) {
 		})
 	}
 }
+
+func TestVendorKustomizeCmd(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("apiVersion: v1\nkind: Namespace\nmetadata:\n  name: remote\n")) //nolint:errcheck // test
+	}))
+	defer server.Close()
+
+	fs := host.NewMemMapFS()
+	req.NoError(fs.MkdirAll(baseKustomizationDir, 0o755))
+	req.NoError(fs.WriteFile(baseKustomizationDir+"/kustomization.yaml",
+		[]byte("resources:\n- "+server.URL+"/ns.yaml\n"), 0o600))
+
+	kustomizeCmd := NewKustomizeCmd(nil, nil, fs)
+	var output bytes.Buffer
+	kustomizeCmd.SetOut(&output)
+	kustomizeCmd.SetArgs([]string{"vendor", baseKustomizationDir})
+	req.NoError(kustomizeCmd.Execute())
+	req.Contains(output.String(), "/ns.yaml sha256:")
+
+	exists, err := fs.Exists(baseKustomizationDir + "/" + provision.VendorLockFileName)
+	req.NoError(err)
+	req.True(exists)
+}
+
+//nolint:paralleltest // The cluster configuration is decoded from the global viper
+func TestPrintKustomizeCmd_Substitution(t *testing.T) {
+	req := require.New(t)
+	fs := host.NewMemMapFS()
+	req.NoError(fs.MkdirAll(baseKustomizationDir, 0o755))
+	req.NoError(fs.WriteFile(baseKustomizationDir+"/kustomization.yaml",
+		[]byte("resources:\n- pool.yaml\n"), 0o600))
+	req.NoError(fs.WriteFile(baseKustomizationDir+"/pool.yaml",
+		[]byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: pool\ndata:\n"+
+			"  address: ${IKNITE_IP}\n  zone: ${IKNITE_ZONE:=lan}\n  other: ${IKNITE_UNDEFINED}\n"), 0o600))
+
+	run := func(args ...string) (string, error) {
+		kustomizeOptions := utils.NewKustomizeOptions()
+		kustomizeOptions.Kustomization = baseKustomizationDir
+		cmd := NewKustomizeCmd(kustomizeOptions, nil, fs)
+		var output bytes.Buffer
+		cmd.SetOut(&output)
+		cmd.SetErr(io.Discard)
+		cmd.SetArgs(args)
+		err := cmd.ExecuteContext(t.Context())
+		return output.String(), err
+	}
+
+	output, err := run("print", "--show-variables")
+	req.NoError(err)
+	req.Contains(output, "IKNITE_IP="+constants.WslIPAddress+"\n")
+	req.Contains(output, "IKNITE_CLUSTER_NAME="+constants.DefaultClusterName+"\n")
+
+	output, err = run("print")
+	req.NoError(err)
+	req.Contains(output, "address: "+constants.WslIPAddress)
+	req.Contains(output, "zone: lan")
+	req.NotContains(output, "IKNITE_UNDEFINED")
+
+	_, err = run("print", "--substitute-strict")
+	req.ErrorContains(err, "undefined variables: IKNITE_UNDEFINED")
+
+	output, err = run("print", "--substitute-allow", "IKNITE_ZONE")
+	req.NoError(err)
+	req.Contains(output, "address: ${IKNITE_IP}")
+	req.Contains(output, "zone: lan")
+}
+
+type manifestRoundTripper struct{}
+
+func (manifestRoundTripper) RoundTrip(request *http.Request) (*http.Response, error) {
+	body := fmt.Sprintf("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: %s\n", path.Base(request.URL.Path))
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Status:     "200 OK",
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    request,
+	}, nil
+}
+
+//nolint:paralleltest // modifies vendorHTTPClient
+func TestPerformVendorKustomize_Embedded(t *testing.T) {
+	req := require.New(t)
+	vendorHTTPClient = &http.Client{Transport: manifestRoundTripper{}}
+	defer func() {
+		vendorHTTPClient = http.DefaultClient
+	}()
+
+	fs := host.NewMemMapFS()
+	var output bytes.Buffer
+	req.NoError(performVendorKustomize(t.Context(), fs, "/etc/iknite.d", true, &output, testutil.TestLogger(t)))
+
+	content, err := fs.ReadFile("/etc/iknite.d/kustomization.yaml")
+	req.NoError(err)
+	req.NotContains(string(content), "- https://")
+	req.Contains(string(content), "- vendor/github.com/kubernetes-sigs/metrics-server/releases/latest/download/components.yaml")
+	req.Len(strings.Split(strings.TrimSpace(output.String()), "\n"), 3)
+}
+
+func TestPerformDiffKustomize(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	fs := host.NewMemMapFS()
+	req.NoError(testutil.CreateBasicKustomization(fs, baseKustomizationDir, false))
+	sOpts := &testutil.TestServerOptions{Entry: testutil.TestLogger(t)}
+	kubeClient := testutil.CreateDefaultTestClientGetter(t, sOpts)
+
+	var output bytes.Buffer
+	err := performDiffKustomize(t.Context(), kubeClient, fs,
+		&utils.KustomizeOptions{Kustomization: baseKustomizationDir}, &output)
+	req.ErrorContains(err, "differs from the cluster")
+	req.Equal(1, util.ExitCode(err))
+	req.Contains(output.String(), "+++ merged/configmaps/test-config")
+	req.Contains(output.String(), "+  name: test-config\n")
+	req.Contains(output.String(), "1 created, 0 changed, 0 unchanged, 0 pruned")
+
+	err = performDiffKustomize(t.Context(), kubeClient, fs,
+		&utils.KustomizeOptions{Kustomization: "/missing"}, &output)
+	req.Error(err)
+	req.Equal(2, util.ExitCode(err))
+}
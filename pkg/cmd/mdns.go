@@ -20,18 +20,30 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"maps"
 	"net"
 	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"time"
 
 	"github.com/pion/mdns/v2"
 	"github.com/spf13/cobra"
 	"golang.org/x/net/dns/dnsmessage"
-	"golang.org/x/net/ipv4"
-	"golang.org/x/net/ipv6"
+	"golang.org/x/sync/errgroup"
 
 	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
+	"github.com/kaweezle/iknite/pkg/cmd/options"
 	"github.com/kaweezle/iknite/pkg/cmd/util"
 	"github.com/kaweezle/iknite/pkg/config"
+	"github.com/kaweezle/iknite/pkg/constants"
+	"github.com/kaweezle/iknite/pkg/host"
+	"github.com/kaweezle/iknite/pkg/k8s"
+	ikniteMdns "github.com/kaweezle/iknite/pkg/mdns"
+	"github.com/kaweezle/iknite/pkg/utils"
 )
 
 type mdnsServer interface {
@@ -40,37 +52,20 @@ type mdnsServer interface {
 }
 
 var newMdnsServerFn = func(cfg *mdns.Config) (mdnsServer, net.Addr, net.Addr, error) {
-	addr4, err := net.ResolveUDPAddr("udp", mdns.DefaultAddressIPv4)
-	if err != nil { // nocov -- should not happen on supported platforms
-		return nil, nil, nil, fmt.Errorf("cannot resolve default address: %w", err)
-	}
+	return ikniteMdns.Listen(cfg)
+}
 
-	l4, err := net.ListenUDP("udp4", addr4)
-	if err != nil { // nocov -- should not happen on supported platforms
-		return nil, nil, nil, fmt.Errorf("cannot listen on default address: %w", err)
-	}
+var newMdnsAdvertiserFn = ikniteMdns.ListenAdvertiser
 
-	addr6, err := net.ResolveUDPAddr("udp6", mdns.DefaultAddressIPv6)
-	if err != nil { // nocov -- should not happen on supported platforms
-		return nil, nil, nil, fmt.Errorf("cannot resolve default address: %w", err)
-	}
+var probeMdnsNameFn ikniteMdns.ProbeFunc = ikniteMdns.Probe
 
-	l6, err := net.ListenUDP("udp6", addr6)
-	if err != nil { // nocov -- should not happen on supported platforms
-		return nil, nil, nil, fmt.Errorf("cannot listen on default address: %w", err)
-	}
+var browseMdnsFn = ikniteMdns.Browse
 
-	conn, err := mdns.Server(ipv4.NewPacketConn(l4), ipv6.NewPacketConn(l6), cfg)
-	if err != nil {
-		_ = l4.Close() //nolint:errcheck // best effort cleanup
-		_ = l6.Close() //nolint:errcheck // best effort cleanup
-		return nil, nil, nil, fmt.Errorf("cannot create server: %w", err)
+func NewMdnsCmd(ikniteConfig *v1alpha1.IkniteClusterSpec, alpineHost host.Host) *cobra.Command {
+	if alpineHost == nil {
+		alpineHost = host.NewDefaultHost()
 	}
-
-	return conn, addr4, addr6, nil
-}
-
-func NewMdnsCmd(ikniteConfig *v1alpha1.IkniteClusterSpec) *cobra.Command {
+	watchRoutes := false
 	// configureCmd represents the start command
 	mdnsCmd := &cobra.Command{
 		Use:   "mdns",
@@ -79,14 +74,30 @@ func NewMdnsCmd(ikniteConfig *v1alpha1.IkniteClusterSpec) *cobra.Command {
 with the DNS on the Windows side.
 
 It assumes that mDNS is not use elsewhere inside WSL.
+
+The domain name is probed before being published. If another host on the
+network answers for it, it is renamed with a numeric suffix (cluster-2.iknite)
+or the command fails, depending on --mdns-conflict-policy.
+
+The API server and the status server are also advertised with DNS-SD as the
+_kubernetes._tcp and _iknite._tcp services. Their TXT records contain the
+name, the Kubernetes version and the state of the cluster.
+
+With --routes, the .local hostnames of the HTTPRoutes, of the Ingresses and of
+the LoadBalancer services annotated with config.iknite.app/hostnames are also
+published. The published names follow the changes of these resources.
 `,
+		Example: `> iknite mdns --routes`,
 		RunE: func(cmd *cobra.Command, _ []string) error {
-			return performMdns(cmd.Context(), ikniteConfig)
+			return performMdns(cmd.Context(), ikniteConfig, watchRoutes, alpineHost)
 		},
 	}
 
 	config.AddIkniteClusterFlags(mdnsCmd.PersistentFlags(), ikniteConfig)
+	mdnsCmd.Flags().BoolVar(&watchRoutes, options.MdnsRoutes, watchRoutes,
+		"Also publish the .local hostnames of the cluster routes and annotated services")
 	mdnsCmd.AddCommand(NewMdnsTestCmd(ikniteConfig))
+	mdnsCmd.AddCommand(NewMdnsBrowseCmd())
 
 	return mdnsCmd
 }
@@ -106,23 +117,130 @@ queries the configured domain name once.
 	}
 }
 
-func performMdns(ctx context.Context, ikniteConfig *v1alpha1.IkniteClusterSpec) error {
-	conn, addr4, addr6, err := newMdnsServerFn(&mdns.Config{
-		LocalNames: []string{ikniteConfig.DomainName},
+func NewMdnsBrowseCmd() *cobra.Command {
+	timeout := defaultBrowseTimeout
+	browseCmd := &cobra.Command{
+		Use:   "browse",
+		Short: "List the iknite clusters advertised through mdns",
+		Long: `Browses the _kubernetes._tcp and _iknite._tcp DNS-SD services for the
+duration of the timeout and prints the clusters that advertise them.
+`,
+		Example: `> iknite mdns browse --timeout 5s`,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return performMdnsBrowse(cmd.Context(), cmd.OutOrStdout(), timeout)
+		},
+	}
+	browseCmd.Flags().DurationVar(&timeout, options.Timeout, timeout, "Duration of the browsing")
+	return browseCmd
+}
+
+func performMdns(
+	ctx context.Context,
+	ikniteConfig *v1alpha1.IkniteClusterSpec,
+	watchRoutes bool,
+	fs host.FileSystem,
+) error {
+	logger := util.LoggerFromContext(ctx)
+	ips := ikniteMdns.InterfaceAddresses(ikniteConfig.NetworkInterface)
+	name, conflict, err := ikniteMdns.ResolveName(ctx, ikniteMdns.LenientProbe(probeMdnsNameFn, logger),
+		ikniteConfig.DomainName, ikniteConfig.MDNSConflictPolicy, ips)
+	if err != nil {
+		return fmt.Errorf("cannot publish %s: %w", ikniteConfig.DomainName, err)
+	}
+	if conflict {
+		logger.Warn("The domain name is used by another host, publishing a renamed one",
+			"domainName", ikniteConfig.DomainName, "name", name)
+	}
+
+	responder := ikniteMdns.NewResponder(func(cfg *mdns.Config) (io.Closer, error) {
+		conn, addr4, addr6, err := newMdnsServerFn(cfg)
+		if err != nil {
+			return nil, err
+		}
+		logger.Debug("Start mdns responder...", "names", cfg.LocalNames, "addr4", addr4, "addr6", addr6)
+		return conn, nil
 	})
+	if err = responder.SetNames(name); err != nil {
+		return fmt.Errorf("while publishing %s: %w", name, err)
+	}
+	defer responder.Close() //nolint:errcheck // should not fail.
+
+	interval := time.Duration(ikniteConfig.StatusUpdateLongIntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = constants.StatusUpdateLongIntervalSeconds * time.Second
+	}
+	group, groupCtx := errgroup.WithContext(ctx)
+
+	advertiser, err := newMdnsAdvertiserFn()
 	if err != nil {
-		return err
+		logger.Warn("Cannot advertise the cluster services with DNS-SD", utils.ErrorKey, err)
+	} else {
+		defer advertiser.Close() //nolint:errcheck // should not fail.
+		group.Go(func() error {
+			advertiseCluster(groupCtx, advertiser, ikniteConfig, fs, interval, name, ips)
+			return nil
+		})
 	}
 
-	logger := util.LoggerFromContext(ctx)
-	logger.Debug("Start mdns responder...", "domainName", ikniteConfig.DomainName, "addr4", addr4, "addr6", addr6)
+	if watchRoutes {
+		kubeClient, clientErr := k8s.NewDefaultClient(fs)
+		if clientErr != nil {
+			return fmt.Errorf("failed to create kube client: %w", clientErr)
+		}
+		watcher, watcherErr := k8s.NewRouteWatcherFromGetter(kubeClient, interval,
+			responder.HostsHandler(name))
+		if watcherErr != nil {
+			return fmt.Errorf("failed to create route watcher: %w", watcherErr)
+		}
+		group.Go(func() error {
+			if runErr := watcher.Run(groupCtx); runErr != nil {
+				return fmt.Errorf("while watching the routes: %w", runErr)
+			}
+			return nil
+		})
+	}
 
-	defer conn.Close() //nolint:errcheck // should not fail.
-	<-ctx.Done()
+	<-groupCtx.Done()
+	if err = group.Wait(); err != nil {
+		return err //nolint:wrapcheck // already wrapped
+	}
 	logger.Info("Shutting down mdns responder...")
 	return nil
 }
 
+// advertiseCluster advertises the DNS-SD services of the cluster, targeting name and ips, until ctx is done. The
+// state of the cluster is read from the status file every interval.
+func advertiseCluster(
+	ctx context.Context,
+	advertiser *ikniteMdns.Advertiser,
+	ikniteConfig *v1alpha1.IkniteClusterSpec,
+	fs host.FileSystem,
+	interval time.Duration,
+	name string,
+	ips []net.IP,
+) {
+	logger := util.LoggerFromContext(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		cluster, err := v1alpha1.LoadIkniteClusterOrDefault(fs)
+		if err != nil {
+			logger.Warn("Cannot read the cluster status", utils.ErrorKey, err)
+			cluster = v1alpha1.NewDefaultIkniteCluster()
+		}
+		cluster.Spec = *ikniteConfig
+		cluster.Status.MDNS.Name = name
+		if err = advertiser.SetServices(ikniteMdns.ClusterServices(cluster, ips...)...); err != nil {
+			logger.Warn("Cannot advertise the cluster services", utils.ErrorKey, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
 func performMdnsTest(ctx context.Context, out io.Writer, ikniteConfig *v1alpha1.IkniteClusterSpec) error {
 	conn, _, _, err := newMdnsServerFn(&mdns.Config{})
 	if err != nil {
@@ -143,3 +261,70 @@ func performMdnsTest(ctx context.Context, out io.Writer, ikniteConfig *v1alpha1.
 
 	return nil
 }
+
+const defaultBrowseTimeout = 3 * time.Second
+
+type browsedCluster struct {
+	name      string
+	host      string
+	version   string
+	state     string
+	addresses []string
+	apiPort   uint16
+	status    uint16
+}
+
+func performMdnsBrowse(ctx context.Context, out io.Writer, timeout time.Duration) error {
+	browseCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	services, err := browseMdnsFn(browseCtx, ikniteMdns.KubernetesServiceType, ikniteMdns.IkniteServiceType)
+	if err != nil {
+		return fmt.Errorf("while browsing the clusters: %w", err)
+	}
+
+	clusters := map[string]*browsedCluster{}
+	for _, service := range services {
+		cluster, ok := clusters[service.Instance]
+		if !ok {
+			cluster = &browsedCluster{name: service.Instance, host: service.Host}
+			clusters[service.Instance] = cluster
+		}
+		if version := service.Text[ikniteMdns.VersionTextKey]; version != "" {
+			cluster.version = version
+		}
+		if state := service.Text[ikniteMdns.StateTextKey]; state != "" {
+			cluster.state = state
+		}
+		for _, ip := range service.IPs {
+			if !slices.Contains(cluster.addresses, ip.String()) {
+				cluster.addresses = append(cluster.addresses, ip.String())
+			}
+		}
+		switch service.Type {
+		case ikniteMdns.KubernetesServiceType:
+			cluster.apiPort = service.Port
+		case ikniteMdns.IkniteServiceType:
+			cluster.status = service.Port
+		}
+	}
+
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0) //nolint:mnd // padding
+	fmt.Fprintln(writer, "NAME\tHOST\tADDRESSES\tAPI\tSTATUS\tVERSION\tSTATE")
+	for _, name := range slices.Sorted(maps.Keys(clusters)) {
+		cluster := clusters[name]
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", cluster.name, cluster.host,
+			strings.Join(cluster.addresses, ","), portString(cluster.apiPort), portString(cluster.status),
+			cluster.version, cluster.state)
+	}
+	if err = writer.Flush(); err != nil { // nocov -- unlikely to fail
+		return fmt.Errorf("cannot write the clusters: %w", err)
+	}
+	return nil
+}
+
+func portString(port uint16) string {
+	if port == 0 {
+		return "-"
+	}
+	return strconv.Itoa(int(port))
+}
@@ -6,6 +6,7 @@ import (
 	"context"
 	"net"
 	"net/netip"
+	"strings"
 	"sync"
 	"testing"
 
@@ -14,6 +15,7 @@ import (
 	"golang.org/x/net/dns/dnsmessage"
 
 	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
+	ikniteMdns "github.com/kaweezle/iknite/pkg/mdns"
 )
 
 type fakeMdnsServer struct {
@@ -56,7 +58,7 @@ func TestNewMdnsCmdTestSubcommand(t *testing.T) {
 		return fakeServer, nil, nil, nil
 	}
 
-	command := NewMdnsCmd(spec)
+	command := NewMdnsCmd(spec, nil)
 	testCommand, _, err := command.Find([]string{"test"})
 	req.NoError(err)
 	req.NotNil(testCommand)
@@ -84,13 +86,13 @@ func TestMdnsCmd(t *testing.T) {
 	spec := &v1alpha1.IkniteClusterSpec{CreateIp: true, DomainName: "cluster.iknite"}
 	v1alpha1.SetDefaults_IkniteClusterSpec(spec)
 
-	command := NewMdnsCmd(spec)
+	command := NewMdnsCmd(spec, nil)
 	testCommand, _, err := command.Find([]string{"test"})
 	req.NoError(err)
 	req.NotNil(testCommand)
 	req.Equal("test", testCommand.Name())
 
-	dnsCommand := NewMdnsCmd(spec)
+	dnsCommand := NewMdnsCmd(spec, nil)
 	var dnsErrMu sync.Mutex
 	var dnsErr error
 	dnsCtx, cancel := context.WithCancel(context.Background())
@@ -116,3 +118,41 @@ func TestMdnsCmd(t *testing.T) {
 	defer dnsErrMu.Unlock()
 	req.NoError(dnsErr)
 }
+
+//nolint:paralleltest // overrides package-level test hook
+func TestMdnsBrowseCmd(t *testing.T) {
+	req := require.New(t)
+
+	originalBrowseMdnsFn := browseMdnsFn
+	t.Cleanup(func() {
+		browseMdnsFn = originalBrowseMdnsFn
+	})
+	browseMdnsFn = func(_ context.Context, serviceTypes ...string) ([]*ikniteMdns.Service, error) {
+		req.Equal([]string{ikniteMdns.KubernetesServiceType, ikniteMdns.IkniteServiceType}, serviceTypes)
+		text := map[string]string{ikniteMdns.VersionTextKey: "1.35.0", ikniteMdns.StateTextKey: "Running"}
+		ips := []net.IP{net.ParseIP("192.168.99.2")}
+		return []*ikniteMdns.Service{
+			{
+				Instance: "kaweezle", Type: ikniteMdns.IkniteServiceType, Host: "kaweezle.local",
+				Port: 11443, Text: text, IPs: ips,
+			},
+			{
+				Instance: "kaweezle", Type: ikniteMdns.KubernetesServiceType, Host: "kaweezle.local",
+				Port: 6443, Text: text, IPs: ips,
+			},
+			{Instance: "other", Type: ikniteMdns.KubernetesServiceType, Host: "other.local", Port: 6443},
+		}, nil
+	}
+
+	command := NewMdnsCmd(&v1alpha1.IkniteClusterSpec{}, nil)
+	out := &bytes.Buffer{}
+	command.SetOut(out)
+	command.SetArgs([]string{"browse", "--timeout", "10ms"})
+	req.NoError(command.ExecuteContext(t.Context()))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	req.Len(lines, 3)
+	req.Regexp(`^NAME\s+HOST\s+ADDRESSES\s+API\s+STATUS\s+VERSION\s+STATE$`, lines[0])
+	req.Regexp(`^kaweezle\s+kaweezle\.local\s+192\.168\.99\.2\s+6443\s+11443\s+1\.35\.0\s+Running$`, lines[1])
+	req.Regexp(`^other\s+other\.local\s+6443\s+-\s*$`, lines[2])
+}
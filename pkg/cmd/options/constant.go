@@ -18,6 +18,15 @@ const (
 	Kustomization = "kustomization"
 	ForceConfig   = "force-config"
 	ForceEmbedded = "force-embedded"
+	Prune         = "prune"
+	ApplyRetries  = "apply-retries"
+	DryRun        = "dry-run"
+
+	SubstituteAllow  = "substitute-allow"
+	SubstituteStrict = "substitute-strict"
+	ShowVariables    = "show-variables"
+
+	ReconcileKustomization = "reconcile-kustomization"
 
 	// Configuration.
 	Ip                 = "ip"
@@ -25,11 +34,24 @@ const (
 	IpNetworkInterface = "network-interface"
 	DomainName         = "domain-name"
 	EnableMDNS         = "enable-mdns"
+	MDNSConflictPolicy = "mdns-conflict-policy"
 	ClusterName        = "cluster-name"
+	LoadBalancerIPPool = "lb-ip-pool"
+
+	// Mdns.
+	MdnsRoutes = "routes"
+
+	// Forward.
+	ForwardListenAddress = "listen-address"
+	ForwardPort          = "port"
+	ForwardTarget        = "target"
 
 	// Etcd/Kine.
 	UseEtcd = "use-etcd"
 
+	// Air-gapped mode.
+	AirGapped = "air-gapped"
+
 	// Clean.
 	StopContainers     = "stop-containers"
 	UnmountPaths       = "unmount-paths"
@@ -43,4 +65,9 @@ const (
 	// Info.
 	OutputFormat      = "output-format"
 	OutputDestination = "output-destination"
+
+	// Status.
+	StatusOutput            = "output"
+	StatusFix               = "fix"
+	StatusMaxParallelChecks = "max-parallel-checks"
 )
@@ -79,14 +79,18 @@ kubernetes.`,
 
 	rootCmd.AddCommand(NewKustomizeCmd(nil, nil, nil))
 	rootCmd.AddCommand(newCmdInit(os.Stdout, nil, nil, alpineHost))
+	rootCmd.AddCommand(newCmdJoin(os.Stdout, nil, nil, alpineHost))
+	rootCmd.AddCommand(NewTokenCmd(alpineHost))
 	rootCmd.AddCommand(newCmdReset(os.Stdin, os.Stdout, nil, nil))
 	rootCmd.AddCommand(NewCmdClean(ikniteConfig, nil, alpineHost))
 	rootCmd.AddCommand(NewKubeletCmd(ikniteConfig, nil, alpineHost))
-	rootCmd.AddCommand(NewMdnsCmd(ikniteConfig))
+	rootCmd.AddCommand(NewMdnsCmd(ikniteConfig, alpineHost))
+	rootCmd.AddCommand(NewForwardCmd(nil))
 	rootCmd.AddCommand(NewPrepareCommand(ikniteConfig))
 	rootCmd.AddCommand(NewStartCmd(ikniteConfig, nil, alpineHost))
 	rootCmd.AddCommand(NewStatusCmd(ikniteConfig, nil, nil, alpineHost))
 	rootCmd.AddCommand(NewInfoCmd(ikniteConfig))
+	rootCmd.AddCommand(NewContainerImagesCmd(ikniteConfig, alpineHost))
 
 	util.BindFlagsToViper(rootCmd, cmdIf)
 
@@ -21,8 +21,11 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"slices"
+	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/spf13/cobra"
@@ -30,6 +33,7 @@ import (
 	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
 	"github.com/kaweezle/iknite/pkg/check"
 	"github.com/kaweezle/iknite/pkg/checkers"
+	"github.com/kaweezle/iknite/pkg/cmd/options"
 	"github.com/kaweezle/iknite/pkg/cmd/util"
 	"github.com/kaweezle/iknite/pkg/config"
 	"github.com/kaweezle/iknite/pkg/host"
@@ -73,6 +77,7 @@ func NewStatusCmd(
 	if alpineHost == nil {
 		alpineHost = host.NewDefaultHost()
 	}
+	statusOptions := &statusOptions{}
 	// configureCmd represents the start command
 	statusCmd := &cobra.Command{
 		Use:   "status",
@@ -82,12 +87,46 @@ func NewStatusCmd(
 - Deployments
 - Daemonsets
 - Statefulsets
+
+The checks declared in the YAML files of /etc/iknite.d/checks are run in the
+user_checks phase. Each file contains a list of checks of type file, service,
+http, tcp, command or k8s-resource:
+
+  checks:
+    - name: registry
+      type: http
+      url: https://registry.local/v2/
+      dependsOn: [nfs_data]
+      timeoutSeconds: 10
+      retries: 3
+      retryIntervalSeconds: 5
+
+With --output, the checks are run without the interactive display and their
+results are printed on the standard output as json, yaml, junit or text. The
+junit format allows publishing the results as test results in CI.
+
+With --fix, the failed checks that iknite knows how to repair, like the IP
+forwarding, the machine id or the domain name mapping, are fixed. The fixed
+checks and the checks depending on them are then run again.
+
+With --max-parallel-checks, no more than the given number of checks run at
+the same time.
+
+The exit status is 0 if all checks succeed and 1 otherwise.
 `,
+		Example: `> iknite status
+> iknite status --output junit > iknite-status.xml
+> iknite status --fix`,
+		SilenceUsage: true,
 		RunE: func(cmd *cobra.Command, _ []string) error {
 			cmdIf, ok := util.CmdInterfaceFromCommand(cmd)
 			if !ok {
 				return fmt.Errorf("cannot get command interface")
 			}
+			if statusOptions.outputFormat != "" && !slices.Contains(check.ReportFormats, statusOptions.outputFormat) {
+				return fmt.Errorf("invalid output format %q, expected one of %s", statusOptions.outputFormat,
+					strings.Join(check.ReportFormats, ", "))
+			}
 			var output bytes.Buffer
 			opts := &util.BaseOptions{Verbosity: slog.LevelWarn}
 			opts.SetUpLogs(&output, cmdIf)
@@ -99,6 +138,8 @@ func NewStatusCmd(
 				waitOptions,
 				configurer,
 				cmdIf.Logger(),
+				statusOptions,
+				cmd.OutOrStdout(),
 				teaOptions...)
 			if output.Len() > 0 {
 				fmt.Fprintln(os.Stderr, "Additional logs:")
@@ -111,10 +152,37 @@ func NewStatusCmd(
 	flags := statusCmd.Flags()
 	config.AddIkniteClusterFlags(flags, ikniteConfig)
 	utils.AddWaitOptionsFlags(flags, waitOptions)
+	flags.StringVarP(
+		&statusOptions.outputFormat,
+		options.StatusOutput,
+		"o",
+		"",
+		"Print the results of the checks instead of displaying them. One of: json|yaml|junit|text",
+	)
+	flags.BoolVar(
+		&statusOptions.fix,
+		options.StatusFix,
+		false,
+		"Fix the failed checks that can be repaired and run them again",
+	)
+	flags.IntVar(
+		&statusOptions.maxParallelChecks,
+		options.StatusMaxParallelChecks,
+		0,
+		"Maximum number of checks running at the same time. Unlimited if 0",
+	)
 
 	return statusCmd
 }
 
+const statusFailedExitCode = 1
+
+type statusOptions struct {
+	outputFormat      string
+	maxParallelChecks int
+	fix               bool
+}
+
 func performStatus(
 	ctx context.Context,
 	alpineHost host.Host,
@@ -122,17 +190,67 @@ func performStatus(
 	waitOptions *utils.WaitOptions,
 	configurer CheckExecutorConfigurer,
 	logger *slog.Logger,
+	statusOptions *statusOptions,
+	out io.Writer,
 	teaOptions ...tea.ProgramOption,
 ) error {
 	executor := check.NewCheckExecutor()
 	configurer.Configure(executor, ikniteConfig, waitOptions)
+	executor.MaxParallelism = statusOptions.maxParallelChecks
 
 	checkData := checkers.CreateCheckWorkloadData(ikniteConfig, waitOptions, alpineHost, logger)
 	teaOptions = append(teaOptions, tea.WithOutput(os.Stderr))
-	p := tea.NewProgram(check.NewCheckModel(ctx, executor, checkData, logger), teaOptions...)
-	_, err := p.Run()
+	run := func() (bool, error) {
+		if statusOptions.outputFormat != "" {
+			if executor.Results == nil {
+				executor.PrepareRun()
+			}
+			executor.Run(ctx, checkData)
+			return ctx.Err() == nil, nil
+		}
+		model := check.NewCheckModel(ctx, executor, checkData, logger)
+		_, err := tea.NewProgram(model, teaOptions...).Run()
+		if err != nil { // nocov -- hard to cover in all test scenarios.
+			return false, fmt.Errorf("error running checks: %w", err)
+		}
+		return model.Context().Err() == nil, nil
+	}
+
+	completed, err := run()
 	if err != nil { // nocov -- hard to cover in all test scenarios.
-		return fmt.Errorf("error running checks: %w", err)
+		return err
+	}
+	var fixed []*check.CheckResult
+	if statusOptions.fix && completed {
+		fixed = executor.Fix(ctx, checkData)
+		if len(fixed) > 0 {
+			if _, err = run(); err != nil { // nocov -- hard to cover in all test scenarios.
+				return err
+			}
+		}
+	}
+
+	report := check.NewReport(executor.Results)
+	if statusOptions.outputFormat != "" {
+		if err = report.Write(out, statusOptions.outputFormat); err != nil {
+			return fmt.Errorf("while writing the status report: %w", err)
+		}
+	} else {
+		for _, result := range fixed {
+			writeFixResult(os.Stderr, result)
+		}
+	}
+	if !report.Success {
+		return util.NewExitError(statusFailedExitCode, fmt.Errorf("%d of %d checks failed or did not complete",
+			report.Summary.Failed+report.Summary.Incomplete, report.Summary.Total))
 	}
 	return nil
 }
+
+func writeFixResult(out io.Writer, result *check.CheckResult) {
+	if result.FixError != nil {
+		fmt.Fprintf(out, "%s Could not fix %s: %v\n", check.ErrorStyle.Render("✗"), result.Name(), result.FixError)
+	} else {
+		fmt.Fprintf(out, "%s Fixed %s: %s\n", check.SuccessStyle.Render("✓"), result.Name(), result.FixMessage)
+	}
+}
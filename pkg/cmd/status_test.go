@@ -1,4 +1,4 @@
-// cSpell: words paralleltest configurer testutil charmbracelet bubbletea
+// cSpell: words paralleltest configurer testutil charmbracelet bubbletea testcase
 //
 //nolint:paralleltest // mutates viper
 package cmd_test
@@ -6,6 +6,8 @@ package cmd_test
 import (
 	"bytes"
 	"context"
+	"errors"
+	"sync/atomic"
 	"testing"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -54,3 +56,120 @@ func TestStatusCommand(t *testing.T) {
 	err = command.ExecuteContext(ctx)
 	req.NoError(err)
 }
+
+func failingConfigurer(
+	executor *check.CheckExecutor,
+	_ *v1alpha1.IkniteClusterSpec,
+	_ *utils.WaitOptions,
+) {
+	simpleConfigurer(executor, nil, nil)
+	executor.AddCheck(&check.Check{
+		Name:      "failing",
+		DependsOn: []string{"simple"},
+		CheckFn: func(_ context.Context, _ check.CheckData) (bool, string, error) {
+			return false, "", errors.New("check failed")
+		},
+	})
+}
+
+func TestStatusCommand_Output(t *testing.T) {
+	tests := []struct {
+		configurer cmd.CheckExecutorConfigFunc
+		name       string
+		format     string
+		contains   string
+		wantErr    string
+		args       []string
+		exitCode   int
+	}{
+		{name: "json", configurer: simpleConfigurer, format: "json", contains: `"success": true`},
+		{name: "yaml", configurer: simpleConfigurer, format: "yaml", contains: "message: simple check passed"},
+		{name: "junit", configurer: simpleConfigurer, format: "junit", contains: `<testcase name="simple"`},
+		{name: "text", configurer: simpleConfigurer, format: "text", contains: "✓ simple - simple check passed"},
+		{
+			name: "sequential", configurer: failingConfigurer, format: "text", contains: "✗ failing - check failed",
+			args: []string{"--max-parallel-checks", "1"}, wantErr: "1 of 2 checks failed", exitCode: 1,
+		},
+		{
+			name: "failure", configurer: failingConfigurer, format: "json", contains: `"error": "check failed"`,
+			wantErr: "1 of 2 checks failed or did not complete", exitCode: 1,
+		},
+		{
+			name: "invalid format", configurer: simpleConfigurer, format: "csv",
+			wantErr: `invalid output format "csv"`, exitCode: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := require.New(t)
+
+			fs := host.NewMemMapFS()
+			mockHost, err := testutil.NewDummyHost(fs, &testutil.DummyHostOptions{})
+			req.NoError(err)
+			command := cmd.NewStatusCmd(&v1alpha1.IkniteClusterSpec{}, utils.NewWaitOptions(), tt.configurer, mockHost)
+			var out bytes.Buffer
+			command.SetOut(&out)
+			command.SetErr(&bytes.Buffer{})
+			command.SetArgs(append([]string{"--output", tt.format}, tt.args...))
+			ctx := util.WithCmdInterface(t.Context(), util.NewCmdInterface(nil))
+			err = command.ExecuteContext(ctx)
+			if tt.wantErr != "" {
+				req.ErrorContains(err, tt.wantErr)
+				req.Equal(tt.exitCode, util.ExitCode(err))
+			} else {
+				req.NoError(err)
+			}
+			req.Contains(out.String(), tt.contains)
+		})
+	}
+}
+
+func TestStatusCommand_Fix(t *testing.T) {
+	req := require.New(t)
+
+	var fixed atomic.Bool
+	configurer := func(executor *check.CheckExecutor, _ *v1alpha1.IkniteClusterSpec, _ *utils.WaitOptions) {
+		executor.AddCheck((&check.Check{
+			Name: "fixable",
+			CheckFn: func(_ context.Context, _ check.CheckData) (bool, string, error) {
+				return fixed.Load(), "", nil
+			},
+		}).WithFix(func(_ context.Context, _ check.CheckData) (string, error) {
+			fixed.Store(true)
+			return "fixed the check", nil
+		}))
+	}
+
+	fs := host.NewMemMapFS()
+	mockHost, err := testutil.NewDummyHost(fs, &testutil.DummyHostOptions{})
+	req.NoError(err)
+	ctx := util.WithCmdInterface(t.Context(), util.NewCmdInterface(nil))
+
+	// Without --fix, the failure is only reported
+	command := cmd.NewStatusCmd(&v1alpha1.IkniteClusterSpec{}, utils.NewWaitOptions(),
+		cmd.CheckExecutorConfigFunc(configurer), mockHost)
+	command.SetOut(&bytes.Buffer{})
+	command.SetErr(&bytes.Buffer{})
+	command.SetArgs([]string{"--output", "text"})
+	req.Error(command.ExecuteContext(ctx))
+	req.False(fixed.Load())
+
+	command = cmd.NewStatusCmd(&v1alpha1.IkniteClusterSpec{}, utils.NewWaitOptions(),
+		cmd.CheckExecutorConfigFunc(configurer), mockHost)
+	var out bytes.Buffer
+	command.SetOut(&out)
+	command.SetErr(&bytes.Buffer{})
+	command.SetArgs([]string{"--output", "text", "--fix"})
+	req.NoError(command.ExecuteContext(ctx))
+	req.Contains(out.String(), "✓ fixable")
+	req.Contains(out.String(), "[fixed: fixed the check]")
+	req.Contains(out.String(), "1 checks: 1 succeeded, 0 failed, 0 skipped, 0 incomplete, 1 fixed")
+
+	// The interactive display runs the fixed checks again
+	fixed.Store(false)
+	command = cmd.NewStatusCmd(&v1alpha1.IkniteClusterSpec{}, utils.NewWaitOptions(),
+		cmd.CheckExecutorConfigFunc(configurer), mockHost, tea.WithInput(&bytes.Buffer{}), tea.WithoutRenderer())
+	command.SetArgs([]string{"--fix"})
+	req.NoError(command.ExecuteContext(ctx))
+	req.True(fixed.Load())
+}
@@ -0,0 +1,169 @@
+/*
+Copyright © 2021 Antoine Martin <antoine@openance.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+// cSpell: words bootstraptokenv1 pubkeypin kubeadm
+// cSpell: disable
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+	certUtil "k8s.io/client-go/util/cert"
+	bootstrapUtil "k8s.io/cluster-bootstrap/token/util"
+	bootstraptokenv1 "k8s.io/kubernetes/cmd/kubeadm/app/apis/bootstraptoken/v1"
+	"k8s.io/kubernetes/cmd/kubeadm/app/cmd/options"
+	kubeadmConstants "k8s.io/kubernetes/cmd/kubeadm/app/constants"
+	tokenPhase "k8s.io/kubernetes/cmd/kubeadm/app/phases/bootstraptoken/node"
+	kubeConfigUtil "k8s.io/kubernetes/cmd/kubeadm/app/util/kubeconfig"
+	"k8s.io/kubernetes/cmd/kubeadm/app/util/pubkeypin"
+
+	"github.com/kaweezle/iknite/pkg/host"
+	"github.com/kaweezle/iknite/pkg/k8s"
+)
+
+// cSpell: enable
+
+// createNewTokensFn creates the bootstrap tokens secrets in the cluster. It is replaced in tests.
+var createNewTokensFn = tokenPhase.CreateNewTokens
+
+type tokenCreateOptions struct {
+	bto            *options.BootstrapTokenOptions
+	kubeconfigPath string
+}
+
+func newTokenCreateOptions() *tokenCreateOptions {
+	bto := options.NewBootstrapTokenOptions()
+	bto.Description = "Bootstrap token generated by 'iknite token create'."
+	return &tokenCreateOptions{
+		bto:            bto,
+		kubeconfigPath: kubeadmConstants.GetAdminKubeConfigPath(),
+	}
+}
+
+func NewTokenCmd(alpineHost host.Host) *cobra.Command {
+	tokenCmd := &cobra.Command{
+		Use:   "token",
+		Short: "Manage bootstrap tokens",
+		Long: `Manages the bootstrap tokens used to join worker nodes to the cluster.
+
+Bootstrap tokens are short lived secrets that allow a worker node to perform
+the discovery of the cluster and the TLS bootstrap of its kubelet.`,
+	}
+	tokenCmd.AddCommand(NewTokenCreateCmd(alpineHost, nil))
+	return tokenCmd
+}
+
+func NewTokenCreateCmd(alpineHost host.Host, createOptions *tokenCreateOptions) *cobra.Command {
+	if alpineHost == nil {
+		alpineHost = host.NewDefaultHost()
+	}
+	if createOptions == nil {
+		createOptions = newTokenCreateOptions()
+	}
+
+	createCmd := &cobra.Command{
+		Use:   "create [token]",
+		Short: "Create a bootstrap token and print the join command",
+		Long: `Creates a bootstrap token on the cluster and prints the 'iknite join'
+command that a worker node can use to join the cluster.
+
+If no token is given, a random one is generated. The token format is
+[a-z0-9]{6}.[a-z0-9]{16}.`,
+		Example: `> iknite token create --ttl 2h`,
+		Args:    cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 0 {
+				createOptions.bto.TokenStr = args[0]
+			}
+			return performTokenCreate(cmd.OutOrStdout(), alpineHost, createOptions)
+		},
+	}
+
+	flags := createCmd.Flags()
+	options.AddKubeConfigFlag(flags, &createOptions.kubeconfigPath)
+	createOptions.bto.AddTTLFlagWithName(flags, "ttl")
+	createOptions.bto.AddUsagesFlag(flags)
+	createOptions.bto.AddGroupsFlag(flags)
+	createOptions.bto.AddDescriptionFlag(flags)
+
+	return createCmd
+}
+
+func performTokenCreate(out io.Writer, fs host.FileSystem, createOptions *tokenCreateOptions) error {
+	tokenStr := createOptions.bto.TokenStr
+	if tokenStr == "" {
+		var err error
+		tokenStr, err = bootstrapUtil.GenerateBootstrapToken()
+		if err != nil {
+			return fmt.Errorf("while generating bootstrap token: %w", err)
+		}
+	}
+	tokenString, err := bootstraptokenv1.NewBootstrapTokenString(tokenStr)
+	if err != nil {
+		return fmt.Errorf("while parsing bootstrap token: %w", err)
+	}
+	token := *createOptions.bto.BootstrapToken
+	token.Token = tokenString
+
+	// Compute the join command first to fail early on an invalid kubeconfig
+	joinCommand, err := joinWorkerCommand(fs, createOptions.kubeconfigPath, tokenString.String())
+	if err != nil {
+		return err
+	}
+
+	client, err := k8s.ClientSetFromFile(fs, createOptions.kubeconfigPath)
+	if err != nil {
+		return fmt.Errorf("while creating client: %w", err)
+	}
+
+	if err = createNewTokensFn(client, []bootstraptokenv1.BootstrapToken{token}); err != nil {
+		return fmt.Errorf("while creating bootstrap token: %w", err)
+	}
+
+	fmt.Fprintln(out, joinCommand)
+	return nil
+}
+
+// joinWorkerCommand returns the iknite join command for the given token and the current cluster of the kubeconfig
+// file.
+func joinWorkerCommand(fs host.FileSystem, kubeconfigPath, token string) (string, error) {
+	kubeConfig, err := k8s.LoadFromFile(fs, kubeconfigPath)
+	if err != nil {
+		return "", fmt.Errorf("while loading kubeconfig: %w", err)
+	}
+
+	_, cluster, err := kubeConfigUtil.GetClusterFromKubeConfig(kubeConfig)
+	if err != nil {
+		return "", fmt.Errorf("malformed kubeconfig file %s: %w", kubeconfigPath, err)
+	}
+	if len(cluster.CertificateAuthorityData) == 0 {
+		return "", errors.New("no CA certificates found in kubeconfig")
+	}
+	caCerts, err := certUtil.ParseCertsPEM(cluster.CertificateAuthorityData)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse CA certificate from kubeconfig: %w", err)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "iknite join %s --token %s", strings.TrimPrefix(cluster.Server, "https://"), token)
+	for _, caCert := range caCerts {
+		fmt.Fprintf(&sb, " --%s %s", options.TokenDiscoveryCAHash, pubkeypin.Hash(caCert))
+	}
+	return sb.String(), nil
+}
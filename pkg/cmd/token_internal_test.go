@@ -0,0 +1,106 @@
+// cSpell: words paralleltest bootstraptokenv1 clientcmd
+//
+//nolint:paralleltest // These tests modify global state and cannot be run in parallel
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	certUtil "k8s.io/client-go/util/cert"
+	bootstraptokenv1 "k8s.io/kubernetes/cmd/kubeadm/app/apis/bootstraptoken/v1"
+	tokenPhase "k8s.io/kubernetes/cmd/kubeadm/app/phases/bootstraptoken/node"
+
+	"github.com/kaweezle/iknite/pkg/host"
+)
+
+const testTokenKubeconfigPath = "/etc/kubernetes/admin.conf"
+
+func writeTestAdminKubeconfig(t *testing.T, fs host.FileSystem, caData []byte) {
+	t.Helper()
+	config := clientcmdapi.NewConfig()
+	config.Clusters["kubernetes"] = &clientcmdapi.Cluster{
+		Server:                   "https://iknite.local:6443",
+		CertificateAuthorityData: caData,
+	}
+	config.AuthInfos["admin"] = &clientcmdapi.AuthInfo{Token: "admin-token"}
+	config.Contexts["admin@kubernetes"] = &clientcmdapi.Context{Cluster: "kubernetes", AuthInfo: "admin"}
+	config.CurrentContext = "admin@kubernetes"
+	content, err := clientcmd.Write(*config)
+	require.NoError(t, err)
+	require.NoError(t, fs.WriteFile(testTokenKubeconfigPath, content, 0o600))
+}
+
+func TestJoinWorkerCommand(t *testing.T) {
+	req := require.New(t)
+	fs := host.NewMemMapFS()
+
+	_, err := joinWorkerCommand(fs, testTokenKubeconfigPath, "abcdef.0123456789abcdef")
+	req.Error(err, "missing kubeconfig")
+
+	writeTestAdminKubeconfig(t, fs, nil)
+	_, err = joinWorkerCommand(fs, testTokenKubeconfigPath, "abcdef.0123456789abcdef")
+	req.ErrorContains(err, "no CA certificates found in kubeconfig")
+
+	caCert, _, err := certUtil.GenerateSelfSignedCertKey("kubernetes", nil, nil)
+	req.NoError(err)
+	writeTestAdminKubeconfig(t, fs, caCert)
+
+	joinCommand, err := joinWorkerCommand(fs, testTokenKubeconfigPath, "abcdef.0123456789abcdef")
+	req.NoError(err)
+	req.True(strings.HasPrefix(joinCommand,
+		"iknite join iknite.local:6443 --token abcdef.0123456789abcdef --discovery-token-ca-cert-hash sha256:"),
+		"unexpected join command: %s", joinCommand)
+	req.NotContains(joinCommand, "\n")
+}
+
+func TestPerformTokenCreate(t *testing.T) {
+	req := require.New(t)
+	fs := host.NewMemMapFS()
+	caCert, _, err := certUtil.GenerateSelfSignedCertKey("kubernetes", nil, nil)
+	req.NoError(err)
+	writeTestAdminKubeconfig(t, fs, caCert)
+
+	var createdTokens []bootstraptokenv1.BootstrapToken
+	createNewTokensFn = func(_ clientset.Interface, tokens []bootstraptokenv1.BootstrapToken) error {
+		createdTokens = tokens
+		return nil
+	}
+	defer func() {
+		createNewTokensFn = tokenPhase.CreateNewTokens
+	}()
+
+	// Generated token
+	createOptions := newTokenCreateOptions()
+	createOptions.kubeconfigPath = testTokenKubeconfigPath
+	var out bytes.Buffer
+	req.NoError(performTokenCreate(&out, fs, createOptions))
+	req.Len(createdTokens, 1)
+	generated := createdTokens[0].Token.String()
+	req.Contains(out.String(), "iknite join iknite.local:6443 --token "+generated)
+	req.Equal("Bootstrap token generated by 'iknite token create'.", createdTokens[0].Description)
+
+	// Provided token
+	out.Reset()
+	createOptions.bto.TokenStr = "abcdef.0123456789abcdef"
+	req.NoError(performTokenCreate(&out, fs, createOptions))
+	req.Equal("abcdef.0123456789abcdef", createdTokens[0].Token.String())
+	req.Contains(out.String(), "--token abcdef.0123456789abcdef")
+
+	// Invalid token
+	createOptions.bto.TokenStr = "invalid"
+	req.ErrorContains(performTokenCreate(&out, fs, createOptions), "while parsing bootstrap token")
+
+	// Error while creating the token
+	createOptions.bto.TokenStr = ""
+	createNewTokensFn = func(_ clientset.Interface, _ []bootstraptokenv1.BootstrapToken) error {
+		return errors.New("secret already exists")
+	}
+	req.ErrorContains(performTokenCreate(&out, fs, createOptions), "secret already exists")
+}
@@ -19,9 +19,12 @@ package config
 // cSpell: disable
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
+	"net"
 	"slices"
 
 	"github.com/bitfield/script"
@@ -93,7 +96,7 @@ func AddIkniteClusterFlags(dest *flag.FlagSet, ikniteConfig *v1alpha1.IkniteClus
 		&ikniteConfig.Kustomization,
 		options.Kustomization,
 		ikniteConfig.Kustomization,
-		"Kustomization location (URL or directory)",
+		"Kustomization location (directory, URL, oci:// artifact or git+ repository)",
 	)
 	flagSet.BoolVar(
 		&ikniteConfig.UseEtcd,
@@ -101,6 +104,30 @@ func AddIkniteClusterFlags(dest *flag.FlagSet, ikniteConfig *v1alpha1.IkniteClus
 		ikniteConfig.UseEtcd,
 		"Use etcd instead of kine as the backing store",
 	)
+	flagSet.BoolVar(
+		&ikniteConfig.AirGapped,
+		options.AirGapped,
+		ikniteConfig.AirGapped,
+		"Verify that the cluster can be initialized without network access before starting",
+	)
+	flagSet.BoolVar(
+		&ikniteConfig.ReconcileKustomization,
+		options.ReconcileKustomization,
+		ikniteConfig.ReconcileKustomization,
+		"Re-apply the kustomization when its rendered content changes",
+	)
+	flagSet.StringVar(
+		&ikniteConfig.LoadBalancerIPPool,
+		options.LoadBalancerIPPool,
+		ikniteConfig.LoadBalancerIPPool,
+		"CIDR of the pool of IPs allocated to the LoadBalancer services (e.g. 192.168.99.16/28)",
+	)
+	flagSet.StringVar(
+		&ikniteConfig.MDNSConflictPolicy,
+		options.MDNSConflictPolicy,
+		ikniteConfig.MDNSConflictPolicy,
+		"What to do when the domain name is used by another host on the network: rename (default) or fail",
+	)
 	flagSet.VisitAll(func(f *flag.Flag) {
 		util.SetFlagConfigSection(flagSet, f.Name, "cluster") //nolint:errcheck // flag exists
 	})
@@ -110,6 +137,27 @@ func AddIkniteClusterFlags(dest *flag.FlagSet, ikniteConfig *v1alpha1.IkniteClus
 // DecodeIkniteConfig decodes the configuration from the viper configuration.
 // This allows providing configuration values as environment variables.
 func DecodeIkniteConfig(ikniteConfig *v1alpha1.IkniteClusterSpec) error {
+	return decodeIkniteSettings(viper.AllSettings()["cluster"], ikniteConfig)
+}
+
+// LoadIkniteConfig reads the configuration file of v again and returns the cluster specification it contains,
+// starting from the default values. The values of the environment are also taken into account. A missing
+// configuration file is not an error.
+func LoadIkniteConfig(v *viper.Viper) (*v1alpha1.IkniteClusterSpec, error) {
+	if err := v.ReadInConfig(); err != nil {
+		if !errors.As(err, &viper.ConfigFileNotFoundError{}) {
+			return nil, fmt.Errorf("failed to read the configuration file: %w", err)
+		}
+	}
+	ikniteConfig := &v1alpha1.IkniteClusterSpec{}
+	v1alpha1.SetDefaults_IkniteClusterSpec(ikniteConfig)
+	if err := decodeIkniteSettings(v.AllSettings()["cluster"], ikniteConfig); err != nil {
+		return nil, err
+	}
+	return ikniteConfig, nil
+}
+
+func decodeIkniteSettings(settings any, ikniteConfig *v1alpha1.IkniteClusterSpec) error {
 	// Cannot use Unmarshal. Look here: https://github.com/spf13/viper/issues/368
 	decoderConfig := mapstructure.DecoderConfig{
 		DecodeHook:       mapstructure.StringToIPHookFunc(),
@@ -123,7 +171,7 @@ func DecodeIkniteConfig(ikniteConfig *v1alpha1.IkniteClusterSpec) error {
 		return fmt.Errorf("while creating decoder: %w", err)
 	}
 
-	if err := decoder.Decode(viper.AllSettings()["cluster"]); err != nil {
+	if err := decoder.Decode(settings); err != nil {
 		return fmt.Errorf("failed to decode cluster settings: %w", err)
 	}
 	return nil
@@ -204,6 +252,36 @@ func ApplyIkniteClusterSpecToInitConfiguration(
 	cfg.NodeRegistration.KubeletExtraArgs = append(cfg.NodeRegistration.KubeletExtraArgs, *arg)
 }
 
+// ApplyIkniteClusterSpecToJoinConfiguration applies IkniteClusterSpec to the JoinConfiguration of a worker node.
+func ApplyIkniteClusterSpecToJoinConfiguration(
+	ikniteCfg *v1alpha1.IkniteClusterSpec,
+	cfg *kubeadmApi.JoinConfiguration,
+) {
+	// Apply configured IP to the node registration
+	arg := &kubeadmApi.Arg{Name: "node-ip", Value: ikniteCfg.Ip.String()}
+	cfg.NodeRegistration.KubeletExtraArgs = append(cfg.NodeRegistration.KubeletExtraArgs, *arg)
+}
+
+// SubstitutionVariables returns the variables substituted in the kustomization. They are computed from ikniteCfg and
+// outboundIP, that may be nil. Variables with an empty value are not defined.
+func SubstitutionVariables(ikniteCfg *v1alpha1.IkniteClusterSpec, outboundIP net.IP) map[string]string {
+	variables := map[string]string{
+		"IKNITE_DOMAIN":             ikniteCfg.DomainName,
+		"IKNITE_CLUSTER_NAME":       ikniteCfg.ClusterName,
+		"IKNITE_KUBERNETES_VERSION": ikniteCfg.KubernetesVersion,
+		"IKNITE_NETWORK_INTERFACE":  ikniteCfg.NetworkInterface,
+	}
+	if ikniteCfg.Ip != nil {
+		variables["IKNITE_IP"] = ikniteCfg.Ip.String()
+		variables["IKNITE_API_ENDPOINT"] = ikniteCfg.GetApiEndPoint()
+	}
+	if outboundIP != nil {
+		variables["IKNITE_OUTBOUND_IP"] = outboundIP.String()
+	}
+	maps.DeleteFunc(variables, func(_, value string) bool { return value == "" })
+	return variables
+}
+
 func GetKubeVipImage() string {
 	return "ghcr.io/kube-vip/kube-vip:v1.1.2"
 }
@@ -309,10 +387,11 @@ func getKustomizationImages(
 	fs host.FileSystem,
 	kustomization string,
 	forceEmbedded bool,
+	substitute *provision.SubstituteOptions,
 	logger *slog.Logger,
 ) ([]string, error) {
 	var containerImages []string
-	resources, err := provision.GetBaseKustomizationResources(fs, kustomization, forceEmbedded, logger)
+	resources, err := provision.GetBaseKustomizationResources(fs, kustomization, forceEmbedded, substitute, logger)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get resources from base kustomizations: %w", err)
 	}
@@ -387,7 +466,8 @@ func GetIkniteImages(
 	}
 
 	// Now let's perform the default kustomization to add images.
-	kustomizationImages, err := getKustomizationImages(fs, ikniteConfig.Kustomization, embedded, logger)
+	substitute := &provision.SubstituteOptions{Variables: SubstitutionVariables(ikniteConfig, nil)}
+	kustomizationImages, err := getKustomizationImages(fs, ikniteConfig.Kustomization, embedded, substitute, logger)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get images from kustomization: %w", err)
 	}
@@ -5,6 +5,7 @@ package config
 
 import (
 	"bytes"
+	"net"
 	"os"
 	"path/filepath"
 	"testing"
@@ -56,6 +57,50 @@ func TestIkniteClusterFlagsAndDecode(t *testing.T) {
 	req.True(spec.UseEtcd)
 }
 
+func TestLoadIkniteConfig(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	configFile := filepath.Join(t.TempDir(), "iknite.yaml")
+	writeConfig := func(content string) {
+		req.NoError(os.WriteFile(configFile, []byte(content), 0o600))
+	}
+	writeConfig(`cluster:
+  cluster_name: demo
+  forwards:
+    - name: web
+      port: 8080
+      target: 10.0.0.5:80
+`)
+	v := viper.New()
+	v.SetConfigFile(configFile)
+
+	spec, err := LoadIkniteConfig(v)
+	req.NoError(err)
+	req.Equal("demo", spec.ClusterName)
+	req.Equal([]v1alpha1.ForwardRule{{Name: "web", Port: 8080, Target: "10.0.0.5:80"}}, spec.Forwards)
+
+	writeConfig(`cluster:
+  forwards:
+    - port: 9090
+      listen_address: 127.0.0.1
+`)
+	spec, err = LoadIkniteConfig(v)
+	req.NoError(err)
+	req.Equal([]v1alpha1.ForwardRule{{Port: 9090, ListenAddress: "127.0.0.1"}}, spec.Forwards)
+
+	writeConfig("cluster: [")
+	_, err = LoadIkniteConfig(v)
+	req.Error(err)
+
+	v = viper.New()
+	v.SetConfigName("iknite")
+	v.AddConfigPath(t.TempDir())
+	spec, err = LoadIkniteConfig(v)
+	req.NoError(err)
+	req.Empty(spec.Forwards)
+}
+
 func TestMarshalAndPrintIkniteConfig(t *testing.T) {
 	t.Parallel()
 	req := require.New(t)
@@ -106,6 +151,35 @@ func TestApplyIkniteClusterSpecToKubeadmConfigs(t *testing.T) {
 	req.NotEmpty(initCfg.NodeRegistration.KubeletExtraArgs)
 	req.Equal("node-ip", initCfg.NodeRegistration.KubeletExtraArgs[0].Name)
 	req.Equal("10.0.0.2", initCfg.NodeRegistration.KubeletExtraArgs[0].Value)
+
+	joinCfg := &kubeadmApi.JoinConfiguration{}
+	ApplyIkniteClusterSpecToJoinConfiguration(spec, joinCfg)
+	req.Len(joinCfg.NodeRegistration.KubeletExtraArgs, 1)
+	req.Equal("node-ip", joinCfg.NodeRegistration.KubeletExtraArgs[0].Name)
+	req.Equal("10.0.0.2", joinCfg.NodeRegistration.KubeletExtraArgs[0].Value)
+}
+
+func TestSubstitutionVariables(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	spec := &v1alpha1.IkniteClusterSpec{
+		KubernetesVersion: "1.35.1",
+		ClusterName:       "iknite",
+		Ip:                []byte{10, 0, 0, 2},
+	}
+	req.Equal(map[string]string{
+		"IKNITE_IP":                 "10.0.0.2",
+		"IKNITE_API_ENDPOINT":       "10.0.0.2",
+		"IKNITE_CLUSTER_NAME":       "iknite",
+		"IKNITE_KUBERNETES_VERSION": "1.35.1",
+	}, SubstitutionVariables(spec, nil))
+
+	spec.DomainName = "iknite.local"
+	variables := SubstitutionVariables(spec, net.IPv4(172, 20, 0, 3))
+	req.Equal("iknite.local", variables["IKNITE_DOMAIN"])
+	req.Equal("iknite.local", variables["IKNITE_API_ENDPOINT"])
+	req.Equal("172.20.0.3", variables["IKNITE_OUTBOUND_IP"])
 }
 
 func TestImageHelpers(t *testing.T) {
@@ -202,7 +276,7 @@ func TestGetKustomizationImages(t *testing.T) {
 	fs := host.NewMemMapFS()
 	kustomization := "/etc/iknite.d"
 	logger := testutil.TestLogger(t)
-	ids, err := getKustomizationImages(fs, kustomization, false, logger)
+	ids, err := getKustomizationImages(fs, kustomization, false, nil, logger)
 	req.NoError(err)
 	req.Len(ids, 9)
 	req.Contains(ids, "public.ecr.aws/docker/library/busybox:1.37.0")
@@ -214,7 +288,7 @@ func TestGetKustomizationImages(t *testing.T) {
 			[]byte("invalid: yaml: :"),
 			os.FileMode(0o644),
 		))
-	_, err = getKustomizationImages(fs, kustomization, false, logger)
+	_, err = getKustomizationImages(fs, kustomization, false, nil, logger)
 	req.Error(err)
 	req.Contains(err.Error(), "failed to get resources from base kustomizations")
 
@@ -227,7 +301,7 @@ func TestGetKustomizationImages(t *testing.T) {
 		[]byte(kustomizationYAML),
 		os.FileMode(0o644),
 	))
-	_, err = getKustomizationImages(fs, kustomization, false, logger)
+	_, err = getKustomizationImages(fs, kustomization, false, nil, logger)
 	req.Error(err)
 	req.Contains(err.Error(), "failed to get images from resource")
 
@@ -235,7 +309,7 @@ func TestGetKustomizationImages(t *testing.T) {
 		[]byte(badGatewayDeploymentYAML),
 		os.FileMode(0o644),
 	))
-	_, err = getKustomizationImages(fs, kustomization, false, logger)
+	_, err = getKustomizationImages(fs, kustomization, false, nil, logger)
 	req.Error(err)
 	req.Contains(err.Error(), "failed to get kgateway gateway image")
 }
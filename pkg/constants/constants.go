@@ -23,6 +23,11 @@ const (
 	IkniteLocalConfPath             = "/root/.kube/iknite.conf"
 	DefaultClusterName              = "iknite"
 	DefaultKustomization            = "/etc/iknite.d"
+	UserChecksDirectory             = "/etc/iknite.d/checks"
+	DefaultApplyRetries             = 5
+	DefaultSubstituteAllow          = "IKNITE_*"
+	KustomizationCacheDir           = "/var/cache/iknite/kustomizations"
+	HelmChartCacheDir               = "/var/cache/iknite/charts"
 	WSLHostName                     = "cluster.iknite"
 	WslIPAddress                    = "192.168.99.2"
 	KubernetesVersion               = "1.35.0"
@@ -39,6 +44,7 @@ const (
 	IkniteServerCertName            = "iknite-server"
 	IkniteClientCertName            = "iknite-client"
 	IkniteServerPort                = 11443
+	KubernetesAPIServerPort         = 6443
 	IkniteConfPath                  = "/etc/kubernetes/iknite.conf"
 	IkniteConfName                  = "iknite"
 	NetworkInterfacesConfFile       = "/etc/network/interfaces"
@@ -0,0 +1,165 @@
+/*
+Copyright © 2021 Antoine Martin <antoine@openance.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cri
+
+// cSpell: words crictl containerd
+// cSpell: disable
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/distribution/reference"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/kaweezle/iknite/pkg/constants"
+	"github.com/kaweezle/iknite/pkg/host"
+)
+
+// cSpell: enable
+
+const (
+	crictlPath = "/usr/bin/crictl"
+	ctrPath    = "/usr/bin/ctr"
+	// ContainerdNamespace is the containerd namespace used by the kubelet through the CRI.
+	ContainerdNamespace = "k8s.io"
+)
+
+type CRIImage struct {
+	ID          string   `json:"id"`
+	RepoTags    []string `json:"repoTags"`
+	RepoDigests []string `json:"repoDigests"`
+}
+
+type CRIImagesResponse struct {
+	Images []CRIImage `json:"images"`
+}
+
+// NormalizeImageReference returns the fully qualified form of image, i.e. nginx becomes
+// docker.io/library/nginx:latest. This is the form used by containerd to store images. When image is pinned by
+// digest, the tag is dropped: registry.k8s.io/pause:3.10@sha256:<digest> becomes registry.k8s.io/pause@sha256:<digest>,
+// as the image is stored by digest.
+func NormalizeImageReference(image string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", fmt.Errorf("invalid image reference %s: %w", image, err)
+	}
+	if canonical, ok := named.(reference.Canonical); ok {
+		pinned, err := reference.WithDigest(reference.TrimNamed(named), canonical.Digest())
+		if err != nil { // nocov - the digest has already been validated
+			return "", fmt.Errorf("invalid image reference %s: %w", image, err)
+		}
+		return pinned.String(), nil
+	}
+	return reference.TagNameOnly(named).String(), nil
+}
+
+// NormalizeImageReferences returns the fully qualified form of all the images.
+func NormalizeImageReferences(images []string) ([]string, error) {
+	result := make([]string, 0, len(images))
+	for _, image := range images {
+		normalized, err := NormalizeImageReference(image)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, normalized)
+	}
+	return result, nil
+}
+
+func crictlArgs(arguments ...string) []string {
+	return append([]string{"--runtime-endpoint", "unix://" + constants.ContainerServiceSock}, arguments...)
+}
+
+func ctrArgs(arguments ...string) []string {
+	return append(
+		[]string{"--address", constants.ContainerServiceSock, "--namespace", ContainerdNamespace},
+		arguments...)
+}
+
+// PullImages pulls the given images in the containerd store used by the kubelet.
+func PullImages(exec host.Executor, images []string, logger *slog.Logger) error {
+	for _, image := range images {
+		logger.Info("Pulling image", "image", image)
+		if out, err := exec.Run(true, crictlPath, crictlArgs("pull", image)...); err != nil {
+			return fmt.Errorf("failed to pull image %s: %w (%s)", image, err, string(out))
+		}
+	}
+	return nil
+}
+
+// LocalImages returns the set of tags and digests of the images present in the containerd store used by the
+// kubelet.
+func LocalImages(exec host.Executor) (sets.Set[string], error) {
+	out, err := exec.Run(false, crictlPath, crictlArgs("images", "--output", "json")...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list local images: %w", err)
+	}
+	response := &CRIImagesResponse{}
+	if err = json.Unmarshal(out, response); err != nil {
+		return nil, fmt.Errorf("failed to parse local images list: %w", err)
+	}
+	result := sets.New[string]()
+	for _, image := range response.Images {
+		result.Insert(image.RepoTags...)
+		result.Insert(image.RepoDigests...)
+	}
+	return result, nil
+}
+
+// MissingImages returns the images that are not present in the containerd store used by the kubelet.
+func MissingImages(exec host.Executor, images []string) ([]string, error) {
+	localImages, err := LocalImages(exec)
+	if err != nil {
+		return nil, err
+	}
+	missing := []string{}
+	for _, image := range images {
+		normalized, err := NormalizeImageReference(image)
+		if err != nil {
+			return nil, err
+		}
+		if !localImages.Has(normalized) {
+			missing = append(missing, image)
+		}
+	}
+	return missing, nil
+}
+
+// ExportImages exports the given images from the containerd store into the OCI tarball at path.
+func ExportImages(exec host.Executor, path string, images []string, logger *slog.Logger) error {
+	normalized, err := NormalizeImageReferences(images)
+	if err != nil {
+		return err
+	}
+	logger.Info("Exporting images", "path", path, "count", len(normalized))
+	arguments := append([]string{"images", "export", path}, normalized...)
+	if out, err := exec.Run(true, ctrPath, ctrArgs(arguments...)...); err != nil {
+		return fmt.Errorf("failed to export images to %s: %w (%s)", path, err, string(out))
+	}
+	return nil
+}
+
+// ImportImages imports the images contained in the OCI tarball at path into the containerd store.
+func ImportImages(exec host.Executor, path string, logger *slog.Logger) error {
+	logger.Info("Importing images", "path", path)
+	out, err := exec.Run(true, ctrPath, ctrArgs("images", "import", path)...)
+	if err != nil {
+		return fmt.Errorf("failed to import images from %s: %w (%s)", path, err, string(out))
+	}
+	logger.Debug(string(out))
+	return nil
+}
@@ -0,0 +1,110 @@
+// cSpell: words crictl containerd
+//
+//nolint:lll // long image digests
+package cri_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	mockHost "github.com/kaweezle/iknite/mocks/pkg/host"
+	"github.com/kaweezle/iknite/pkg/constants"
+	"github.com/kaweezle/iknite/pkg/cri"
+	"github.com/kaweezle/iknite/pkg/testutil"
+)
+
+var crictlEndpoint = []string{"--runtime-endpoint", "unix://" + constants.ContainerServiceSock}
+
+var ctrNamespace = []string{"--address", constants.ContainerServiceSock, "--namespace", cri.ContainerdNamespace}
+
+const localImagesJSON = `{"images":[
+{"id":"sha256:1","repoTags":["registry.k8s.io/pause:3.10"],"repoDigests":["registry.k8s.io/pause@sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"]},
+{"id":"sha256:2","repoTags":["docker.io/rancher/local-path-provisioner:v0.0.35"],"repoDigests":[]}
+]}`
+
+func TestNormalizeImageReference(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	normalized, err := cri.NormalizeImageReference("nginx")
+	req.NoError(err)
+	req.Equal("docker.io/library/nginx:latest", normalized)
+
+	normalized, err = cri.NormalizeImageReference("registry.k8s.io/pause:3.10")
+	req.NoError(err)
+	req.Equal("registry.k8s.io/pause:3.10", normalized)
+
+	// The tag of an image pinned by digest is dropped
+	normalized, err = cri.NormalizeImageReference(
+		"registry.k8s.io/pause:3.10@sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	req.NoError(err)
+	req.Equal("registry.k8s.io/pause@sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", normalized)
+
+	_, err = cri.NormalizeImageReferences([]string{"nginx", "Invalid:Image"})
+	req.Error(err)
+}
+
+func TestPullImages(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	mockExec := mockHost.NewMockExecutor(t)
+	mockExec.EXPECT().Run(true, "/usr/bin/crictl", append(crictlEndpoint, "pull", "nginx")).
+		Return(nil, nil).Once()
+	mockExec.EXPECT().Run(true, "/usr/bin/crictl", append(crictlEndpoint, "pull", "unknown")).
+		Return([]byte("not found"), errors.New("exit status 1")).Once()
+
+	req.NoError(cri.PullImages(mockExec, []string{"nginx"}, testutil.TestLogger(t)))
+	err := cri.PullImages(mockExec, []string{"unknown"}, testutil.TestLogger(t))
+	req.ErrorContains(err, "failed to pull image unknown")
+	req.ErrorContains(err, "not found")
+}
+
+func TestMissingImages(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	mockExec := mockHost.NewMockExecutor(t)
+	mockExec.EXPECT().Run(false, "/usr/bin/crictl", append(crictlEndpoint, "images", "--output", "json")).
+		Return([]byte(localImagesJSON), nil).Once()
+
+	missing, err := cri.MissingImages(mockExec, []string{
+		"registry.k8s.io/pause:3.10",
+		"rancher/local-path-provisioner:v0.0.35",
+		"registry.k8s.io/pause@sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+		"registry.k8s.io/pause:3.10@sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+		"registry.k8s.io/pause:3.10@sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb",
+		"registry.k8s.io/kube-apiserver:v1.36.1",
+	})
+	req.NoError(err)
+	req.Equal([]string{
+		"registry.k8s.io/pause:3.10@sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb",
+		"registry.k8s.io/kube-apiserver:v1.36.1",
+	}, missing)
+
+	mockExec.EXPECT().Run(false, "/usr/bin/crictl", append(crictlEndpoint, "images", "--output", "json")).
+		Return([]byte("not json"), nil).Once()
+	_, err = cri.MissingImages(mockExec, []string{"nginx"})
+	req.ErrorContains(err, "failed to parse local images list")
+}
+
+func TestExportImportImages(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+	logger := testutil.TestLogger(t)
+
+	mockExec := mockHost.NewMockExecutor(t)
+	mockExec.EXPECT().Run(true, "/usr/bin/ctr",
+		append(ctrNamespace, "images", "export", "/tmp/images.tar", "docker.io/library/nginx:latest")).
+		Return(nil, nil).Once()
+	mockExec.EXPECT().Run(true, "/usr/bin/ctr", append(ctrNamespace, "images", "import", "/tmp/images.tar")).
+		Return([]byte("unpacking docker.io/library/nginx:latest...done"), nil).Once()
+	mockExec.EXPECT().Run(true, "/usr/bin/ctr", append(ctrNamespace, "images", "import", "/tmp/bad.tar")).
+		Return([]byte("bad archive"), errors.New("exit status 1")).Once()
+
+	req.NoError(cri.ExportImages(mockExec, "/tmp/images.tar", []string{"nginx"}, logger))
+	req.NoError(cri.ImportImages(mockExec, "/tmp/images.tar", logger))
+	req.ErrorContains(cri.ImportImages(mockExec, "/tmp/bad.tar", logger), "bad archive")
+}
@@ -0,0 +1,466 @@
+/*
+Copyright © 2021 Antoine Martin <antoine@openance.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Package forward forwards TCP ports of the host to the cluster.
+package forward
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"reflect"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
+	"github.com/kaweezle/iknite/pkg/host"
+	"github.com/kaweezle/iknite/pkg/utils"
+)
+
+const dialTimeout = 5 * time.Second
+
+var (
+	// ErrRuleExists is returned when adding a rule with the name of an existing rule.
+	ErrRuleExists = errors.New("forward rule already exists")
+	// ErrRuleNotFound is returned when removing a rule that does not exist.
+	ErrRuleNotFound = errors.New("forward rule not found")
+)
+
+// RuleStatus is a forward rule with its resolved addresses and its connection metrics.
+type RuleStatus struct {
+	v1alpha1.ForwardRule
+	ListenAddr        string `json:"listenAddr"`
+	TargetAddr        string `json:"targetAddr"`
+	Error             string `json:"error,omitempty"`
+	ActiveConnections int64  `json:"activeConnections"`
+	TotalConnections  int64  `json:"totalConnections"`
+	FailedConnections int64  `json:"failedConnections"`
+	BytesIn           int64  `json:"bytesIn"`
+	BytesOut          int64  `json:"bytesOut"`
+}
+
+// NormalizeRule returns rule with its default name and validates it.
+func NormalizeRule(rule v1alpha1.ForwardRule) (v1alpha1.ForwardRule, error) {
+	if rule.Port <= 0 || rule.Port > 65535 {
+		return rule, fmt.Errorf("invalid port %d for forward rule %q", rule.Port, rule.Name)
+	}
+	if rule.Name == "" {
+		rule.Name = strconv.Itoa(rule.Port)
+	}
+	if rule.ListenAddress != "" && net.ParseIP(rule.ListenAddress) == nil {
+		return rule, fmt.Errorf("invalid listen address %q for forward rule %s", rule.ListenAddress, rule.Name)
+	}
+	if host, port, err := net.SplitHostPort(rule.Target); err == nil {
+		if host == "" {
+			return rule, fmt.Errorf("invalid target %q for forward rule %s", rule.Target, rule.Name)
+		}
+		if targetPort, portErr := strconv.Atoi(port); portErr != nil || targetPort <= 0 || targetPort > 65535 {
+			return rule, fmt.Errorf("invalid target port %q for forward rule %s", port, rule.Name)
+		}
+	}
+	return rule, nil
+}
+
+// NormalizeRules normalizes rules and checks that their names are unique.
+func NormalizeRules(rules []v1alpha1.ForwardRule) ([]v1alpha1.ForwardRule, error) {
+	result := make([]v1alpha1.ForwardRule, 0, len(rules))
+	seen := make(map[string]struct{}, len(rules))
+	for _, rule := range rules {
+		normalized, err := NormalizeRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := seen[normalized.Name]; ok {
+			return nil, fmt.Errorf("duplicate forward rule %s", normalized.Name)
+		}
+		seen[normalized.Name] = struct{}{}
+		result = append(result, normalized)
+	}
+	return result, nil
+}
+
+// forwarder serves the connections of a rule.
+type forwarder struct {
+	rule       v1alpha1.ForwardRule
+	listenAddr string
+	targetAddr string
+	listener   net.Listener
+	conns      map[net.Conn]struct{}
+	wg         sync.WaitGroup
+	mu         sync.Mutex
+	closed     bool
+	active     atomic.Int64
+	total      atomic.Int64
+	failed     atomic.Int64
+	bytesIn    atomic.Int64
+	bytesOut   atomic.Int64
+}
+
+func (f *forwarder) status() RuleStatus {
+	return RuleStatus{
+		ForwardRule:       f.rule,
+		ListenAddr:        f.listenAddr,
+		TargetAddr:        f.targetAddr,
+		ActiveConnections: f.active.Load(),
+		TotalConnections:  f.total.Load(),
+		FailedConnections: f.failed.Load(),
+		BytesIn:           f.bytesIn.Load(),
+		BytesOut:          f.bytesOut.Load(),
+	}
+}
+
+// track registers conn so that it is closed with the forwarder. It returns false if the forwarder is closed.
+func (f *forwarder) track(conn net.Conn) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return false
+	}
+	f.conns[conn] = struct{}{}
+	return true
+}
+
+func (f *forwarder) untrack(conn net.Conn) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.conns, conn)
+}
+
+func (f *forwarder) serve(ctx context.Context, network host.NetworkHost, logger *slog.Logger) {
+	defer f.wg.Done()
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logger.Warn("Forward listener stopped", utils.ErrorKey, err, "rule", f.rule.Name)
+			}
+			return
+		}
+		f.wg.Add(1)
+		go f.forward(ctx, network, conn, logger)
+	}
+}
+
+func (f *forwarder) forward(ctx context.Context, network host.NetworkHost, clientConn net.Conn, logger *slog.Logger) {
+	defer f.wg.Done()
+	f.total.Add(1)
+	if !f.track(clientConn) {
+		closeConn(clientConn, "client", logger)
+		return
+	}
+	defer func() {
+		f.untrack(clientConn)
+		closeConn(clientConn, "client", logger)
+	}()
+
+	targetConn, err := network.DialTimeout(ctx, "tcp", f.targetAddr, dialTimeout)
+	if err != nil {
+		f.failed.Add(1)
+		logger.Warn("Forward dial failed", utils.ErrorKey, err, "rule", f.rule.Name, "target", f.targetAddr)
+		return
+	}
+	if !f.track(targetConn) {
+		closeConn(targetConn, "target", logger)
+		return
+	}
+	defer func() {
+		f.untrack(targetConn)
+		closeConn(targetConn, "target", logger)
+	}()
+
+	f.active.Add(1)
+	defer f.active.Add(-1)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		f.bytesIn.Add(copyStream(targetConn, clientConn, logger))
+	}()
+	go func() {
+		defer wg.Done()
+		f.bytesOut.Add(copyStream(clientConn, targetConn, logger))
+	}()
+	wg.Wait()
+}
+
+// close stops accepting connections, closes the open ones and waits for their goroutines to end.
+func (f *forwarder) close() error {
+	err := f.listener.Close()
+	if errors.Is(err, net.ErrClosed) {
+		err = nil
+	}
+	f.mu.Lock()
+	f.closed = true
+	for conn := range f.conns {
+		conn.Close() //nolint:errcheck,gosec // the connection is being dropped
+	}
+	f.mu.Unlock()
+	f.wg.Wait()
+	if err != nil {
+		return fmt.Errorf("while closing the listener of forward rule %s: %w", f.rule.Name, err)
+	}
+	return nil
+}
+
+func copyStream(dst, src net.Conn, logger *slog.Logger) int64 {
+	written, err := io.Copy(dst, src)
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		logger.Debug("Forward stream stopped", utils.ErrorKey, err)
+	}
+	if closeWriter, ok := dst.(interface{ CloseWrite() error }); ok {
+		if err := closeWriter.CloseWrite(); err != nil && !errors.Is(err, net.ErrClosed) {
+			logger.Debug("Failed to close forward write side", utils.ErrorKey, err)
+		}
+	}
+	return written
+}
+
+func closeConn(conn net.Conn, side string, logger *slog.Logger) {
+	if err := conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		logger.Debug("Failed to close forward connection", utils.ErrorKey, err, "side", side)
+	}
+}
+
+// Manager runs the forwarders of a set of rules. The set can be changed while the manager runs: only the rules that
+// are added, changed or removed are restarted.
+type Manager struct {
+	utils.LogEnabled
+	ctx        context.Context //nolint:containedctx // used to dial the targets of the connections
+	network    host.NetworkHost
+	targetIP   net.IP
+	onChange   func([]v1alpha1.ForwardRule)
+	forwarders map[string]*forwarder
+	errors     map[string]string
+	desired    []v1alpha1.ForwardRule
+	mu         sync.Mutex
+}
+
+// NewManager creates a manager forwarding connections with network. The rules without target host are forwarded to
+// targetIP and the rules without listen address listen on the outbound IP address of the host. onChange, if not nil,
+// is called with the rules after they are modified with Add or Remove.
+func NewManager(
+	ctx context.Context,
+	network host.NetworkHost,
+	targetIP net.IP,
+	onChange func([]v1alpha1.ForwardRule),
+	logger *slog.Logger,
+) *Manager {
+	return &Manager{
+		LogEnabled: utils.LogEnabled{LogEntry: logger},
+		ctx:        ctx,
+		network:    network,
+		targetIP:   targetIP,
+		onChange:   onChange,
+		forwarders: map[string]*forwarder{},
+		errors:     map[string]string{},
+	}
+}
+
+func (m *Manager) addresses(rule v1alpha1.ForwardRule) (string, string, error) {
+	listenIP := rule.ListenAddress
+	if listenIP == "" {
+		outboundIP, err := m.network.GetOutboundIP()
+		if err != nil {
+			return "", "", fmt.Errorf("failed to get outbound IP: %w", err)
+		}
+		listenIP = outboundIP.String()
+	}
+	listenAddr := net.JoinHostPort(listenIP, strconv.Itoa(rule.Port))
+
+	targetAddr := rule.Target
+	if _, _, err := net.SplitHostPort(targetAddr); err != nil {
+		targetHost := targetAddr
+		if targetHost == "" {
+			if m.targetIP == nil {
+				return "", "", fmt.Errorf("forward rule %s has no target and there is no cluster IP", rule.Name)
+			}
+			targetHost = m.targetIP.String()
+		}
+		targetAddr = net.JoinHostPort(targetHost, strconv.Itoa(rule.Port))
+	}
+	if listenAddr == targetAddr {
+		return "", "", fmt.Errorf("forward rule %s forwards %s to itself", rule.Name, listenAddr)
+	}
+	return listenAddr, targetAddr, nil
+}
+
+// start starts the forwarder of rule. It must be called with the lock held.
+func (m *Manager) start(rule v1alpha1.ForwardRule) error {
+	listenAddr, targetAddr, err := m.addresses(rule)
+	if err != nil {
+		return err
+	}
+	listener, err := m.network.Listen(m.ctx, "tcp", listenAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s for forward rule %s: %w", listenAddr, rule.Name, err)
+	}
+	f := &forwarder{
+		rule:       rule,
+		listenAddr: listenAddr,
+		targetAddr: targetAddr,
+		listener:   listener,
+		conns:      map[net.Conn]struct{}{},
+	}
+	f.wg.Add(1)
+	go f.serve(m.ctx, m.network, m.Logger())
+	m.forwarders[rule.Name] = f
+	m.Logger().Info("Forwarding port", "rule", rule.Name, "listen", listenAddr, "target", targetAddr)
+	return nil
+}
+
+// stop stops the forwarder of the rule name. It must be called with the lock held.
+func (m *Manager) stop(name string) error {
+	f, ok := m.forwarders[name]
+	if !ok {
+		return nil
+	}
+	delete(m.forwarders, name)
+	m.Logger().Info("Stopping port forwarding", "rule", name, "listen", f.listenAddr)
+	return f.close()
+}
+
+// Apply makes the manager forward the ports of rules. Unchanged rules are kept running. The rules that cannot be
+// started are reported in the returned error and in Status. Applying the same rules again does nothing.
+func (m *Manager) Apply(rules []v1alpha1.ForwardRule) error {
+	rules, err := NormalizeRules(rules)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.desired != nil && reflect.DeepEqual(rules, m.desired) {
+		return nil
+	}
+	return m.apply(rules)
+}
+
+// apply must be called with the lock held.
+func (m *Manager) apply(rules []v1alpha1.ForwardRule) error {
+	m.desired = rules
+	wanted := make(map[string]v1alpha1.ForwardRule, len(rules))
+	for _, rule := range rules {
+		wanted[rule.Name] = rule
+	}
+
+	var errs []error
+	for name, f := range m.forwarders {
+		if rule, ok := wanted[name]; !ok || rule != f.rule {
+			if err := m.stop(name); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	clear(m.errors)
+	for _, rule := range rules {
+		if _, ok := m.forwarders[rule.Name]; ok {
+			continue
+		}
+		if err := m.start(rule); err != nil {
+			m.errors[rule.Name] = err.Error()
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Add starts forwarding the port of rule.
+func (m *Manager) Add(rule v1alpha1.ForwardRule) error {
+	rule, err := NormalizeRule(rule)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	if slices.ContainsFunc(m.desired, func(r v1alpha1.ForwardRule) bool { return r.Name == rule.Name }) {
+		m.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrRuleExists, rule.Name)
+	}
+	if err = m.start(rule); err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	m.desired = append(slices.Clone(m.desired), rule)
+	rules := slices.Clone(m.desired)
+	m.mu.Unlock()
+
+	m.changed(rules)
+	return nil
+}
+
+// Remove stops forwarding the port of the rule name.
+func (m *Manager) Remove(name string) error {
+	m.mu.Lock()
+	index := slices.IndexFunc(m.desired, func(r v1alpha1.ForwardRule) bool { return r.Name == name })
+	if index < 0 {
+		m.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrRuleNotFound, name)
+	}
+	m.desired = slices.Delete(slices.Clone(m.desired), index, index+1)
+	delete(m.errors, name)
+	err := m.stop(name)
+	rules := slices.Clone(m.desired)
+	m.mu.Unlock()
+
+	m.changed(rules)
+	return err
+}
+
+func (m *Manager) changed(rules []v1alpha1.ForwardRule) {
+	if m.onChange != nil {
+		m.onChange(rules)
+	}
+}
+
+// Rules returns the rules of the manager.
+func (m *Manager) Rules() []v1alpha1.ForwardRule {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.desired)
+}
+
+// Status returns the status of the rules of the manager, in the order of the rules.
+func (m *Manager) Status() []RuleStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := make([]RuleStatus, 0, len(m.desired))
+	for _, rule := range m.desired {
+		if f, ok := m.forwarders[rule.Name]; ok {
+			result = append(result, f.status())
+		} else {
+			result = append(result, RuleStatus{ForwardRule: rule, Error: m.errors[rule.Name]})
+		}
+	}
+	return result
+}
+
+// Close stops all the forwarders.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var errs []error
+	for name := range m.forwarders {
+		if err := m.stop(name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,151 @@
+//nolint:errcheck // Unit testing
+package forward_test
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
+	"github.com/kaweezle/iknite/pkg/forward"
+	"github.com/kaweezle/iknite/pkg/host"
+	"github.com/kaweezle/iknite/pkg/testutil"
+)
+
+// startBackend starts a server answering each line it receives with prefix followed by the line.
+func startBackend(t *testing.T, prefix string) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, acceptErr := listener.Accept()
+			if acceptErr != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					if _, writeErr := conn.Write([]byte(prefix + scanner.Text() + "\n")); writeErr != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port //nolint:forcetypeassert // tcp listener
+}
+
+func roundTrip(t *testing.T, port int, payload string) string {
+	t.Helper()
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), time.Second)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+	_, err = conn.Write([]byte(payload + "\n"))
+	require.NoError(t, err)
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	require.NoError(t, err)
+	return line
+}
+
+func TestNormalizeRules(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	rules, err := forward.NormalizeRules([]v1alpha1.ForwardRule{
+		{Port: 8080, Target: "10.0.0.5:80"},
+		{Name: "api", Port: 6443},
+	})
+	req.NoError(err)
+	req.Equal("8080", rules[0].Name)
+	req.Equal("api", rules[1].Name)
+
+	_, err = forward.NormalizeRules([]v1alpha1.ForwardRule{{Port: 8080}, {Name: "8080", Port: 8081}})
+	req.ErrorContains(err, "duplicate")
+
+	for _, rule := range []v1alpha1.ForwardRule{
+		{Port: 0},
+		{Port: 70000},
+		{Port: 80, ListenAddress: "localhost"},
+		{Port: 80, Target: ":80"},
+		{Port: 80, Target: "10.0.0.5:http"},
+	} {
+		_, err = forward.NormalizeRule(rule)
+		req.Error(err, "rule %+v", rule)
+	}
+}
+
+func TestManager(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	first := startBackend(t, "first:")
+	second := startBackend(t, "second:")
+	port := freePort(t)
+
+	var changes [][]v1alpha1.ForwardRule
+	manager := forward.NewManager(t.Context(), host.NewDefaultHost(), net.ParseIP("127.0.0.1"),
+		func(rules []v1alpha1.ForwardRule) { changes = append(changes, rules) }, testutil.TestLogger(t))
+	defer manager.Close()
+
+	rules := []v1alpha1.ForwardRule{{Name: "web", ListenAddress: "127.0.0.1", Port: port, Target: first}}
+	req.NoError(manager.Apply(rules))
+	req.Equal("first:hello\n", roundTrip(t, port, "hello"))
+
+	// Applying the same rules keeps the forwarder and its metrics
+	req.NoError(manager.Apply(rules))
+	req.Eventually(func() bool { return manager.Status()[0].ActiveConnections == 0 }, 5*time.Second, 10*time.Millisecond)
+	status := manager.Status()
+	req.Len(status, 1)
+	req.Equal(int64(1), status[0].TotalConnections)
+	req.Equal(int64(6), status[0].BytesIn)
+	req.Equal(int64(12), status[0].BytesOut)
+	req.Equal(first, status[0].TargetAddr)
+
+	// Hot reload with another target
+	rules[0].Target = second
+	req.NoError(manager.Apply(rules))
+	req.Equal("second:hello\n", roundTrip(t, port, "hello"))
+	req.Equal(int64(1), manager.Status()[0].TotalConnections)
+
+	// Runtime rules
+	otherPort := freePort(t)
+	added := v1alpha1.ForwardRule{ListenAddress: "127.0.0.1", Port: otherPort, Target: first}
+	req.NoError(manager.Add(added))
+	req.True(errors.Is(manager.Add(added), forward.ErrRuleExists))
+	req.Equal("first:again\n", roundTrip(t, otherPort, "again"))
+	req.Len(changes, 1)
+	req.Len(changes[0], 2)
+	req.Equal(strconv.Itoa(otherPort), changes[0][1].Name)
+
+	req.NoError(manager.Remove("web"))
+	req.True(errors.Is(manager.Remove("web"), forward.ErrRuleNotFound))
+	req.Len(changes, 2)
+	req.Equal(changes[1], manager.Rules())
+	_, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), time.Second)
+	req.Error(err)
+
+	// A rule forwarding to itself is reported in the status
+	req.Error(manager.Apply([]v1alpha1.ForwardRule{{Name: "loop", ListenAddress: "127.0.0.1", Port: port}}))
+	status = manager.Status()
+	req.Len(status, 1)
+	req.Contains(status[0].Error, "to itself")
+
+	req.NoError(manager.Close())
+}
@@ -0,0 +1,318 @@
+/*
+Copyright © 2021 Antoine Martin <antoine@openance.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package k8s
+
+// cSpell: words resid apimachinery metav apiextensions resmap
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/cli-runtime/pkg/resource"
+	"sigs.k8s.io/kustomize/api/provider"
+	"sigs.k8s.io/kustomize/api/resmap"
+	kustomizeResource "sigs.k8s.io/kustomize/api/resource"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+
+	"github.com/kaweezle/iknite/pkg/constants"
+	"github.com/kaweezle/iknite/pkg/utils"
+)
+
+const (
+	ApplyStageNamespaces = "namespaces"
+	ApplyStageCRDs       = "crds"
+	ApplyStageResources  = "resources"
+)
+
+var crdGVR = schema.GroupVersionResource{
+	Group:    "apiextensions.k8s.io",
+	Version:  "v1",
+	Resource: "customresourcedefinitions",
+}
+
+// ApplyOptions controls the retries of ApplyResMapWithServerSideApply.
+type ApplyOptions struct {
+	// Backoff is used to retry the objects that failed to apply in a stage.
+	Backoff wait.Backoff
+	// CRDEstablishedTimeout is the maximum time to wait for the applied CRDs to be established.
+	CRDEstablishedTimeout time.Duration
+	// CRDEstablishedInterval is the interval between checks of the CRDs status.
+	CRDEstablishedInterval time.Duration
+}
+
+// DefaultApplyOptions returns the options used to apply the kustomizations.
+func DefaultApplyOptions() *ApplyOptions {
+	return &ApplyOptions{
+		Backoff: wait.Backoff{
+			Duration: time.Second,
+			Factor:   2, //nolint:mnd // exponential backoff
+			Steps:    constants.DefaultApplyRetries,
+			Cap:      30 * time.Second,
+		},
+		CRDEstablishedTimeout:  time.Minute,
+		CRDEstablishedInterval: time.Second,
+	}
+}
+
+// ApplyResult is the outcome of the application of one object.
+type ApplyResult struct {
+	ID       resid.ResId
+	Stage    string
+	Attempts int
+	Err      error
+}
+
+// ApplyReport contains the outcome of the application of each object of a kustomization.
+type ApplyReport struct {
+	Results []*ApplyResult
+}
+
+// Succeeded returns the IDs of the objects successfully applied.
+func (r *ApplyReport) Succeeded() []resid.ResId {
+	result := []resid.ResId{}
+	for _, applyResult := range r.Results {
+		if applyResult.Err == nil {
+			result = append(result, applyResult.ID)
+		}
+	}
+	return result
+}
+
+// Failed returns the results of the objects that could not be applied.
+func (r *ApplyReport) Failed() []*ApplyResult {
+	result := []*ApplyResult{}
+	for _, applyResult := range r.Results {
+		if applyResult.Err != nil {
+			result = append(result, applyResult)
+		}
+	}
+	return result
+}
+
+// Err returns an error listing the objects that could not be applied, or nil if all objects have been applied.
+func (r *ApplyReport) Err() error {
+	failed := r.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+	errs := make([]error, 0, len(failed))
+	for _, applyResult := range failed {
+		errs = append(errs, fmt.Errorf("%s: %w", applyResult.ID, applyResult.Err))
+	}
+	return fmt.Errorf("%d of %d resources failed to apply: %w", len(failed), len(r.Results), errors.Join(errs...))
+}
+
+// cachedMapperGetter shares the same RESTMapper between all the builders of an apply, so that discovery happens once
+// per stage instead of once per object.
+type cachedMapperGetter struct {
+	resource.RESTClientGetter
+	mapper meta.RESTMapper
+}
+
+func (g *cachedMapperGetter) ToRESTMapper() (meta.RESTMapper, error) {
+	if g.mapper == nil {
+		mapper, err := g.RESTClientGetter.ToRESTMapper()
+		if err != nil {
+			return nil, fmt.Errorf("while getting REST mapper: %w", err)
+		}
+		g.mapper = mapper
+	}
+	return g.mapper, nil
+}
+
+// reset makes the mapper discover the resources again, typically after new CRDs have been established.
+func (g *cachedMapperGetter) reset() {
+	if resettable, ok := g.mapper.(meta.ResettableRESTMapper); ok {
+		resettable.Reset()
+	}
+}
+
+func applyStage(res *kustomizeResource.Resource) string {
+	id := res.CurId()
+	switch {
+	case id.Group == "" && id.Kind == "Namespace":
+		return ApplyStageNamespaces
+	case id.Group == crdGVR.Group && id.Kind == "CustomResourceDefinition":
+		return ApplyStageCRDs
+	default:
+		return ApplyStageResources
+	}
+}
+
+// applyResource applies a single resource with server-side apply.
+func applyResource(client resource.RESTClientGetter, res *kustomizeResource.Resource) error {
+	single := resmap.NewFactory(provider.NewDefaultDepProvider().GetResourceFactory()).
+		FromResourceSlice([]*kustomizeResource.Resource{res})
+	infos, err := ResourceInfosFromResMap(client, single)
+	if err != nil {
+		return err
+	}
+	return ApplyResourceInfosServerSide(infos)
+}
+
+func boolRank(value bool) int {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+type stagedApplier struct {
+	client  *cachedMapperGetter
+	options *ApplyOptions
+	logger  *slog.Logger
+}
+
+// applyWithRetries applies resources, retrying the failed ones with backoff.
+func (a *stagedApplier) applyWithRetries(
+	ctx context.Context,
+	stage string,
+	resources []*kustomizeResource.Resource,
+) []*ApplyResult {
+	results := make([]*ApplyResult, len(resources))
+	for i, res := range resources {
+		results[i] = &ApplyResult{ID: res.CurId(), Stage: stage}
+	}
+
+	backoff := a.options.Backoff
+	pending := make([]int, len(resources))
+	for i := range pending {
+		pending[i] = i
+	}
+	for {
+		failed := []int{}
+		for _, i := range pending {
+			results[i].Attempts++
+			results[i].Err = applyResource(a.client, resources[i])
+			if results[i].Err != nil {
+				failed = append(failed, i)
+			}
+		}
+		if len(failed) == 0 || backoff.Steps <= 1 {
+			break
+		}
+		delay := backoff.Step()
+		a.logger.Info("Retrying failed resources", "stage", stage, "count", len(failed), "delay", delay)
+		select {
+		case <-ctx.Done():
+			return results
+		case <-time.After(delay):
+		}
+		// The kinds of the failed resources may have been registered in the meantime
+		a.client.reset()
+		pending = failed
+	}
+	return results
+}
+
+// isEstablished returns true if the CRD has an Established condition set to True.
+func isEstablished(crd *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(crd.Object, "status", "conditions") //nolint:errcheck // no condition
+	for _, condition := range conditions {
+		conditionMap, ok := condition.(map[string]any)
+		if ok && conditionMap["type"] == "Established" && conditionMap["status"] == string(metaV1.ConditionTrue) {
+			return true
+		}
+	}
+	return false
+}
+
+// waitForCRDs waits for the successfully applied CRDs of results to be established. The CRDs not established in time
+// are marked as failed.
+func (a *stagedApplier) waitForCRDs(ctx context.Context, results []*ApplyResult) {
+	dynamicClient, err := newDynamicClientFn(a.client)
+	if err != nil {
+		a.logger.Warn("Cannot wait for CRDs to be established", utils.ErrorKey, err)
+		return
+	}
+	for _, applyResult := range results {
+		if applyResult.Err != nil {
+			continue
+		}
+		name := applyResult.ID.Name
+		err = wait.PollUntilContextTimeout(ctx, a.options.CRDEstablishedInterval, a.options.CRDEstablishedTimeout, true,
+			func(ctx context.Context) (bool, error) {
+				crd, err := dynamicClient.Resource(crdGVR).Get(ctx, name, metaV1.GetOptions{})
+				if err != nil {
+					a.logger.Debug("Waiting for CRD", "crd", name, utils.ErrorKey, err)
+					return false, nil
+				}
+				return isEstablished(crd), nil
+			})
+		if err != nil {
+			applyResult.Err = fmt.Errorf("CRD %s not established: %w", name, err)
+		}
+	}
+}
+
+// ApplyResMapWithServerSideApply applies the given resources to the cluster using server-side apply, in stages:
+// namespaces first, then CRDs, then, once the CRDs are established, all the other resources. Resources that fail to
+// apply are retried with backoff. The report contains the outcome of each resource. The returned error is the one of
+// the report.
+func ApplyResMapWithServerSideApply(
+	ctx context.Context,
+	client resource.RESTClientGetter,
+	resources resmap.ResMap,
+	options *ApplyOptions,
+	logger *slog.Logger,
+) (*ApplyReport, error) {
+	if options == nil {
+		options = DefaultApplyOptions()
+	}
+	applier := &stagedApplier{
+		client:  &cachedMapperGetter{RESTClientGetter: client},
+		options: options,
+		logger:  logger,
+	}
+
+	stages := map[string][]*kustomizeResource.Resource{}
+	for _, res := range resources.Resources() {
+		stage := applyStage(res)
+		stages[stage] = append(stages[stage], res)
+	}
+	// Cluster scoped resources come first as namespaced resources may depend on them
+	slices.SortStableFunc(stages[ApplyStageResources], func(a, b *kustomizeResource.Resource) int {
+		return boolRank(!a.CurId().IsClusterScoped()) - boolRank(!b.CurId().IsClusterScoped())
+	})
+
+	report := &ApplyReport{Results: make([]*ApplyResult, 0, resources.Size())}
+	for _, stage := range []string{ApplyStageNamespaces, ApplyStageCRDs, ApplyStageResources} {
+		if len(stages[stage]) == 0 {
+			continue
+		}
+		logger.Debug("Applying stage", "stage", stage, "count", len(stages[stage]))
+		results := applier.applyWithRetries(ctx, stage, stages[stage])
+		if stage == ApplyStageCRDs {
+			applier.waitForCRDs(ctx, results)
+			applier.client.reset()
+		}
+		report.Results = append(report.Results, results...)
+	}
+
+	for _, applyResult := range report.Failed() {
+		logger.Warn("Resource failed to apply", "resource", applyResult.ID.String(), "stage", applyResult.Stage,
+			"attempts", applyResult.Attempts, utils.ErrorKey, applyResult.Err)
+	}
+	return report, report.Err()
+}
@@ -0,0 +1,145 @@
+// cSpell: words apimachinery apiextensions testutil resmap
+package k8s
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/kustomize/api/provider"
+	"sigs.k8s.io/kustomize/api/resmap"
+
+	"github.com/kaweezle/iknite/pkg/testutil"
+)
+
+const stagedResources = `apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: widget
+  namespace: test
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: test
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: test
+`
+
+//nolint:lll // JSON response
+const establishedCRD = `{"apiVersion":"apiextensions.k8s.io/v1","kind":"CustomResourceDefinition","metadata":{"name":"widgets.example.com"},"status":{"conditions":[{"type":"Established","status":"True"}]}}`
+
+const pendingCRD = `{"apiVersion":"apiextensions.k8s.io/v1","kind":"CustomResourceDefinition","metadata":{"name":"widgets.example.com"}}`
+
+// discoveringMapper only knows the Widget kind after a reset, like a discovery mapper once the CRD is established.
+type discoveringMapper struct {
+	*meta.DefaultRESTMapper
+}
+
+func (m *discoveringMapper) Reset() {
+	m.Add(schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}, meta.RESTScopeNamespace)
+}
+
+func newDiscoveringMapper() *discoveringMapper {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}, meta.RESTScopeRoot)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: crdGVR.Group, Version: "v1", Kind: "CustomResourceDefinition"},
+		meta.RESTScopeRoot)
+	return &discoveringMapper{DefaultRESTMapper: mapper}
+}
+
+type stagedServer struct {
+	crd     string
+	mu      sync.Mutex
+	patches []string
+}
+
+func (s *stagedServer) handle(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodPatch:
+		s.mu.Lock()
+		s.patches = append(s.patches, r.URL.Path)
+		s.mu.Unlock()
+		body, _ := io.ReadAll(r.Body) //nolint:errcheck // test server
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(body) //nolint:errcheck // test server
+	case strings.HasSuffix(r.URL.Path, "/customresourcedefinitions/widgets.example.com"):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(s.crd)) //nolint:errcheck // test server
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func stagedApplyOptions() *ApplyOptions {
+	return &ApplyOptions{
+		Backoff:                wait.Backoff{Duration: time.Millisecond, Steps: 2},
+		CRDEstablishedTimeout:  100 * time.Millisecond,
+		CRDEstablishedInterval: 10 * time.Millisecond,
+	}
+}
+
+func TestApplyResMapWithServerSideApply_Stages(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	resources, err := resmap.NewFactory(provider.NewDefaultDepProvider().GetResourceFactory()).
+		NewResMapFromBytes([]byte(stagedResources))
+	req.NoError(err)
+
+	server := &stagedServer{crd: establishedCRD}
+	getter := testutil.CreateClientGetterWithTestServer(t, newDiscoveringMapper(), server.handle)
+
+	report, err := ApplyResMapWithServerSideApply(t.Context(), getter, resources, stagedApplyOptions(),
+		testutil.TestLogger(t))
+	req.NoError(err)
+	req.Len(report.Succeeded(), 4)
+	req.Equal([]string{
+		"/api/v1/namespaces/test",
+		"/apis/apiextensions.k8s.io/v1/customresourcedefinitions/widgets.example.com",
+		"/apis/example.com/v1/namespaces/test/widgets/widget",
+		"/api/v1/namespaces/test/configmaps/config",
+	}, server.patches)
+	for _, result := range report.Results {
+		req.Equal(1, result.Attempts, result.ID.String())
+	}
+}
+
+func TestApplyResMapWithServerSideApply_CRDNotEstablished(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	resources, err := resmap.NewFactory(provider.NewDefaultDepProvider().GetResourceFactory()).
+		NewResMapFromBytes([]byte(stagedResources))
+	req.NoError(err)
+
+	server := &stagedServer{crd: pendingCRD}
+	getter := testutil.CreateClientGetterWithTestServer(t, newDiscoveringMapper(), server.handle)
+
+	report, err := ApplyResMapWithServerSideApply(t.Context(), getter, resources, stagedApplyOptions(),
+		testutil.TestLogger(t))
+	req.ErrorContains(err, "1 of 4 resources failed to apply")
+	req.ErrorContains(err, "CRD widgets.example.com not established")
+	failed := report.Failed()
+	req.Len(failed, 1)
+	req.Equal(ApplyStageCRDs, failed[0].Stage)
+}
@@ -35,9 +35,7 @@ import (
 	"k8s.io/client-go/util/cert"
 	"k8s.io/kubectl/pkg/polymorphichelpers"
 	kubeadmConstants "k8s.io/kubernetes/cmd/kubeadm/app/constants"
-	"sigs.k8s.io/kustomize/api/provider"
 	"sigs.k8s.io/kustomize/api/resmap"
-	"sigs.k8s.io/kustomize/kyaml/resid"
 
 	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
 	"github.com/kaweezle/iknite/pkg/host"
@@ -278,6 +276,9 @@ func StatusViewerFor(kind schema.GroupKind) (polymorphichelpers.StatusViewer, er
 	if kind == ApplicationSchemaGroupVersionKind.GroupKind() {
 		return &ApplicationStatusViewer{}, nil
 	}
+	if (&FluxStatusReader{}).Supports(kind) {
+		return &FluxStatusViewer{}, nil
+	}
 	sv, err := polymorphichelpers.StatusViewerFor(kind)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get status viewer for %v: %w", kind, err)
@@ -307,48 +308,11 @@ func (s *ApplicationStatusViewer) Status(
 	return message, healthStatusString == "Healthy" && syncStatusString == "Synced", nil
 }
 
-// ApplyResMapWithServerSideApply applies the given resources to the cluster using server-side apply. It returns the
-// IDs of the applied resources or an error if the operation fails.
-func ApplyResMapWithServerSideApply(client resource.RESTClientGetter, resources resmap.ResMap) ([]resid.ResId, error) {
-	ids := resources.AllIds()
-
-	// Separate cluster-scoped resources from namespace-scoped ones, as the former need to be applied before the latter
-	// to avoid potential dependency issues.
-	clusterResources := resmap.NewFactory(provider.NewDefaultDepProvider().GetResourceFactory()).
-		FromResourceSlice(resources.ClusterScoped())
-	if clusterResources.Size() != 0 {
-		clusterInfos, err := ResourceInfosFromResMap(client, clusterResources)
-		if err != nil {
-			return nil, fmt.Errorf("failed to build cluster resource infos: %w", err)
-		}
-		if err = ApplyResourceInfosServerSide(clusterInfos); err != nil {
-			return nil, fmt.Errorf("failed to apply cluster resources: %w", err)
-		}
-
-		// Remove cluster-scoped resources from the original resmap to avoid applying them again in the next step.
-		for _, curID := range clusterResources.AllIds() {
-			if err = resources.Remove(curID); err != nil {
-				return nil, fmt.Errorf("failed to remove cluster-scoped resource: %w", err)
-			}
-		}
-	}
-
-	// Apply namespace-scoped resources after cluster-scoped ones.
-	if resources.Size() != 0 {
-		resourceInfos, err := ResourceInfosFromResMap(client, resources)
-		if err != nil {
-			return nil, fmt.Errorf("failed to build resource infos: %w", err)
-		}
-		if err = ApplyResourceInfosServerSide(resourceInfos); err != nil {
-			return nil, fmt.Errorf("failed to apply resources: %w", err)
-		}
-	}
-
-	return ids, nil
-}
-
 func AllWorkloadStates(client resource.RESTClientGetter, logger *slog.Logger) ([]*v1alpha1.WorkloadState, error) {
-	resourceTypes := []string{"deployments", "statefulsets", "daemonsets", "applications"}
+	resourceTypes := []string{
+		"deployments", "statefulsets", "daemonsets", "applications",
+		"kustomizations", "helmreleases", "gitrepositories",
+	}
 
 	mapper, err := client.ToRESTMapper()
 	if err != nil {
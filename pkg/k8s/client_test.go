@@ -12,12 +12,14 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
 	cliOptions "k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/cli-runtime/pkg/resource"
 	"k8s.io/client-go/rest"
@@ -25,7 +27,6 @@ import (
 	kubeadmConstants "k8s.io/kubernetes/cmd/kubeadm/app/constants"
 	"sigs.k8s.io/kustomize/api/provider"
 	"sigs.k8s.io/kustomize/api/resmap"
-	"sigs.k8s.io/kustomize/kyaml/resid"
 
 	"github.com/kaweezle/iknite/mocks/k8s.io/cli-runtime/pkg/genericclioptions"
 	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
@@ -48,11 +49,6 @@ type asYAMLErrorResMap struct{ resmap.ResMap }
 
 func (m asYAMLErrorResMap) AsYaml() ([]byte, error) { return nil, errors.New("yaml conversion boom") }
 
-type removeErrorResMap struct{ resmap.ResMap }
-
-//nolint:gocritic // interface
-func (m removeErrorResMap) Remove(_ resid.ResId) error { return errors.New("remove boom") }
-
 type jsonMarshalErrorObject struct{}
 
 func (jsonMarshalErrorObject) GetObjectKind() schema.ObjectKind { return schema.EmptyObjectKind }
@@ -187,9 +183,9 @@ func TestResourceInfosFromResMap(t *testing.T) {
 	err = k8s.ApplyResourceInfosServerSide(infos)
 	req.NoError(err)
 
-	ids, err := k8s.ApplyResMapWithServerSideApply(mGetter, resources)
+	report, err := k8s.ApplyResMapWithServerSideApply(t.Context(), mGetter, resources, nil, testutil.TestLogger(t))
 	req.NoError(err)
-	req.Len(ids, 5)
+	req.Len(report.Succeeded(), 5)
 }
 
 func TestStatusViewerForAndApplicationStatusViewer(t *testing.T) {
@@ -324,103 +320,65 @@ func TestApplyResourceInfosServerSide_ErrorPaths(t *testing.T) {
 	req.Contains(err.Error(), "failed to convert resource")
 }
 
+func fastApplyOptions() *k8s.ApplyOptions {
+	options := k8s.DefaultApplyOptions()
+	options.Backoff = wait.Backoff{Duration: time.Millisecond, Steps: 2}
+	return options
+}
+
 func TestApplyResMapWithServerSideApply_Branches(t *testing.T) {
 	t.Parallel()
 	req := require.New(t)
+	logger := testutil.TestLogger(t)
 
 	getter := genericclioptions.NewMockRESTClientGetter(t)
 	getter.EXPECT().ToRESTMapper().Return(nil, errors.New("mapper boom"))
-	_, err := k8s.ApplyResMapWithServerSideApply(getter, sampleResMap(t))
-	req.Error(err)
-	req.Contains(err.Error(), "failed to build cluster resource infos")
+	report, err := k8s.ApplyResMapWithServerSideApply(t.Context(), getter, sampleResMap(t), fastApplyOptions(), logger)
+	req.ErrorContains(err, "5 of 5 resources failed to apply")
+	req.ErrorContains(err, "mapper boom")
+	req.Empty(report.Succeeded())
+	for _, result := range report.Failed() {
+		req.Equal(2, result.Attempts)
+	}
 
 	_, err = k8s.ResourceInfosFromResMap(getter, asYAMLErrorResMap{})
 	req.Error(err)
 
-	realGetter := testutil.CreateClientGetterWithTestServer(
+	patchFail := testutil.CreateClientGetterWithTestServer(
 		t,
 		testutil.NewRESTMapper(),
 		func(w http.ResponseWriter, r *http.Request) {
-			if r.Method == http.MethodPatch {
+			if r.Method == http.MethodPatch && strings.Contains(r.URL.Path, "clusterroles") {
 				w.WriteHeader(http.StatusInternalServerError)
 				return
 			}
-			w.WriteHeader(http.StatusNotFound)
-		},
-	)
-	_, err = k8s.ApplyResMapWithServerSideApply(
-		realGetter,
-		resMapFromYAML(
-			t,
-			"apiVersion: rbac.authorization.k8s.io/v1\nkind: ClusterRole\nmetadata:\n  name: cr\nrules: []\n",
-		),
-	)
-	req.Error(err)
-	req.Contains(err.Error(), "failed to apply cluster resources")
-
-	getter = genericclioptions.NewMockRESTClientGetter(t)
-	getter.EXPECT().ToRESTMapper().Return(nil, errors.New("mapper boom")).Maybe()
-	_, err = k8s.ApplyResMapWithServerSideApply(
-		getter,
-		resMapFromYAML(
-			t,
-			"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm\n  namespace: default\ndata:\n  k: v\n",
-		),
-	)
-	req.Error(err)
-	req.Contains(err.Error(), "failed to build resource infos")
-
-	nsPatchFail := testutil.CreateClientGetterWithTestServer(
-		t,
-		testutil.NewRESTMapper(),
-		func(w http.ResponseWriter, r *http.Request) {
 			if r.Method == http.MethodPatch {
-				w.WriteHeader(http.StatusInternalServerError)
+				body, _ := io.ReadAll(r.Body)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				_, _ = w.Write(body)
 				return
 			}
 			w.WriteHeader(http.StatusNotFound)
 		},
 	)
-
-	nsMap := resMapFromYAML(
-		t,
-		"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm2\n  namespace: default\ndata:\n  k: v\n",
-	)
-	_, err = k8s.ApplyResMapWithServerSideApply(nsPatchFail, nsMap)
-	req.Error(err)
-	req.Contains(err.Error(), "failed to apply resources")
-
-	logger := testutil.TestLogger(t)
-	removeServer := testutil.CreateClientGetterWithTestServer(
-		t,
-		testutil.NewRESTMapper(),
-		func(w http.ResponseWriter, r *http.Request) {
-			if r.Method != http.MethodPatch {
-				w.WriteHeader(http.StatusNotFound)
-				return
-			}
-			body, readErr := io.ReadAll(r.Body)
-			if readErr != nil {
-				logger.Error("Failed to read request body", utils.ErrorKey, readErr)
-				w.WriteHeader(http.StatusInternalServerError)
-				return
-			}
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			_, _ = w.Write(body)
-		},
-	)
-	_, err = k8s.ApplyResMapWithServerSideApply(
-		removeServer,
-		removeErrorResMap{
-			ResMap: resMapFromYAML(
-				t,
-				"apiVersion: rbac.authorization.k8s.io/v1\nkind: ClusterRole\nmetadata:\n  name: remove-err\nrules: []\n",
-			),
-		},
+	report, err = k8s.ApplyResMapWithServerSideApply(
+		t.Context(),
+		patchFail,
+		resMapFromYAML(
+			t,
+			"apiVersion: rbac.authorization.k8s.io/v1\nkind: ClusterRole\nmetadata:\n  name: cr\nrules: []\n"+
+				"---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm\n  namespace: default\ndata:\n  k: v\n",
+		),
+		fastApplyOptions(),
+		logger,
 	)
-	req.Error(err)
-	req.Contains(err.Error(), "failed to remove cluster-scoped resource")
+	req.ErrorContains(err, "1 of 2 resources failed to apply")
+	req.ErrorContains(err, "failed to server-side apply resource")
+	req.Len(report.Succeeded(), 1)
+	req.Equal("cm", report.Succeeded()[0].Name)
+	req.Len(report.Failed(), 1)
+	req.Equal(k8s.ApplyStageResources, report.Failed()[0].Stage)
 }
 
 func TestAllWorkloadStates(t *testing.T) {
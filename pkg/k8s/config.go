@@ -15,11 +15,14 @@ limitations under the License.
 */
 package k8s
 
-// cSpell: words clientcmd readyz polymorphichelpers objectrestarter kust
+// cSpell: words clientcmd readyz polymorphichelpers objectrestarter kust resid
 // cSpell: disable
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"log/slog"
 	"path/filepath"
 	"strings"
 	"time"
@@ -34,6 +37,8 @@ import (
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/clientcmd/api"
 	kubeadmConstants "k8s.io/kubernetes/cmd/kubeadm/app/constants"
+	"sigs.k8s.io/kustomize/api/resmap"
+	"sigs.k8s.io/kustomize/kyaml/resid"
 
 	"github.com/kaweezle/iknite/pkg/cmd/util"
 	"github.com/kaweezle/iknite/pkg/host"
@@ -44,9 +49,10 @@ import (
 // cSpell: enable
 
 const (
-	configuredValueTrue = "true"
-	errKey              = "err"
-	kustKey             = "kustomization"
+	// KustomizationHashKey is the key of the iknite ConfigMap containing the hash of the applied kustomization.
+	KustomizationHashKey = "kustomizationHash"
+	errKey               = "err"
+	kustKey              = "kustomization"
 )
 
 // LoadFromFile loads the configuration from the file specified by filename.
@@ -239,70 +245,169 @@ func RestartProxy(ctx context.Context, client kubernetes.Interface) error {
 	return nil
 }
 
+// NewSubstituteOptions returns the options of the substitution of the variables in the kustomization described by
+// options.
+func NewSubstituteOptions(options *utils.KustomizeOptions) *provision.SubstituteOptions {
+	return &provision.SubstituteOptions{
+		Variables: options.Variables,
+		Allow:     options.SubstituteAllow,
+		Strict:    options.SubstituteStrict,
+	}
+}
+
+// kustomizationResources renders the kustomization described by options.
+func kustomizationResources(
+	fs host.FileSystem,
+	options *utils.KustomizeOptions,
+	logger *slog.Logger,
+) (resmap.ResMap, error) {
+	resources, err := provision.GetBaseKustomizationResources(fs, options.Kustomization, options.ForceEmbedded,
+		NewSubstituteOptions(options), logger)
+	if err != nil {
+		return nil, fmt.Errorf("while getting kustomization resources: %w", err)
+	}
+	return resources, nil
+}
+
+// KustomizationHash returns the hex encoded sha256 digest of the rendered resources.
+func KustomizationHash(resources resmap.ResMap) (string, error) {
+	content, err := resources.AsYaml()
+	if err != nil {
+		return "", fmt.Errorf("while rendering kustomization resources: %w", err)
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
 // Kustomize applies Kubernetes kustomizations to configure the cluster.
-// It takes an outbound IP address, a kustomization path or content, a force flag,
-// and a wait timeout in seconds.
-//
-// The function checks if configuration has already been applied by reading the
-// 'configured' field in the iknite ConfigMap. If already configured and force is
-// false, it logs a warning and skips configuration. Otherwise, it applies the
-// provided kustomization and  marks the cluster as configured by updating the
-// ConfigMap.
 //
-// If waitTimeout is greater than 0, the function waits for all workloads to be
-// ready for the specified duration before returning.
+// The function checks if the configuration has already been applied by comparing
+// the hash of the rendered kustomization with the one stored in the iknite
+// ConfigMap. If they are the same and force is false, it skips configuration.
+// Otherwise, it applies the kustomization and stores its hash in the ConfigMap.
 //
 // Returns an error if the client cannot be created, the ConfigMap cannot be read
-// or written, kustomizations fail to apply, or workloads don't become ready within
-// the timeout period.
+// or written, or kustomizations fail to apply.
 func Kustomize(
 	ctx context.Context,
 	kubeClient resource.RESTClientGetter,
 	fs host.FileSystem,
 	options *utils.KustomizeOptions,
 ) error {
+	_, _, err := ReconcileKustomization(ctx, kubeClient, fs, options)
+	return err
+}
+
+// ReconcileKustomization renders the kustomization and applies it with server-side
+// apply if the hash of the rendered content differs from the one stored in the
+// iknite ConfigMap, or if options.ForceConfig is true. It returns the hash of the
+// rendered kustomization and whether it has been applied.
+func ReconcileKustomization(
+	ctx context.Context,
+	kubeClient resource.RESTClientGetter,
+	fs host.FileSystem,
+	options *utils.KustomizeOptions,
+) (string, bool, error) {
 	logger := util.LoggerFromContext(ctx)
 	if options.Kustomization == "" && !options.ForceEmbedded {
 		logger.Warn("Empty kustomization.")
-		return nil
+		return "", false, nil
+	}
+
+	resources, err := kustomizationResources(fs, options, logger)
+	if err != nil {
+		return "", false, err
 	}
+	return ApplyKustomizationResources(ctx, kubeClient, resources, options)
+}
 
+// ApplyKustomizationResources applies the rendered resources of the kustomization described by options like
+// ReconcileKustomization.
+func ApplyKustomizationResources(
+	ctx context.Context,
+	kubeClient resource.RESTClientGetter,
+	resources resmap.ResMap,
+	options *utils.KustomizeOptions,
+) (string, bool, error) {
+	logger := util.LoggerFromContext(ctx)
 	client, err := ClientSet(kubeClient)
 	if err != nil {
-		return err
+		return "", false, err
 	}
 
 	cm, err := GetIkniteConfigMap(ctx, client)
 	if err != nil {
-		return err
+		return "", false, err
 	}
-	if cm.Data["configured"] == configuredValueTrue && !options.ForceConfig {
-		logger.Info("configuration has already occurred. Use -C to force.")
-		return nil
-	}
-
-	logger.Info("Performing configuration", kustKey, options.Kustomization)
 
-	resources, err := provision.GetBaseKustomizationResources(fs, options.Kustomization, options.ForceEmbedded, logger)
+	hash, err := KustomizationHash(resources)
 	if err != nil {
-		return fmt.Errorf("while getting kustomization resources: %w", err)
+		return "", false, err
 	}
+	if cm.Data[KustomizationHashKey] == hash && !options.ForceConfig {
+		logger.Info("configuration is up to date. Use -C to force.", "hash", hash)
+		return hash, false, nil
+	}
+
+	logger.Info("Performing configuration", kustKey, options.Kustomization, "hash", hash)
 	logger.Info("Applying base kustomization resources", "resourceCount", resources.Size())
 
-	ids, err := ApplyResMapWithServerSideApply(kubeClient, resources)
+	ids := resources.AllIds()
+	applyOptions := DefaultApplyOptions()
+	if options.ApplyRetries > 0 {
+		applyOptions.Backoff.Steps = options.ApplyRetries
+	}
+	report, err := ApplyResMapWithServerSideApply(ctx, kubeClient, resources, applyOptions, logger)
 	if err != nil {
-		return fmt.Errorf("while applying kustomization resources server side: %w", err)
+		return hash, false, fmt.Errorf("while applying kustomization resources server side: %w", err)
+	}
+
+	var pruned []resid.ResId
+	if options.Prune {
+		pruneResult, err := PruneInventory(ctx, kubeClient, cm, ids, false, logger)
+		if err != nil {
+			return hash, true, fmt.Errorf("while pruning resources: %w", err)
+		}
+		logger.Info("Pruning done", "pruned", len(pruneResult.Pruned), "protected", len(pruneResult.Protected))
+		pruned = pruneResult.Pruned
 	}
 
-	cm.Data["configured"] = configuredValueTrue
+	SetConfigMapInventory(cm, MergeInventory(InventoryFromConfigMap(cm, logger), ids, pruned))
+	// Replaced by the hash
+	delete(cm.Data, "configured")
+	cm.Data[KustomizationHashKey] = hash
 	_, err = WriteIkniteConfigMap(ctx, client, cm)
 	if err != nil {
-		return fmt.Errorf("while writing configuration: %w", err)
+		return hash, true, fmt.Errorf("while writing configuration: %w", err)
 	}
 
-	logger.Info("Configuration applied", kustKey, options.Kustomization, "resources", ids)
+	logger.Info("Configuration applied", kustKey, options.Kustomization, "resources", len(report.Results))
 
-	return nil
+	return hash, true, nil
+}
+
+// PlanPrune returns the resources that would be pruned by applying the kustomization described by options, without
+// modifying the cluster.
+func PlanPrune(
+	ctx context.Context,
+	kubeClient resource.RESTClientGetter,
+	fs host.FileSystem,
+	options *utils.KustomizeOptions,
+) (*PruneResult, error) {
+	logger := util.LoggerFromContext(ctx)
+	client, err := ClientSet(kubeClient)
+	if err != nil {
+		return nil, err
+	}
+	cm, err := GetIkniteConfigMap(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	resources, err := kustomizationResources(fs, options, logger)
+	if err != nil {
+		return nil, err
+	}
+	return PruneInventory(ctx, kubeClient, cm, resources.AllIds(), true, logger)
 }
 
 func GetIkniteConfigMap(ctx context.Context, client kubernetes.Interface) (*coreV1.ConfigMap, error) {
@@ -315,7 +420,7 @@ func GetIkniteConfigMap(ctx context.Context, client kubernetes.Interface) (*core
 			TypeMeta:   metaV1.TypeMeta{Kind: "ConfigMap", APIVersion: "v1"},
 			ObjectMeta: metaV1.ObjectMeta{Name: "iknite-config", Namespace: "kube-system"},
 			Immutable:  new(bool),
-			Data:       map[string]string{"configured": "false"},
+			Data:       map[string]string{},
 			BinaryData: map[string][]byte{},
 		}
 	}
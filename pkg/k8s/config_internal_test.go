@@ -69,18 +69,18 @@ func TestGetAndWriteIkniteConfigMap(t *testing.T) {
 	cm, err := GetIkniteConfigMap(ctx, client)
 	req.NoError(err)
 	req.Equal("iknite-config", cm.Name)
-	req.Equal("false", cm.Data["configured"])
+	req.Empty(cm.Data[KustomizationHashKey])
 
 	written, err := WriteIkniteConfigMap(ctx, client, cm)
 	req.NoError(err)
 	req.Equal("iknite-config", written.Name)
 	req.Equal("kube-system", written.Namespace)
 
-	written.Data["configured"] = "true"
+	written.Data[KustomizationHashKey] = "abc"
 	written.UID = "uid-1"
 	updated, err := WriteIkniteConfigMap(ctx, client, written)
 	req.NoError(err)
-	req.Equal("true", updated.Data["configured"])
+	req.Equal("abc", updated.Data[KustomizationHashKey])
 }
 
 func TestGetIkniteConfigMapExisting(t *testing.T) {
@@ -88,10 +88,10 @@ func TestGetIkniteConfigMapExisting(t *testing.T) {
 
 	client := fake.NewSimpleClientset(&coreV1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{Name: "iknite-config", Namespace: "kube-system"},
-		Data:       map[string]string{"configured": "true"},
+		Data:       map[string]string{KustomizationHashKey: "abc"},
 	})
 
 	cm, err := GetIkniteConfigMap(context.Background(), client)
 	req.NoError(err)
-	req.Equal("true", cm.Data["configured"])
+	req.Equal("abc", cm.Data[KustomizationHashKey])
 }
@@ -0,0 +1,252 @@
+/*
+Copyright © 2021 Antoine Martin <antoine@openance.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package k8s
+
+// cSpell: words difflib pmezard apimachinery metav resmap
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pmezard/go-difflib/difflib"
+	k8Errors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sTypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/resource"
+	"sigs.k8s.io/kustomize/api/resmap"
+	"sigs.k8s.io/yaml"
+
+	"github.com/kaweezle/iknite/pkg/cmd/util"
+	"github.com/kaweezle/iknite/pkg/host"
+	"github.com/kaweezle/iknite/pkg/utils"
+)
+
+// DiffStatus is the outcome of the comparison of a rendered object with the live cluster.
+type DiffStatus string
+
+const (
+	DiffCreated   DiffStatus = "created"
+	DiffChanged   DiffStatus = "changed"
+	DiffUnchanged DiffStatus = "unchanged"
+	DiffPruned    DiffStatus = "pruned"
+)
+
+// ObjectDiff is the difference between the live and the rendered version of an object.
+type ObjectDiff struct {
+	// Name identifies the object.
+	Name   string
+	Status DiffStatus
+	// Diff is the unified diff between the live and the rendered object. It is empty for unchanged objects.
+	Diff string
+}
+
+// DiffResult contains the differences between a kustomization and the live cluster.
+type DiffResult struct {
+	Objects []ObjectDiff
+}
+
+// Count returns the number of objects with the given status.
+func (r *DiffResult) Count(status DiffStatus) int {
+	count := 0
+	for _, object := range r.Objects {
+		if object.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// HasChanges returns true if applying the kustomization would modify the cluster.
+func (r *DiffResult) HasChanges() bool {
+	return r.Count(DiffUnchanged) != len(r.Objects)
+}
+
+// Summary returns a one line summary of the result.
+func (r *DiffResult) Summary() string {
+	return fmt.Sprintf("%d created, %d changed, %d unchanged, %d pruned",
+		r.Count(DiffCreated), r.Count(DiffChanged), r.Count(DiffUnchanged), r.Count(DiffPruned))
+}
+
+// diffIgnoredMetadata are the metadata fields that change on each apply and are not relevant for the diff.
+var diffIgnoredMetadata = []string{"managedFields", "resourceVersion", "generation"}
+
+// diffYAML returns the YAML representation of obj without the fields that change on each apply.
+func diffYAML(obj *unstructured.Unstructured) (string, error) {
+	if obj == nil {
+		return "", nil
+	}
+	content := obj.DeepCopy().Object
+	for _, field := range diffIgnoredMetadata {
+		unstructured.RemoveNestedField(content, "metadata", field)
+	}
+	result, err := yaml.Marshal(content)
+	if err != nil {
+		return "", fmt.Errorf("while serializing %s: %w", obj.GetName(), err)
+	}
+	return string(result), nil
+}
+
+// CompareObjects compares the live version of an object with the version it would have after the apply. live is nil
+// if the object doesn't exist.
+func CompareObjects(name string, live, applied *unstructured.Unstructured) (*ObjectDiff, error) {
+	liveYAML, err := diffYAML(live)
+	if err != nil {
+		return nil, err
+	}
+	appliedYAML, err := diffYAML(applied)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ObjectDiff{Name: name, Status: DiffChanged}
+	switch {
+	case live == nil:
+		result.Status = DiffCreated
+	case applied == nil:
+		result.Status = DiffPruned
+	case liveYAML == appliedYAML:
+		result.Status = DiffUnchanged
+		return result, nil
+	}
+
+	result.Diff, err = difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        diffLines(liveYAML),
+		B:        diffLines(appliedYAML),
+		FromFile: "live/" + name,
+		ToFile:   "merged/" + name,
+		Context:  3, //nolint:mnd // same as diff
+	})
+	if err != nil {
+		return nil, fmt.Errorf("while computing diff of %s: %w", name, err)
+	}
+	return result, nil
+}
+
+// diffLines splits content in lines, returning no line for an absent object.
+func diffLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	return difflib.SplitLines(content)
+}
+
+func toUnstructured(obj runtime.Object) (*unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, fmt.Errorf("while converting object to unstructured: %w", err)
+	}
+	return &unstructured.Unstructured{Object: content}, nil
+}
+
+// DiffResourceInfo compares the live version of the object described by info with the result of a server-side
+// apply dry run.
+func DiffResourceInfo(info *resource.Info) (*ObjectDiff, error) {
+	name := info.ObjectName()
+	helper := resource.NewHelper(info.Client, info.Mapping).WithFieldManager("iknite")
+
+	var live *unstructured.Unstructured
+	liveObj, err := helper.Get(info.Namespace, info.Name)
+	switch {
+	case k8Errors.IsNotFound(err):
+	case err != nil:
+		return nil, fmt.Errorf("while getting live version of %s: %w", name, err)
+	default:
+		if live, err = toUnstructured(liveObj); err != nil {
+			return nil, err
+		}
+	}
+
+	payload, err := json.Marshal(info.Object)
+	if err != nil { // nocov - the objects come from the kustomization and are serializable
+		return nil, fmt.Errorf("failed to marshal resource %s for apply: %w", name, err)
+	}
+	force := true
+	appliedObj, err := helper.DryRun(true).Patch(
+		info.Namespace,
+		info.Name,
+		k8sTypes.ApplyPatchType,
+		payload,
+		&metav1.PatchOptions{Force: &force, FieldManager: "iknite"},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dry run server-side apply of %s: %w", name, err)
+	}
+	applied, err := toUnstructured(appliedObj)
+	if err != nil {
+		return nil, err
+	}
+	return CompareObjects(name, live, applied)
+}
+
+// DiffKustomization compares the kustomization described by options with the live cluster. The resources recorded
+// in the inventory that are not rendered anymore are reported as pruned.
+func DiffKustomization(
+	ctx context.Context,
+	kubeClient resource.RESTClientGetter,
+	fs host.FileSystem,
+	options *utils.KustomizeOptions,
+) (*DiffResult, error) {
+	logger := util.LoggerFromContext(ctx)
+	resources, err := kustomizationResources(fs, options, logger)
+	if err != nil {
+		return nil, err
+	}
+	return DiffResources(ctx, kubeClient, resources)
+}
+
+// DiffResources compares the rendered resources of a kustomization with the live cluster. The resources recorded in
+// the inventory that are not rendered anymore are reported as pruned.
+func DiffResources(
+	ctx context.Context,
+	kubeClient resource.RESTClientGetter,
+	resources resmap.ResMap,
+) (*DiffResult, error) {
+	logger := util.LoggerFromContext(ctx)
+	ids := resources.AllIds()
+
+	infos, err := ResourceInfosFromResMap(kubeClient, resources)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DiffResult{Objects: make([]ObjectDiff, 0, len(infos))}
+	for _, info := range infos {
+		objectDiff, err := DiffResourceInfo(info)
+		if err != nil {
+			return nil, err
+		}
+		result.Objects = append(result.Objects, *objectDiff)
+	}
+
+	client, err := ClientSet(kubeClient)
+	if err != nil {
+		return nil, err
+	}
+	cm, err := GetIkniteConfigMap(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	pruneResult, err := PruneInventory(ctx, kubeClient, cm, ids, true, logger)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range pruneResult.Pruned {
+		result.Objects = append(result.Objects, ObjectDiff{Name: id.String(), Status: DiffPruned})
+	}
+	return result, nil
+}
@@ -0,0 +1,128 @@
+// cSpell: words apimachinery testutil resmap
+package k8s
+
+import (
+	"embed"
+	"log/slog"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/kustomize/api/provider"
+	"sigs.k8s.io/kustomize/api/resmap"
+
+	"github.com/kaweezle/iknite/pkg/testutil"
+)
+
+const diffTestConfigMap = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: diff-config
+  namespace: kube-system
+data:
+  key: new
+`
+
+//nolint:lll // JSON response
+const diffLiveConfigMap = `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"diff-config","namespace":"kube-system","resourceVersion":"42","managedFields":[{"manager":"iknite"}]},"data":{"key":"old"}}`
+
+func diffTestObject(value string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]any{
+			"name":            "test",
+			"resourceVersion": value,
+			"managedFields":   []any{map[string]any{"manager": value}},
+		},
+		"data": map[string]any{"key": value},
+	}}
+}
+
+func TestCompareObjects(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	created, err := CompareObjects("configmap/test", nil, diffTestObject("a"))
+	req.NoError(err)
+	req.Equal(DiffCreated, created.Status)
+	req.Contains(created.Diff, "+  key: a")
+	req.NotContains(created.Diff, "managedFields")
+
+	changed, err := CompareObjects("configmap/test", diffTestObject("a"), diffTestObject("b"))
+	req.NoError(err)
+	req.Equal(DiffChanged, changed.Status)
+	req.Contains(changed.Diff, "--- live/configmap/test")
+	req.Contains(changed.Diff, "+++ merged/configmap/test")
+	req.Contains(changed.Diff, "-  key: a")
+	req.Contains(changed.Diff, "+  key: b")
+	req.NotContains(changed.Diff, "resourceVersion")
+
+	unchanged := diffTestObject("a")
+	unchanged.SetResourceVersion("other")
+	same, err := CompareObjects("configmap/test", diffTestObject("a"), unchanged)
+	req.NoError(err)
+	req.Equal(DiffUnchanged, same.Status)
+	req.Empty(same.Diff)
+
+	result := &DiffResult{Objects: []ObjectDiff{*created, *changed, *same, {Name: "x", Status: DiffPruned}}}
+	req.True(result.HasChanges())
+	req.Equal("1 created, 1 changed, 1 unchanged, 1 pruned", result.Summary())
+	req.False((&DiffResult{Objects: []ObjectDiff{*same}}).HasChanges())
+}
+
+func liveConfigMapHandler(
+	_ string,
+	w http.ResponseWriter,
+	r *http.Request,
+	log *testutil.RequestLog,
+	_ embed.FS,
+	_ *slog.Logger,
+) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	log.StatusCode = http.StatusOK
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(diffLiveConfigMap)) //nolint:errcheck // In tests we can ignore write errors
+	return true
+}
+
+func TestDiffResourceInfo(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	resources, err := resmap.NewFactory(provider.NewDefaultDepProvider().GetResourceFactory()).
+		NewResMapFromBytes([]byte(diffTestConfigMap))
+	req.NoError(err)
+
+	// Object doesn't exist yet
+	sOpts := &testutil.TestServerOptions{Entry: testutil.TestLogger(t)}
+	infos, err := ResourceInfosFromResMap(testutil.CreateDefaultTestClientGetter(t, sOpts), resources)
+	req.NoError(err)
+	req.Len(infos, 1)
+	objectDiff, err := DiffResourceInfo(infos[0])
+	req.NoError(err)
+	req.Equal(DiffCreated, objectDiff.Status)
+
+	patch := sOpts.Requests[len(sOpts.Requests)-1]
+	req.Equal(http.MethodPatch, patch.Method)
+	req.Contains(patch.Query, "dryRun=All")
+
+	// Object exists with another value
+	sOpts = &testutil.TestServerOptions{
+		Entry: testutil.TestLogger(t),
+		Overrides: map[string]testutil.HandlerOverrideFunc{
+			"/api/v1/namespaces/kube-system/configmaps/diff-config": liveConfigMapHandler,
+		},
+	}
+	infos, err = ResourceInfosFromResMap(testutil.CreateDefaultTestClientGetter(t, sOpts), resources)
+	req.NoError(err)
+	objectDiff, err = DiffResourceInfo(infos[0])
+	req.NoError(err)
+	req.Equal(DiffChanged, objectDiff.Status)
+	req.Contains(objectDiff.Diff, "-  key: old")
+	req.Contains(objectDiff.Diff, "+  key: new")
+}
@@ -0,0 +1,167 @@
+/*
+Copyright © 2021 Antoine Martin <antoine@openance.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package k8s
+
+// cSpell: words kstatus fluxcd helmreleases gitrepositories unstructured apimachinery
+import (
+	"context"
+	"fmt"
+
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/cli-utils/pkg/kstatus/polling/engine"
+	"sigs.k8s.io/cli-utils/pkg/kstatus/polling/event"
+	kstatus "sigs.k8s.io/cli-utils/pkg/kstatus/status"
+	"sigs.k8s.io/cli-utils/pkg/object"
+	runTimeClient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	FluxKustomizationGVK = schema.GroupVersionKind{
+		Group:   "kustomize.toolkit.fluxcd.io",
+		Version: "v1",
+		Kind:    "Kustomization",
+	}
+	FluxHelmReleaseGVK = schema.GroupVersionKind{
+		Group:   "helm.toolkit.fluxcd.io",
+		Version: "v2",
+		Kind:    "HelmRelease",
+	}
+	FluxGitRepositoryGVK = schema.GroupVersionKind{
+		Group:   "source.toolkit.fluxcd.io",
+		Version: "v1",
+		Kind:    "GitRepository",
+	}
+
+	// fluxGVKs are the Flux kinds read by the FluxStatusReader, by group and kind.
+	fluxGVKs = map[schema.GroupKind]schema.GroupVersionKind{
+		FluxKustomizationGVK.GroupKind(): FluxKustomizationGVK,
+		FluxHelmReleaseGVK.GroupKind():   FluxHelmReleaseGVK,
+		FluxGitRepositoryGVK.GroupKind(): FluxGitRepositoryGVK,
+	}
+)
+
+const (
+	fluxReadyCondition       = "Ready"
+	fluxReconcilingCondition = "Reconciling"
+	fluxStalledCondition     = "Stalled"
+	// Reasons of a false Ready condition that only mean that the reconciliation is not over.
+	fluxProgressingReason          = "Progressing"
+	fluxDependencyNotReadyReason   = "DependencyNotReady"
+	fluxProgressingWithRetryReason = "ProgressingWithRetry"
+)
+
+// FluxStatusReader teaches kstatus about the Flux Kustomization, HelmRelease and GitRepository resources. Their
+// readiness is given by their Ready, Reconciling and Stalled conditions. kstatus alone sees a failed HelmRelease as
+// InProgress, so waiting on it never fails.
+type FluxStatusReader struct{}
+
+var _ engine.StatusReader = (*FluxStatusReader)(nil)
+
+func (r *FluxStatusReader) Supports(gk schema.GroupKind) bool {
+	_, ok := fluxGVKs[gk]
+	return ok
+}
+
+func (r *FluxStatusReader) ReadStatus(
+	ctx context.Context,
+	reader engine.ClusterReader,
+	identifier object.ObjMetadata,
+) (*event.ResourceStatus, error) {
+	gvk, ok := fluxGVKs[identifier.GroupKind]
+	if !ok {
+		return nil, fmt.Errorf("unsupported resource %s", identifier)
+	}
+	var obj unstructured.Unstructured
+	obj.SetGroupVersionKind(gvk)
+	key := runTimeClient.ObjectKey{Namespace: identifier.Namespace, Name: identifier.Name}
+	if err := reader.Get(ctx, key, &obj); err != nil {
+		return nil, fmt.Errorf("while getting resource %s: %w", identifier, err)
+	}
+	return r.ReadStatusForObject(ctx, reader, &obj)
+}
+
+func (r *FluxStatusReader) ReadStatusForObject(
+	_ context.Context,
+	_ engine.ClusterReader,
+	obj *unstructured.Unstructured,
+) (*event.ResourceStatus, error) {
+	status, message := fluxStatus(obj)
+	return &event.ResourceStatus{
+		Identifier: object.UnstructuredToObjMetadata(obj),
+		Status:     status,
+		Resource:   obj,
+		Message:    message,
+	}, nil
+}
+
+// fluxCondition returns the status, reason and message of the condition conditionType of obj.
+func fluxCondition(obj *unstructured.Unstructured, conditionType string) (status, reason, message string) {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions") //nolint:errcheck // missing
+	for _, item := range conditions {
+		condition, ok := item.(map[string]any)
+		if !ok || condition["type"] != conditionType {
+			continue
+		}
+		status, _ = condition["status"].(string)
+		reason, _ = condition["reason"].(string)
+		message, _ = condition["message"].(string)
+		return status, reason, message
+	}
+	return "", "", ""
+}
+
+// fluxStatus computes the kstatus status of a Flux resource from its conditions.
+func fluxStatus(obj *unstructured.Unstructured) (kstatus.Status, string) {
+	kind := obj.GetKind()
+	if suspended, _, _ := unstructured.NestedBool(obj.Object, "spec", "suspend"); suspended { //nolint:errcheck // missing
+		return kstatus.CurrentStatus, fmt.Sprintf("%s reconciliation is suspended", kind)
+	}
+	observed, found, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration") //nolint:errcheck // missing
+	if !found || observed < obj.GetGeneration() {
+		return kstatus.InProgressStatus, fmt.Sprintf("%s generation %d is not reconciled yet", kind, obj.GetGeneration())
+	}
+
+	if status, _, message := fluxCondition(obj, fluxStalledCondition); status == string(metaV1.ConditionTrue) {
+		return kstatus.FailedStatus, fmt.Sprintf("%s is stalled: %s", kind, message)
+	}
+	status, reason, message := fluxCondition(obj, fluxReadyCondition)
+	switch status {
+	case string(metaV1.ConditionTrue):
+		return kstatus.CurrentStatus, fmt.Sprintf("%s is ready: %s", kind, message)
+	case string(metaV1.ConditionFalse):
+		reconciling, _, _ := fluxCondition(obj, fluxReconcilingCondition)
+		if reconciling == string(metaV1.ConditionTrue) || reason == fluxProgressingReason ||
+			reason == fluxDependencyNotReadyReason || reason == fluxProgressingWithRetryReason {
+			return kstatus.InProgressStatus, fmt.Sprintf("%s is reconciling: %s", kind, message)
+		}
+		return kstatus.FailedStatus, fmt.Sprintf("%s is not ready (%s): %s", kind, reason, message)
+	case "":
+		return kstatus.InProgressStatus, fmt.Sprintf("%s has no Ready condition yet", kind)
+	default:
+		return kstatus.InProgressStatus, fmt.Sprintf("%s is reconciling: %s", kind, message)
+	}
+}
+
+// FluxStatusViewer reports the readiness of the Flux resources to AllWorkloadStates.
+type FluxStatusViewer struct{}
+
+func (s *FluxStatusViewer) Status(obj runtime.Unstructured, _ int64) (string, bool, error) {
+	status, message := fluxStatus(&unstructured.Unstructured{Object: obj.UnstructuredContent()})
+	return message, status == kstatus.CurrentStatus, nil
+}
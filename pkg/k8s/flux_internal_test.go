@@ -0,0 +1,149 @@
+// cSpell: words apimachinery unstructured kstatus fluxcd helmreleases
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	kstatus "sigs.k8s.io/cli-utils/pkg/kstatus/status"
+)
+
+func fluxResource(
+	gvk schema.GroupVersionKind,
+	observedGeneration int64,
+	conditions ...map[string]any,
+) *unstructured.Unstructured {
+	items := make([]any, 0, len(conditions))
+	for _, condition := range conditions {
+		items = append(items, condition)
+	}
+	obj := &unstructured.Unstructured{Object: map[string]any{
+		"metadata": map[string]any{"name": "podinfo", "namespace": "flux-system", "generation": int64(2)},
+		"spec":     map[string]any{},
+		"status":   map[string]any{"observedGeneration": observedGeneration, "conditions": items},
+	}}
+	obj.SetGroupVersionKind(gvk)
+	return obj
+}
+
+func fluxReady(status, reason, message string) map[string]any {
+	return map[string]any{"type": "Ready", "status": status, "reason": reason, "message": message}
+}
+
+func TestFluxStatus(t *testing.T) {
+	t.Parallel()
+
+	suspended := fluxResource(FluxKustomizationGVK, 1)
+	suspended.Object["spec"] = map[string]any{"suspend": true}
+
+	tests := []struct {
+		obj         *unstructured.Unstructured
+		name        string
+		wantStatus  kstatus.Status
+		wantMessage string
+	}{
+		{
+			name: "ready kustomization",
+			obj: fluxResource(FluxKustomizationGVK, 2,
+				fluxReady("True", "ReconciliationSucceeded", "Applied revision: main@sha1:0123456")),
+			wantStatus:  kstatus.CurrentStatus,
+			wantMessage: "Kustomization is ready: Applied revision: main@sha1:0123456",
+		},
+		{
+			name: "failed helm release",
+			obj: fluxResource(FluxHelmReleaseGVK, 2,
+				fluxReady("False", "InstallFailed", "Helm install failed: timed out")),
+			wantStatus:  kstatus.FailedStatus,
+			wantMessage: "HelmRelease is not ready (InstallFailed): Helm install failed: timed out",
+		},
+		{
+			name: "reconciling helm release",
+			obj: fluxResource(FluxHelmReleaseGVK, 2,
+				fluxReady("False", "InstallFailed", "Helm install failed"),
+				map[string]any{"type": "Reconciling", "status": "True", "reason": "ProgressingWithRetry"}),
+			wantStatus:  kstatus.InProgressStatus,
+			wantMessage: "HelmRelease is reconciling: Helm install failed",
+		},
+		{
+			name: "waiting for a dependency",
+			obj: fluxResource(FluxKustomizationGVK, 2,
+				fluxReady("False", "DependencyNotReady", "dependency 'flux-system/infra' is not ready")),
+			wantStatus:  kstatus.InProgressStatus,
+			wantMessage: "Kustomization is reconciling: dependency 'flux-system/infra' is not ready",
+		},
+		{
+			name: "stalled git repository",
+			obj: fluxResource(FluxGitRepositoryGVK, 2,
+				fluxReady("False", "GitOperationFailed", "authentication required"),
+				map[string]any{"type": "Stalled", "status": "True", "message": "invalid credentials"}),
+			wantStatus:  kstatus.FailedStatus,
+			wantMessage: "GitRepository is stalled: invalid credentials",
+		},
+		{
+			name:        "unknown ready condition",
+			obj:         fluxResource(FluxGitRepositoryGVK, 2, fluxReady("Unknown", "Progressing", "cloning")),
+			wantStatus:  kstatus.InProgressStatus,
+			wantMessage: "GitRepository is reconciling: cloning",
+		},
+		{
+			name:        "no ready condition",
+			obj:         fluxResource(FluxGitRepositoryGVK, 2),
+			wantStatus:  kstatus.InProgressStatus,
+			wantMessage: "GitRepository has no Ready condition yet",
+		},
+		{
+			name:        "generation not observed",
+			obj:         fluxResource(FluxHelmReleaseGVK, 1, fluxReady("True", "InstallSucceeded", "installed")),
+			wantStatus:  kstatus.InProgressStatus,
+			wantMessage: "HelmRelease generation 2 is not reconciled yet",
+		},
+		{
+			name:        "suspended",
+			obj:         suspended,
+			wantStatus:  kstatus.CurrentStatus,
+			wantMessage: "Kustomization reconciliation is suspended",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			req := require.New(t)
+
+			status, message := fluxStatus(tt.obj)
+			req.Equal(tt.wantStatus, status)
+			req.Equal(tt.wantMessage, message)
+
+			res, err := (&FluxStatusReader{}).ReadStatusForObject(t.Context(), nil, tt.obj)
+			req.NoError(err)
+			req.Equal(tt.wantStatus, res.Status)
+			req.Equal("podinfo", res.Identifier.Name)
+
+			message, ok, err := (&FluxStatusViewer{}).Status(tt.obj, 0)
+			req.NoError(err)
+			req.Equal(tt.wantStatus == kstatus.CurrentStatus, ok)
+			req.Equal(tt.wantMessage, message)
+		})
+	}
+}
+
+func TestWorkloadState_FailedHelmRelease(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	release := fluxResource(FluxHelmReleaseGVK, 2, fluxReady("False", "UpgradeFailed", "Helm upgrade failed"))
+	// kstatus alone considers the release as in progress
+	res, err := kstatus.Compute(release)
+	req.NoError(err)
+	req.Equal(kstatus.InProgressStatus, res.Status)
+
+	state := workloadState(FluxHelmReleaseGVK.GroupVersion().WithResource("helmreleases"), release)
+	req.Equal("helmreleases/podinfo", state.Name)
+	req.False(state.Ok)
+	req.Equal("HelmRelease is not ready (UpgradeFailed): Helm upgrade failed", state.Message)
+
+	viewer, err := StatusViewerFor(FluxHelmReleaseGVK.GroupKind())
+	req.NoError(err)
+	req.IsType(&FluxStatusViewer{}, viewer)
+}
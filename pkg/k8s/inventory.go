@@ -0,0 +1,236 @@
+/*
+Copyright © 2021 Antoine Martin <antoine@openance.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package k8s
+
+// cSpell: words resid apimachinery metav
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	coreV1 "k8s.io/api/core/v1"
+	k8Errors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+)
+
+const (
+	// InventoryKey is the key of the iknite ConfigMap listing the resources of the applied kustomization.
+	InventoryKey = "inventory"
+	// PruneAnnotation set to PruneAnnotationDisabled on an object prevents it from being pruned.
+	PruneAnnotation = "config.iknite.app/prune"
+	// PruneAnnotationDisabled is the value of PruneAnnotation that protects an object from pruning.
+	PruneAnnotationDisabled = "disabled"
+)
+
+// newDynamicClientFn creates the dynamic client used to prune resources. It is replaced in tests.
+var newDynamicClientFn = func(client resource.RESTClientGetter) (dynamic.Interface, error) {
+	config, err := client.ToRESTConfig()
+	if err != nil {
+		return nil, fmt.Errorf("while getting REST config: %w", err)
+	}
+	result, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("while creating dynamic client: %w", err)
+	}
+	return result, nil
+}
+
+// PruneResult contains the outcome of a pruning operation.
+type PruneResult struct {
+	// Pruned contains the resources that have been deleted (or would be in dry run mode).
+	Pruned []resid.ResId
+	// Protected contains the resources that have not been deleted because of their PruneAnnotation.
+	Protected []resid.ResId
+}
+
+// InventoryFromConfigMap returns the resources recorded in the inventory of the iknite ConfigMap. Invalid lines are
+// skipped with a warning.
+func InventoryFromConfigMap(cm *coreV1.ConfigMap, logger *slog.Logger) []resid.ResId {
+	result := []resid.ResId{}
+	for line := range strings.SplitSeq(cm.Data[InventoryKey], "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		id, err := parseInventoryLine(line)
+		if err != nil {
+			logger.Warn("Ignoring invalid inventory entry", "entry", line, "err", err)
+			continue
+		}
+		result = append(result, id)
+	}
+	return result
+}
+
+// parseInventoryLine parses a line of the inventory written by SetConfigMapInventory, i.e.
+// Kind.version.group/name.namespace. Unlike resid.FromString, it doesn't panic on malformed lines.
+func parseInventoryLine(line string) (resid.ResId, error) {
+	gvk, nameAndNamespace, found := strings.Cut(line, "/")
+	if !found || strings.Contains(nameAndNamespace, "/") {
+		return resid.ResId{}, fmt.Errorf("expected one / in %q", line)
+	}
+	if strings.Count(gvk, ".") < 2 { //nolint:mnd // kind, version and group
+		return resid.ResId{}, fmt.Errorf("expected kind.version.group in %q", gvk)
+	}
+	if !strings.Contains(nameAndNamespace, ".") {
+		return resid.ResId{}, fmt.Errorf("expected name.namespace in %q", nameAndNamespace)
+	}
+	return resid.FromString(line), nil
+}
+
+// SetConfigMapInventory records ids as the inventory of the iknite ConfigMap.
+func SetConfigMapInventory(cm *coreV1.ConfigMap, ids []resid.ResId) {
+	lines := make([]string, 0, len(ids))
+	for _, id := range ids {
+		lines = append(lines, id.String())
+	}
+	slices.Sort(lines)
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[InventoryKey] = strings.Join(lines, "\n")
+}
+
+// PruneCandidates returns the resources of previous that are not in current.
+func PruneCandidates(previous, current []resid.ResId) []resid.ResId {
+	result := []resid.ResId{}
+	for _, id := range previous {
+		if !slices.ContainsFunc(current, id.Equals) {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// MergeInventory returns the inventory to record after applying current: the resources of previous and current,
+// without the ones that have been pruned. Resources removed from the kustomization without being pruned are kept so
+// that a later prune can delete them.
+func MergeInventory(previous, current, pruned []resid.ResId) []resid.ResId {
+	result := slices.Clone(current)
+	for _, id := range previous {
+		if !slices.ContainsFunc(result, id.Equals) && !slices.ContainsFunc(pruned, id.Equals) {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// pruneOrder sorts ids so that namespaced resources are deleted before cluster scoped ones and namespaces last.
+func pruneOrder(ids []resid.ResId) []resid.ResId {
+	rank := func(id resid.ResId) int {
+		switch {
+		case id.Kind == "Namespace":
+			return 2 //nolint:mnd // last
+		case id.IsClusterScoped():
+			return 1
+		default:
+			return 0
+		}
+	}
+	result := slices.Clone(ids)
+	slices.SortStableFunc(result, func(a, b resid.ResId) int {
+		return rank(a) - rank(b)
+	})
+	return result
+}
+
+// PruneResources deletes the resources identified by ids from the cluster. Resources that don't exist anymore or
+// whose kind is unknown are ignored. Resources annotated with PruneAnnotation set to PruneAnnotationDisabled are
+// kept. If dryRun is true, nothing is deleted.
+func PruneResources(
+	ctx context.Context,
+	mapper meta.RESTMapper,
+	client dynamic.Interface,
+	ids []resid.ResId,
+	dryRun bool,
+	logger *slog.Logger,
+) (*PruneResult, error) {
+	result := &PruneResult{Pruned: []resid.ResId{}, Protected: []resid.ResId{}}
+	for _, id := range pruneOrder(ids) {
+		mapping, err := mapper.RESTMapping(schema.GroupKind{Group: id.Group, Kind: id.Kind}, id.Version)
+		if err != nil {
+			if meta.IsNoMatchError(err) {
+				logger.Debug("Unknown kind, not pruning", "resource", id.String())
+				continue
+			}
+			return result, fmt.Errorf("while getting mapping of %s: %w", id, err)
+		}
+
+		var resourceClient dynamic.ResourceInterface = client.Resource(mapping.Resource)
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			namespace := id.Namespace
+			if namespace == "" {
+				namespace = resid.DefaultNamespace
+			}
+			resourceClient = client.Resource(mapping.Resource).Namespace(namespace)
+		}
+
+		obj, err := resourceClient.Get(ctx, id.Name, metaV1.GetOptions{})
+		if err != nil {
+			if k8Errors.IsNotFound(err) {
+				continue
+			}
+			return result, fmt.Errorf("while getting %s: %w", id, err)
+		}
+		if obj.GetAnnotations()[PruneAnnotation] == PruneAnnotationDisabled {
+			logger.Info("Resource protected from pruning", "resource", id.String())
+			result.Protected = append(result.Protected, id)
+			continue
+		}
+		result.Pruned = append(result.Pruned, id)
+		if dryRun {
+			continue
+		}
+
+		logger.Info("Pruning resource", "resource", id.String())
+		propagation := metaV1.DeletePropagationBackground
+		err = resourceClient.Delete(ctx, id.Name, metaV1.DeleteOptions{PropagationPolicy: &propagation})
+		if err != nil && !k8Errors.IsNotFound(err) {
+			return result, fmt.Errorf("while pruning %s: %w", id, err)
+		}
+	}
+	return result, nil
+}
+
+// PruneInventory prunes the resources of the inventory of cm that are not in current.
+func PruneInventory(
+	ctx context.Context,
+	client resource.RESTClientGetter,
+	cm *coreV1.ConfigMap,
+	current []resid.ResId,
+	dryRun bool,
+	logger *slog.Logger,
+) (*PruneResult, error) {
+	candidates := PruneCandidates(InventoryFromConfigMap(cm, logger), current)
+	if len(candidates) == 0 {
+		return &PruneResult{Pruned: []resid.ResId{}, Protected: []resid.ResId{}}, nil
+	}
+	mapper, err := client.ToRESTMapper()
+	if err != nil {
+		return nil, fmt.Errorf("while getting REST mapper: %w", err)
+	}
+	dynamicClient, err := newDynamicClientFn(client)
+	if err != nil {
+		return nil, err
+	}
+	return PruneResources(ctx, mapper, dynamicClient, candidates, dryRun, logger)
+}
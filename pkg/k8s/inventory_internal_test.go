@@ -0,0 +1,126 @@
+// cSpell: words resid apimachinery metav corev
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	coreV1 "k8s.io/api/core/v1"
+	k8Errors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicFake "k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+
+	"github.com/kaweezle/iknite/pkg/testutil"
+)
+
+var (
+	configMapGVR = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	namespaceGVR = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+)
+
+func pruneTestMapper() meta.RESTMapper {
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{{Version: "v1"}})
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}, meta.RESTScopeRoot)
+	return mapper
+}
+
+func pruneTestObject(kind, name, namespace string, annotations map[string]string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("v1")
+	obj.SetKind(kind)
+	obj.SetName(name)
+	obj.SetNamespace(namespace)
+	obj.SetAnnotations(annotations)
+	return obj
+}
+
+func TestInventoryRoundTrip(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	ids := []resid.ResId{
+		resid.NewResIdWithNamespace(resid.NewGvk("", "v1", "ConfigMap"), "b", "test"),
+		resid.NewResId(resid.NewGvk("", "v1", "Namespace"), "test"),
+		resid.NewResIdWithNamespace(resid.NewGvk("apps", "v1", "Deployment"), "a", "test"),
+	}
+	cm := &coreV1.ConfigMap{}
+	SetConfigMapInventory(cm, ids)
+	req.Len(InventoryFromConfigMap(cm, testutil.TestLogger(t)), 3)
+	for _, id := range InventoryFromConfigMap(cm, testutil.TestLogger(t)) {
+		req.True(id.Equals(ids[0]) || id.Equals(ids[1]) || id.Equals(ids[2]), id.String())
+	}
+
+	req.Empty(InventoryFromConfigMap(&coreV1.ConfigMap{}, testutil.TestLogger(t)))
+
+	// Corrupted entries are skipped
+	cm.Data[InventoryKey] += "\nnot-an-id\nConfigMap/a.b\nConfigMap.v1.[noGrp]/noNamespace\na/b/c"
+	req.Len(InventoryFromConfigMap(cm, testutil.TestLogger(t)), 3)
+
+	candidates := PruneCandidates(ids, ids[1:])
+	req.Len(candidates, 1)
+	req.True(candidates[0].Equals(ids[0]))
+}
+
+func TestMergeInventory(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	removed := resid.NewResIdWithNamespace(resid.NewGvk("", "v1", "ConfigMap"), "removed", "test")
+	pruned := resid.NewResIdWithNamespace(resid.NewGvk("", "v1", "ConfigMap"), "pruned", "test")
+	kept := resid.NewResIdWithNamespace(resid.NewGvk("", "v1", "ConfigMap"), "kept", "test")
+	added := resid.NewResIdWithNamespace(resid.NewGvk("", "v1", "ConfigMap"), "added", "test")
+
+	// Without pruning, the removed resources stay in the inventory
+	req.Equal([]resid.ResId{kept, added, removed},
+		MergeInventory([]resid.ResId{kept, removed}, []resid.ResId{kept, added}, nil))
+	// Only the pruned resources are dropped
+	req.Equal([]resid.ResId{kept, removed}, MergeInventory([]resid.ResId{kept, removed, pruned}, []resid.ResId{kept},
+		[]resid.ResId{pruned}))
+}
+
+func TestPruneResources(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	client := dynamicFake.NewSimpleDynamicClient(runtime.NewScheme(),
+		pruneTestObject("ConfigMap", "removed", "test", nil),
+		pruneTestObject("ConfigMap", "kept", "test", map[string]string{PruneAnnotation: PruneAnnotationDisabled}),
+		pruneTestObject("Namespace", "test", "", nil),
+	)
+	ids := []resid.ResId{
+		resid.NewResId(resid.NewGvk("", "v1", "Namespace"), "test"),
+		resid.NewResIdWithNamespace(resid.NewGvk("", "v1", "ConfigMap"), "removed", "test"),
+		resid.NewResIdWithNamespace(resid.NewGvk("", "v1", "ConfigMap"), "kept", "test"),
+		resid.NewResIdWithNamespace(resid.NewGvk("", "v1", "ConfigMap"), "gone", "test"),
+		resid.NewResId(resid.NewGvk("example.com", "v1", "Unknown"), "unknown"),
+	}
+
+	// Dry run doesn't delete anything
+	result, err := PruneResources(t.Context(), pruneTestMapper(), client, ids, true, testutil.TestLogger(t))
+	req.NoError(err)
+	req.Len(result.Pruned, 2)
+	req.Len(result.Protected, 1)
+	_, err = client.Resource(configMapGVR).Namespace("test").Get(t.Context(), "removed", metaV1.GetOptions{})
+	req.NoError(err)
+
+	result, err = PruneResources(t.Context(), pruneTestMapper(), client, ids, false, testutil.TestLogger(t))
+	req.NoError(err)
+	req.Len(result.Pruned, 2)
+	// Namespaced resources are pruned before namespaces
+	req.Equal("removed", result.Pruned[0].Name)
+	req.Equal("test", result.Pruned[1].Name)
+	req.Equal("kept", result.Protected[0].Name)
+
+	_, err = client.Resource(configMapGVR).Namespace("test").Get(t.Context(), "removed", metaV1.GetOptions{})
+	req.True(k8Errors.IsNotFound(err))
+	_, err = client.Resource(namespaceGVR).Get(t.Context(), "test", metaV1.GetOptions{})
+	req.True(k8Errors.IsNotFound(err))
+	_, err = client.Resource(configMapGVR).Namespace("test").Get(t.Context(), "kept", metaV1.GetOptions{})
+	req.NoError(err)
+}
@@ -47,6 +47,31 @@ func NewClientFromKubeconfig(fs host.FileSystem, kubeconfigPath string, logger *
 	return NewClientFromFile(fs, loadingRules.Precedence[0])
 }
 
+// CustomStatusReaders returns the status readers of the kinds kstatus does not know about: the Argo CD applications
+// and the Flux resources.
+func CustomStatusReaders() []engine.StatusReader {
+	return []engine.StatusReader{&ApplicationStatusReader{}, &FluxStatusReader{}}
+}
+
+// ComputeStatus computes the status of obj with the custom status readers, falling back to kstatus.
+func ComputeStatus(obj *unstructured.Unstructured) (kstatus.Status, string, error) {
+	for _, reader := range CustomStatusReaders() {
+		if !reader.Supports(obj.GroupVersionKind().GroupKind()) {
+			continue
+		}
+		res, err := reader.ReadStatusForObject(context.Background(), nil, obj)
+		if err != nil {
+			return kstatus.UnknownStatus, "", fmt.Errorf("while reading status of %s: %w", obj.GetName(), err)
+		}
+		return res.Status, res.Message, nil
+	}
+	res, err := kstatus.Compute(obj)
+	if err != nil {
+		return kstatus.UnknownStatus, "", fmt.Errorf("while computing status of %s: %w", obj.GetName(), err)
+	}
+	return res.Status, res.Message, nil
+}
+
 // workloadStatesToSlice converts resource.Info objects to WorkloadState using kstatus.
 func workloadStatesToSlice(infos []*resource.Info) ([]*v1alpha1.WorkloadState, error) {
 	result := make([]*v1alpha1.WorkloadState, 0, len(infos))
@@ -57,7 +82,7 @@ func workloadStatesToSlice(infos []*resource.Info) ([]*v1alpha1.WorkloadState, e
 		}
 
 		obj := &unstructured.Unstructured{Object: u}
-		res, err := kstatus.Compute(obj)
+		status, message, err := ComputeStatus(obj)
 		if err != nil {
 			result = append(result, &v1alpha1.WorkloadState{
 				Namespace: info.Namespace,
@@ -71,8 +96,8 @@ func workloadStatesToSlice(infos []*resource.Info) ([]*v1alpha1.WorkloadState, e
 		result = append(result, &v1alpha1.WorkloadState{
 			Namespace: info.Namespace,
 			Name:      info.ObjectName(),
-			Ok:        res.Status == kstatus.CurrentStatus,
-			Message:   res.Message,
+			Ok:        status == kstatus.CurrentStatus,
+			Message:   message,
 		})
 	}
 
@@ -194,8 +219,8 @@ func ObjectMetadataSetForNamespace(
 	return infosToObjectMetadataSet(infos), nil
 }
 
-// WorkloadStatesForNamespace returns the readiness state of deployments, statefulsets, and
-// daemonsets in a single namespace using kstatus to evaluate each resource.
+// WorkloadStatesForNamespace returns the readiness state of the resources of resourceTypes in a single namespace
+// using kstatus and the custom status readers to evaluate each resource.
 func WorkloadStatesForNamespace(
 	client resource.RESTClientGetter,
 	namespace string, resourceTypes []string,
@@ -208,6 +233,15 @@ func WorkloadStatesForNamespace(
 	return workloadStatesToSlice(infos)
 }
 
+// shortRevision returns the abbreviated form of a git revision. Other revisions, like chart versions, are kept.
+func shortRevision(revision string) string {
+	const length = 7
+	if len(revision) > length {
+		return revision[:length]
+	}
+	return revision
+}
+
 type ApplicationStatusReader struct{}
 
 var _ engine.StatusReader = (*ApplicationStatusReader)(nil)
@@ -250,7 +284,7 @@ func (r *ApplicationStatusReader) ReadStatus(
 	}
 	if app.Status.Sync.Status == applicationSyncedStatus && app.Status.Health.Status == applicationHealthyStatus {
 		status.Status = kstatus.CurrentStatus
-		status.Message = fmt.Sprintf("Application is healthy and synced on revision %s", app.Status.Sync.Revision[0:7])
+		status.Message = fmt.Sprintf("Application is healthy and synced on revision %s", shortRevision(app.Status.Sync.Revision))
 	} else {
 		status.Status = kstatus.InProgressStatus
 		status.Message = fmt.Sprintf(
@@ -280,7 +314,7 @@ func (r *ApplicationStatusReader) ReadStatusForObject(
 	}
 	if app.Status.Sync.Status == applicationSyncedStatus && app.Status.Health.Status == applicationHealthyStatus {
 		status.Status = kstatus.CurrentStatus
-		status.Message = fmt.Sprintf("Application is healthy and synced on revision %s", app.Status.Sync.Revision[0:7])
+		status.Message = fmt.Sprintf("Application is healthy and synced on revision %s", shortRevision(app.Status.Sync.Revision))
 	} else {
 		status.Status = kstatus.InProgressStatus
 		status.Message = fmt.Sprintf(
@@ -0,0 +1,98 @@
+package init
+
+// cSpell: words containerd
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"k8s.io/kubernetes/cmd/kubeadm/app/cmd/phases/workflow"
+
+	"github.com/kaweezle/iknite/pkg/config"
+	"github.com/kaweezle/iknite/pkg/cri"
+	"github.com/kaweezle/iknite/pkg/host"
+	"github.com/kaweezle/iknite/pkg/provision"
+	"github.com/kaweezle/iknite/pkg/utils"
+)
+
+// These functions are replaced in tests.
+var (
+	getIkniteImagesFn     = config.GetIkniteImages
+	findRemoteResourcesFn = provision.FindRemoteResources
+)
+
+func NewAirGappedPreflightPhase() workflow.Phase {
+	return workflow.Phase{
+		Name:  "air-gapped-preflight",
+		Short: "Verify that the cluster can be initialized without network access.",
+		Long: `Verifies, when the air-gapped mode is enabled, that the kustomization doesn't
+reference any remote resource and that all the container images are present
+in the local containerd store.`,
+		Run: runAirGappedPreflight,
+	}
+}
+
+type airGappedPreflightData interface {
+	IkniteClusterProvider
+	host.HostProvider
+	KustomizeOptionsProvider
+	utils.LoggerProvider
+}
+
+// runAirGappedPreflight fails fast if the cluster cannot be initialized without network access.
+func runAirGappedPreflight(c workflow.RunData) error {
+	data, ok := c.(airGappedPreflightData)
+	if !ok {
+		return fmt.Errorf("air-gapped-preflight phase invoked with an invalid data struct. ")
+	}
+	logger := data.Logger().With("phase", "air-gapped-preflight")
+	ikniteConfig := &data.IkniteCluster().Spec
+	if !ikniteConfig.AirGapped {
+		logger.Debug("Air-gapped mode not enabled, skipping")
+		return nil
+	}
+	alpineHost := data.Host()
+	kustomizeOptions := data.KustomizeOptions()
+
+	// Remote resources are checked first because computing the images needs to build the kustomization, which
+	// would hang while trying to fetch them.
+	remoteResources, err := findRemoteResourcesFn(
+		alpineHost, kustomizeOptions.Kustomization, kustomizeOptions.ForceEmbedded, logger)
+	if err != nil {
+		return fmt.Errorf("while looking for remote kustomization resources: %w", err)
+	}
+	if len(remoteResources) > 0 {
+		return airGappedError("remote kustomization resources", remoteResources)
+	}
+
+	ready, err := cri.WaitForContainerService(alpineHost, alpineHost, logger)
+	if err != nil {
+		return fmt.Errorf("while waiting for the container service: %w", err)
+	}
+	if !ready {
+		return errors.New("air-gapped preflight failed: container service is not ready, cannot verify images")
+	}
+
+	images, err := getIkniteImagesFn(alpineHost, ikniteConfig, kustomizeOptions.ForceEmbedded, logger)
+	if err != nil {
+		return fmt.Errorf("while getting iknite images: %w", err)
+	}
+	missing, err := cri.MissingImages(alpineHost, images)
+	if err != nil {
+		return fmt.Errorf("while checking local images: %w", err)
+	}
+	if len(missing) > 0 {
+		return airGappedError("missing container images", missing)
+	}
+	logger.Info("Air-gapped preflight passed", "images", len(images))
+	return nil
+}
+
+func airGappedError(kind string, items []string) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "air-gapped preflight failed, %d %s:", len(items), kind)
+	for _, item := range items {
+		fmt.Fprintf(&sb, "\n  - %s", item)
+	}
+	return errors.New(sb.String())
+}
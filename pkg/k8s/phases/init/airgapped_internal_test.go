@@ -0,0 +1,139 @@
+// cSpell: words testutil crictl containerd paralleltest
+//
+//nolint:paralleltest // These tests modify global state and cannot be run in parallel
+package init
+
+import (
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	mockHost "github.com/kaweezle/iknite/mocks/pkg/host"
+	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
+	"github.com/kaweezle/iknite/pkg/config"
+	"github.com/kaweezle/iknite/pkg/constants"
+	"github.com/kaweezle/iknite/pkg/host"
+	"github.com/kaweezle/iknite/pkg/provision"
+	"github.com/kaweezle/iknite/pkg/testutil"
+	"github.com/kaweezle/iknite/pkg/utils"
+)
+
+type airGappedPhaseData struct {
+	host    *mockHost.MockHost
+	cluster *v1alpha1.IkniteCluster
+	options *utils.KustomizeOptions
+	logger  *slog.Logger
+}
+
+var _ airGappedPreflightData = (*airGappedPhaseData)(nil)
+
+func (d *airGappedPhaseData) Host() host.Host {
+	return d.host
+}
+
+func (d *airGappedPhaseData) IkniteCluster() *v1alpha1.IkniteCluster {
+	return d.cluster
+}
+
+func (d *airGappedPhaseData) KustomizeOptions() *utils.KustomizeOptions {
+	return d.options
+}
+
+func (d *airGappedPhaseData) Logger() *slog.Logger {
+	return d.logger
+}
+
+func newAirGappedPhaseData(t *testing.T, airGapped bool) *airGappedPhaseData {
+	t.Helper()
+	return &airGappedPhaseData{
+		host:    mockHost.NewMockHost(t),
+		cluster: &v1alpha1.IkniteCluster{Spec: v1alpha1.IkniteClusterSpec{AirGapped: airGapped}},
+		options: utils.NewKustomizeOptions(),
+		logger:  testutil.TestLogger(t),
+	}
+}
+
+func setAirGappedHooks(t *testing.T, remote []string, images []string) {
+	t.Helper()
+	findRemoteResourcesFn = func(_ host.FileSystem, _ string, _ bool, _ *slog.Logger) ([]string, error) {
+		return remote, nil
+	}
+	getIkniteImagesFn = func(_ host.FileSystem, _ *v1alpha1.IkniteClusterSpec, _ bool, _ *slog.Logger) ([]string, error) {
+		return images, nil
+	}
+	t.Cleanup(func() {
+		findRemoteResourcesFn = provision.FindRemoteResources
+		getIkniteImagesFn = config.GetIkniteImages
+	})
+}
+
+func expectContainerServiceReady(h *mockHost.MockHost) {
+	h.EXPECT().Exists(constants.ContainerServiceSock).Return(true, nil).Once()
+	h.EXPECT().Run(false, "/usr/bin/crictl", []string{
+		"--runtime-endpoint", "unix://" + constants.ContainerServiceSock, "info",
+	}).Return([]byte(`{"status":{"conditions":[{"type":"RuntimeReady","status":true},`+
+		`{"type":"NetworkReady","status":true}]}}`), nil).Once()
+}
+
+func expectLocalImages(h *mockHost.MockHost, payload string) {
+	h.EXPECT().Run(false, "/usr/bin/crictl", []string{
+		"--runtime-endpoint", "unix://" + constants.ContainerServiceSock, "images", "--output", "json",
+	}).Return([]byte(payload), nil).Once()
+}
+
+func TestRunAirGappedPreflight_Disabled(t *testing.T) {
+	req := require.New(t)
+	setAirGappedHooks(t, []string{"base/kustomization.yaml: https://example.com/x.yaml"}, nil)
+
+	req.NoError(runAirGappedPreflight(newAirGappedPhaseData(t, false)))
+}
+
+func TestRunAirGappedPreflight_RemoteResources(t *testing.T) {
+	req := require.New(t)
+	setAirGappedHooks(t, []string{
+		"base/kustomization.yaml: https://example.com/a.yaml",
+		"base/kustomization.yaml: https://example.com/b.yaml",
+	}, nil)
+
+	err := runAirGappedPreflight(newAirGappedPhaseData(t, true))
+	req.Error(err)
+	req.Equal("air-gapped preflight failed, 2 remote kustomization resources:\n"+
+		"  - base/kustomization.yaml: https://example.com/a.yaml\n"+
+		"  - base/kustomization.yaml: https://example.com/b.yaml", err.Error())
+}
+
+func TestRunAirGappedPreflight_RemoteResourcesError(t *testing.T) {
+	req := require.New(t)
+	setAirGappedHooks(t, nil, nil)
+	findRemoteResourcesFn = func(_ host.FileSystem, _ string, _ bool, _ *slog.Logger) ([]string, error) {
+		return nil, errors.New("bad kustomization")
+	}
+
+	err := runAirGappedPreflight(newAirGappedPhaseData(t, true))
+	req.ErrorContains(err, "bad kustomization")
+}
+
+func TestRunAirGappedPreflight_MissingImages(t *testing.T) {
+	req := require.New(t)
+	setAirGappedHooks(t, nil, []string{"registry.k8s.io/pause:3.10", "registry.k8s.io/kube-apiserver:v1.36.1"})
+	data := newAirGappedPhaseData(t, true)
+	expectContainerServiceReady(data.host)
+	expectLocalImages(data.host, `{"images":[{"id":"1","repoTags":["registry.k8s.io/pause:3.10"]}]}`)
+
+	err := runAirGappedPreflight(data)
+	req.Error(err)
+	req.Equal("air-gapped preflight failed, 1 missing container images:\n"+
+		"  - registry.k8s.io/kube-apiserver:v1.36.1", err.Error())
+}
+
+func TestRunAirGappedPreflight_Success(t *testing.T) {
+	req := require.New(t)
+	setAirGappedHooks(t, nil, []string{"registry.k8s.io/pause:3.10"})
+	data := newAirGappedPhaseData(t, true)
+	expectContainerServiceReady(data.host)
+	expectLocalImages(data.host, `{"images":[{"id":"1","repoTags":["registry.k8s.io/pause:3.10"]}]}`)
+
+	req.NoError(runAirGappedPreflight(data))
+}
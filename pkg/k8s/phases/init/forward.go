@@ -0,0 +1,142 @@
+package init
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+
+	"k8s.io/kubernetes/cmd/kubeadm/app/cmd/phases/workflow"
+
+	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
+	"github.com/kaweezle/iknite/pkg/forward"
+	"github.com/kaweezle/iknite/pkg/host"
+	"github.com/kaweezle/iknite/pkg/utils"
+)
+
+const forwardPhaseName = "forward"
+
+var (
+	// notifyReloadFn makes ch receive the signals requesting a reload of the forward rules. It is replaced in tests.
+	notifyReloadFn = func(ch chan<- os.Signal) { signal.Notify(ch, syscall.SIGHUP) }
+	// stopReloadFn stops the delivery of the signals to ch. It is replaced in tests.
+	stopReloadFn = func(ch chan<- os.Signal) { signal.Stop(ch) }
+)
+
+func NewForwardPhase() workflow.Phase {
+	return workflow.Phase{
+		Name:  forwardPhaseName,
+		Short: "Forward the TCP ports of the configured forward rules.",
+		Long: `Forward the TCP ports of the forward rules of the cluster specification.
+
+The rules without listen address listen on the outbound IP address of the host and
+the rules without target host forward to the cluster IP address. A rule that
+cannot be started, for instance because its port is already in use, is reported
+in the status without stopping the other rules. On SIGHUP, the
+configuration file is read again and the forward rules it contains replace the
+configured ones. The rules can also be added and removed at runtime with the
+iknite forward command. These rules are kept across reloads but not across
+restarts of the daemon.`,
+		Run: runForward,
+	}
+}
+
+type forwardData interface {
+	IkniteClusterProvider
+	host.HostProvider
+	ContextProvider
+	IkniteClusterListenerRegistrar
+	ShutdownHookRegistrar
+	ForwardManagerHolder
+	ForwardRulesUpdater
+	IkniteClusterSpecLoader
+	utils.LoggerProvider
+}
+
+func runForward(c workflow.RunData) error {
+	data, ok := c.(forwardData)
+	if !ok {
+		return fmt.Errorf("%s phase invoked with an invalid data struct", forwardPhaseName)
+	}
+
+	spec := data.IkniteCluster().Spec
+	logger := data.Logger()
+	rules, err := forward.NormalizeRules(spec.Forwards)
+	if err != nil {
+		return fmt.Errorf("failed to start the port forwarding: %w", err)
+	}
+	manager := forward.NewManager(data.Context(), data.Host(), spec.Ip, data.UpdateForwardRules, logger)
+	// The cluster is already up, a rule that cannot be started is reported in the status of the manager
+	if err = manager.Apply(rules); err != nil {
+		logger.Warn("Failed to start some forward rules", utils.ErrorKey, err)
+	}
+	data.SetForwardManager(manager)
+
+	ch, unregister := data.RegisterIkniteClusterListener()
+	go func() {
+		for cluster := range ch {
+			if err := manager.Apply(cluster.Spec.Forwards); err != nil {
+				logger.Warn("Failed to reload the forward rules", utils.ErrorKey, err)
+			}
+		}
+	}()
+
+	reload := make(chan os.Signal, 1)
+	notifyReloadFn(reload)
+	go func() {
+		configured := ruleNames(spec.Forwards)
+		for range reload {
+			configured = reloadForwardRules(data, manager, configured)
+		}
+	}()
+
+	data.RegisterShutdownHook(forwardPhaseName, func() error {
+		stopReloadFn(reload)
+		close(reload)
+		unregister()
+		return manager.Close()
+	})
+	return nil
+}
+
+// reloadForwardRules replaces the forward rules coming from the configuration, whose names are configured, by the ones
+// of the configuration file. The rules added at runtime are kept unless the configuration contains a rule with the
+// same name. It returns the names of the new configured rules.
+func reloadForwardRules(data forwardData, manager *forward.Manager, configured []string) []string {
+	logger := data.Logger()
+	spec, err := data.LoadIkniteClusterSpec()
+	if err != nil {
+		logger.Warn("Failed to reload the configuration", utils.ErrorKey, err)
+		return configured
+	}
+	rules, err := forward.NormalizeRules(spec.Forwards)
+	if err != nil {
+		logger.Warn("Invalid forward rules in the configuration", utils.ErrorKey, err)
+		return configured
+	}
+	names := ruleNames(rules)
+	for _, rule := range manager.Rules() {
+		if !slices.Contains(configured, rule.Name) && !slices.Contains(names, rule.Name) {
+			rules = append(rules, rule)
+		}
+	}
+
+	logger.Info("Reloading the forward rules", "rules", len(rules))
+	if err = manager.Apply(rules); err != nil {
+		logger.Warn("Failed to reload the forward rules", utils.ErrorKey, err)
+	}
+	data.UpdateForwardRules(manager.Rules())
+	return names
+}
+
+// ruleNames returns the names of rules, defaulting to their port.
+func ruleNames(rules []v1alpha1.ForwardRule) []string {
+	result := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		if normalized, err := forward.NormalizeRule(rule); err == nil {
+			result = append(result, normalized.Name)
+		}
+	}
+	return result
+}
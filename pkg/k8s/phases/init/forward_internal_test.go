@@ -0,0 +1,251 @@
+// cSpell: words testutil
+package init
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
+	"github.com/kaweezle/iknite/pkg/forward"
+	"github.com/kaweezle/iknite/pkg/host"
+	"github.com/kaweezle/iknite/pkg/testutil"
+	"github.com/kaweezle/iknite/pkg/utils"
+)
+
+//nolint:containedctx // context is provided by the workflow.RunData
+type forwardPhaseData struct {
+	host        host.Host
+	ctx         context.Context
+	specErr     error
+	cluster     *v1alpha1.IkniteCluster
+	spec        *v1alpha1.IkniteClusterSpec
+	manager     *forward.Manager
+	updates     chan *v1alpha1.IkniteCluster
+	rules       chan []v1alpha1.ForwardRule
+	logger      *slog.Logger
+	hookManager utils.HookManager
+}
+
+func (d *forwardPhaseData) IkniteCluster() *v1alpha1.IkniteCluster { return d.cluster }
+func (d *forwardPhaseData) Host() host.Host                        { return d.host }
+func (d *forwardPhaseData) Context() context.Context               { return d.ctx }
+func (d *forwardPhaseData) Logger() *slog.Logger                   { return d.logger }
+func (d *forwardPhaseData) ForwardManager() *forward.Manager       { return d.manager }
+
+func (d *forwardPhaseData) SetForwardManager(manager *forward.Manager) {
+	d.manager = manager
+}
+
+func (d *forwardPhaseData) UpdateForwardRules(rules []v1alpha1.ForwardRule) {
+	d.rules <- rules
+}
+
+func (d *forwardPhaseData) LoadIkniteClusterSpec() (*v1alpha1.IkniteClusterSpec, error) {
+	return d.spec, d.specErr
+}
+
+func (d *forwardPhaseData) RegisterIkniteClusterListener() (<-chan *v1alpha1.IkniteCluster, func()) {
+	return d.updates, func() { close(d.updates) }
+}
+
+func (d *forwardPhaseData) RegisterShutdownHook(name string, fn func() error) {
+	d.hookManager.Register(name, fn)
+}
+
+func startForwardTestBackend(t *testing.T) string {
+	t.Helper()
+	listener, err := (&net.ListenConfig{}).Listen(t.Context(), "tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() }) //nolint:errcheck,gosec // test cleanup
+	go func() {
+		for {
+			conn, acceptErr := listener.Accept()
+			if acceptErr != nil {
+				return
+			}
+			line, _ := bufio.NewReader(conn).ReadString('\n') //nolint:errcheck // checked by the client
+			conn.Write([]byte("echo:" + line))                //nolint:errcheck,gosec // checked by the client
+			conn.Close()                                      //nolint:errcheck,gosec // test backend
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func forwardTestPort(t *testing.T) int {
+	t.Helper()
+	listener, err := (&net.ListenConfig{}).Listen(t.Context(), "tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port //nolint:forcetypeassert // tcp listener
+	require.NoError(t, listener.Close())
+	return port
+}
+
+func forwardTestRoundTrip(t *testing.T, port int) (string, error) {
+	t.Helper()
+	conn, err := (&net.Dialer{Timeout: time.Second}).DialContext(t.Context(), "tcp",
+		net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return "", err //nolint:wrapcheck // test helper
+	}
+	defer conn.Close() //nolint:errcheck // test cleanup
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+	_, err = conn.Write([]byte("ping\n"))
+	require.NoError(t, err)
+	return bufio.NewReader(conn).ReadString('\n') //nolint:wrapcheck // test helper
+}
+
+func TestRunForward(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	backend := startForwardTestBackend(t)
+	listener, err := (&net.ListenConfig{}).Listen(t.Context(), "tcp", "127.0.0.1:0")
+	req.NoError(err)
+	port := listener.Addr().(*net.TCPAddr).Port //nolint:forcetypeassert // tcp listener
+	req.NoError(listener.Close())
+
+	cluster := v1alpha1.NewDefaultIkniteCluster()
+	cluster.Spec.Forwards = []v1alpha1.ForwardRule{
+		{Name: "web", ListenAddress: "127.0.0.1", Port: port, Target: backend},
+	}
+	data := &forwardPhaseData{
+		host:    host.NewDefaultHost(),
+		ctx:     t.Context(),
+		cluster: cluster,
+		updates: make(chan *v1alpha1.IkniteCluster, 1),
+		rules:   make(chan []v1alpha1.ForwardRule, 1),
+		logger:  testutil.TestLogger(t),
+	}
+
+	req.NoError(runForward(data))
+	req.NotNil(data.manager)
+	line, err := forwardTestRoundTrip(t, port)
+	req.NoError(err)
+	req.Equal("echo:ping\n", line)
+
+	// Runtime changes are reported to the cluster
+	req.NoError(data.manager.Remove("web"))
+	req.Empty(<-data.rules)
+
+	// The rules are reloaded when the cluster changes
+	data.updates <- cluster.DeepCopy()
+	req.Eventually(func() bool { return len(data.manager.Rules()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	line, err = forwardTestRoundTrip(t, port)
+	req.NoError(err)
+	req.Equal("echo:ping\n", line)
+
+	req.NoError(data.hookManager.Run())
+	_, err = forwardTestRoundTrip(t, port)
+	req.Error(err)
+}
+
+func TestRunForward_InvalidRule(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	cluster := v1alpha1.NewDefaultIkniteCluster()
+	cluster.Spec.Forwards = []v1alpha1.ForwardRule{{Name: "invalid"}}
+	data := &forwardPhaseData{
+		host:    host.NewDefaultHost(),
+		ctx:     t.Context(),
+		cluster: cluster,
+		logger:  testutil.TestLogger(t),
+	}
+
+	req.ErrorContains(runForward(data), "failed to start the port forwarding")
+	req.Nil(data.manager)
+}
+
+func TestRunForward_FailingRule(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	backend := startForwardTestBackend(t)
+	webPort := forwardTestPort(t)
+	// The port of the busy rule is already in use
+	busy, err := (&net.ListenConfig{}).Listen(t.Context(), "tcp", "127.0.0.1:0")
+	req.NoError(err)
+	t.Cleanup(func() { busy.Close() })          //nolint:errcheck,gosec // test cleanup
+	busyPort := busy.Addr().(*net.TCPAddr).Port //nolint:forcetypeassert // tcp listener
+
+	cluster := v1alpha1.NewDefaultIkniteCluster()
+	cluster.Spec.Forwards = []v1alpha1.ForwardRule{
+		{Name: "busy", ListenAddress: "127.0.0.1", Port: busyPort, Target: backend},
+		{Name: "web", ListenAddress: "127.0.0.1", Port: webPort, Target: backend},
+	}
+	data := &forwardPhaseData{
+		host:    host.NewDefaultHost(),
+		ctx:     t.Context(),
+		cluster: cluster,
+		updates: make(chan *v1alpha1.IkniteCluster, 1),
+		rules:   make(chan []v1alpha1.ForwardRule, 1),
+		logger:  testutil.TestLogger(t),
+	}
+
+	req.NoError(runForward(data))
+	req.NotNil(data.manager)
+	line, err := forwardTestRoundTrip(t, webPort)
+	req.NoError(err)
+	req.Equal("echo:ping\n", line)
+	status := data.manager.Status()
+	req.Len(status, 2)
+	req.Equal("busy", status[0].Name)
+	req.NotEmpty(status[0].Error)
+	req.Empty(status[1].Error)
+
+	req.NoError(data.hookManager.Run())
+}
+
+func TestReloadForwardRules(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	backend := startForwardTestBackend(t)
+	webPort, extraPort, apiPort := forwardTestPort(t), forwardTestPort(t), forwardTestPort(t)
+	data := &forwardPhaseData{
+		host:   host.NewDefaultHost(),
+		ctx:    t.Context(),
+		rules:  make(chan []v1alpha1.ForwardRule, 4),
+		logger: testutil.TestLogger(t),
+	}
+	manager := forward.NewManager(t.Context(), data.host, nil, data.UpdateForwardRules, data.logger)
+	t.Cleanup(func() { manager.Close() }) //nolint:errcheck,gosec // test cleanup
+	configured := []v1alpha1.ForwardRule{{Name: "web", ListenAddress: "127.0.0.1", Port: webPort, Target: backend}}
+	req.NoError(manager.Apply(configured))
+	req.NoError(manager.Add(v1alpha1.ForwardRule{
+		Name: "extra", ListenAddress: "127.0.0.1", Port: extraPort, Target: backend,
+	}))
+	<-data.rules
+
+	// The configured rules are replaced and the runtime rules are kept
+	data.spec = &v1alpha1.IkniteClusterSpec{Forwards: []v1alpha1.ForwardRule{
+		{ListenAddress: "127.0.0.1", Port: apiPort, Target: backend},
+	}}
+	names := reloadForwardRules(data, manager, ruleNames(configured))
+	apiName := strconv.Itoa(apiPort)
+	req.Equal([]string{apiName}, names)
+	rules := <-data.rules
+	req.Len(rules, 2)
+	req.Equal(apiName, rules[0].Name)
+	req.Equal("extra", rules[1].Name)
+	_, err := forwardTestRoundTrip(t, webPort)
+	req.Error(err)
+	line, err := forwardTestRoundTrip(t, apiPort)
+	req.NoError(err)
+	req.Equal("echo:ping\n", line)
+
+	// A configuration that cannot be loaded or is invalid keeps the current rules
+	data.specErr = errors.New("invalid configuration")
+	req.Equal(names, reloadForwardRules(data, manager, names))
+	data.spec, data.specErr = &v1alpha1.IkniteClusterSpec{Forwards: []v1alpha1.ForwardRule{{Name: "invalid"}}}, nil
+	req.Equal(names, reloadForwardRules(data, manager, names))
+	req.Len(manager.Rules(), 2)
+}
@@ -30,7 +30,6 @@ import (
 	"k8s.io/kubernetes/cmd/kubeadm/app/features"
 	kubeletPhase "k8s.io/kubernetes/cmd/kubeadm/app/phases/kubelet"
 
-	"github.com/kaweezle/iknite/pkg/host"
 	"github.com/kaweezle/iknite/pkg/k8s"
 	"github.com/kaweezle/iknite/pkg/utils"
 )
@@ -62,9 +61,7 @@ func NewKubeletStartPhase() workflow.Phase {
 }
 
 type kubeletStartData interface {
-	host.HostProvider
-	ContextProvider
-	KubeletProcessHolder
+	KubeletStarter
 	Cfg() *kubeadmapi.InitConfiguration
 	DryRun() bool
 	KubeletDir() string
@@ -127,13 +124,18 @@ func runKubeletStart(c workflow.RunData) error {
 	// Try to start the kubelet service in case it's inactive
 	if !data.DryRun() {
 		logger.Info("Starting the kubelet")
-		ctx := data.Context()
-		process, err := k8s.StartKubelet(ctx, data.Host())
-		if err != nil {
-			return fmt.Errorf("failed to start kubelet: %w", err)
-		}
-		data.SetKubeletProcess(process)
+		return StartKubeletProcess(data)
 	}
 
 	return nil
 }
+
+// StartKubeletProcess starts the kubelet as a child process and keeps track of it in data.
+func StartKubeletProcess(data KubeletStarter) error {
+	process, err := k8s.StartKubelet(data.Context(), data.Host())
+	if err != nil {
+		return fmt.Errorf("failed to start kubelet: %w", err)
+	}
+	data.SetKubeletProcess(process)
+	return nil
+}
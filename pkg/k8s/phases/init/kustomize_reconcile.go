@@ -0,0 +1,84 @@
+package init
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/kubernetes/cmd/kubeadm/app/cmd/phases/workflow"
+
+	"github.com/kaweezle/iknite/pkg/constants"
+	"github.com/kaweezle/iknite/pkg/host"
+	"github.com/kaweezle/iknite/pkg/k8s"
+	"github.com/kaweezle/iknite/pkg/utils"
+)
+
+const kustomizeReconcilePhaseName = "kustomize-reconcile"
+
+// runKustomizationReconcilerFn runs the reconciler until the context is done. It is replaced in tests.
+var runKustomizationReconcilerFn = func(ctx context.Context, reconciler *k8s.KustomizationReconciler) error {
+	return reconciler.Run(ctx)
+}
+
+func NewKustomizeReconcilePhase() workflow.Phase {
+	return workflow.Phase{
+		Name:  kustomizeReconcilePhaseName,
+		Short: "Re-apply the kustomization when its content changes.",
+		Long: `Watches the kustomization directory when the reconciliation is enabled and
+re-applies the kustomization with server-side apply each time its rendered
+content changes. OCI and git sources are rendered again when their digest
+changes. The live objects are regularly compared with the rendered ones to
+detect drift. The state of the reconciliation is reported in the cluster
+status.`,
+		Run: runKustomizeReconcile,
+	}
+}
+
+type kustomizeReconcileData interface {
+	host.HostProvider
+	IkniteClusterProvider
+	KustomizeOptionsProvider
+	ContextProvider
+	RESTClientGetterProvider
+	ErrGroupProvider
+	KustomizationStateUpdater
+	utils.LoggerProvider
+}
+
+func runKustomizeReconcile(c workflow.RunData) error {
+	data, ok := c.(kustomizeReconcileData)
+	if !ok {
+		return fmt.Errorf("%s phase invoked with an invalid data struct", kustomizeReconcilePhaseName)
+	}
+	logger := data.Logger().With("phase", kustomizeReconcilePhaseName)
+	spec := &data.IkniteCluster().Spec
+	if !spec.ReconcileKustomization {
+		logger.Debug("Kustomization reconciliation not enabled, skipping")
+		return nil
+	}
+
+	kubeClient, err := data.RESTClientGetter()
+	if err != nil {
+		return fmt.Errorf("failed to get REST client getter: %w", err)
+	}
+
+	interval := time.Duration(spec.StatusUpdateLongIntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = constants.StatusUpdateLongIntervalSeconds * time.Second
+	}
+
+	reconciler := k8s.NewKustomizationReconciler(
+		kubeClient,
+		data.Host(),
+		data.KustomizeOptions(),
+		interval,
+		data.UpdateKustomizationState,
+	)
+
+	ctx := data.Context()
+	logger.Debug("Starting kustomization reconciliation...")
+	data.ErrGroup().Go(func() error {
+		return runKustomizationReconcilerFn(ctx, reconciler)
+	})
+	return nil
+}
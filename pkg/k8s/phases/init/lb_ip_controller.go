@@ -0,0 +1,331 @@
+package init
+
+// cSpell: words clientset corev metav apierrors apimachinery lbip informer informers workqueue
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	listersV1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
+	"github.com/kaweezle/iknite/pkg/host"
+	"github.com/kaweezle/iknite/pkg/utils"
+)
+
+var (
+	// setLBIPResync is the interval at which all the LoadBalancer services are synchronized again.
+	setLBIPResync = 10 * time.Minute
+	// setLBIPOutboundIPCheckInterval is the interval at which the outbound IP address is checked for changes.
+	setLBIPOutboundIPCheckInterval = 30 * time.Second
+	// setLBIPBaseBackoff and setLBIPMaxBackoff bound the exponential backoff of the services that cannot be patched.
+	setLBIPBaseBackoff = 500 * time.Millisecond
+	setLBIPMaxBackoff  = 5 * time.Minute
+)
+
+// lbIPController sets the ingress IPs of the LoadBalancer services. The services are watched with an informer and
+// synchronized through a rate limited work queue, so that the services that cannot be patched are retried with an
+// exponential backoff. The outbound IP address of the host is checked periodically and all the services are
+// synchronized again when it changes.
+type lbIPController struct {
+	client      kubernetes.Interface
+	network     host.NetworkHost
+	clusterIP   net.IP
+	allocation  *lbIPAllocation
+	onState     func(*v1alpha1.LoadBalancerState)
+	logger      *slog.Logger
+	queue       workqueue.TypedRateLimitingInterface[string]
+	lister      listersV1.ServiceLister
+	failures    map[string]string
+	outboundIPs []string
+	// outboundIPError is the error of the last check of the outbound IP address.
+	outboundIPError string
+	state           v1alpha1.LoadBalancerState
+	resync          time.Duration
+	checkInterval   time.Duration
+	mu              sync.Mutex
+}
+
+func newLBIPController(
+	client kubernetes.Interface,
+	network host.NetworkHost,
+	clusterIP, outboundIP net.IP,
+	allocation *lbIPAllocation,
+	onState func(*v1alpha1.LoadBalancerState),
+	logger *slog.Logger,
+) *lbIPController {
+	return &lbIPController{
+		client:     client,
+		network:    network,
+		clusterIP:  clusterIP,
+		allocation: allocation,
+		onState:    onState,
+		logger:     logger,
+		queue: workqueue.NewTypedRateLimitingQueueWithConfig(
+			workqueue.NewTypedItemExponentialFailureRateLimiter[string](setLBIPBaseBackoff, setLBIPMaxBackoff),
+			workqueue.TypedRateLimitingQueueConfig[string]{Name: setLBIPPhaseName},
+		),
+		failures:      map[string]string{},
+		outboundIPs:   lbOutboundIPs(outboundIP, clusterIP),
+		state:         v1alpha1.LoadBalancerState{OutboundIP: outboundIP.String()},
+		resync:        setLBIPResync,
+		checkInterval: setLBIPOutboundIPCheckInterval,
+	}
+}
+
+// lbOutboundIPs returns the IPs given to the annotated services: the outbound IP and the cluster IP if it differs.
+func lbOutboundIPs(outboundIP, clusterIP net.IP) []string {
+	ips := []string{outboundIP.String()}
+	if clusterIP != nil && !clusterIP.Equal(outboundIP) {
+		ips = append(ips, clusterIP.String())
+	}
+	return ips
+}
+
+// Run synchronizes the services until ctx is done.
+func (c *lbIPController) Run(ctx context.Context) error {
+	factory := informers.NewSharedInformerFactoryWithOptions(c.client, c.resync,
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("spec.type",
+				string(corev1.ServiceTypeLoadBalancer)).String()
+		}))
+	informer := factory.Core().V1().Services()
+	c.lister = informer.Lister()
+	if _, err := informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.enqueue,
+		UpdateFunc: func(_, obj any) { c.enqueue(obj) },
+		DeleteFunc: c.deleted,
+	}); err != nil {
+		return fmt.Errorf("while adding the services event handler: %w", err)
+	}
+
+	defer c.queue.ShutDown()
+	factory.Start(ctx.Done())
+	defer factory.Shutdown()
+
+	if !cache.WaitForCacheSync(ctx.Done(), informer.Informer().HasSynced) {
+		return nil
+	}
+	c.mu.Lock()
+	c.state.Synced = true
+	c.mu.Unlock()
+	c.publish()
+
+	go wait.UntilWithContext(ctx, func(ctx context.Context) {
+		for c.processNextItem(ctx) {
+		}
+	}, time.Second)
+
+	ticker := time.NewTicker(c.checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			c.checkOutboundIP()
+		}
+	}
+}
+
+func (c *lbIPController) enqueue(obj any) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil { // nocov -- services always have a key
+		c.logger.Warn("Cannot get the key of the service", utils.ErrorKey, err)
+		return
+	}
+	c.queue.Add(key)
+}
+
+// deleted enqueues the deleted service so that its IP is released by the worker, the only one to use the pool.
+func (c *lbIPController) deleted(obj any) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil { // nocov -- services always have a key
+		c.logger.Warn("Cannot get the key of the deleted service", utils.ErrorKey, err)
+		return
+	}
+	c.queue.Add(key)
+}
+
+func (c *lbIPController) processNextItem(ctx context.Context) bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	err := c.sync(ctx, key)
+	c.mu.Lock()
+	if err != nil {
+		c.failures[key] = err.Error()
+		c.state.LastError = err.Error()
+	} else {
+		delete(c.failures, key)
+	}
+	c.mu.Unlock()
+	c.publish()
+
+	if err != nil {
+		c.logger.Error("Failed to patch LoadBalancer service", utils.ErrorKey, err, "service", key,
+			"retries", c.queue.NumRequeues(key))
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+// sync sets the ingress IPs of the service key.
+func (c *lbIPController) sync(ctx context.Context, key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil { // nocov -- keys come from the informer
+		return fmt.Errorf("invalid service key %s: %w", key, err)
+	}
+	service, err := c.lister.Services(namespace).Get(name)
+	if apierrors.IsNotFound(err) {
+		// Services that stop being LoadBalancer services are also reported as deleted
+		if c.allocation != nil {
+			c.allocation.release(&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}},
+				c.logger.With("service", name, "namespace", namespace))
+		}
+		return nil
+	}
+	if err != nil { // nocov -- the lister only returns not found errors
+		return fmt.Errorf("while getting service %s: %w", key, err)
+	}
+	if service.Spec.Type != corev1.ServiceTypeLoadBalancer {
+		if c.allocation != nil {
+			c.allocation.release(service, c.logger.With("service", name, "namespace", namespace))
+		}
+		return nil
+	}
+
+	logger := c.logger.With("service", name, "namespace", namespace)
+	if c.allocation != nil && !c.allocation.manages(service) {
+		// The service may have had an IP of the pool before being annotated
+		c.allocation.release(service, logger)
+	}
+
+	c.mu.Lock()
+	outboundIPs := slices.Clone(c.outboundIPs)
+	c.mu.Unlock()
+
+	core := c.client.CoreV1()
+	if shouldPatchServiceLBIP(service, outboundIPs) {
+		logger.Info("Patching LoadBalancer service with outbound IP", "outboundIPs", outboundIPs)
+		return patchServiceLBIP(ctx, core, service, logger, outboundIPs)
+	}
+	if c.allocation == nil || !c.allocation.manages(service) {
+		logger.Debug("No patch needed for service")
+		return nil
+	}
+	ip, err := c.allocation.allocate(service, logger)
+	if err != nil {
+		return err
+	}
+	if lbIngressDiffers(service, []string{ip}) {
+		return patchServiceLBIP(ctx, core, service, logger, []string{ip})
+	}
+	return nil
+}
+
+// checkOutboundIP synchronizes all the services again when the outbound IP address of the host has changed.
+func (c *lbIPController) checkOutboundIP() {
+	outboundIP, err := c.network.GetOutboundIP()
+	if err == nil && outboundIP == nil {
+		err = errors.New("no outbound IP address")
+	}
+	if err != nil {
+		c.logger.Warn("Failed to check the outbound IP", utils.ErrorKey, err)
+		c.mu.Lock()
+		c.outboundIPError = fmt.Sprintf("failed to get outbound IP: %v", err)
+		c.state.LastError = c.outboundIPError
+		c.mu.Unlock()
+		c.publish()
+		return
+	}
+
+	outboundIPs := lbOutboundIPs(outboundIP, c.clusterIP)
+	c.mu.Lock()
+	changed := !slices.Equal(outboundIPs, c.outboundIPs)
+	previous := c.outboundIPs
+	c.outboundIPs = outboundIPs
+	c.state.OutboundIP = outboundIP.String()
+	recovered := c.outboundIPError != ""
+	c.outboundIPError = ""
+	c.mu.Unlock()
+	if !changed {
+		if recovered {
+			c.publish()
+		}
+		return
+	}
+
+	c.logger.Info("Outbound IP changed, patching the LoadBalancer services again",
+		"previous", previous, "outboundIPs", outboundIPs)
+	services, err := c.lister.List(labels.Everything())
+	if err != nil { // nocov -- the lister does not fail
+		c.logger.Warn("Failed to list the LoadBalancer services", utils.ErrorKey, err)
+	}
+	for _, service := range services {
+		c.enqueue(service)
+	}
+	c.publish()
+}
+
+// publish reports the state of the controller if it has changed.
+func (c *lbIPController) publish() {
+	services := 0
+	if c.lister != nil {
+		if list, err := c.lister.List(labels.Everything()); err == nil {
+			for _, service := range list {
+				if service.Spec.Type == corev1.ServiceTypeLoadBalancer {
+					services++
+				}
+			}
+		}
+	}
+
+	c.mu.Lock()
+	state := c.state
+	state.Services = services
+	state.FailingServices = nil
+	for key := range c.failures {
+		state.FailingServices = append(state.FailingServices, key)
+	}
+	slices.Sort(state.FailingServices)
+	state.Healthy = state.Synced && len(state.FailingServices) == 0 && c.outboundIPError == ""
+	if state.Healthy {
+		state.LastError = ""
+	}
+	changed := !reflect.DeepEqual(state, c.state)
+	c.state = state
+	c.mu.Unlock()
+
+	if changed && c.onState != nil {
+		c.onState(state.DeepCopy())
+	}
+}
+
+// State returns the current state of the controller.
+func (c *lbIPController) State() *v1alpha1.LoadBalancerState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state.DeepCopy()
+}
@@ -0,0 +1,225 @@
+// cSpell: words lbip corev metav clientset testutil workqueue apierrors
+package init
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/util/workqueue"
+
+	mockHost "github.com/kaweezle/iknite/mocks/pkg/host"
+	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
+	"github.com/kaweezle/iknite/pkg/testutil"
+)
+
+// lbIPControllerTest runs a controller on a fake clientset and records the states it reports.
+type lbIPControllerTest struct {
+	client     *fake.Clientset
+	controller *lbIPController
+	outboundIP atomic.Value
+	states     []*v1alpha1.LoadBalancerState
+	mu         sync.Mutex
+}
+
+func newLBIPControllerTest(
+	t *testing.T,
+	allocation *lbIPAllocation,
+	objects ...runtime.Object,
+) *lbIPControllerTest {
+	t.Helper()
+	test := &lbIPControllerTest{client: fake.NewClientset(objects...)}
+	test.outboundIP.Store(net.ParseIP(testOutboundIP))
+
+	network := mockHost.NewMockNetworkHost(t)
+	network.EXPECT().GetOutboundIP().RunAndReturn(func() (net.IP, error) {
+		ip, ok := test.outboundIP.Load().(net.IP)
+		if !ok || ip == nil {
+			return nil, errors.New("network is unreachable")
+		}
+		return ip, nil
+	}).Maybe()
+
+	test.controller = newLBIPController(test.client, network, nil, net.ParseIP(testOutboundIP), allocation,
+		func(state *v1alpha1.LoadBalancerState) {
+			test.mu.Lock()
+			defer test.mu.Unlock()
+			test.states = append(test.states, state)
+		}, testutil.TestLogger(t))
+	test.controller.checkInterval = 10 * time.Millisecond
+	test.controller.queue = workqueue.NewTypedRateLimitingQueue(
+		workqueue.NewTypedItemExponentialFailureRateLimiter[string](time.Millisecond, 10*time.Millisecond))
+	return test
+}
+
+func (test *lbIPControllerTest) run(t *testing.T) func() {
+	t.Helper()
+	ctx, cancel := context.WithCancel(t.Context())
+	var eg errgroup.Group
+	eg.Go(func() error { return test.controller.Run(ctx) })
+	return func() {
+		cancel()
+		require.NoError(t, eg.Wait())
+	}
+}
+
+func (test *lbIPControllerTest) ingressIPs(t *testing.T, namespace, name string) []string {
+	t.Helper()
+	service, err := test.client.CoreV1().Services(namespace).Get(t.Context(), name, metav1.GetOptions{})
+	require.NoError(t, err)
+	ips := make([]string, 0, len(service.Status.LoadBalancer.Ingress))
+	for _, ingress := range service.Status.LoadBalancer.Ingress {
+		ips = append(ips, ingress.IP)
+	}
+	return ips
+}
+
+func (test *lbIPControllerTest) hasState(match func(*v1alpha1.LoadBalancerState) bool) bool {
+	test.mu.Lock()
+	defer test.mu.Unlock()
+	for _, state := range test.states {
+		if match(state) {
+			return true
+		}
+	}
+	return false
+}
+
+func annotatedLBService(namespace, name string) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   namespace,
+			Annotations: map[string]string{setLBIPAnnotation: setLBIPAnnotationValue},
+		},
+		Spec: corev1.ServiceSpec{
+			Type:  corev1.ServiceTypeLoadBalancer,
+			Ports: []corev1.ServicePort{{Name: "https", Port: 443, Protocol: corev1.ProtocolTCP}},
+		},
+	}
+}
+
+func TestLBIPController_PatchesAndFollowsOutboundIP(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	test := newLBIPControllerTest(t, nil, annotatedLBService("argocd", "argocd-gateway"))
+	stop := test.run(t)
+	defer stop()
+
+	req.Eventually(func() bool {
+		ips := test.ingressIPs(t, "argocd", "argocd-gateway")
+		return len(ips) == 1 && ips[0] == testOutboundIP
+	}, 5*time.Second, 10*time.Millisecond)
+	req.Eventually(func() bool {
+		return test.hasState(func(state *v1alpha1.LoadBalancerState) bool {
+			return state.Healthy && state.Services == 1 && state.OutboundIP == testOutboundIP
+		})
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// A failing check of the outbound IP makes the controller unhealthy until it recovers
+	test.outboundIP.Store(net.IP(nil))
+	req.Eventually(func() bool {
+		state := test.controller.State()
+		return !state.Healthy && state.LastError != ""
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The services are patched again with the new outbound IP
+	test.outboundIP.Store(net.ParseIP("10.196.248.120"))
+	req.Eventually(func() bool {
+		ips := test.ingressIPs(t, "argocd", "argocd-gateway")
+		return len(ips) == 1 && ips[0] == "10.196.248.120"
+	}, 5*time.Second, 10*time.Millisecond)
+	req.Eventually(func() bool {
+		state := test.controller.State()
+		return state.Healthy && state.LastError == "" && state.OutboundIP == "10.196.248.120"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestLBIPController_RetriesFailedServices(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	test := newLBIPControllerTest(t, nil, annotatedLBService("argocd", "argocd-gateway"))
+	var attempts atomic.Int32
+	test.client.PrependReactor("update", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() == "status" && attempts.Add(1) <= 3 {
+			return true, nil, errors.New("api server unavailable")
+		}
+		return false, nil, nil
+	})
+	stop := test.run(t)
+	defer stop()
+
+	req.Eventually(func() bool {
+		ips := test.ingressIPs(t, "argocd", "argocd-gateway")
+		return len(ips) == 1 && ips[0] == testOutboundIP
+	}, 5*time.Second, 10*time.Millisecond)
+	req.GreaterOrEqual(attempts.Load(), int32(4))
+	req.True(test.hasState(func(state *v1alpha1.LoadBalancerState) bool {
+		return !state.Healthy && len(state.FailingServices) == 1 && state.FailingServices[0] == "argocd/argocd-gateway" &&
+			state.LastError != ""
+	}))
+	req.Eventually(func() bool {
+		state := test.controller.State()
+		return state.Healthy && len(state.FailingServices) == 0 && state.LastError == ""
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestLBIPController_Pool(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	pool, err := newLBIPPool("192.168.99.16/28")
+	req.NoError(err)
+	h := mockHost.NewMockHost(t)
+	allocation := &lbIPAllocation{pool: pool, host: h, iface: "eth0"}
+
+	h.On("CheckIpExists", net.ParseIP("192.168.99.20").To4()).Return(false, nil).Once()
+	h.On("Run", true, "/sbin/ip", []string{"addr", "add", "192.168.99.20/24", "broadcast", "+", "dev", "eth0"}).
+		Return([]byte{}, nil).Once()
+	removed := make(chan struct{}, 1)
+	h.On("Run", true, "/sbin/ip", []string{"addr", "del", "192.168.99.20/24", "dev", "eth0"}).
+		Return([]byte{}, nil).Run(func(mock.Arguments) { removed <- struct{}{} }).Once()
+
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "internal", Namespace: "gateways"},
+		Spec: corev1.ServiceSpec{
+			Type:           corev1.ServiceTypeLoadBalancer,
+			LoadBalancerIP: "192.168.99.20", //nolint:staticcheck // requested IP
+			Ports:          []corev1.ServicePort{{Name: "https", Port: 443, Protocol: corev1.ProtocolTCP}},
+		},
+	}
+	test := newLBIPControllerTest(t, allocation, service)
+	stop := test.run(t)
+	defer stop()
+
+	req.Eventually(func() bool {
+		ips := test.ingressIPs(t, "gateways", "internal")
+		return len(ips) == 1 && ips[0] == "192.168.99.20"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Deleting the service releases its IP
+	req.NoError(test.client.CoreV1().Services("gateways").Delete(t.Context(), "internal", metav1.DeleteOptions{}))
+	select {
+	case <-removed:
+	case <-time.After(5 * time.Second):
+		req.Fail("the IP of the deleted service has not been released")
+	}
+	req.Eventually(func() bool { return test.controller.State().Services == 0 }, 5*time.Second, 10*time.Millisecond)
+	stop()
+	_, allocated := pool.Get("gateways/internal")
+	req.False(allocated)
+}
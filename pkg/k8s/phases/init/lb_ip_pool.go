@@ -0,0 +1,117 @@
+package init
+
+// cSpell: words lbip fnv
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net"
+)
+
+// lbIPPool allocates the IPs of the LoadBalancer services from a CIDR. The IP of a service is derived from a hash of
+// its key so that it stays the same across restarts as long as there is no collision.
+type lbIPPool struct {
+	network   *net.IPNet
+	byIP      map[uint32]string
+	byService map[string]uint32
+	first     uint32
+	size      uint32
+}
+
+func newLBIPPool(cidr string, reserved ...net.IP) (*lbIPPool, error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid load balancer IP pool %s: %w", cidr, err)
+	}
+	if network.IP.To4() == nil {
+		return nil, fmt.Errorf("load balancer IP pool %s is not an IPv4 network", cidr)
+	}
+	ones, bits := network.Mask.Size()
+	pool := &lbIPPool{
+		network:   network,
+		byIP:      map[uint32]string{},
+		byService: map[string]uint32{},
+		first:     binary.BigEndian.Uint32(network.IP.To4()),
+		size:      uint32(1) << (bits - ones),
+	}
+	// Exclude the network and broadcast addresses of networks having them
+	if pool.size > 2 { //nolint:mnd // network and broadcast addresses
+		pool.first++
+		pool.size -= 2
+	}
+	for _, ip := range reserved {
+		if pool.contains(ip) {
+			pool.byIP[binary.BigEndian.Uint32(ip.To4())] = ""
+		}
+	}
+	return pool, nil
+}
+
+func (p *lbIPPool) contains(ip net.IP) bool {
+	if ip == nil || ip.To4() == nil {
+		return false
+	}
+	value := binary.BigEndian.Uint32(ip.To4())
+	return value >= p.first && value-p.first < p.size
+}
+
+func toIP(value uint32) net.IP {
+	ip := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(ip, value)
+	return ip
+}
+
+// Get returns the IP allocated to the service with key, if any.
+func (p *lbIPPool) Get(key string) (net.IP, bool) {
+	value, ok := p.byService[key]
+	if !ok {
+		return nil, false
+	}
+	return toIP(value), true
+}
+
+// Allocate returns the IP of the service with key, allocating it if needed. The first free preferred IP in the pool,
+// such as the current IP of the service, is allocated first.
+func (p *lbIPPool) Allocate(key string, preferred ...net.IP) (net.IP, error) {
+	if ip, ok := p.Get(key); ok {
+		return ip, nil
+	}
+	for _, ip := range preferred {
+		if !p.contains(ip) {
+			continue
+		}
+		value := binary.BigEndian.Uint32(ip.To4())
+		if _, taken := p.byIP[value]; !taken {
+			return p.assign(key, value), nil
+		}
+	}
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(key)) //nolint:errcheck // never fails
+	start := hash.Sum32() % p.size
+	for i := range p.size {
+		value := p.first + (start+i)%p.size
+		if _, taken := p.byIP[value]; !taken {
+			return p.assign(key, value), nil
+		}
+	}
+	return nil, errors.New("load balancer IP pool " + p.network.String() + " is exhausted")
+}
+
+func (p *lbIPPool) assign(key string, value uint32) net.IP {
+	p.byIP[value] = key
+	p.byService[key] = value
+	return toIP(value)
+}
+
+// Release frees the IP of the service with key and returns it, or nil if the service had no IP.
+func (p *lbIPPool) Release(key string) net.IP {
+	value, ok := p.byService[key]
+	if !ok {
+		return nil
+	}
+	delete(p.byService, key)
+	delete(p.byIP, value)
+	return toIP(value)
+}
@@ -0,0 +1,66 @@
+// cSpell: words lbip
+package init
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLBIPPool(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	pool, err := newLBIPPool("192.168.99.16/30", net.ParseIP("192.168.99.17"), net.ParseIP("10.0.0.1"))
+	req.NoError(err)
+
+	// Only 192.168.99.18 is available: .16 and .19 are the network and broadcast addresses, .17 is reserved
+	ip, err := pool.Allocate("default/first")
+	req.NoError(err)
+	req.Equal("192.168.99.18", ip.String())
+	ip, err = pool.Allocate("default/first")
+	req.NoError(err)
+	req.Equal("192.168.99.18", ip.String(), "allocation is stable")
+
+	_, err = pool.Allocate("default/second")
+	req.ErrorContains(err, "192.168.99.16/30 is exhausted")
+
+	req.Equal("192.168.99.18", pool.Release("default/first").String())
+	req.Nil(pool.Release("default/first"))
+	ip, err = pool.Allocate("default/second")
+	req.NoError(err)
+	req.Equal("192.168.99.18", ip.String())
+
+	_, err = newLBIPPool("192.168.99.300/28")
+	req.ErrorContains(err, "invalid load balancer IP pool")
+	_, err = newLBIPPool("fd00::/120")
+	req.ErrorContains(err, "is not an IPv4 network")
+}
+
+func TestLBIPPool_Preferred(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	pool, err := newLBIPPool("192.168.99.16/28")
+	req.NoError(err)
+
+	ip, err := pool.Allocate("default/first", net.ParseIP("10.0.0.1"), net.ParseIP("192.168.99.20"))
+	req.NoError(err)
+	req.Equal("192.168.99.20", ip.String())
+
+	ip, err = pool.Allocate("default/second", net.ParseIP("192.168.99.20"))
+	req.NoError(err)
+	req.NotEqual("192.168.99.20", ip.String())
+	req.True(pool.contains(ip))
+
+	// Without preferred IP, the allocation only depends on the service key
+	pool, err = newLBIPPool("192.168.99.16/28")
+	req.NoError(err)
+	first, err := pool.Allocate("default/third")
+	req.NoError(err)
+	req.Equal(first.String(), pool.Release("default/third").String())
+	second, err := pool.Allocate("default/third")
+	req.NoError(err)
+	req.Equal(first.String(), second.String())
+}
@@ -3,29 +3,59 @@ package init
 // cSpell: disable
 import (
 	"fmt"
-	"net"
+	"time"
 
-	"github.com/pion/mdns/v2"
-	"golang.org/x/net/ipv4"
-	"golang.org/x/net/ipv6"
 	"k8s.io/kubernetes/cmd/kubeadm/app/cmd/phases/workflow"
 
+	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
+	"github.com/kaweezle/iknite/pkg/constants"
+	"github.com/kaweezle/iknite/pkg/k8s"
+	"github.com/kaweezle/iknite/pkg/mdns"
 	"github.com/kaweezle/iknite/pkg/utils"
 )
 
 // cSpell: enable
 
+// probeMDnsNameFn probes the name published by the phase. It is replaced in tests.
+var probeMDnsNameFn mdns.ProbeFunc = mdns.Probe
+
+// newMDnsAdvertiserFn creates the DNS-SD advertiser of the phase. It is replaced in tests.
+var newMDnsAdvertiserFn = mdns.ListenAdvertiser
+
+// newMDnsResponderFn creates the mDNS responder of the phase. It is replaced in tests.
+var newMDnsResponderFn = func() *mdns.Responder {
+	return mdns.NewResponder(nil)
+}
+
 func NewMDnsPublishPhase() workflow.Phase {
 	return workflow.Phase{
 		Name:  "mdns-publish",
 		Short: "Publish the cluster domain with mdns.",
-		Run:   runMDnsPublish,
+		Long: `Publishes the cluster domain with mdns. The .local hostnames of the
+HTTPRoutes, of the Ingresses and of the LoadBalancer services annotated with
+config.iknite.app/hostnames are also published, and the published names are
+updated as these resources change.
+
+The domain name is probed before being published. If another host on the
+network answers for it, it is renamed with a numeric suffix or the phase fails,
+depending on the mdns conflict policy. The outcome is recorded in the cluster
+status.
+
+The API server and the status server are advertised with DNS-SD as the
+_kubernetes._tcp and _iknite._tcp services, with the name, the Kubernetes
+version and the state of the cluster in their TXT records.`,
+		Run: runMDnsPublish,
 	}
 }
 
 type mdnsData interface {
 	IkniteClusterProvider
 	ShutdownHookRegistrar
+	IkniteClusterListenerRegistrar
+	MDNSStateUpdater
+	ContextProvider
+	RESTClientGetterProvider
+	ErrGroupProvider
 	utils.LoggerProvider
 }
 
@@ -43,38 +73,67 @@ func runMDnsPublish(c workflow.RunData) error {
 		return nil
 	}
 
-	addr4, err := net.ResolveUDPAddr("udp", mdns.DefaultAddressIPv4)
+	ips := mdns.InterfaceAddresses(ikniteConfig.NetworkInterface)
+	name, conflict, err := mdns.ResolveName(data.Context(), mdns.LenientProbe(probeMDnsNameFn, logger),
+		ikniteConfig.DomainName, ikniteConfig.MDNSConflictPolicy, ips)
+	state := &v1alpha1.MDNSState{RequestedName: ikniteConfig.DomainName, Name: name, Conflict: conflict}
 	if err != nil {
-		return fmt.Errorf("cannot resolve default address: %w", err)
+		state.Error = err.Error()
+		data.UpdateMDNSState(state)
+		return fmt.Errorf("cannot publish %s with mdns: %w", ikniteConfig.DomainName, err)
+	}
+	data.UpdateMDNSState(state)
+	if conflict {
+		logger.Warn("The domain name is used by another host, publishing a renamed one",
+			"domainName", ikniteConfig.DomainName, "name", name)
 	}
 
-	l4, err := net.ListenUDP("udp4", addr4)
-	if err != nil {
-		return fmt.Errorf("cannot listen on default address: %w", err)
+	logger.Info("Starting the mdns responder...", "name", name)
+	responder := newMDnsResponderFn()
+	if err = responder.SetNames(name); err != nil {
+		return fmt.Errorf("cannot create server: %w", err)
 	}
+	data.RegisterShutdownHook("mdns", responder.Close)
 
-	addr6, err := net.ResolveUDPAddr("udp6", mdns.DefaultAddressIPv6)
+	advertiser, err := newMDnsAdvertiserFn()
 	if err != nil {
-		return fmt.Errorf("cannot resolve default address: %w", err)
+		logger.Warn("Cannot advertise the cluster services with DNS-SD", utils.ErrorKey, err)
+	} else {
+		if err = advertiser.SetServices(mdns.ClusterServices(data.IkniteCluster(), ips...)...); err != nil {
+			logger.Warn("Cannot advertise the cluster services", utils.ErrorKey, err)
+		}
+		ch, unregister := data.RegisterIkniteClusterListener()
+		go func() {
+			for cluster := range ch {
+				if updateErr := advertiser.SetServices(mdns.ClusterServices(cluster, ips...)...); updateErr != nil {
+					logger.Warn("Cannot advertise the cluster services", utils.ErrorKey, updateErr)
+				}
+			}
+		}()
+		data.RegisterShutdownHook("dns-sd", func() error {
+			unregister()
+			return advertiser.Close()
+		})
 	}
 
-	l6, err := net.ListenUDP("udp6", addr6)
+	kubeClient, err := data.RESTClientGetter()
 	if err != nil {
-		return fmt.Errorf("cannot listen on default address: %w", err)
+		return fmt.Errorf("failed to get REST client getter: %w", err)
 	}
-
-	logger.Debug("Start mdns responder...", "addr4", addr4, "addr6", addr6, "interface4", l4.LocalAddr(),
-		"interface6", l6.LocalAddr())
-
-	var conn *mdns.Conn
-	logger.Info("Starting the mdns responder...")
-	conn, err = mdns.Server(ipv4.NewPacketConn(l4), ipv6.NewPacketConn(l6), &mdns.Config{
-		LocalNames: []string{ikniteConfig.DomainName},
-	})
+	interval := time.Duration(ikniteConfig.StatusUpdateLongIntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = constants.StatusUpdateLongIntervalSeconds * time.Second
+	}
+	watcher, err := k8s.NewRouteWatcherFromGetter(kubeClient, interval,
+		responder.HostsHandler(name))
 	if err != nil {
-		return fmt.Errorf("cannot create server: %w", err)
+		return fmt.Errorf("failed to create route watcher: %w", err)
 	}
-	data.RegisterShutdownHook("mdns", conn.Close)
 
+	ctx := data.Context()
+	logger.Debug("Starting route names publication...")
+	data.ErrGroup().Go(func() error {
+		return runRouteWatcherFn(ctx, watcher)
+	})
 	return nil
 }
@@ -0,0 +1,77 @@
+package init
+
+import (
+	"fmt"
+
+	"k8s.io/kubernetes/cmd/kubeadm/app/cmd/phases/workflow"
+
+	"github.com/kaweezle/iknite/pkg/host"
+	"github.com/kaweezle/iknite/pkg/notify"
+	"github.com/kaweezle/iknite/pkg/utils"
+)
+
+const notifyPhaseName = "notify"
+
+func NewNotifyPhase() workflow.Phase {
+	return workflow.Phase{
+		Name:  notifyPhaseName,
+		Short: "Send the lifecycle events of the cluster to the configured notifiers.",
+		Long: `Send the lifecycle events of the cluster to the notifiers of the cluster
+specification.
+
+An event is sent when the state of the cluster changes, for instance when it
+becomes Running or Failed, and when the set of unready workloads changes. The
+webhook notifiers receive the event as a JSON POST request and the command
+notifiers on their standard input. The failed notifications are retried and
+the notifications of each notifier are rate limited.`,
+		Run: runNotify,
+	}
+}
+
+type notifyData interface {
+	IkniteClusterProvider
+	host.HostProvider
+	IkniteClusterListenerRegistrar
+	ShutdownHookRegistrar
+	utils.LoggerProvider
+}
+
+func runNotify(c workflow.RunData) error {
+	data, ok := c.(notifyData)
+	if !ok {
+		return fmt.Errorf("%s phase invoked with an invalid data struct", notifyPhaseName)
+	}
+
+	cluster := data.IkniteCluster()
+	logger := data.Logger().With("phase", notifyPhaseName)
+	if len(cluster.Spec.Notifiers) == 0 {
+		logger.Info("No notifier configured, skipping notify phase.")
+		return nil
+	}
+
+	manager := notify.NewManager(data.Host(), logger)
+	if err := manager.Apply(cluster.Spec.Notifiers); err != nil {
+		return fmt.Errorf("invalid notifiers configuration: %w", err)
+	}
+	manager.Notify(cluster)
+
+	ch, unregister := data.RegisterIkniteClusterListener()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for cluster := range ch {
+			if err := manager.Apply(cluster.Spec.Notifiers); err != nil {
+				logger.Warn("Failed to reload the notifiers", utils.ErrorKey, err)
+			}
+			manager.Notify(cluster)
+		}
+	}()
+
+	data.RegisterShutdownHook(notifyPhaseName, func() error {
+		// Let the last updates, like the failure of the workflow, reach the notifiers
+		unregister()
+		<-done
+		return manager.Close()
+	})
+	return nil
+}
@@ -0,0 +1,104 @@
+// cSpell: words testutil httptest
+package init
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	ikniteApi "github.com/kaweezle/iknite/pkg/apis/iknite"
+	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
+	"github.com/kaweezle/iknite/pkg/host"
+	"github.com/kaweezle/iknite/pkg/notify"
+	"github.com/kaweezle/iknite/pkg/testutil"
+	"github.com/kaweezle/iknite/pkg/utils"
+)
+
+type notifyPhaseData struct {
+	host        host.Host
+	cluster     *v1alpha1.IkniteCluster
+	updates     chan *v1alpha1.IkniteCluster
+	logger      *slog.Logger
+	hookManager utils.HookManager
+}
+
+func (d *notifyPhaseData) IkniteCluster() *v1alpha1.IkniteCluster { return d.cluster }
+func (d *notifyPhaseData) Host() host.Host                        { return d.host }
+func (d *notifyPhaseData) Logger() *slog.Logger                   { return d.logger }
+
+func (d *notifyPhaseData) RegisterIkniteClusterListener() (<-chan *v1alpha1.IkniteCluster, func()) {
+	return d.updates, func() { close(d.updates) }
+}
+
+func (d *notifyPhaseData) RegisterShutdownHook(name string, fn func() error) {
+	d.hookManager.Register(name, fn)
+}
+
+func TestRunNotify(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	var (
+		events []notify.Event
+		mu     sync.Mutex
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		var event notify.Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err == nil {
+			mu.Lock()
+			events = append(events, event)
+			mu.Unlock()
+		}
+	}))
+	defer server.Close()
+
+	cluster := v1alpha1.NewDefaultIkniteCluster()
+	cluster.Update(ikniteApi.Started, "notify", nil, nil)
+	cluster.Spec.Notifiers = []v1alpha1.NotifierConfig{{Name: "hook", URL: server.URL, Events: []string{"state"}}}
+	data := &notifyPhaseData{
+		host:    host.NewDefaultHost(),
+		cluster: cluster,
+		updates: make(chan *v1alpha1.IkniteCluster, 4),
+		logger:  testutil.TestLogger(t),
+	}
+	req.NoError(runNotify(data))
+
+	// The updates published before the shutdown are sent
+	initializing := cluster.DeepCopy()
+	initializing.Update(ikniteApi.Initializing, "kubelet-start", nil, nil)
+	data.updates <- initializing
+	failed := initializing.DeepCopy()
+	failed.Update(ikniteApi.Failed, "kubelet-start", nil, nil)
+	data.updates <- failed
+	req.NoError(data.hookManager.Run())
+
+	mu.Lock()
+	defer mu.Unlock()
+	req.Len(events, 2)
+	req.Equal(ikniteApi.Initializing, events[0].State)
+	req.Equal(ikniteApi.Started, events[0].PreviousState)
+	req.Equal(ikniteApi.Failed, events[1].State)
+	req.Equal("kubelet-start", events[1].Phase)
+}
+
+func TestRunNotify_Configuration(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	// Without notifiers, the phase does nothing
+	data := &notifyPhaseData{
+		host:    host.NewDefaultHost(),
+		cluster: v1alpha1.NewDefaultIkniteCluster(),
+		logger:  testutil.TestLogger(t),
+	}
+	req.NoError(runNotify(data))
+	req.NoError(data.hookManager.Run())
+
+	data.cluster.Spec.Notifiers = []v1alpha1.NotifierConfig{{Name: "invalid", URL: "hooks.example.com"}}
+	req.ErrorContains(runNotify(data), "invalid notifiers configuration")
+}
@@ -43,16 +43,20 @@ func TestPhaseConstructors(t *testing.T) {
 		name        string
 		wantName    string
 	}{
+		{name: "air-gapped", constructor: NewAirGappedPreflightPhase, wantName: "air-gapped-preflight"},
 		{name: "pre-clean", constructor: NewPreCleanHostPhase, wantName: "pre-clean-host"},
 		{name: "prepare", constructor: NewPrepareHostPhase, wantName: "prepare-host"},
 		{name: "kubelet", constructor: NewKubeletStartPhase, wantName: "kubelet-start"},
 		{name: "kine", constructor: NewKineControlPlanePhase, wantName: "kine"},
 		{name: "kube-vip", constructor: NewKubeVipControlPlanePhase, wantName: "kube-vip"},
 		{name: "kustomize", constructor: NewKustomizeClusterPhase, wantName: "kustomize-cluster"},
+		{name: "kustomize-reconcile", constructor: NewKustomizeReconcilePhase, wantName: "kustomize-reconcile"},
 		{name: "mdns", constructor: NewMDnsPublishPhase, wantName: "mdns-publish"},
+		{name: forwardPhaseName, constructor: NewForwardPhase, wantName: forwardPhaseName},
+		{name: notifyPhaseName, constructor: NewNotifyPhase, wantName: notifyPhaseName},
 		{name: "serve", constructor: NewServePhase, wantName: "serve"},
-		{name: proxyAPIPhaseName, constructor: NewProxyAPIPhase, wantName: proxyAPIPhaseName},
 		{name: setLBIPPhaseName, constructor: NewSetLBIPPhase, wantName: setLBIPPhaseName},
+		{name: publishHostsPhaseName, constructor: NewPublishHostsPhase, wantName: publishHostsPhaseName},
 		{name: "copy-config", constructor: NewCopyConfigPhase, wantName: "copy-config"},
 		{name: "workloads", constructor: NewWorkloadsPhase, wantName: "workloads"},
 		{name: "daemonize", constructor: NewDaemonizePhase, wantName: "daemonize"},
@@ -78,14 +82,18 @@ func TestRunPhasesRejectInvalidData(t *testing.T) {
 		run  func(workflow.RunData) error
 		name string
 	}{
+		{name: "air-gapped", run: runAirGappedPreflight},
 		{name: "pre-clean", run: runPreCleanHost},
 		{name: "prepare", run: runPrepareHost},
 		{name: "kubelet", run: runKubeletStart},
 		{name: "kustomize", run: runKustomize},
+		{name: "kustomize-reconcile", run: runKustomizeReconcile},
 		{name: "mdns", run: runMDnsPublish},
+		{name: forwardPhaseName, run: runForward},
+		{name: notifyPhaseName, run: runNotify},
 		{name: "serve", run: runServe},
-		{name: proxyAPIPhaseName, run: runProxyAPI},
 		{name: setLBIPPhaseName, run: runSetLBIP},
+		{name: publishHostsPhaseName, run: runPublishHosts},
 		{name: "copy-config", run: runCopyConfig},
 		{name: "workloads", run: runMonitorWorkloads},
 		{name: "daemonize", run: runDaemonize},
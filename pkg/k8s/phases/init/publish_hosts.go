@@ -0,0 +1,83 @@
+package init
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"k8s.io/kubernetes/cmd/kubeadm/app/cmd/phases/workflow"
+
+	"github.com/kaweezle/iknite/pkg/alpine"
+	"github.com/kaweezle/iknite/pkg/constants"
+	"github.com/kaweezle/iknite/pkg/host"
+	"github.com/kaweezle/iknite/pkg/k8s"
+	"github.com/kaweezle/iknite/pkg/utils"
+)
+
+const (
+	publishHostsPhaseName = "publish-hosts"
+	// routeHostsComment identifies the entries of the hosts file managed by the phase.
+	routeHostsComment = "iknite-routes"
+)
+
+// runRouteWatcherFn runs the route watcher until the context is done. It is replaced in tests.
+var runRouteWatcherFn = func(ctx context.Context, watcher *k8s.RouteWatcher) error {
+	return watcher.Run(ctx)
+}
+
+func NewPublishHostsPhase() workflow.Phase {
+	return workflow.Phase{
+		Name:  publishHostsPhaseName,
+		Short: "Publish the HTTPRoute and Ingress hostnames in the hosts file.",
+		Long: `Watches the hostnames of the Gateway API HTTPRoutes, of the Ingresses and
+of the LoadBalancer services annotated with config.iknite.app/hostnames and
+maps them to the IP of their LoadBalancer service in the hosts file. The
+entries are kept at the end of the file, each one marked with the
+iknite-routes comment, and are removed when the routes disappear.`,
+		Run: runPublishHosts,
+	}
+}
+
+type publishHostsData interface {
+	host.HostProvider
+	IkniteClusterProvider
+	ContextProvider
+	RESTClientGetterProvider
+	ErrGroupProvider
+	utils.LoggerProvider
+}
+
+func runPublishHosts(c workflow.RunData) error {
+	data, ok := c.(publishHostsData)
+	if !ok {
+		return fmt.Errorf("%s phase invoked with an invalid data struct", publishHostsPhaseName)
+	}
+	logger := data.Logger().With("phase", publishHostsPhaseName)
+
+	kubeClient, err := data.RESTClientGetter()
+	if err != nil {
+		return fmt.Errorf("failed to get REST client getter: %w", err)
+	}
+
+	interval := time.Duration(data.IkniteCluster().Spec.StatusUpdateLongIntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = constants.StatusUpdateLongIntervalSeconds * time.Second
+	}
+
+	hostsConfig := data.Host().GetHostsConfig()
+	watcher, err := k8s.NewRouteWatcherFromGetter(kubeClient, interval,
+		func(_ context.Context, hosts map[string]net.IP) error {
+			return alpine.SetHostsBlock(hostsConfig, routeHostsComment, hosts, logger)
+		})
+	if err != nil {
+		return fmt.Errorf("failed to create route watcher: %w", err)
+	}
+
+	ctx := data.Context()
+	logger.Debug("Starting route hosts publication...")
+	data.ErrGroup().Go(func() error {
+		return runRouteWatcherFn(ctx, watcher)
+	})
+	return nil
+}
@@ -44,6 +44,12 @@ func runServe(c workflow.RunData) error {
 
 	data.Logger().Info("Iknite status server started", "port", ikniteCluster.Spec.StatusServerPort)
 
+	if provider, ok := c.(ForwardManagerProvider); ok {
+		if manager := provider.ForwardManager(); manager != nil {
+			srv.SetForwarder(manager)
+		}
+	}
+
 	ch, unregister := data.RegisterIkniteClusterListener()
 	go func() {
 		for cluster := range ch {
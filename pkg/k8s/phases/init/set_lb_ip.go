@@ -5,15 +5,15 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net"
 
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/fields"
-	"k8s.io/apimachinery/pkg/watch"
 	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/kubernetes/cmd/kubeadm/app/cmd/phases/workflow"
 
+	"github.com/kaweezle/iknite/pkg/alpine"
 	"github.com/kaweezle/iknite/pkg/host"
 	"github.com/kaweezle/iknite/pkg/k8s"
 	"github.com/kaweezle/iknite/pkg/utils"
@@ -28,8 +28,19 @@ const (
 func NewSetLBIPPhase() workflow.Phase {
 	return workflow.Phase{
 		Name:  setLBIPPhaseName,
-		Short: "Set LoadBalancer ingress IPs to the outbound IP.",
-		Run:   runSetLBIP,
+		Short: "Set LoadBalancer ingress IPs to the outbound IP or to IPs of the LoadBalancer IP pool.",
+		Long: `Set the ingress IPs of the LoadBalancer services.
+
+The services annotated with config.iknite.app/outbound-ip=true receive the outbound
+IP address of the host (and the cluster IP address if it differs). The other
+services receive an IP of the LoadBalancer IP pool, if configured.
+
+The services are watched with an informer that is resynchronized periodically.
+The services that cannot be patched are retried with an exponential backoff.
+The outbound IP address is checked periodically and the services are patched
+again when it changes. The health of the controller is reported in the
+loadBalancer field of the cluster status.`,
+		Run: runSetLBIP,
 	}
 }
 
@@ -39,6 +50,7 @@ type setLBIPData interface {
 	ContextProvider
 	RESTClientGetterProvider
 	ErrGroupProvider
+	LoadBalancerStateUpdater
 	utils.LoggerProvider
 }
 
@@ -51,17 +63,21 @@ func runSetLBIP(c workflow.RunData) error {
 	alpineHost := data.Host()
 	logger := data.Logger()
 
-	ips := make([]string, 0)
-
 	outboundIP, err := alpineHost.GetOutboundIP()
 	if err != nil { // nocov -- Unlikely to fail and hard to test, so skipping coverage
 		return fmt.Errorf("failed to get outbound IP: %w", err)
 	}
-	ips = append(ips, outboundIP.String())
 
-	clusterIp := data.IkniteCluster().Spec.Ip
-	if !clusterIp.Equal(outboundIP) {
-		ips = append(ips, clusterIp.String())
+	spec := &data.IkniteCluster().Spec
+	clusterIp := spec.Ip
+
+	var allocation *lbIPAllocation
+	if spec.LoadBalancerIPPool != "" {
+		pool, err := newLBIPPool(spec.LoadBalancerIPPool, outboundIP, clusterIp)
+		if err != nil {
+			return err
+		}
+		allocation = &lbIPAllocation{pool: pool, host: alpineHost, iface: spec.NetworkInterface}
 	}
 
 	getter, err := data.RESTClientGetter()
@@ -74,70 +90,69 @@ func runSetLBIP(c workflow.RunData) error {
 		return fmt.Errorf("failed to get kubernetes clientset: %w", err)
 	}
 
-	core := cs.CoreV1()
-
+	controller := newLBIPController(cs, alpineHost, clusterIp, outboundIP, allocation, data.UpdateLoadBalancerState,
+		logger)
 	ctx := data.Context()
 	data.ErrGroup().Go(func() error {
-		return watchSetLBIPServices(ctx, core, logger, ips...)
+		return controller.Run(ctx)
 	})
 
 	return nil
 }
 
-func watchSetLBIPServices(
-	ctx context.Context,
-	core v1.CoreV1Interface,
-	l *slog.Logger,
-	outboundIPs ...string,
-) error {
-	listOptions := metav1.ListOptions{
-		FieldSelector: fields.OneTermEqualSelector("spec.type", string(corev1.ServiceTypeLoadBalancer)).String(),
-	}
+// lbIPAllocation allocates the IPs of the LoadBalancer services from the pool and adds them to the interface.
+type lbIPAllocation struct {
+	pool  *lbIPPool
+	host  host.Host
+	iface string
+}
+
+// manages returns true if the IP of the service is allocated from the pool. The services annotated with
+// config.iknite.app/outbound-ip and the services of another load balancer class are not.
+func (a *lbIPAllocation) manages(service *corev1.Service) bool {
+	return service.Spec.Type == corev1.ServiceTypeLoadBalancer &&
+		service.Spec.LoadBalancerClass == nil &&
+		service.GetAnnotations()[setLBIPAnnotation] != setLBIPAnnotationValue
+}
 
-	watcher, err := core.Services(metav1.NamespaceAll).Watch(ctx, listOptions)
+// allocate returns the IP of the service, allocating it and adding it to the interface if needed. The current IP of
+// the service is kept when possible.
+func (a *lbIPAllocation) allocate(service *corev1.Service, l *slog.Logger) (string, error) {
+	key := service.Namespace + "/" + service.Name
+	if ip, ok := a.pool.Get(key); ok {
+		return ip.String(), nil
+	}
+	preferred := []net.IP{net.ParseIP(service.Spec.LoadBalancerIP)} //nolint:staticcheck // still used to request IPs
+	for _, ingress := range service.Status.LoadBalancer.Ingress {
+		preferred = append(preferred, net.ParseIP(ingress.IP))
+	}
+	ip, err := a.pool.Allocate(key, preferred...)
 	if err != nil {
-		return fmt.Errorf("failed to watch services in all namespaces: %w", err)
+		return "", fmt.Errorf("while allocating IP to service %s: %w", key, err)
 	}
-	defer watcher.Stop()
-
-	for event := range watcher.ResultChan() {
-		if event.Type == watch.Error {
-			if status, ok := event.Object.(*metav1.Status); ok {
-				return fmt.Errorf("watch error: %s", status.Message)
-			}
-			return fmt.Errorf("unknown watch error")
-		}
-		if event.Type != watch.Added && event.Type != watch.Modified {
-			l.Debug("Ignoring non-added/modified service event", "eventType", event.Type)
-			continue
-		}
-
-		service, ok := event.Object.(*corev1.Service)
-		if !ok { // nocov -- Should never happen, and hard to test, so skipping coverage
-			l.Warn("Received unexpected object type in service watch", "eventObject", event.Object)
-			continue
-		}
-
-		logger := l.With(
-			"service", service.Name,
-			"namespace", service.Namespace,
-			"eventType", event.Type,
-		)
-
-		logger.Info("Received service event")
-
-		if shouldPatchServiceLBIP(service, outboundIPs) {
-			logger.Info("Patching LoadBalancer service with outbound IP", "outboundIPs", outboundIPs)
-
-			if err := patchServiceLBIP(ctx, core, service, logger, outboundIPs); err != nil {
-				logger.Error("Failed to patch LoadBalancer service", utils.ErrorKey, err, "service", service.Name)
-			}
-		} else {
-			logger.Debug("No patch needed for service")
-		}
+	exists, err := a.host.CheckIpExists(ip)
+	if err == nil && !exists {
+		err = alpine.AddIpAddress(a.host, a.iface, ip, l)
 	}
+	if err != nil {
+		a.pool.Release(key)
+		return "", fmt.Errorf("while adding IP %v of service %s to interface %s: %w", ip, key, a.iface, err)
+	}
+	l.Info("Allocated load balancer IP", "ip", ip.String())
+	return ip.String(), nil
+}
 
-	return nil
+// release frees the IP of the service and removes it from the interface.
+func (a *lbIPAllocation) release(service *corev1.Service, l *slog.Logger) {
+	ip := a.pool.Release(service.Namespace + "/" + service.Name)
+	if ip == nil {
+		return
+	}
+	if err := alpine.RemoveIpAddress(a.host, a.iface, ip, l); err != nil {
+		l.Warn("Failed to remove load balancer IP from interface", "ip", ip.String(), utils.ErrorKey, err)
+		return
+	}
+	l.Info("Released load balancer IP", "ip", ip.String())
 }
 
 func shouldPatchServiceLBIP(service *corev1.Service, outboundIPs []string) bool {
@@ -156,6 +171,11 @@ func shouldPatchServiceLBIP(service *corev1.Service, outboundIPs []string) bool
 		return false
 	}
 	// Now check if the service already has the correct IP to avoid unnecessary patching
+	return lbIngressDiffers(service, outboundIPs)
+}
+
+// lbIngressDiffers returns true if the LoadBalancer ingress of the service doesn't contain exactly the IPs.
+func lbIngressDiffers(service *corev1.Service, outboundIPs []string) bool {
 	if len(service.Status.LoadBalancer.Ingress) != len(outboundIPs) {
 		return true
 	}
@@ -5,23 +5,24 @@ package init
 import (
 	"context"
 	"embed"
+	"encoding/json"
 	"errors"
 	"log/slog"
 	"net"
 	"net/http"
+	"sync"
 	"testing"
+	"time"
 
-	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/sync/errgroup"
 	corev1 "k8s.io/api/core/v1"
-	apiErrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 
 	mockGenericCLI "github.com/kaweezle/iknite/mocks/k8s.io/cli-runtime/pkg/genericclioptions"
-	mockV1 "github.com/kaweezle/iknite/mocks/k8s.io/client-go/kubernetes/typed/core/v1"
 	mockHost "github.com/kaweezle/iknite/mocks/pkg/host"
 	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
 	"github.com/kaweezle/iknite/pkg/host"
@@ -32,7 +33,7 @@ const (
 	testOutboundIP = "10.196.248.109"
 	testClusterIP  = "10.196.248.110"
 	//nolint:lll // JSON string is long and difficult to break into multiple lines without losing readability
-	serviceEvent = `{"type":"ADDED","object":{"kind":"Service","apiVersion":"v1","metadata":{"name":"argocd-gateway","namespace":"argocd","uid":"53bb5ca7-e030-41c0-9dd2-47d5acb43f6c","resourceVersion":"1065","creationTimestamp":"2026-05-10T16:14:31Z","labels":{"app.kubernetes.io/instance":"argocd-gateway","app.kubernetes.io/managed-by":"kgateway","app.kubernetes.io/name":"argocd-gateway","app.kubernetes.io/version":"v2.2.2"},"annotations":{"config.iknite.app/outbound-ip":"true"}},"spec":{"ports":[{"name":"listener-80","protocol":"TCP","port":80,"targetPort":80,"nodePort":30818},{"name":"listener-443","protocol":"TCP","port":443,"targetPort":443,"nodePort":32243}],"selector":{"app.kubernetes.io/instance":"argocd-gateway","app.kubernetes.io/name":"argocd-gateway","gateway.networking.k8s.io/gateway-name":"argocd-gateway"},"type":"LoadBalancer","sessionAffinity":"None","externalTrafficPolicy":"Cluster","ipFamilies":["IPv4"],"ipFamilyPolicy":"SingleStack","allocateLoadBalancerNodePorts":true,"internalTrafficPolicy":"Cluster"}}}`
+	serviceList = `{"kind":"ServiceList","apiVersion":"v1","metadata":{"resourceVersion":"1065"},"items":[{"metadata":{"name":"argocd-gateway","namespace":"argocd","uid":"53bb5ca7-e030-41c0-9dd2-47d5acb43f6c","resourceVersion":"1065","creationTimestamp":"2026-05-10T16:14:31Z","labels":{"app.kubernetes.io/instance":"argocd-gateway","app.kubernetes.io/managed-by":"kgateway","app.kubernetes.io/name":"argocd-gateway","app.kubernetes.io/version":"v2.2.2"},"annotations":{"config.iknite.app/outbound-ip":"true"}},"spec":{"ports":[{"name":"listener-80","protocol":"TCP","port":80,"targetPort":80,"nodePort":30818},{"name":"listener-443","protocol":"TCP","port":443,"targetPort":443,"nodePort":32243}],"selector":{"app.kubernetes.io/instance":"argocd-gateway","app.kubernetes.io/name":"argocd-gateway","gateway.networking.k8s.io/gateway-name":"argocd-gateway"},"type":"LoadBalancer","sessionAffinity":"None","externalTrafficPolicy":"Cluster","ipFamilies":["IPv4"],"ipFamilyPolicy":"SingleStack","allocateLoadBalancerNodePorts":true,"internalTrafficPolicy":"Cluster"}}]}`
 )
 
 func createMockHostWithOutboundIP(t *testing.T, ip string) *mockHost.MockHost {
@@ -48,7 +49,7 @@ func createMockHostWithOutboundIP(t *testing.T, ip string) *mockHost.MockHost {
 func serviceToFillHandler(
 	_ string,
 	w http.ResponseWriter,
-	_ *http.Request,
+	r *http.Request,
 	log *testutil.RequestLog,
 	_ embed.FS,
 	_ *slog.Logger,
@@ -56,11 +57,53 @@ func serviceToFillHandler(
 	w.Header().Set("Content-Type", "application/json")
 	log.StatusCode = http.StatusOK
 	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write([]byte(serviceEvent)) //nolint:errcheck // In tests we can ignore write errors
+	if r.URL.Query().Get("watch") == "true" {
+		if r.URL.Query().Get("sendInitialEvents") == "true" {
+			writeInitialWatchEvents(w)
+		}
+		// Keep the watch open until the informer stops
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		<-r.Context().Done()
+		return true
+	}
+	_, _ = w.Write([]byte(serviceList)) //nolint:errcheck // In tests we can ignore write errors
 
 	return true
 }
 
+// writeInitialWatchEvents streams the services of serviceList as a watch list request expects them: one ADDED
+// event per service followed by the bookmark ending the initial events.
+func writeInitialWatchEvents(w http.ResponseWriter) {
+	var list corev1.ServiceList
+	if err := json.Unmarshal([]byte(serviceList), &list); err != nil {
+		return
+	}
+	encoder := json.NewEncoder(w)
+	for i := range list.Items {
+		service := list.Items[i]
+		service.TypeMeta = metav1.TypeMeta{Kind: "Service", APIVersion: "v1"}
+		raw, _ := json.Marshal(&service)      //nolint:errcheck,errchkjson // service is serializable
+		_ = encoder.Encode(metav1.WatchEvent{ //nolint:errcheck // In tests we can ignore write errors
+			Type:   string(watch.Added),
+			Object: runtime.RawExtension{Raw: raw},
+		})
+	}
+	bookmark := corev1.Service{
+		TypeMeta: metav1.TypeMeta{Kind: "Service", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{
+			ResourceVersion: list.ResourceVersion,
+			Annotations:     map[string]string{metav1.InitialEventsAnnotationKey: "true"},
+		},
+	}
+	raw, _ := json.Marshal(&bookmark)     //nolint:errcheck,errchkjson // service is serializable
+	_ = encoder.Encode(metav1.WatchEvent{ //nolint:errcheck // In tests we can ignore write errors
+		Type:   string(watch.Bookmark),
+		Object: runtime.RawExtension{Raw: raw},
+	})
+}
+
 func toUpdateServiceOptions() *testutil.TestServerOptions {
 	return &testutil.TestServerOptions{
 		Overrides: map[string]testutil.HandlerOverrideFunc{
@@ -82,6 +125,8 @@ type setLBIPPhaseData struct {
 	getter   genericclioptions.RESTClientGetter
 	errGroup *errgroup.Group
 	logger   *slog.Logger
+	states   []*v1alpha1.LoadBalancerState
+	mu       sync.Mutex
 }
 
 var _ setLBIPData = (*setLBIPPhaseData)(nil)
@@ -113,6 +158,40 @@ func (d *setLBIPPhaseData) ErrGroup() *errgroup.Group {
 	return d.errGroup
 }
 
+func (d *setLBIPPhaseData) UpdateLoadBalancerState(state *v1alpha1.LoadBalancerState) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.states = append(d.states, state)
+}
+
+func (d *setLBIPPhaseData) lastState() *v1alpha1.LoadBalancerState {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.states) == 0 {
+		return nil
+	}
+	return d.states[len(d.states)-1]
+}
+
+// waitForStatusUpdate waits for the update of the status of the service and stops the controller.
+func waitForStatusUpdate(t *testing.T, sOpts *testutil.TestServerOptions, cancel context.CancelFunc) testutil.RequestLog {
+	t.Helper()
+	var update testutil.RequestLog
+	require.Eventually(t, func() bool {
+		sOpts.RequestMu.Lock()
+		defer sOpts.RequestMu.Unlock()
+		for _, request := range sOpts.Requests {
+			if request.Method == http.MethodPut {
+				update = request
+				return true
+			}
+		}
+		return false
+	}, 10*time.Second, 10*time.Millisecond)
+	cancel()
+	return update
+}
+
 func TestNewSetLBIPPhase(t *testing.T) {
 	t.Parallel()
 	req := require.New(t)
@@ -137,9 +216,11 @@ func TestRunSetLBIP_NominalCase(t *testing.T) {
 	req := require.New(t)
 
 	sOpts := toUpdateServiceOptions()
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
 
 	data := &setLBIPPhaseData{
-		ctx:      t.Context(),
+		ctx:      ctx,
 		errGroup: &errgroup.Group{},
 		host:     createMockHostWithOutboundIP(t, ""),
 		cluster:  &v1alpha1.IkniteCluster{Spec: v1alpha1.IkniteClusterSpec{Ip: net.ParseIP(testOutboundIP)}},
@@ -148,11 +229,13 @@ func TestRunSetLBIP_NominalCase(t *testing.T) {
 	}
 
 	req.NoError(runSetLBIP(data))
+	writeLog := waitForStatusUpdate(t, sOpts, cancel)
 	req.NoError(data.errGroup.Wait())
-	req.Len(sOpts.Requests, 2)
-	writeLog := sOpts.Requests[1]
-	req.Equal(http.MethodPut, writeLog.Method)
 	req.Equal("/api/v1/namespaces/argocd/services/argocd-gateway/status", writeLog.Path)
+	state := data.lastState()
+	req.NotNil(state)
+	req.True(state.Synced)
+	req.Equal(testOutboundIP, state.OutboundIP)
 }
 
 func TestRunSetLBIP_UsesOutboundAndClusterIPWhenDifferent(t *testing.T) {
@@ -160,9 +243,11 @@ func TestRunSetLBIP_UsesOutboundAndClusterIPWhenDifferent(t *testing.T) {
 	req := require.New(t)
 
 	sOpts := toUpdateServiceOptions()
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
 
 	data := &setLBIPPhaseData{
-		ctx:      t.Context(),
+		ctx:      ctx,
 		errGroup: &errgroup.Group{},
 		host:     createMockHostWithOutboundIP(t, testOutboundIP),
 		cluster:  &v1alpha1.IkniteCluster{Spec: v1alpha1.IkniteClusterSpec{Ip: net.ParseIP(testClusterIP)}},
@@ -171,11 +256,8 @@ func TestRunSetLBIP_UsesOutboundAndClusterIPWhenDifferent(t *testing.T) {
 	}
 
 	req.NoError(runSetLBIP(data))
+	writeLog := waitForStatusUpdate(t, sOpts, cancel)
 	req.NoError(data.errGroup.Wait())
-	req.Len(sOpts.Requests, 2)
-
-	writeLog := sOpts.Requests[1]
-	req.Equal(http.MethodPut, writeLog.Method)
 	req.Equal("/api/v1/namespaces/argocd/services/argocd-gateway/status", writeLog.Path)
 	req.Contains(writeLog.Body, testOutboundIP)
 	req.Contains(writeLog.Body, testClusterIP)
@@ -341,10 +423,12 @@ func TestRunSetLBIP_ContextCancellation(t *testing.T) {
 		host:     createMockHostWithOutboundIP(t, ""),
 		cluster:  &v1alpha1.IkniteCluster{Spec: v1alpha1.IkniteClusterSpec{Ip: net.ParseIP(testOutboundIP)}},
 		getter:   createGetter(t, sOpts),
+		logger:   testutil.TestLogger(t),
 	}
 
-	// Should return nil since Ip is nil
+	// The controller stops as soon as it is started
 	req.NoError(runSetLBIP(data))
+	req.NoError(eg.Wait())
 }
 
 func TestShouldPatchServiceLBIP_NilAnnotations(t *testing.T) {
@@ -375,223 +459,3 @@ func TestSetLBIPPatchGeneration(t *testing.T) {
 	service.Annotations = map[string]string{setLBIPAnnotation: "false"}
 	req.False(shouldPatchServiceLBIP(service, []string{testOutboundIP}))
 }
-
-func TestWatchSetLBIPServices(t *testing.T) {
-	t.Parallel()
-	req := require.New(t)
-	logger := testutil.TestLogger(t)
-	mockServiceInterface := mockV1.NewMockServiceInterface(t)
-	mockCoreV1Interface := mockV1.NewMockCoreV1Interface(t)
-	mockCoreV1Interface.EXPECT().Services(metav1.NamespaceAll).Return(mockServiceInterface).Once()
-	mockCoreV1Interface.EXPECT().Services("argocd").Return(mockServiceInterface).Once()
-	fakeWatcher := watch.NewFake()
-	var updatedService *corev1.Service
-	mockServiceInterface.EXPECT().Watch(mock.Anything, mock.Anything).Return(fakeWatcher, nil).Once()
-	updateChannel := make(chan struct{}, 1) // Buffered channel to avoid blocking
-	mockServiceInterface.EXPECT().UpdateStatus(mock.Anything, mock.Anything, mock.Anything).RunAndReturn(
-		func(_ context.Context, service *corev1.Service, _ metav1.UpdateOptions) (*corev1.Service, error) {
-			updatedService = service
-			updateChannel <- struct{}{} // Signal that the update was called
-			return service, nil
-		}).Once()
-
-	service := &corev1.Service{
-		Spec: corev1.ServiceSpec{
-			Type: corev1.ServiceTypeLoadBalancer,
-			Ports: []corev1.ServicePort{
-				{Name: "http", Port: 80, Protocol: corev1.ProtocolTCP},
-				{Name: "https", Port: 443, Protocol: corev1.ProtocolTCP},
-			},
-		},
-		ObjectMeta: metav1.ObjectMeta{
-			Name:        "argocd-gateway",
-			Namespace:   "argocd",
-			Annotations: map[string]string{setLBIPAnnotation: "true"},
-		},
-	}
-
-	var eg errgroup.Group
-	eg.Go(func() error {
-		return watchSetLBIPServices(t.Context(), mockCoreV1Interface, logger, testOutboundIP)
-	})
-
-	fakeWatcher.Add(service)
-	<-updateChannel // Wait for the update to be called
-	req.NotNil(updatedService)
-	req.Len(updatedService.Status.LoadBalancer.Ingress, 1)
-	fakeWatcher.Modify(updatedService)               // IPs as expected, should not trigger another update
-	fakeWatcher.Delete(service)                      // Clean up by simulating deletion of the service
-	service.Annotations[setLBIPAnnotation] = "false" // Change annotation to avoid patch
-	fakeWatcher.Add(service)                         // Should not patch (Once still valid)
-	fakeWatcher.Stop()                               // Stop the watcher to end the test
-
-	err := eg.Wait()
-	req.NoError(err)
-}
-
-// Same test as before, but with update error because the service has been deleted between the watch event and the patch
-// attempt. This tests that we handle NotFound errors gracefully.
-func TestWatchSetLBIPServices_ServiceDeletedBeforePatch(t *testing.T) {
-	t.Parallel()
-	req := require.New(t)
-	mockServiceInterface := mockV1.NewMockServiceInterface(t)
-	mockCoreV1Interface := mockV1.NewMockCoreV1Interface(t)
-	mockCoreV1Interface.EXPECT().Services(metav1.NamespaceAll).Return(mockServiceInterface).Once()
-	mockCoreV1Interface.EXPECT().Services("argocd").Return(mockServiceInterface).Once()
-	fakeWatcher := watch.NewFake()
-	mockServiceInterface.EXPECT().Watch(mock.Anything, mock.Anything).Return(fakeWatcher, nil).Once()
-	mockServiceInterface.EXPECT().UpdateStatus(mock.Anything, mock.Anything, mock.Anything).
-		Return(nil, apiErrors.NewNotFound(corev1.Resource("services"), "argocd-gateway")).Once()
-
-	service := &corev1.Service{
-		Spec: corev1.ServiceSpec{
-			Type: corev1.ServiceTypeLoadBalancer,
-			Ports: []corev1.ServicePort{
-				{Name: "http", Port: 80, Protocol: corev1.ProtocolTCP},
-				{Name: "https", Port: 443, Protocol: corev1.ProtocolTCP},
-			},
-		},
-		ObjectMeta: metav1.ObjectMeta{
-			Name:        "argocd-gateway",
-			Namespace:   "argocd",
-			Annotations: map[string]string{setLBIPAnnotation: "true"},
-		},
-	}
-
-	logger, hook := testutil.TestLoggerWithHook(t) // Create a test logger and hook to capture logs
-
-	var eg errgroup.Group
-	eg.Go(func() error {
-		return watchSetLBIPServices(t.Context(), mockCoreV1Interface, logger, testOutboundIP)
-	})
-
-	fakeWatcher.Add(service)
-	fakeWatcher.Stop() // Stop the watcher to end the test
-
-	err := eg.Wait()
-	req.NoError(err) // Should not return an error even though the update failed with NotFound
-	req.Equal(slog.LevelWarn, hook.LastEntry().Level)
-	req.Equal("Service not found when patching LB IP, it may have been deleted", hook.LastEntry().Message)
-}
-
-// Same test as before, but other kind of error when patching, to verify that we log an error but keep watching for
-// other events.
-func TestWatchSetLBIPServices_PatchError(t *testing.T) {
-	t.Parallel()
-	req := require.New(t)
-	mockServiceInterface := mockV1.NewMockServiceInterface(t)
-	mockCoreV1Interface := mockV1.NewMockCoreV1Interface(t)
-	mockCoreV1Interface.EXPECT().Services(metav1.NamespaceAll).Return(mockServiceInterface).Once()
-	mockCoreV1Interface.EXPECT().Services("argocd").Return(mockServiceInterface).Once()
-	fakeWatcher := watch.NewFake()
-	mockServiceInterface.EXPECT().Watch(mock.Anything, mock.Anything).Return(fakeWatcher, nil).Once()
-	mockServiceInterface.EXPECT().UpdateStatus(mock.Anything, mock.Anything, mock.Anything).
-		Return(nil, errors.New("mock update error")).Once()
-
-	service := &corev1.Service{
-		Spec: corev1.ServiceSpec{
-			Type: corev1.ServiceTypeLoadBalancer,
-			Ports: []corev1.ServicePort{
-				{Name: "http", Port: 80, Protocol: corev1.ProtocolTCP},
-				{Name: "https", Port: 443, Protocol: corev1.ProtocolTCP},
-			},
-		},
-		ObjectMeta: metav1.ObjectMeta{
-			Name:        "argocd-gateway",
-			Namespace:   "argocd",
-			Annotations: map[string]string{setLBIPAnnotation: "true"},
-		},
-	}
-
-	logger, hook := testutil.TestLoggerWithHook(t) // Create a test logger and hook to capture logs
-	var eg errgroup.Group
-	eg.Go(func() error {
-		return watchSetLBIPServices(t.Context(), mockCoreV1Interface, logger, testOutboundIP)
-	})
-
-	fakeWatcher.Add(service)
-	fakeWatcher.Stop() // Stop the watcher to end the test
-
-	err := eg.Wait()
-	req.NoError(err) // Should not return an error even though the update failed
-	req.Equal(slog.LevelError, hook.LastEntry().Level)
-	req.Equal("Failed to patch LoadBalancer service", hook.LastEntry().Message)
-}
-
-func TestWatchSetLBIPServices_WatchError(t *testing.T) {
-	t.Parallel()
-	req := require.New(t)
-	mockServiceInterface := mockV1.NewMockServiceInterface(t)
-	mockCoreV1Interface := mockV1.NewMockCoreV1Interface(t)
-	mockCoreV1Interface.EXPECT().Services(metav1.NamespaceAll).Return(mockServiceInterface).Once()
-	mockServiceInterface.EXPECT().Watch(mock.Anything, mock.Anything).Return(nil, errors.New("mock watch error")).Once()
-
-	var eg errgroup.Group
-	logger := testutil.TestLogger(t)
-	eg.Go(func() error {
-		return watchSetLBIPServices(t.Context(), mockCoreV1Interface, logger, testOutboundIP)
-	})
-
-	err := eg.Wait()
-	req.Error(err)
-}
-
-func TestWatchSetLBIPServices_ChangeOneIpAddress(t *testing.T) {
-	t.Parallel()
-	req := require.New(t)
-	mockServiceInterface := mockV1.NewMockServiceInterface(t)
-	mockCoreV1Interface := mockV1.NewMockCoreV1Interface(t)
-	mockCoreV1Interface.EXPECT().Services(metav1.NamespaceAll).Return(mockServiceInterface).Once()
-	mockCoreV1Interface.EXPECT().Services("argocd").Return(mockServiceInterface).Twice()
-	fakeWatcher := watch.NewFake()
-	var updatedService *corev1.Service
-	mockServiceInterface.EXPECT().Watch(mock.Anything, mock.Anything).Return(fakeWatcher, nil).Once()
-	updateChannel := make(chan struct{}, 1) // Buffered channel to avoid blocking
-	mockServiceInterface.EXPECT().UpdateStatus(mock.Anything, mock.Anything, mock.Anything).RunAndReturn(
-		func(_ context.Context, service *corev1.Service, _ metav1.UpdateOptions) (*corev1.Service, error) {
-			updatedService = service
-			updateChannel <- struct{}{} // Signal that the update was called
-			return service, nil
-		}).Twice()
-
-	service := &corev1.Service{
-		Spec: corev1.ServiceSpec{
-			Type: corev1.ServiceTypeLoadBalancer,
-			Ports: []corev1.ServicePort{
-				{Name: "http", Port: 80, Protocol: corev1.ProtocolTCP},
-				{Name: "https", Port: 443, Protocol: corev1.ProtocolTCP},
-			},
-		},
-		ObjectMeta: metav1.ObjectMeta{
-			Name:        "argocd-gateway",
-			Namespace:   "argocd",
-			Annotations: map[string]string{setLBIPAnnotation: "true"},
-		},
-	}
-
-	var eg errgroup.Group
-	logger := testutil.TestLogger(t)
-	eg.Go(func() error {
-		return watchSetLBIPServices(t.Context(), mockCoreV1Interface, logger, testOutboundIP, testClusterIP)
-	})
-
-	fakeWatcher.Add(service)
-	<-updateChannel // Wait for the update to be called
-	req.NotNil(updatedService)
-	req.Len(updatedService.Status.LoadBalancer.Ingress, 2)
-	otherService := updatedService.DeepCopy()
-	otherService.Status.LoadBalancer.Ingress[0].IP = "192.168.1.19" // Simulate change of one IP address
-
-	fakeWatcher.Modify(otherService) // Should trigger another update since one IP address changed
-	<-updateChannel                  // Wait for the second update to be called
-	req.NotNil(updatedService)
-	req.Len(updatedService.Status.LoadBalancer.Ingress, 2)
-	req.Contains(updatedService.Status.LoadBalancer.Ingress[0].IP, testOutboundIP)
-	req.Contains(updatedService.Status.LoadBalancer.Ingress[1].IP, testClusterIP)
-	fakeWatcher.Error(&apiErrors.NewInternalError(errors.New("internal error")).ErrStatus)
-	fakeWatcher.Stop() // Stop the watcher to end the test
-
-	err := eg.Wait()
-	req.Error(err)
-	req.Contains(err.Error(), "watch error: Internal error occurred: internal error")
-}
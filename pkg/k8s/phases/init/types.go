@@ -10,6 +10,7 @@ import (
 
 	ikniteApi "github.com/kaweezle/iknite/pkg/apis/iknite"
 	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
+	"github.com/kaweezle/iknite/pkg/forward"
 	"github.com/kaweezle/iknite/pkg/host"
 	"github.com/kaweezle/iknite/pkg/utils"
 )
@@ -44,6 +45,12 @@ type ContextProvider interface {
 	Context() context.Context
 }
 
+type KubeletStarter interface {
+	host.HostProvider
+	ContextProvider
+	KubeletProcessHolder
+}
+
 type KustomizeOptionsProvider interface {
 	KustomizeOptions() *utils.KustomizeOptions
 }
@@ -60,6 +67,35 @@ type ErrGroupProvider interface {
 	ErrGroup() *errgroup.Group
 }
 
+type KustomizationStateUpdater interface {
+	UpdateKustomizationState(state *v1alpha1.KustomizationState)
+}
+
+type MDNSStateUpdater interface {
+	UpdateMDNSState(state *v1alpha1.MDNSState)
+}
+
+type LoadBalancerStateUpdater interface {
+	UpdateLoadBalancerState(state *v1alpha1.LoadBalancerState)
+}
+
+type ForwardRulesUpdater interface {
+	UpdateForwardRules(rules []v1alpha1.ForwardRule)
+}
+
+type IkniteClusterSpecLoader interface {
+	LoadIkniteClusterSpec() (*v1alpha1.IkniteClusterSpec, error)
+}
+
+type ForwardManagerProvider interface {
+	ForwardManager() *forward.Manager
+}
+
+type ForwardManagerHolder interface {
+	ForwardManagerProvider
+	SetForwardManager(manager *forward.Manager)
+}
+
 type ShutdownHookRegistrar interface {
 	RegisterShutdownHook(name string, fn func() error)
 }
@@ -78,6 +114,7 @@ type IkniteInitData interface {
 	KustomizeOptionsProvider
 	RESTClientGetterProvider
 	ErrGroupProvider
+	KustomizationStateUpdater
 	ShutdownHookRegistrar
 	ShutdownHookRunner
 	utils.LoggerProvider
@@ -9,6 +9,7 @@ import (
 
 	"github.com/kaweezle/iknite/pkg/apis/iknite"
 	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
+	"github.com/kaweezle/iknite/pkg/constants"
 	"github.com/kaweezle/iknite/pkg/k8s"
 	"github.com/kaweezle/iknite/pkg/utils"
 )
@@ -19,7 +20,11 @@ func NewWorkloadsPhase() workflow.Phase {
 	return workflow.Phase{
 		Name:  "workloads",
 		Short: "Monitor the cluster workloads.",
-		Run:   runMonitorWorkloads,
+		Long: `Watch the deployments, statefulsets, daemonsets, jobs, Argo CD applications and Flux
+kustomizations, helm releases and git repositories of the cluster and update the
+cluster state each time their readiness changes. The Argo CD and Flux types are
+watched once they are served by the cluster.`,
+		Run: runMonitorWorkloads,
 	}
 }
 
@@ -31,7 +36,7 @@ type monitorData interface {
 	utils.LoggerProvider
 }
 
-// runPrepare executes the node initialization process.
+// runMonitorWorkloads watches the cluster workloads and updates the cluster state each time their readiness changes.
 func runMonitorWorkloads(c workflow.RunData) error {
 	data, ok := c.(monitorData)
 	if !ok {
@@ -46,43 +51,42 @@ func runMonitorWorkloads(c workflow.RunData) error {
 	cluster := data.IkniteCluster()
 	logger := data.Logger()
 
-	ticker := time.NewTicker(time.Duration(cluster.Spec.StatusUpdateIntervalSeconds) * time.Second)
-	updateWorkloads := k8s.WorkloadsReadyConditionWithContextFunc(kubeClient, logger,
-		func(allReady bool, _ int, ready, unready []*v1alpha1.WorkloadState, _, _ int) bool {
+	// The changes are reported once they have settled for the status update interval
+	debounce := time.Duration(cluster.Spec.StatusUpdateIntervalSeconds) * time.Second
+	if debounce <= 0 {
+		debounce = constants.StatusUpdateIntervalSeconds * time.Second
+	}
+	monitor, err := k8s.NewWorkloadMonitorFromGetter(kubeClient, debounce,
+		func(ready, unready []*v1alpha1.WorkloadState) {
 			var status iknite.ClusterState
+			allReady := len(unready) == 0
 			cluster := data.IkniteCluster()
+			logger.Info(
+				fmt.Sprintf("Workloads total: %d, ready: %d, unready: %d",
+					len(ready)+len(unready), len(ready), len(unready)),
+				"ready", len(ready),
+				"unready", len(unready),
+			)
 			if allReady && cluster.Status.State != iknite.Running {
-				logger.Info("All workloads are ready. Going to 60 seconds interval.")
-				ticker.Reset(time.Duration(cluster.Spec.StatusUpdateLongIntervalSeconds) * time.Second)
+				logger.Info("All workloads are ready.")
 			}
 			if allReady || cluster.Status.State == iknite.Running {
 				status = iknite.Running
-			} else { // nocov - TODO: add a test case for this branch
+			} else {
 				status = iknite.Stabilizing
 			}
 
 			data.UpdateIkniteCluster(status, "daemonize", ready, unready)
-			return true
-		})
+		}, logger)
+	if err != nil {
+		return fmt.Errorf("cannot create the workloads monitor: %w", err)
+	}
 
-	logger.Debug("Starting workloads timer...")
+	logger.Debug("Starting workloads monitoring...")
 	data.ErrGroup().Go(func() error {
-		for {
-			select {
-			case <-ctx.Done():
-				logger.Info("Workloads monitoring stopped.")
-				ticker.Stop()
-				return ctx.Err()
-			case <-ticker.C:
-				logger.Debug("Getting workloads information...")
-				_, err := updateWorkloads(ctx)
-				if err != nil {
-					logger.Error("while getting workloads information", utils.ErrorKey, err)
-					ticker.Stop()
-					return err
-				}
-			}
-		}
+		err := monitor.Run(ctx)
+		logger.Info("Workloads monitoring stopped.")
+		return err
 	})
 
 	return nil
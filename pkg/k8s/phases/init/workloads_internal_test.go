@@ -6,6 +6,7 @@ import (
 	"errors"
 	"net"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -37,6 +38,21 @@ func createTestIkniteCluster() *v1alpha1.IkniteCluster {
 	}
 }
 
+// workloadsServerOptions lets the workloads monitor watch the workloads of the test server.
+func workloadsServerOptions() *testutil.TestServerOptions {
+	overrides := map[string]testutil.HandlerOverrideFunc{}
+	for _, path := range []string{
+		"/apis/apps/v1/deployments",
+		"/apis/apps/v1/statefulsets",
+		"/apis/apps/v1/daemonsets",
+		"/apis/batch/v1/jobs",
+		"/apis/argoproj.io/v1alpha1/applications",
+	} {
+		overrides[path] = testutil.WatchOverrideHandler
+	}
+	return &testutil.TestServerOptions{Overrides: overrides}
+}
+
 func TestRunMonitorWorkloads(t *testing.T) {
 	t.Parallel()
 
@@ -45,7 +61,7 @@ func TestRunMonitorWorkloads(t *testing.T) {
 		req := require.New(t)
 		logger := testutil.TestLogger(t)
 		m := mockData.NewMockMonitorData(t)
-		sOpts := &testutil.TestServerOptions{}
+		sOpts := workloadsServerOptions()
 		getter := testutil.CreateDefaultTestClientGetter(t, sOpts)
 		m.EXPECT().RESTClientGetter().Return(getter, nil).Once()
 
@@ -96,7 +112,7 @@ func TestRunMonitorWorkloads(t *testing.T) {
 		req.Contains(err.Error(), "cannot load the kubernetes configuration")
 	})
 
-	t.Run("Fail on download error", func(t *testing.T) {
+	t.Run("No update before the workloads are listed", func(t *testing.T) {
 		t.Parallel()
 		req := require.New(t)
 		m := mockData.NewMockMonitorData(t)
@@ -104,8 +120,10 @@ func TestRunMonitorWorkloads(t *testing.T) {
 		m.EXPECT().RESTClientGetter().Return(getter, nil).Once()
 
 		cluster := createTestIkniteCluster()
-		errGroup, ctx := errgroup.WithContext(t.Context())
+		errGroup, egContext := errgroup.WithContext(t.Context())
 		m.EXPECT().ErrGroup().Return(errGroup).Once()
+		ctx, cancel := context.WithTimeout(egContext, 500*time.Millisecond)
+		defer cancel()
 
 		m.EXPECT().Context().Return(ctx).Maybe()
 		m.EXPECT().IkniteCluster().Return(cluster).Once()
@@ -115,7 +133,7 @@ func TestRunMonitorWorkloads(t *testing.T) {
 		req.NoError(err)
 		err = errGroup.Wait()
 		req.Error(err)
-		req.Contains(err.Error(), "failed to get resource infos")
+		req.Contains(err.Error(), "while waiting for the workloads informers")
 	})
 }
 
@@ -123,7 +141,7 @@ func TestNewWorkloadsPhase(t *testing.T) {
 	t.Parallel()
 	req := require.New(t)
 	m := mockData.NewMockMonitorData(t)
-	sOpts := &testutil.TestServerOptions{}
+	sOpts := workloadsServerOptions()
 	getter := testutil.CreateDefaultTestClientGetter(t, sOpts)
 	m.EXPECT().RESTClientGetter().Return(getter, nil).Once()
 
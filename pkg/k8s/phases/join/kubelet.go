@@ -0,0 +1,193 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// cSpell: words kubeadmapi clientcmdapi clientcmd
+package join
+
+// cSpell: disable
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	kubeletConfig "k8s.io/kubelet/config/v1beta1"
+	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
+	"k8s.io/kubernetes/cmd/kubeadm/app/cmd/options"
+	"k8s.io/kubernetes/cmd/kubeadm/app/cmd/phases/workflow"
+	cmdUtil "k8s.io/kubernetes/cmd/kubeadm/app/cmd/util"
+	kubeadmConstants "k8s.io/kubernetes/cmd/kubeadm/app/constants"
+	"k8s.io/kubernetes/cmd/kubeadm/app/features"
+	kubeletPhase "k8s.io/kubernetes/cmd/kubeadm/app/phases/kubelet"
+
+	iknitePhase "github.com/kaweezle/iknite/pkg/k8s/phases/init"
+	"github.com/kaweezle/iknite/pkg/utils"
+)
+
+// cSpell: enable
+
+var kubeletStartPhaseExample = cmdUtil.Examples(`
+		# Writes a dynamic environment file with kubelet flags from a JoinConfiguration file.
+		iknite join phase kubelet-start --config config.yaml
+		`)
+
+// NewKubeletStartPhase creates an iknite workflow phase that writes the kubelet bootstrap configuration of a
+// joining worker node and starts the kubelet as a child process.
+func NewKubeletStartPhase() workflow.Phase {
+	return workflow.Phase{
+		Name:    "kubelet-start [api-server-endpoint]",
+		Short:   "Write kubelet settings, certificates and (re)start the kubelet",
+		Long:    "Write a file with KubeletConfiguration and an environment file with node specific kubelet settings, and then (re)start kubelet.", //nolint:lll // Ignore long line linter warning
+		Example: kubeletStartPhaseExample,
+		Run:     runKubeletStartJoin,
+		InheritFlags: []string{
+			options.CfgPath,
+			options.NodeCRISocket,
+			options.NodeName,
+			options.FileDiscovery,
+			options.TokenDiscovery,
+			options.TokenDiscoveryCAHash,
+			options.TokenDiscoverySkipCAHash,
+			options.TLSBootstrapToken,
+			options.TokenStr,
+			options.Patches,
+			options.DryRun,
+		},
+	}
+}
+
+type kubeletStartData interface {
+	iknitePhase.KubeletStarter
+	Cfg() *kubeadmapi.JoinConfiguration
+	InitCfg() (*kubeadmapi.InitConfiguration, error)
+	TLSBootstrapCfg() (*clientcmdapi.Config, error)
+	DryRun() bool
+	KubeConfigDir() string
+	KubeletDir() string
+	PatchesDir() string
+	OutputWriter() io.Writer
+	utils.LoggerProvider
+}
+
+// runKubeletStartJoin writes the bootstrap kubeconfig and the kubelet configuration, and then starts the kubelet.
+// The kubelet then performs the TLS bootstrap that completes the node joining the cluster.
+//
+//nolint:gocyclo // This comes from kubeadm
+func runKubeletStartJoin(c workflow.RunData) error {
+	data, ok := c.(kubeletStartData)
+	if !ok {
+		return errors.New("kubelet-start phase invoked with an invalid data struct")
+	}
+	logger := data.Logger().With("phase", "kubelet-start")
+
+	cfg := data.Cfg()
+	initCfg, err := data.InitCfg()
+	if err != nil {
+		return fmt.Errorf("failed to get the cluster init configuration: %w", err)
+	}
+	tlsBootstrapCfg, err := data.TLSBootstrapCfg()
+	if err != nil {
+		return fmt.Errorf("failed to get the TLS bootstrap configuration: %w", err)
+	}
+
+	alpineHost := data.Host()
+
+	// Write the bootstrap kubelet config file down to disk
+	bootstrapKubeConfigFile := filepath.Join(
+		data.KubeConfigDir(),
+		kubeadmConstants.KubeletBootstrapKubeConfigFileName,
+	)
+	logger.Info("Writing bootstrap kubelet config file", "path", bootstrapKubeConfigFile)
+	content, err := clientcmd.Write(*tlsBootstrapCfg)
+	if err != nil {
+		return fmt.Errorf("failed to serialize the bootstrap kubelet config: %w", err)
+	}
+	if err = alpineHost.MkdirAll(filepath.Dir(bootstrapKubeConfigFile), 0o700); err != nil {
+		return fmt.Errorf("failed to create the kubernetes configuration directory: %w", err)
+	}
+	if err = alpineHost.WriteFile(bootstrapKubeConfigFile, content, 0o600); err != nil {
+		return fmt.Errorf("couldn't save bootstrap-kubelet.conf to disk: %w", err)
+	}
+
+	// Write the ca certificate to disk so kubelet can use it for authentication
+	kubeContext, ok := tlsBootstrapCfg.Contexts[tlsBootstrapCfg.CurrentContext]
+	if !ok {
+		return fmt.Errorf("the TLS bootstrap kubeconfig has no context named %q", tlsBootstrapCfg.CurrentContext)
+	}
+	cluster, ok := tlsBootstrapCfg.Clusters[kubeContext.Cluster]
+	if !ok {
+		return fmt.Errorf("the TLS bootstrap kubeconfig has no cluster named %q", kubeContext.Cluster)
+	}
+	caPath := cfg.CACertPath
+	exists, err := alpineHost.Exists(caPath)
+	if err != nil {
+		return fmt.Errorf("failed to check the CA certificate %s: %w", caPath, err)
+	}
+	if !exists {
+		logger.Info("Writing CA certificate", "path", caPath)
+		if err = alpineHost.MkdirAll(filepath.Dir(caPath), 0o755); err != nil {
+			return fmt.Errorf("failed to create the certificates directory: %w", err)
+		}
+		if err = alpineHost.WriteFile(caPath, cluster.CertificateAuthorityData, 0o644); err != nil {
+			return fmt.Errorf("couldn't save the CA certificate to disk: %w", err)
+		}
+	}
+
+	kubeletDir := data.KubeletDir()
+
+	// Write the instance kubelet configuration file to disk.
+	if features.Enabled(initCfg.FeatureGates, features.NodeLocalCRISocket) {
+		instanceConfig := &kubeletConfig.KubeletConfiguration{
+			ContainerRuntimeEndpoint: cfg.NodeRegistration.CRISocket,
+		}
+		if err = kubeletPhase.WriteInstanceConfigToDisk(
+			instanceConfig,
+			kubeletDir,
+		); err != nil { // nocov -- only fails on disk write errors.
+			return fmt.Errorf("error writing instance kubelet configuration to disk: %w", err)
+		}
+	}
+
+	// Write the configuration for the kubelet (using the bootstrap token credentials) to disk so the kubelet can start
+	if err = kubeletPhase.WriteConfigToDisk(
+		&initCfg.ClusterConfiguration,
+		kubeletDir,
+		data.PatchesDir(),
+		data.OutputWriter(),
+	); err != nil { // nocov -- only fails on disk write errors.
+		return fmt.Errorf("error writing kubelet configuration to disk: %w", err)
+	}
+
+	// Write env file with flags for the kubelet to use. As there is no mark-control-plane phase on a worker, the taints
+	// are registered through the kubelet flags.
+	if err = kubeletPhase.WriteKubeletDynamicEnvFile(
+		&initCfg.ClusterConfiguration,
+		&initCfg.NodeRegistration,
+		cfg.ControlPlane == nil,
+		kubeletDir,
+	); err != nil {
+		return fmt.Errorf("error writing a dynamic environment file for the kubelet: %w", err)
+	}
+
+	if data.DryRun() {
+		logger.Info("Would start the kubelet")
+		return nil
+	}
+
+	logger.Info("Starting the kubelet")
+	return iknitePhase.StartKubeletProcess(data) //nolint:wrapcheck // already wrapped
+}
@@ -0,0 +1,24 @@
+// cSpell: words kubeadm
+package join
+
+import (
+	joinPhases "k8s.io/kubernetes/cmd/kubeadm/app/cmd/phases/join"
+
+	"github.com/kaweezle/iknite/pkg/host"
+	iknitePhase "github.com/kaweezle/iknite/pkg/k8s/phases/init"
+	"github.com/kaweezle/iknite/pkg/utils"
+)
+
+// IkniteJoinData is the data shared by the phases of the iknite join workflow. It extends the kubeadm join data with
+// the iknite providers needed by the host preparation, kubelet and daemonize phases.
+type IkniteJoinData interface {
+	joinPhases.JoinData
+	iknitePhase.IkniteClusterHolder
+	iknitePhase.IkniteClusterListenerRegistrar
+	iknitePhase.KubeletProcessHolder
+	host.HostProvider
+	iknitePhase.ContextProvider
+	iknitePhase.ShutdownHookRegistrar
+	iknitePhase.ShutdownHookRunner
+	utils.LoggerProvider
+}
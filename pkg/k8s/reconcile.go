@@ -0,0 +1,274 @@
+/*
+Copyright © 2021 Antoine Martin <antoine@openance.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package k8s
+
+// cSpell: words fsnotify resmap
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/resource"
+	"sigs.k8s.io/kustomize/api/resmap"
+
+	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
+	"github.com/kaweezle/iknite/pkg/cmd/util"
+	"github.com/kaweezle/iknite/pkg/host"
+	"github.com/kaweezle/iknite/pkg/provision"
+	"github.com/kaweezle/iknite/pkg/utils"
+)
+
+// These variables are replaced in tests.
+var (
+	// reconcileDebounce is the delay between the last change in the kustomization directory and the reconciliation.
+	reconcileDebounce     = 2 * time.Second
+	renderKustomizationFn = kustomizationResources
+	applyKustomizationFn  = ApplyKustomizationResources
+	diffResourcesFn       = DiffResources
+	sourceDigestFn        = provision.SourceDigest
+)
+
+// KustomizationReconciler re-applies the kustomization when its rendered content changes.
+type KustomizationReconciler struct {
+	kubeClient resource.RESTClientGetter
+	fs         host.FileSystem
+	// resources are the resources of the last rendering of the kustomization.
+	resources resmap.ResMap
+	options   *utils.KustomizeOptions
+	onUpdate  func(state *v1alpha1.KustomizationState)
+	// sourceDigest is the digest of the kustomization source at the last rendering.
+	sourceDigest string
+	state        v1alpha1.KustomizationState
+	interval     time.Duration
+	mu           sync.RWMutex
+}
+
+// NewKustomizationReconciler creates a reconciler for the kustomization described by options. The kustomization is
+// rendered again each time its directory changes and, when it is an OCI or git source, each interval in which its
+// digest has changed. Each interval, the live objects are also compared with the rendered ones to detect drift.
+// onUpdate is called each time the state of the reconciliation changes.
+func NewKustomizationReconciler(
+	kubeClient resource.RESTClientGetter,
+	fs host.FileSystem,
+	options *utils.KustomizeOptions,
+	interval time.Duration,
+	onUpdate func(state *v1alpha1.KustomizationState),
+) *KustomizationReconciler {
+	reconcileOptions := *options
+	// The hash decides when to apply
+	reconcileOptions.ForceConfig = false
+	return &KustomizationReconciler{
+		kubeClient: kubeClient,
+		fs:         fs,
+		options:    &reconcileOptions,
+		interval:   interval,
+		onUpdate:   onUpdate,
+	}
+}
+
+// State returns the current state of the reconciliation.
+func (r *KustomizationReconciler) State() *v1alpha1.KustomizationState {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.state.DeepCopy()
+}
+
+func (r *KustomizationReconciler) isSource() bool {
+	return !r.options.ForceEmbedded && provision.IsSource(r.options.Kustomization)
+}
+
+// Reconcile renders the kustomization, applies it if it has changed since the last application and checks if the
+// cluster has drifted from it. Reconcile and Refresh must not be called concurrently.
+func (r *KustomizationReconciler) Reconcile(ctx context.Context) {
+	logger := util.LoggerFromContext(ctx)
+	if r.options.Kustomization == "" && !r.options.ForceEmbedded {
+		logger.Warn("Empty kustomization.")
+		return
+	}
+	state := r.State()
+
+	if r.isSource() {
+		digest, err := sourceDigestFn(ctx, r.options.Kustomization)
+		if err != nil {
+			logger.Warn("Failed to get the digest of the kustomization source", utils.ErrorKey, err)
+		}
+		r.sourceDigest = digest
+	}
+
+	var hash string
+	var applied bool
+	resources, err := renderKustomizationFn(r.fs, r.options, logger)
+	if err == nil {
+		r.resources = resources
+		hash, applied, err = applyKustomizationFn(ctx, r.kubeClient, resources, r.options)
+	}
+	if hash != "" {
+		state.DesiredHash = hash
+	}
+	if err != nil {
+		logger.Warn("Kustomization reconciliation failed", utils.ErrorKey, err)
+		state.Error = err.Error()
+	} else {
+		state.Error = ""
+		state.AppliedHash = hash
+		if applied {
+			state.LastAppliedTime = metaV1.Now()
+		}
+	}
+	r.checkDrift(ctx, state)
+	r.setState(state)
+}
+
+// Refresh renders and reconciles the kustomization again if it has never been rendered or if it is a source whose
+// digest has changed. Otherwise, it only checks if the cluster has drifted from the last rendering.
+func (r *KustomizationReconciler) Refresh(ctx context.Context) {
+	logger := util.LoggerFromContext(ctx)
+	if r.resources == nil {
+		r.Reconcile(ctx)
+		return
+	}
+	if r.isSource() {
+		digest, err := sourceDigestFn(ctx, r.options.Kustomization)
+		switch {
+		case err != nil:
+			logger.Warn("Failed to get the digest of the kustomization source", utils.ErrorKey, err)
+		case digest != r.sourceDigest:
+			logger.Info("Kustomization source changed", "digest", digest)
+			r.Reconcile(ctx)
+			return
+		}
+	}
+	state := r.State()
+	r.checkDrift(ctx, state)
+	r.setState(state)
+}
+
+// checkDrift sets state.Drifted to true if the live objects differ from the last rendered resources. The resources
+// that would be pruned are only taken into account when pruning is enabled. The previous value is kept if the
+// comparison fails.
+func (r *KustomizationReconciler) checkDrift(ctx context.Context, state *v1alpha1.KustomizationState) {
+	if r.resources == nil {
+		return
+	}
+	logger := util.LoggerFromContext(ctx)
+	result, err := diffResourcesFn(ctx, r.kubeClient, r.resources)
+	if err != nil {
+		logger.Warn("Failed to compare the kustomization with the cluster", utils.ErrorKey, err)
+		return
+	}
+	drifted := result.Count(DiffCreated)+result.Count(DiffChanged) > 0 ||
+		(r.options.Prune && result.Count(DiffPruned) > 0)
+	if drifted && !state.Drifted {
+		logger.Info("Cluster drifted from the kustomization", "summary", result.Summary())
+	}
+	state.Drifted = drifted
+}
+
+func (r *KustomizationReconciler) setState(state *v1alpha1.KustomizationState) {
+	r.mu.Lock()
+	changed := *state != r.state
+	r.state = *state
+	r.mu.Unlock()
+
+	if changed && r.onUpdate != nil {
+		r.onUpdate(state.DeepCopy())
+	}
+}
+
+// watchDirectory adds dirname and its sub directories to watcher. Nothing is watched if dirname is not a local
+// directory (URL or embedded kustomization).
+func watchDirectory(watcher *fsnotify.Watcher, dirname string, logger *slog.Logger) error {
+	info, err := os.Stat(dirname)
+	if err != nil || !info.IsDir() {
+		logger.Debug("Kustomization is not a local directory, not watching it", kustKey, dirname)
+		return nil
+	}
+	err = filepath.WalkDir(dirname, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return watcher.Add(path) //nolint:wrapcheck // wrapped below
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("while watching %s: %w", dirname, err)
+	}
+	return nil
+}
+
+// Run reconciles the kustomization until ctx is done.
+func (r *KustomizationReconciler) Run(ctx context.Context) error {
+	logger := util.LoggerFromContext(ctx).With(kustKey, r.options.Kustomization)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("while creating kustomization watcher: %w", err)
+	}
+	defer watcher.Close() //nolint:errcheck // best effort
+
+	if !r.options.ForceEmbedded {
+		if err = watchDirectory(watcher, r.options.Kustomization, logger); err != nil {
+			return err
+		}
+	}
+
+	r.Reconcile(ctx)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	debounce := time.NewTimer(reconcileDebounce)
+	debounce.Stop()
+	defer debounce.Stop()
+
+	logger.Info("Kustomization reconciliation started", "interval", r.interval)
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Kustomization reconciliation stopped.")
+			return ctx.Err() //nolint:wrapcheck // context error
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return errors.New("kustomization watcher closed")
+			}
+			logger.Debug("Kustomization directory changed", "event", event.String())
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					_ = watcher.Add(event.Name) //nolint:errcheck // best effort
+				}
+			}
+			debounce.Reset(reconcileDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return errors.New("kustomization watcher closed")
+			}
+			logger.Warn("Kustomization watcher error", utils.ErrorKey, err)
+		case <-debounce.C:
+			r.Reconcile(ctx)
+		case <-ticker.C:
+			r.Refresh(ctx)
+		}
+	}
+}
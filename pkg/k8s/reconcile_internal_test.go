@@ -0,0 +1,216 @@
+// cSpell: words paralleltest resmap
+//
+//nolint:paralleltest // tests replace package level functions
+package k8s
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/cli-runtime/pkg/resource"
+	"sigs.k8s.io/kustomize/api/provider"
+	"sigs.k8s.io/kustomize/api/resmap"
+
+	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
+	"github.com/kaweezle/iknite/pkg/host"
+	"github.com/kaweezle/iknite/pkg/utils"
+)
+
+const reconcileTestResources = `apiVersion: v1
+kind: Namespace
+metadata:
+  name: test
+`
+
+type reconcileCall struct {
+	err     error
+	hash    string
+	applied bool
+}
+
+type reconcileFakes struct {
+	// drift is returned by diffResourcesFn.
+	drift   *DiffResult
+	digest  atomic.Value
+	renders atomic.Int32
+	applies atomic.Int32
+}
+
+// replaceReconcileFunctions makes applyKustomizationFn return the given results in order. The last result is
+// returned once the others have been consumed. The diff returned by diffResourcesFn and the source digest can be
+// changed through the returned fakes.
+func replaceReconcileFunctions(t *testing.T, results ...reconcileCall) *reconcileFakes {
+	t.Helper()
+	previousRender, previousApply := renderKustomizationFn, applyKustomizationFn
+	previousDiff, previousDigest := diffResourcesFn, sourceDigestFn
+	t.Cleanup(func() {
+		renderKustomizationFn, applyKustomizationFn = previousRender, previousApply
+		diffResourcesFn, sourceDigestFn = previousDiff, previousDigest
+	})
+
+	fakes := &reconcileFakes{drift: &DiffResult{}}
+	fakes.digest.Store("d1")
+	factory := resmap.NewFactory(provider.NewDefaultDepProvider().GetResourceFactory())
+	renderKustomizationFn = func(host.FileSystem, *utils.KustomizeOptions, *slog.Logger) (resmap.ResMap, error) {
+		fakes.renders.Add(1)
+		return factory.NewResMapFromBytes([]byte(reconcileTestResources))
+	}
+	applyKustomizationFn = func(
+		_ context.Context, _ resource.RESTClientGetter, _ resmap.ResMap, options *utils.KustomizeOptions,
+	) (string, bool, error) {
+		if options.ForceConfig {
+			return "", false, errors.New("reconciliation should not be forced")
+		}
+		result := results[min(int(fakes.applies.Add(1))-1, len(results)-1)]
+		return result.hash, result.applied, result.err
+	}
+	diffResourcesFn = func(context.Context, resource.RESTClientGetter, resmap.ResMap) (*DiffResult, error) {
+		return fakes.drift, nil
+	}
+	sourceDigestFn = func(context.Context, string) (string, error) {
+		return fakes.digest.Load().(string), nil //nolint:forcetypeassert // always a string
+	}
+	return fakes
+}
+
+func TestKustomizationHash(t *testing.T) {
+	req := require.New(t)
+
+	factory := resmap.NewFactory(provider.NewDefaultDepProvider().GetResourceFactory())
+	resources, err := factory.NewResMapFromBytes([]byte(reconcileTestResources))
+	req.NoError(err)
+
+	hash, err := KustomizationHash(resources)
+	req.NoError(err)
+	req.Len(hash, 64)
+
+	other, err := factory.NewResMapFromBytes([]byte(reconcileTestResources + "  labels:\n    a: b\n"))
+	req.NoError(err)
+	otherHash, err := KustomizationHash(other)
+	req.NoError(err)
+	req.NotEqual(hash, otherHash)
+}
+
+func TestKustomizationReconciler_Reconcile(t *testing.T) {
+	req := require.New(t)
+
+	fakes := replaceReconcileFunctions(t,
+		reconcileCall{hash: "h1", applied: true},
+		reconcileCall{hash: "h1"},
+		reconcileCall{hash: "h2", err: errors.New("apply boom")},
+		reconcileCall{hash: "h2", applied: true},
+	)
+
+	updates := []*v1alpha1.KustomizationState{}
+	reconciler := NewKustomizationReconciler(nil, host.NewMemMapFS(),
+		&utils.KustomizeOptions{Kustomization: "/etc/iknite.d", ForceConfig: true}, time.Minute,
+		func(state *v1alpha1.KustomizationState) { updates = append(updates, state) })
+
+	reconciler.Reconcile(t.Context())
+	req.Len(updates, 1)
+	req.Equal("h1", updates[0].AppliedHash)
+	req.False(updates[0].Drifted)
+	req.False(updates[0].LastAppliedTime.IsZero())
+
+	// Nothing changed, no update
+	reconciler.Reconcile(t.Context())
+	req.Len(updates, 1)
+
+	fakes.drift = &DiffResult{Objects: []ObjectDiff{{Name: "test", Status: DiffChanged}}}
+	reconciler.Reconcile(t.Context())
+	req.Len(updates, 2)
+	req.Equal("h1", updates[1].AppliedHash)
+	req.Equal("h2", updates[1].DesiredHash)
+	req.True(updates[1].Drifted)
+	req.Equal("apply boom", updates[1].Error)
+
+	fakes.drift = &DiffResult{Objects: []ObjectDiff{{Name: "test", Status: DiffUnchanged}}}
+	reconciler.Reconcile(t.Context())
+	req.Len(updates, 3)
+	req.Equal("h2", updates[2].AppliedHash)
+	req.False(updates[2].Drifted)
+	req.Empty(updates[2].Error)
+	req.Equal(*updates[2], *reconciler.State())
+	req.Equal(int32(4), fakes.renders.Load())
+}
+
+func TestKustomizationReconciler_RefreshDetectsDrift(t *testing.T) {
+	req := require.New(t)
+
+	fakes := replaceReconcileFunctions(t, reconcileCall{hash: "h1", applied: true}, reconcileCall{hash: "h1"})
+	reconciler := NewKustomizationReconciler(nil, host.NewMemMapFS(),
+		&utils.KustomizeOptions{Kustomization: "/etc/iknite.d"}, time.Minute, nil)
+
+	// The first refresh renders the kustomization
+	reconciler.Refresh(t.Context())
+	req.Equal(int32(1), fakes.renders.Load())
+	req.False(reconciler.State().Drifted)
+
+	// The next ones only compare the live objects with the rendered ones
+	fakes.drift = &DiffResult{Objects: []ObjectDiff{{Name: "test", Status: DiffChanged}}}
+	reconciler.Refresh(t.Context())
+	req.Equal(int32(1), fakes.renders.Load())
+	req.Equal(int32(1), fakes.applies.Load())
+	req.True(reconciler.State().Drifted)
+
+	// The resources to prune only count when pruning is enabled
+	fakes.drift = &DiffResult{Objects: []ObjectDiff{{Name: "old", Status: DiffPruned}}}
+	reconciler.Refresh(t.Context())
+	req.False(reconciler.State().Drifted)
+	reconciler.options.Prune = true
+	reconciler.Refresh(t.Context())
+	req.True(reconciler.State().Drifted)
+}
+
+func TestKustomizationReconciler_RefreshSourceDigest(t *testing.T) {
+	req := require.New(t)
+
+	fakes := replaceReconcileFunctions(t, reconcileCall{hash: "h1", applied: true})
+	reconciler := NewKustomizationReconciler(nil, host.NewMemMapFS(),
+		&utils.KustomizeOptions{Kustomization: "oci://registry.local/config:v1"}, time.Minute, nil)
+
+	reconciler.Reconcile(t.Context())
+	req.Equal(int32(1), fakes.renders.Load())
+
+	// Same digest, nothing is rendered
+	reconciler.Refresh(t.Context())
+	req.Equal(int32(1), fakes.renders.Load())
+
+	fakes.digest.Store("d2")
+	reconciler.Refresh(t.Context())
+	req.Equal(int32(2), fakes.renders.Load())
+	reconciler.Refresh(t.Context())
+	req.Equal(int32(2), fakes.renders.Load())
+}
+
+func TestKustomizationReconciler_RunReconcilesOnChange(t *testing.T) {
+	req := require.New(t)
+
+	previousDebounce := reconcileDebounce
+	reconcileDebounce = 10 * time.Millisecond
+	t.Cleanup(func() { reconcileDebounce = previousDebounce })
+
+	fakes := replaceReconcileFunctions(t, reconcileCall{hash: "h1", applied: true})
+
+	dir := t.TempDir()
+	reconciler := NewKustomizationReconciler(nil, host.NewMemMapFS(),
+		&utils.KustomizeOptions{Kustomization: dir}, time.Hour, nil)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan error, 1)
+	go func() { done <- reconciler.Run(ctx) }()
+
+	req.Eventually(func() bool { return reconciler.State().AppliedHash == "h1" }, 5*time.Second, 10*time.Millisecond)
+	req.NoError(os.WriteFile(filepath.Join(dir, "kustomization.yaml"), []byte("resources: []\n"), 0o600))
+	req.Eventually(func() bool { return fakes.renders.Load() >= 2 }, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	req.ErrorIs(<-done, context.Canceled)
+}
@@ -0,0 +1,364 @@
+/*
+Copyright © 2021 Antoine Martin <antoine@openance.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package k8s
+
+// cSpell: words dynamicinformer httproutes informer informers unstructured apimachinery
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	coreV1 "k8s.io/api/core/v1"
+	networkingV1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/kaweezle/iknite/pkg/cmd/util"
+	"github.com/kaweezle/iknite/pkg/utils"
+)
+
+const (
+	// GatewayNameLabel is set by the Gateway API implementations on the LoadBalancer service of a Gateway.
+	GatewayNameLabel = "gateway.networking.k8s.io/gateway-name"
+	// HostnamesAnnotation contains the comma separated hostnames of a LoadBalancer service.
+	HostnamesAnnotation = "config.iknite.app/hostnames"
+	gatewayGroup        = "gateway.networking.k8s.io"
+	gatewayVersion      = "v1"
+)
+
+var (
+	HTTPRouteResource = schema.GroupVersionResource{Group: gatewayGroup, Version: gatewayVersion, Resource: "httproutes"}
+	GatewayResource   = schema.GroupVersionResource{Group: gatewayGroup, Version: gatewayVersion, Resource: "gateways"}
+)
+
+// routeDebounce is the delay between the last route change and the computation of the hosts. It is replaced in tests.
+var routeDebounce = time.Second
+
+// RouteWatcher watches the hostnames of the Ingresses, of the annotated Services and of the Gateway API HTTPRoutes and
+// maps them to the IP of their LoadBalancer service. The Gateway API resources are watched as soon as their CRDs are installed.
+type RouteWatcher struct {
+	client        kubernetes.Interface
+	dynamicClient dynamic.Interface
+	onChange      func(ctx context.Context, hosts map[string]net.IP) error
+	ingresses     cache.GenericLister
+	services      cache.GenericLister
+	routes        cache.GenericLister
+	gateways      cache.GenericLister
+	trigger       chan struct{}
+	published     map[string]net.IP
+	resync        time.Duration
+}
+
+// NewRouteWatcher creates a watcher calling onChange with the hostnames of the routes and their IPs each time they
+// change. The routes are also checked every resync.
+func NewRouteWatcher(
+	client kubernetes.Interface,
+	dynamicClient dynamic.Interface,
+	resync time.Duration,
+	onChange func(ctx context.Context, hosts map[string]net.IP) error,
+) *RouteWatcher {
+	return &RouteWatcher{
+		client:        client,
+		dynamicClient: dynamicClient,
+		resync:        resync,
+		onChange:      onChange,
+		trigger:       make(chan struct{}, 1),
+	}
+}
+
+// NewRouteWatcherFromGetter creates a RouteWatcher with clients created from kubeClient.
+func NewRouteWatcherFromGetter(
+	kubeClient resource.RESTClientGetter,
+	resync time.Duration,
+	onChange func(ctx context.Context, hosts map[string]net.IP) error,
+) (*RouteWatcher, error) {
+	client, err := ClientSet(kubeClient)
+	if err != nil {
+		return nil, err
+	}
+	dynamicClient, err := newDynamicClientFn(kubeClient)
+	if err != nil {
+		return nil, err
+	}
+	return NewRouteWatcher(client, dynamicClient, resync, onChange), nil
+}
+
+func (w *RouteWatcher) notify() {
+	select {
+	case w.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (w *RouteWatcher) handler() cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(any) { w.notify() },
+		UpdateFunc: func(any, any) { w.notify() },
+		DeleteFunc: func(any) { w.notify() },
+	}
+}
+
+// gatewayAPIAvailable returns true if the HTTPRoute and Gateway resources are served.
+func (w *RouteWatcher) gatewayAPIAvailable() bool {
+	resources, err := w.client.Discovery().ServerResourcesForGroupVersion(gatewayGroup + "/" + gatewayVersion)
+	if err != nil {
+		return false
+	}
+	found := 0
+	for _, apiResource := range resources.APIResources {
+		if apiResource.Name == HTTPRouteResource.Resource || apiResource.Name == GatewayResource.Resource {
+			found++
+		}
+	}
+	return found == 2 //nolint:mnd // HTTPRoute and Gateway
+}
+
+// Run watches the routes until the context is done.
+func (w *RouteWatcher) Run(ctx context.Context) error {
+	logger := util.LoggerFromContext(ctx)
+
+	factory := informers.NewSharedInformerFactory(w.client, w.resync)
+	for _, gvr := range []schema.GroupVersionResource{
+		networkingV1.SchemeGroupVersion.WithResource("ingresses"),
+		coreV1.SchemeGroupVersion.WithResource("services"),
+	} {
+		informer, err := factory.ForResource(gvr)
+		if err != nil {
+			return fmt.Errorf("while creating %s informer: %w", gvr.Resource, err)
+		}
+		if _, err = informer.Informer().AddEventHandler(w.handler()); err != nil {
+			return fmt.Errorf("while watching %s: %w", gvr.Resource, err)
+		}
+		if gvr.Resource == "ingresses" {
+			w.ingresses = informer.Lister()
+		} else {
+			w.services = informer.Lister()
+		}
+	}
+	factory.Start(ctx.Done())
+	defer factory.Shutdown()
+	factory.WaitForCacheSync(ctx.Done())
+
+	dynamicFactory := dynamicinformer.NewDynamicSharedInformerFactory(w.dynamicClient, w.resync)
+	defer dynamicFactory.Shutdown()
+
+	ticker := time.NewTicker(w.resync)
+	defer ticker.Stop()
+	w.notify()
+	for {
+		if w.routes == nil && w.gatewayAPIAvailable() {
+			logger.Info("Gateway API available, watching HTTPRoutes")
+			routes := dynamicFactory.ForResource(HTTPRouteResource)
+			gateways := dynamicFactory.ForResource(GatewayResource)
+			for _, informer := range []informers.GenericInformer{routes, gateways} {
+				if _, err := informer.Informer().AddEventHandler(w.handler()); err != nil {
+					return fmt.Errorf("while watching gateway API resources: %w", err)
+				}
+			}
+			dynamicFactory.Start(ctx.Done())
+			dynamicFactory.WaitForCacheSync(ctx.Done())
+			w.routes, w.gateways = routes.Lister(), gateways.Lister()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-w.trigger:
+			// Wait for the related changes, like a Gateway and its routes, to settle
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(routeDebounce):
+			}
+		}
+
+		hosts, err := w.Hosts()
+		if err != nil {
+			logger.Warn("Failed to compute the route hosts", utils.ErrorKey, err)
+			continue
+		}
+		if w.published != nil && maps.EqualFunc(hosts, w.published, net.IP.Equal) {
+			continue
+		}
+		if err = w.onChange(ctx, hosts); err != nil {
+			logger.Warn("Failed to publish the route hosts", utils.ErrorKey, err)
+			continue
+		}
+		logger.Info("Published route hosts", "count", len(hosts))
+		w.published = hosts
+	}
+}
+
+// Hosts returns the hostnames of the routes and their IPs. The wildcard hostnames and the routes without IP are
+// ignored. The hostnames of the services take precedence over the ones of the Ingresses, that take precedence over
+// the ones of the HTTPRoutes. Among the objects of the same kind, the first one in namespace and name order wins.
+func (w *RouteWatcher) Hosts() (map[string]net.IP, error) {
+	hosts := map[string]net.IP{}
+	add := func(hostnames []string, ip net.IP) {
+		if ip == nil {
+			return
+		}
+		for _, hostname := range hostnames {
+			hostname = strings.ToLower(strings.TrimSpace(hostname))
+			if _, exists := hosts[hostname]; hostname == "" || strings.Contains(hostname, "*") || exists {
+				continue
+			}
+			hosts[hostname] = ip
+		}
+	}
+
+	services, err := w.services.List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("while listing services: %w", err)
+	}
+	slices.SortFunc(services, compareObjects)
+	for _, object := range services {
+		service, ok := object.(*coreV1.Service)
+		if !ok || service.Spec.Type != coreV1.ServiceTypeLoadBalancer || service.Annotations[HostnamesAnnotation] == "" {
+			continue
+		}
+		add(strings.Split(service.Annotations[HostnamesAnnotation], ","), serviceIP(service.Status.LoadBalancer.Ingress))
+	}
+
+	ingresses, err := w.ingresses.List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("while listing ingresses: %w", err)
+	}
+	slices.SortFunc(ingresses, compareObjects)
+	for _, object := range ingresses {
+		ingress, ok := object.(*networkingV1.Ingress)
+		if !ok {
+			continue
+		}
+		hostnames := []string{}
+		for _, rule := range ingress.Spec.Rules {
+			hostnames = append(hostnames, rule.Host)
+		}
+		add(hostnames, ingressIP(ingress.Status.LoadBalancer.Ingress))
+	}
+
+	if w.routes == nil {
+		return hosts, nil
+	}
+	routes, err := w.routes.List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("while listing HTTPRoutes: %w", err)
+	}
+	slices.SortFunc(routes, compareObjects)
+	for _, object := range routes {
+		route, ok := object.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+		hostnames, _, _ := unstructured.NestedStringSlice(route.Object, "spec", "hostnames") //nolint:errcheck // empty
+		parentRefs, _, _ := unstructured.NestedSlice(route.Object, "spec", "parentRefs")     //nolint:errcheck // empty
+		for _, parentRef := range parentRefs {
+			ref, ok := parentRef.(map[string]any)
+			if !ok {
+				continue
+			}
+			group, _ := ref["group"].(string) //nolint:errcheck // default group
+			kind, _ := ref["kind"].(string)   //nolint:errcheck // default kind
+			if (group != "" && group != gatewayGroup) || (kind != "" && kind != "Gateway") {
+				continue
+			}
+			name, _ := ref["name"].(string)           //nolint:errcheck // checked by the API server
+			namespace, _ := ref["namespace"].(string) //nolint:errcheck // route namespace by default
+			if namespace == "" {
+				namespace = route.GetNamespace()
+			}
+			add(hostnames, w.gatewayIP(namespace, name))
+		}
+	}
+	return hosts, nil
+}
+
+// gatewayIP returns the IP address of the Gateway or, if the Gateway status has no address, the IP of its
+// LoadBalancer service.
+func (w *RouteWatcher) gatewayIP(namespace, name string) net.IP {
+	if object, err := w.gateways.ByNamespace(namespace).Get(name); err == nil {
+		if gateway, ok := object.(*unstructured.Unstructured); ok {
+			addresses, _, _ := unstructured.NestedSlice(gateway.Object, "status", "addresses") //nolint:errcheck // empty
+			for _, address := range addresses {
+				entry, ok := address.(map[string]any)
+				if !ok {
+					continue
+				}
+				addressType, _ := entry["type"].(string) //nolint:errcheck // IPAddress by default
+				value, _ := entry["value"].(string)      //nolint:errcheck // checked by the API server
+				if ip := net.ParseIP(value); ip != nil && (addressType == "" || addressType == "IPAddress") {
+					return ip
+				}
+			}
+		}
+	}
+
+	selector := labels.SelectorFromSet(labels.Set{GatewayNameLabel: name})
+	services, err := w.services.ByNamespace(namespace).List(selector)
+	if err != nil {
+		return nil
+	}
+	slices.SortFunc(services, compareObjects)
+	for _, object := range services {
+		if service, ok := object.(*coreV1.Service); ok && service.Spec.Type == coreV1.ServiceTypeLoadBalancer {
+			if ip := serviceIP(service.Status.LoadBalancer.Ingress); ip != nil {
+				return ip
+			}
+		}
+	}
+	return nil
+}
+
+func ingressIP(ingresses []networkingV1.IngressLoadBalancerIngress) net.IP {
+	for _, ingress := range ingresses {
+		if ip := net.ParseIP(ingress.IP); ip != nil {
+			return ip
+		}
+	}
+	return nil
+}
+
+func serviceIP(ingresses []coreV1.LoadBalancerIngress) net.IP {
+	for _, ingress := range ingresses {
+		if ip := net.ParseIP(ingress.IP); ip != nil {
+			return ip
+		}
+	}
+	return nil
+}
+
+func compareObjects(a, b runtime.Object) int {
+	objectA, errA := meta.Accessor(a)
+	objectB, errB := meta.Accessor(b)
+	if errA != nil || errB != nil {
+		return 0
+	}
+	return strings.Compare(objectA.GetNamespace()+"/"+objectA.GetName(), objectB.GetNamespace()+"/"+objectB.GetName())
+}
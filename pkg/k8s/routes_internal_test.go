@@ -0,0 +1,141 @@
+// cSpell: words apimachinery unstructured dynamicfake fakediscovery paralleltest gatewaies
+package k8s
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	coreV1 "k8s.io/api/core/v1"
+	networkingV1 "k8s.io/api/networking/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func routeTestObjects() (
+	*networkingV1.Ingress, *coreV1.Service, *coreV1.Service, *unstructured.Unstructured, *unstructured.Unstructured,
+) {
+	ingress := &networkingV1.Ingress{
+		ObjectMeta: metaV1.ObjectMeta{Name: "dashboard", Namespace: "monitoring"},
+		Spec: networkingV1.IngressSpec{Rules: []networkingV1.IngressRule{
+			{Host: "Dashboard.iknite.local"},
+			{Host: "*.iknite.local"},
+		}},
+		Status: networkingV1.IngressStatus{LoadBalancer: networkingV1.IngressLoadBalancerStatus{
+			Ingress: []networkingV1.IngressLoadBalancerIngress{{IP: "192.168.99.16"}},
+		}},
+	}
+	service := &coreV1.Service{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:      "main-gateway",
+			Namespace: "gateways",
+			Labels:    map[string]string{GatewayNameLabel: "main"},
+		},
+		Spec: coreV1.ServiceSpec{Type: coreV1.ServiceTypeLoadBalancer},
+		Status: coreV1.ServiceStatus{LoadBalancer: coreV1.LoadBalancerStatus{
+			Ingress: []coreV1.LoadBalancerIngress{{IP: "192.168.99.17"}},
+		}},
+	}
+	annotated := &coreV1.Service{
+		ObjectMeta: metaV1.ObjectMeta{
+			Name:        "myapp",
+			Namespace:   "default",
+			Annotations: map[string]string{HostnamesAnnotation: "myapp.local, dashboard.iknite.local"},
+		},
+		Spec: coreV1.ServiceSpec{Type: coreV1.ServiceTypeLoadBalancer},
+		Status: coreV1.ServiceStatus{LoadBalancer: coreV1.LoadBalancerStatus{
+			Ingress: []coreV1.LoadBalancerIngress{{IP: "192.168.99.19"}},
+		}},
+	}
+	gateway := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "gateway.networking.k8s.io/v1",
+		"kind":       "Gateway",
+		"metadata":   map[string]any{"name": "main", "namespace": "gateways"},
+	}}
+	route := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "gateway.networking.k8s.io/v1",
+		"kind":       "HTTPRoute",
+		"metadata":   map[string]any{"name": "argocd", "namespace": "argocd"},
+		"spec": map[string]any{
+			"hostnames":  []any{"argocd.iknite.local"},
+			"parentRefs": []any{map[string]any{"name": "main", "namespace": "gateways"}},
+		},
+	}}
+	return ingress, service, annotated, gateway, route
+}
+
+//nolint:paralleltest // modifies routeDebounce
+func TestRouteWatcher(t *testing.T) {
+	req := require.New(t)
+	routeDebounce = 10 * time.Millisecond
+	defer func() { routeDebounce = time.Second }()
+
+	ingress, service, annotated, gateway, route := routeTestObjects()
+	client := fake.NewClientset(ingress, service, annotated)
+	discovery, ok := client.Discovery().(*fakediscovery.FakeDiscovery)
+	req.True(ok)
+	discovery.Resources = []*metaV1.APIResourceList{{
+		GroupVersion: "gateway.networking.k8s.io/v1",
+		APIResources: []metaV1.APIResource{{Name: "httproutes"}, {Name: "gateways"}},
+	}}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{HTTPRouteResource: "HTTPRouteList", GatewayResource: "GatewayList"},
+		route)
+	// The tracker would register the initial objects as gatewaies
+	_, err := dynamicClient.Resource(GatewayResource).Namespace("gateways").
+		Create(t.Context(), gateway, metaV1.CreateOptions{})
+	req.NoError(err)
+
+	published := make(chan map[string]net.IP, 10)
+	watcher := NewRouteWatcher(client, dynamicClient, time.Hour,
+		func(_ context.Context, hosts map[string]net.IP) error {
+			published <- hosts
+			return nil
+		})
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan error)
+	go func() { done <- watcher.Run(ctx) }()
+
+	hosts := <-published
+	req.Len(hosts, 3)
+	req.Equal("192.168.99.19", hosts["myapp.local"].String())
+	req.Equal("192.168.99.19", hosts["dashboard.iknite.local"].String(), "services take precedence")
+	req.Equal("192.168.99.17", hosts["argocd.iknite.local"].String())
+
+	// The address of the Gateway takes precedence over its service
+	gateway.Object["status"] = map[string]any{
+		"addresses": []any{map[string]any{"type": "IPAddress", "value": "192.168.99.18"}},
+	}
+	_, err = dynamicClient.Resource(GatewayResource).Namespace("gateways").
+		Update(ctx, gateway, metaV1.UpdateOptions{})
+	req.NoError(err)
+	hosts = <-published
+	req.Equal("192.168.99.18", hosts["argocd.iknite.local"].String())
+
+	req.NoError(dynamicClient.Resource(HTTPRouteResource).Namespace("argocd").
+		Delete(ctx, "argocd", metaV1.DeleteOptions{}))
+	hosts = <-published
+	req.Len(hosts, 2)
+	req.NotContains(hosts, "argocd.iknite.local")
+
+	cancel()
+	req.NoError(<-done)
+}
+
+func TestRouteWatcher_WithoutGatewayAPI(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	ingress, service, _, _, _ := routeTestObjects()
+	client := fake.NewClientset(ingress, service)
+	watcher := NewRouteWatcher(client, nil, time.Hour, nil)
+	req.False(watcher.gatewayAPIAvailable())
+}
@@ -250,6 +250,9 @@ func PrepareKubernetesEnvironment(
 		"enable_mdns", ikniteConfig.EnableMDNS,
 		"cluster_name", ikniteConfig.ClusterName,
 		"kustomization", ikniteConfig.Kustomization,
+		"air_gapped", ikniteConfig.AirGapped,
+		"load_balancer_ip_pool", ikniteConfig.LoadBalancerIPPool,
+		"mdns_conflict_policy", ikniteConfig.MDNSConflictPolicy,
 	)
 
 	// Allow forwarding (kubeadm requirement)
@@ -338,8 +341,13 @@ func PrepareKubernetesEnvironment(
 	}
 
 	logger.Info("Ensuring file existence...", "file", constants.CrictlYaml)
-	if err := host.ExecuteIfNotExist(alpineHost, constants.CrictlYaml, func() error {
-		return alpineHost.WriteFile(
+	return EnsureCrictlConfiguration(alpineHost)
+}
+
+// EnsureCrictlConfiguration ensures that the crictl configuration file exists and points to the containerd socket.
+func EnsureCrictlConfiguration(fs host.FileSystem) error {
+	if err := host.ExecuteIfNotExist(fs, constants.CrictlYaml, func() error {
+		return fs.WriteFile(
 			constants.CrictlYaml,
 			[]byte("runtime-endpoint: unix://"+constants.ContainerServiceSock+"\n"),
 			os.FileMode(int(0o644)))
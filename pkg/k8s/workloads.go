@@ -0,0 +1,307 @@
+/*
+Copyright © 2021 Antoine Martin <antoine@openance.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package k8s
+
+// cSpell: words dynamicinformer informer informers unstructured apimachinery kstatus statefulsets daemonsets
+// cSpell: words helmreleases gitrepositories
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	kstatus "sigs.k8s.io/cli-utils/pkg/kstatus/status"
+
+	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
+	"github.com/kaweezle/iknite/pkg/utils"
+)
+
+// MonitoredWorkloadTypes are the resource types watched by the WorkloadMonitor. The types that are not served, like
+// the Argo CD applications or the Flux resources when they are not installed, are ignored.
+var MonitoredWorkloadTypes = []string{
+	"deployments", "statefulsets", "daemonsets", "jobs", "applications",
+	"kustomizations", "helmreleases", "gitrepositories",
+}
+
+// DefaultWorkloadDiscoveryInterval is the default interval at which the WorkloadMonitor looks for the monitored
+// resource types that have started being served, for instance after the installation of Flux.
+const DefaultWorkloadDiscoveryInterval = time.Minute
+
+// WorkloadMonitor watches the workloads of the cluster with shared informers and computes their readiness with
+// kstatus each time they change. The ready and unready workloads are given to onChange once no change has happened
+// for the debounce duration.
+type WorkloadMonitor struct {
+	dynamicClient dynamic.Interface
+	mapper        meta.RESTMapper
+	onChange      func(ready, unready []*v1alpha1.WorkloadState)
+	logger        *slog.Logger
+	states        map[string]*v1alpha1.WorkloadState
+	trigger       chan struct{}
+	reported      []*v1alpha1.WorkloadState
+	debounce      time.Duration
+	// discoveryInterval is the interval at which the newly served resource types are looked for.
+	discoveryInterval time.Duration
+	mu                sync.Mutex
+}
+
+// NewWorkloadMonitor creates a monitor of the workloads served by dynamicClient.
+func NewWorkloadMonitor(
+	dynamicClient dynamic.Interface,
+	mapper meta.RESTMapper,
+	debounce time.Duration,
+	onChange func(ready, unready []*v1alpha1.WorkloadState),
+	logger *slog.Logger,
+) *WorkloadMonitor {
+	return &WorkloadMonitor{
+		dynamicClient:     dynamicClient,
+		mapper:            mapper,
+		debounce:          debounce,
+		discoveryInterval: DefaultWorkloadDiscoveryInterval,
+		onChange:          onChange,
+		logger:            logger,
+		states:            map[string]*v1alpha1.WorkloadState{},
+		trigger:           make(chan struct{}, 1),
+	}
+}
+
+// NewWorkloadMonitorFromGetter creates a WorkloadMonitor with a client and a REST mapper created from kubeClient.
+func NewWorkloadMonitorFromGetter(
+	kubeClient resource.RESTClientGetter,
+	debounce time.Duration,
+	onChange func(ready, unready []*v1alpha1.WorkloadState),
+	logger *slog.Logger,
+) (*WorkloadMonitor, error) {
+	mapper, err := kubeClient.ToRESTMapper()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get REST mapper: %w", err)
+	}
+	dynamicClient, err := newDynamicClientFn(kubeClient)
+	if err != nil {
+		return nil, err
+	}
+	return NewWorkloadMonitor(dynamicClient, mapper, debounce, onChange, logger), nil
+}
+
+// workloadState computes the readiness of obj.
+func workloadState(gvr schema.GroupVersionResource, obj *unstructured.Unstructured) *v1alpha1.WorkloadState {
+	state := &v1alpha1.WorkloadState{Namespace: obj.GetNamespace(), Name: gvr.Resource + "/" + obj.GetName()}
+
+	status, message, err := ComputeStatus(obj)
+	if err != nil {
+		state.Message = fmt.Sprintf("failed to compute status: %v", err)
+		return state
+	}
+	state.Ok = status == kstatus.CurrentStatus
+	state.Message = message
+	return state
+}
+
+func (m *WorkloadMonitor) notify() {
+	select {
+	case m.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// update records the state of obj and triggers a notification if it has changed.
+func (m *WorkloadMonitor) update(gvr schema.GroupVersionResource, obj any) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok { // nocov -- dynamic informers only return unstructured objects
+		return
+	}
+	key := gvr.Resource + "/" + u.GetNamespace() + "/" + u.GetName()
+	state := workloadState(gvr, u)
+
+	m.mu.Lock()
+	previous, exists := m.states[key]
+	changed := !exists || *previous != *state
+	m.states[key] = state
+	m.mu.Unlock()
+	if changed {
+		m.notify()
+	}
+}
+
+func (m *WorkloadMonitor) remove(gvr schema.GroupVersionResource, obj any) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok { // nocov -- dynamic informers only return unstructured objects
+		return
+	}
+	m.mu.Lock()
+	delete(m.states, gvr.Resource+"/"+u.GetNamespace()+"/"+u.GetName())
+	m.mu.Unlock()
+	m.notify()
+}
+
+func (m *WorkloadMonitor) handler(gvr schema.GroupVersionResource) cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj any) { m.update(gvr, obj) },
+		UpdateFunc: func(_, obj any) { m.update(gvr, obj) },
+		DeleteFunc: func(obj any) { m.remove(gvr, obj) },
+	}
+}
+
+// States returns the ready and unready workloads sorted by namespace and name.
+func (m *WorkloadMonitor) States() (ready, unready []*v1alpha1.WorkloadState) {
+	m.mu.Lock()
+	states := make([]*v1alpha1.WorkloadState, 0, len(m.states))
+	for _, state := range m.states {
+		stateCopy := *state
+		states = append(states, &stateCopy)
+	}
+	m.mu.Unlock()
+
+	sort.SliceStable(states, func(i, j int) bool {
+		return states[i].String() < states[j].String()
+	})
+	for _, state := range states {
+		if state.Ok {
+			ready = append(ready, state)
+		} else {
+			unready = append(unready, state)
+		}
+	}
+	return ready, unready
+}
+
+// report gives the states to onChange if they differ from the last reported ones or if force is true.
+func (m *WorkloadMonitor) report(force bool) {
+	ready, unready := m.States()
+	states := slices.Concat(ready, unready)
+	if !force && slices.EqualFunc(states, m.reported, func(a, b *v1alpha1.WorkloadState) bool { return *a == *b }) {
+		return
+	}
+	m.reported = states
+	m.onChange(ready, unready)
+}
+
+// watch adds an informer for each resource of gvrs to factory. It returns the functions telling if they have synced.
+func (m *WorkloadMonitor) watch(
+	factory dynamicinformer.DynamicSharedInformerFactory,
+	gvrs []schema.GroupVersionResource,
+) ([]cache.InformerSynced, error) {
+	synced := make([]cache.InformerSynced, 0, len(gvrs))
+	for _, gvr := range gvrs {
+		informer := factory.ForResource(gvr).Informer()
+		if err := informer.SetWatchErrorHandler(func(_ *cache.Reflector, err error) {
+			m.logger.Debug("Workloads watch failed, retrying", "resource", gvr.Resource, utils.ErrorKey, err)
+		}); err != nil { // nocov -- the informer is not started yet
+			return nil, fmt.Errorf("while setting the %s watch error handler: %w", gvr.Resource, err)
+		}
+		if _, err := informer.AddEventHandler(m.handler(gvr)); err != nil {
+			return nil, fmt.Errorf("while watching %s: %w", gvr.Resource, err)
+		}
+		synced = append(synced, informer.HasSynced)
+	}
+	return synced, nil
+}
+
+// discover returns the monitored resource types that are served but not in watched. The discovery information of
+// the mapper is refreshed first when possible.
+func (m *WorkloadMonitor) discover(watched []schema.GroupVersionResource) []schema.GroupVersionResource {
+	if resettable, ok := m.mapper.(meta.ResettableRESTMapper); ok {
+		resettable.Reset()
+	}
+	var result []schema.GroupVersionResource
+	for _, t := range MonitoredWorkloadTypes {
+		gvr, err := m.mapper.ResourceFor(schema.GroupVersionResource{Resource: t})
+		if err != nil {
+			continue
+		}
+		if !slices.Contains(watched, gvr) {
+			result = append(result, gvr)
+		}
+	}
+	return result
+}
+
+// Run watches the workloads until the context is done. The states are given to onChange once all the informers have
+// synced, and then each time they change. The resource types that start being served are watched as they are
+// discovered.
+func (m *WorkloadMonitor) Run(ctx context.Context) error {
+	types, err := ValidateResourceTypes(m.mapper, MonitoredWorkloadTypes, m.logger)
+	if err != nil {
+		return fmt.Errorf("failed to validate resource types: %w", err)
+	}
+
+	watched := make([]schema.GroupVersionResource, 0, len(MonitoredWorkloadTypes))
+	for _, t := range types {
+		gvr, err := m.mapper.ResourceFor(schema.GroupVersionResource{Resource: t})
+		if err != nil {
+			return fmt.Errorf("while getting the resource of %s: %w", t, err)
+		}
+		watched = append(watched, gvr)
+	}
+
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(m.dynamicClient, 0)
+	defer factory.Shutdown()
+	synced, err := m.watch(factory, watched)
+	if err != nil {
+		return err
+	}
+	factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), synced...) {
+		return fmt.Errorf("while waiting for the workloads informers: %w", ctx.Err())
+	}
+
+	// Discard the changes of the initial listing, they are reported now
+	select {
+	case <-m.trigger:
+	default:
+	}
+	m.report(true)
+
+	settled := time.NewTimer(m.debounce)
+	settled.Stop()
+	defer settled.Stop()
+	discovery := time.NewTicker(m.discoveryInterval)
+	defer discovery.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("workloads monitoring stopped: %w", ctx.Err())
+		case <-m.trigger:
+			settled.Reset(m.debounce)
+		case <-settled.C:
+			m.report(false)
+		case <-discovery.C:
+			discovered := m.discover(watched)
+			if len(discovered) == 0 {
+				continue
+			}
+			m.logger.Info("Watching newly served workload types", "resources", discovered)
+			if _, err = m.watch(factory, discovered); err != nil {
+				m.logger.Warn("Failed to watch the new workload types", utils.ErrorKey, err)
+				continue
+			}
+			watched = append(watched, discovered...)
+			factory.Start(ctx.Done())
+		}
+	}
+}
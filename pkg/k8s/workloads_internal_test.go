@@ -0,0 +1,280 @@
+// cSpell: words apimachinery unstructured dynamicfake kstatus testutil
+package k8s
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
+	"github.com/kaweezle/iknite/pkg/testutil"
+)
+
+var (
+	deploymentsResource = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	jobsResource        = schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "jobs"}
+)
+
+func readyDeployment(name string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]any{"name": name, "namespace": "default", "generation": int64(1)},
+		"spec":       map[string]any{"replicas": int64(1)},
+		"status": map[string]any{
+			"observedGeneration": int64(1),
+			"replicas":           int64(1),
+			"updatedReplicas":    int64(1),
+			"readyReplicas":      int64(1),
+			"availableReplicas":  int64(1),
+			"conditions": []any{
+				map[string]any{"type": "Available", "status": "True"},
+				map[string]any{"type": "Progressing", "status": "True", "reason": "NewReplicaSetAvailable"},
+			},
+		},
+	}}
+}
+
+func job(name string, complete bool) *unstructured.Unstructured {
+	status := map[string]any{"active": int64(1)}
+	if complete {
+		status = map[string]any{
+			"succeeded":  int64(1),
+			"conditions": []any{map[string]any{"type": "Complete", "status": "True"}},
+		}
+	}
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"metadata":   map[string]any{"name": name, "namespace": "default", "generation": int64(1)},
+		"spec":       map[string]any{"completions": int64(1), "parallelism": int64(1)},
+		"status":     status,
+	}}
+}
+
+type workloadReports struct {
+	reports [][]*v1alpha1.WorkloadState
+	mu      sync.Mutex
+}
+
+func (r *workloadReports) add(ready, unready []*v1alpha1.WorkloadState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reports = append(r.reports, append(append([]*v1alpha1.WorkloadState{}, ready...), unready...))
+}
+
+func (r *workloadReports) get() [][]*v1alpha1.WorkloadState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([][]*v1alpha1.WorkloadState{}, r.reports...)
+}
+
+func TestWorkloadMonitor(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			deploymentsResource: "DeploymentList",
+			jobsResource:        "JobList",
+			{Group: "apps", Version: "v1", Resource: "statefulsets"}: "StatefulSetList",
+			{Group: "apps", Version: "v1", Resource: "daemonsets"}:   "DaemonSetList",
+		},
+		readyDeployment("web"), job("migrate", false))
+	mapper := meta.NewDefaultRESTMapper(nil)
+	for _, kind := range []schema.GroupVersionKind{
+		{Group: "apps", Version: "v1", Kind: "Deployment"},
+		{Group: "apps", Version: "v1", Kind: "StatefulSet"},
+		{Group: "apps", Version: "v1", Kind: "DaemonSet"},
+		{Group: "batch", Version: "v1", Kind: "Job"},
+	} {
+		mapper.Add(kind, meta.RESTScopeNamespace)
+	}
+
+	reports := &workloadReports{}
+	monitor := NewWorkloadMonitor(client, mapper, 50*time.Millisecond, reports.add, testutil.TestLogger(t))
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- monitor.Run(ctx) }()
+
+	// The initial states are reported once the workloads are listed
+	req.Eventually(func() bool { return len(reports.get()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	ready, unready := monitor.States()
+	req.Len(ready, 1)
+	req.Equal("deployments/web", ready[0].Name)
+	req.Len(unready, 1)
+	req.Equal("jobs/migrate", unready[0].Name)
+
+	// Several changes are reported at once
+	jobs := client.Resource(jobsResource).Namespace("default")
+	_, err := jobs.Update(ctx, job("migrate", true), metaV1.UpdateOptions{})
+	req.NoError(err)
+	_, err = jobs.Create(ctx, job("seed", true), metaV1.CreateOptions{})
+	req.NoError(err)
+	req.Eventually(func() bool { return len(reports.get()) == 2 }, 5*time.Second, 10*time.Millisecond)
+	last := reports.get()[1]
+	req.Len(last, 3)
+	for _, state := range last {
+		req.True(state.Ok, state.String())
+	}
+
+	// Changes that do not modify the states are not reported
+	labeled := readyDeployment("web")
+	labeled.SetLabels(map[string]string{"tier": "frontend"})
+	_, err = client.Resource(deploymentsResource).Namespace("default").Update(ctx, labeled, metaV1.UpdateOptions{})
+	req.NoError(err)
+	req.Never(func() bool { return len(reports.get()) > 2 }, 300*time.Millisecond, 10*time.Millisecond)
+
+	req.NoError(client.Resource(deploymentsResource).Namespace("default").Delete(ctx, "web", metaV1.DeleteOptions{}))
+	req.Eventually(func() bool { return len(reports.get()) == 3 }, 5*time.Second, 10*time.Millisecond)
+	req.Len(reports.get()[2], 2)
+
+	cancel()
+	err = <-done
+	req.ErrorIs(err, context.Canceled)
+}
+
+// discoveryMapper is a RESTMapper whose kinds can be added while it is used, like a mapper refreshing the discovery
+// information of the cluster.
+type discoveryMapper struct {
+	meta.RESTMapper
+	mapper *meta.DefaultRESTMapper
+	resets int
+	mu     sync.Mutex
+}
+
+func (m *discoveryMapper) add(kind schema.GroupVersionKind) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mapper.Add(kind, meta.RESTScopeNamespace)
+}
+
+func (m *discoveryMapper) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.resets++
+}
+
+func (m *discoveryMapper) KindFor(resource schema.GroupVersionResource) (schema.GroupVersionKind, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mapper.KindFor(resource) //nolint:wrapcheck // test mapper
+}
+
+func (m *discoveryMapper) ResourceFor(resource schema.GroupVersionResource) (schema.GroupVersionResource, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mapper.ResourceFor(resource) //nolint:wrapcheck // test mapper
+}
+
+func TestWorkloadMonitor_DiscoversNewTypes(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	statefulSetsResource := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "statefulsets"}
+	statefulSet := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "apps/v1",
+		"kind":       "StatefulSet",
+		"metadata":   map[string]any{"name": "db", "namespace": "default", "generation": int64(1)},
+	}}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			deploymentsResource:  "DeploymentList",
+			statefulSetsResource: "StatefulSetList",
+		},
+		readyDeployment("web"), statefulSet)
+	defaultMapper := meta.NewDefaultRESTMapper(nil)
+	defaultMapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	mapper := &discoveryMapper{RESTMapper: defaultMapper, mapper: defaultMapper}
+
+	reports := &workloadReports{}
+	monitor := NewWorkloadMonitor(client, mapper, 10*time.Millisecond, reports.add, testutil.TestLogger(t))
+	monitor.discoveryInterval = 20 * time.Millisecond
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- monitor.Run(ctx) }()
+
+	req.Eventually(func() bool { return len(reports.get()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	req.Len(reports.get()[0], 1)
+
+	// The stateful sets start being served
+	mapper.add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "StatefulSet"})
+	req.Eventually(func() bool { return len(reports.get()) == 2 }, 5*time.Second, 10*time.Millisecond)
+	last := reports.get()[1]
+	req.Len(last, 2)
+	req.Equal("statefulsets/db", last[1].Name)
+	mapper.mu.Lock()
+	req.Positive(mapper.resets)
+	mapper.mu.Unlock()
+
+	cancel()
+	req.ErrorIs(<-done, context.Canceled)
+}
+
+func TestWorkloadState_Application(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		sync        string
+		health      string
+		revision    string
+		wantOk      bool
+		wantMessage string
+	}{
+		{
+			name:        "synced on a commit",
+			sync:        "Synced",
+			health:      "Healthy",
+			revision:    "0123456789abcdef",
+			wantOk:      true,
+			wantMessage: "Application is healthy and synced on revision 0123456",
+		},
+		{
+			name:        "synced on a chart version",
+			sync:        "Synced",
+			health:      "Healthy",
+			revision:    "1.2.3",
+			wantOk:      true,
+			wantMessage: "Application is healthy and synced on revision 1.2.3",
+		},
+		{
+			name:        "progressing",
+			sync:        "OutOfSync",
+			health:      "Progressing",
+			wantMessage: "Application sync status: OutOfSync, health status: Progressing",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			req := require.New(t)
+
+			app := &unstructured.Unstructured{Object: map[string]any{
+				"apiVersion": "argoproj.io/v1alpha1",
+				"kind":       "Application",
+				"metadata":   map[string]any{"name": "root", "namespace": "argocd"},
+				"status": map[string]any{
+					"sync":   map[string]any{"status": tt.sync, "revision": tt.revision},
+					"health": map[string]any{"status": tt.health},
+				},
+			}}
+			state := workloadState(applicationGVK.GroupVersion().WithResource("applications"), app)
+			req.Equal("applications/root", state.Name)
+			req.Equal("argocd", state.Namespace)
+			req.Equal(tt.wantOk, state.Ok)
+			req.Equal(tt.wantMessage, state.Message)
+		})
+	}
+}
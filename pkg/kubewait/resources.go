@@ -41,7 +41,6 @@ import (
 	"sigs.k8s.io/cli-utils/pkg/kstatus/polling"
 	"sigs.k8s.io/cli-utils/pkg/kstatus/polling/aggregator"
 	"sigs.k8s.io/cli-utils/pkg/kstatus/polling/collector"
-	"sigs.k8s.io/cli-utils/pkg/kstatus/polling/engine"
 	pollingEvent "sigs.k8s.io/cli-utils/pkg/kstatus/polling/event"
 	"sigs.k8s.io/cli-utils/pkg/kstatus/status"
 	"sigs.k8s.io/cli-utils/pkg/object"
@@ -265,7 +264,7 @@ func newResourceWaiter(
 ) (*resourceWaiter, error) {
 	factory := kubeUtil.NewFactory(client)
 	poller, err := polling.NewStatusPollerFromFactory(factory, polling.Options{
-		CustomStatusReaders: []engine.StatusReader{&k8s.ApplicationStatusReader{}},
+		CustomStatusReaders: k8s.CustomStatusReaders(),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create status poller: %w", err)
@@ -0,0 +1,153 @@
+/*
+Copyright © 2025 Antoine Martin <antoine@openance.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package kustomize
+
+// cSpell: words crds commonutil chartutil releaseutil
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+
+	"helm.sh/helm/v4/pkg/chart/common"
+	commonutil "helm.sh/helm/v4/pkg/chart/common/util"
+	"helm.sh/helm/v4/pkg/chart/loader/archive"
+	chart "helm.sh/helm/v4/pkg/chart/v2"
+	"helm.sh/helm/v4/pkg/chart/v2/loader"
+	chartutil "helm.sh/helm/v4/pkg/chart/v2/util"
+	"helm.sh/helm/v4/pkg/engine"
+	release "helm.sh/helm/v4/pkg/release/v1"
+	releaseutil "helm.sh/helm/v4/pkg/release/v1/util"
+	"sigs.k8s.io/kustomize/api/types"
+
+	"github.com/kaweezle/iknite/pkg/constants"
+)
+
+const (
+	chartFileName      = "Chart.yaml"
+	defaultReleaseName = "release-name"
+	defaultNamespace   = "default"
+	notesFileName      = "NOTES.txt"
+)
+
+// loadChart loads a chart from its files, by path relative to the chart directory.
+func loadChart(files map[string][]byte) (*chart.Chart, error) {
+	buffered := make([]*archive.BufferedFile, 0, len(files))
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		buffered = append(buffered, &archive.BufferedFile{Name: name, Data: files[name]})
+	}
+	result, err := loader.LoadFiles(buffered)
+	if err != nil {
+		return nil, fmt.Errorf("while loading chart: %w", err)
+	}
+	return result, nil
+}
+
+// loadChartArchive loads a chart from a gzipped tar archive as produced by helm package.
+func loadChartArchive(archive []byte) (*chart.Chart, error) {
+	result, err := loader.LoadArchive(bytes.NewReader(archive))
+	if err != nil {
+		return nil, fmt.Errorf("while loading chart archive: %w", err)
+	}
+	return result, nil
+}
+
+// chartCapabilities returns the capabilities of the cluster for the options of chart. The Kubernetes version defaults
+// to the one installed by iknite.
+func chartCapabilities(options *types.HelmChart) (*common.Capabilities, error) {
+	kubeVersion := options.KubeVersion
+	if kubeVersion == "" {
+		kubeVersion = constants.KubernetesVersion
+	}
+	version, err := common.ParseKubeVersion(kubeVersion)
+	if err != nil {
+		return nil, fmt.Errorf("invalid kubeVersion %q: %w", kubeVersion, err)
+	}
+	capabilities := common.DefaultCapabilities.Copy()
+	capabilities.KubeVersion = *version
+	capabilities.APIVersions = slices.Concat(common.DefaultVersionSet, options.ApiVersions)
+	return capabilities, nil
+}
+
+func isTestHook(hook *release.Hook) bool {
+	return slices.Contains(hook.Events, release.HookTest)
+}
+
+// renderChart renders c with the user values as helm template would do with the options of chart. c is modified by
+// the processing of its dependencies and should not be reused.
+func renderChart(c *chart.Chart, values map[string]any, options *types.HelmChart) (string, error) {
+	capabilities, err := chartCapabilities(options)
+	if err != nil {
+		return "", err
+	}
+	if c.Metadata.KubeVersion != "" &&
+		!chartutil.IsCompatibleRange(c.Metadata.KubeVersion, capabilities.KubeVersion.String()) {
+		return "", fmt.Errorf("chart requires kubeVersion %s which is incompatible with Kubernetes %s",
+			c.Metadata.KubeVersion, capabilities.KubeVersion.String())
+	}
+	if err = chartutil.ProcessDependencies(c, values); err != nil {
+		return "", fmt.Errorf("while processing dependencies: %w", err)
+	}
+
+	releaseName := options.ReleaseName
+	if releaseName == "" {
+		releaseName = defaultReleaseName
+	}
+	namespace := options.Namespace
+	if namespace == "" {
+		namespace = defaultNamespace
+	}
+	renderValues, err := commonutil.ToRenderValues(c, values, common.ReleaseOptions{
+		Name:      releaseName,
+		Namespace: namespace,
+		Revision:  1,
+		IsInstall: true,
+	}, capabilities)
+	if err != nil {
+		return "", fmt.Errorf("while computing values: %w", err)
+	}
+	files, err := engine.Render(c, renderValues)
+	if err != nil {
+		return "", fmt.Errorf("while rendering templates: %w", err)
+	}
+	maps.DeleteFunc(files, func(name, _ string) bool { return path.Base(name) == notesFileName })
+	hooks, manifests, err := releaseutil.SortManifests(files, capabilities.APIVersions, releaseutil.InstallOrder)
+	if err != nil {
+		return "", fmt.Errorf("while sorting manifests: %w", err)
+	}
+
+	var result strings.Builder
+	if options.IncludeCRDs {
+		for _, crd := range c.CRDObjects() {
+			fmt.Fprintf(&result, "---\n# Source: %s\n%s\n", crd.Filename, crd.File.Data)
+		}
+	}
+	for _, manifest := range manifests {
+		fmt.Fprintf(&result, "---\n# Source: %s\n%s\n", manifest.Name, manifest.Content)
+	}
+	if !options.SkipHooks {
+		for _, hook := range hooks {
+			if options.SkipTests && isTestHook(hook) {
+				continue
+			}
+			fmt.Fprintf(&result, "---\n# Source: %s\n%s\n", hook.Path, hook.Manifest)
+		}
+	}
+	return result.String(), nil
+}
@@ -0,0 +1,327 @@
+/*
+Copyright © 2025 Antoine Martin <antoine@openance.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package kustomize_test
+
+// cSpell: words filesys tgz gzip nindent tpl
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+
+	"github.com/kaweezle/iknite/pkg/kustomize"
+)
+
+const helmKustomization = `namespace: apps
+helmCharts:
+- name: web
+  releaseName: front
+  valuesFile: web-values.yaml
+  valuesInline:
+    replicas: 3
+- name: cache
+  version: 0.1.0
+  releaseName: cache
+  skipHooks: true
+`
+
+const webChart = `apiVersion: v2
+name: web
+version: 1.0.0
+appVersion: "2.1"
+dependencies:
+- name: redis
+  version: 1.0.0
+  condition: redis.enabled
+- name: redis
+  alias: sessions
+  version: 1.0.0
+  tags: [sessions]
+- name: redis
+  alias: queue
+  version: 1.0.0
+  tags: [queue, sessions]
+  condition: queue.enabled
+- name: redis
+  alias: jobs
+  version: 1.0.0
+  tags: [jobs]
+`
+
+const webValues = `replicas: 1
+image:
+  repository: nginx
+  tag: ""
+  pullPolicy: Always
+redis:
+  enabled: false
+queue:
+  enabled: false
+tags:
+  sessions: true
+  jobs: false
+global:
+  domain: example.com
+`
+
+const webHelpers = `{{- define "web.fullname" -}}
+{{ .Release.Name }}-{{ .Chart.Name }}
+{{- end -}}
+{{- define "web.labels" -}}
+app.kubernetes.io/name: {{ .Chart.Name }}
+app.kubernetes.io/instance: {{ .Release.Name }}
+{{- end -}}
+`
+
+const webDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ include "web.fullname" . }}
+  labels:
+    {{- include "web.labels" . | nindent 4 }}
+spec:
+  replicas: {{ .Values.replicas }}
+  template:
+    spec:
+      containers:
+      - name: web
+        image: "{{ .Values.image.repository }}:{{ .Values.image.tag | default .Chart.AppVersion }}"
+        {{- with .Values.image.pullPolicy }}
+        imagePullPolicy: {{ . }}
+        {{- end }}
+        env:
+        - name: HOST
+          value: {{ tpl .Values.host . | quote }}
+{{- if semverCompare ">=1.19-0" .Capabilities.KubeVersion.GitVersion }}
+---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: {{ include "web.fullname" . }}
+{{- end }}
+`
+
+// webConfigMap uses functions and objects of the helm engine.
+const webConfigMap = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ include "web.fullname" . }}-config
+data:
+  root: {{ .Chart.IsRoot | quote }}
+  sessions: {{ .Subcharts.sessions.Chart.Name }}
+  helm: {{ hasPrefix "v4" .Capabilities.HelmVersion.Version | quote }}
+  toml: {{ toToml .Values.image | contains "repository" | quote }}
+  yaml: {{ mustToYaml .Values.image | contains "repository" | quote }}
+  ports: {{ fromJsonArray "[6379, 6380]" | len | quote }}
+`
+
+const webSchema = `{
+  "$schema": "https://json-schema.org/draft-07/schema#",
+  "type": "object",
+  "properties": {
+    "replicas": {"type": "integer", "minimum": 1}
+  }
+}
+`
+
+const webTest = `apiVersion: v1
+kind: Pod
+metadata:
+  name: {{ include "web.fullname" . }}-test
+`
+
+const redisChart = `apiVersion: v2
+name: redis
+version: 1.0.0
+`
+
+const redisService = `apiVersion: v1
+kind: Service
+metadata:
+  name: {{ .Release.Name }}-{{ .Chart.Name }}
+  annotations:
+    domain: {{ .Values.global.domain }}
+spec:
+  ports:
+  - port: {{ .Values.port | default 6380 }}
+`
+
+const cacheConfigMap = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Release.Name }}-config
+data:
+  kubernetes: {{ .Capabilities.KubeVersion.Major | quote }}
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: {{ .Release.Name }}-migrate
+  annotations:
+    helm.sh/hook: pre-install
+`
+
+// helmUserValues removes the default pull policy of the web chart and the default port of its sessions sub chart.
+const helmUserValues = `image:
+  tag: "2.2"
+  pullPolicy: null
+redis:
+  enabled: true
+sessions:
+  port: null
+host: "{{ .Release.Name }}.local"
+`
+
+func chartArchive(t *testing.T, name string, files map[string]string) []byte {
+	t.Helper()
+	req := require.New(t)
+	var buffer bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buffer)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for fileName, content := range files {
+		req.NoError(tarWriter.WriteHeader(&tar.Header{
+			Name:     path.Join(name, fileName),
+			Mode:     0o644,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		}))
+		_, err := tarWriter.Write([]byte(content))
+		req.NoError(err)
+	}
+	req.NoError(tarWriter.Close())
+	req.NoError(gzipWriter.Close())
+	return buffer.Bytes()
+}
+
+func helmFileSystem(t *testing.T) filesys.FileSystem {
+	t.Helper()
+	req := require.New(t)
+	fs := filesys.MakeFsInMemory()
+	files := map[string]string{
+		"/config/kustomization.yaml":                   helmKustomization,
+		"/config/web-values.yaml":                      helmUserValues,
+		"/config/charts/web/Chart.yaml":                webChart,
+		"/config/charts/web/values.yaml":               webValues,
+		"/config/charts/web/templates/_helpers.tpl":    webHelpers,
+		"/config/charts/web/templates/NOTES.txt":       "Installed {{ .Release.Name }}",
+		"/config/charts/web/values.schema.json":        webSchema,
+		"/config/charts/web/templates/deployment.yaml": webDeployment,
+		"/config/charts/web/templates/configmap.yaml":  webConfigMap,
+		"/config/charts/web/templates/tests/pod.yaml":  webTest,
+	}
+	for name, content := range files {
+		req.NoError(fs.WriteFile(name, []byte(content)))
+	}
+	req.NoError(fs.WriteFile("/config/charts/web/charts/redis-1.0.0.tgz", chartArchive(t, "redis", map[string]string{
+		"Chart.yaml":             redisChart,
+		"values.yaml":            "port: 6379\n",
+		"templates/service.yaml": redisService,
+	})))
+	req.NoError(fs.WriteFile("/config/charts/cache-0.1.0.tgz", chartArchive(t, "cache", map[string]string{
+		"Chart.yaml":               "apiVersion: v2\nname: cache\nversion: 0.1.0\n",
+		"templates/configmap.yaml": cacheConfigMap,
+	})))
+	return fs
+}
+
+func TestBuildOnFileSystem_HelmCharts(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	resources, err := kustomize.BuildOnFileSystem(helmFileSystem(t), "/config")
+	req.NoError(err)
+
+	names := []string{}
+	for _, resource := range resources.Resources() {
+		req.Equal("apps", resource.GetNamespace(), "resource %s", resource.CurId())
+		names = append(names, resource.GetKind()+"/"+resource.GetName())
+	}
+	req.ElementsMatch([]string{
+		"Deployment/front-web",
+		"ConfigMap/front-web-config",
+		"Ingress/front-web",
+		"Pod/front-web-test",
+		"Service/front-redis",
+		"Service/front-sessions",
+		"ConfigMap/cache-config",
+	}, names)
+
+	content, err := resources.AsYaml()
+	req.NoError(err)
+	req.Contains(string(content), "replicas: 3")
+	req.Contains(string(content), "image: nginx:2.2")
+	req.Contains(string(content), "value: front.local")
+	req.Contains(string(content), "app.kubernetes.io/instance: front")
+	req.Contains(string(content), "domain: example.com")
+	req.Contains(string(content), "port: 6379")
+	req.Contains(string(content), "port: 6380")
+	req.NotContains(string(content), "imagePullPolicy")
+	req.Contains(string(content), `kubernetes: "1"`)
+	req.NotContains(string(content), "Installed")
+	req.Contains(string(content), `root: "true"`)
+	req.Contains(string(content), "sessions: sessions")
+	req.Contains(string(content), `helm: "true"`)
+	req.Contains(string(content), `toml: "true"`)
+	req.Contains(string(content), `yaml: "true"`)
+	req.Contains(string(content), `ports: "2"`)
+}
+
+func TestBuildOnFileSystem_HelmChartErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		kustomization string
+		wantErr       string
+	}{
+		{
+			name:          "missing chart",
+			kustomization: "helmCharts:\n- name: missing\n",
+			wantErr:       "chart missing not found",
+		},
+		{
+			name:          "invalid merge",
+			kustomization: "helmCharts:\n- name: web\n  valuesMerge: other\n",
+			wantErr:       `invalid valuesMerge "other"`,
+		},
+		{
+			name:          "missing value",
+			kustomization: "helmCharts:\n- name: web\n  valuesMerge: replace\n  valuesInline:\n    host: '{{ required \"host is required\" .Values.missing }}'\n",
+			wantErr:       "host is required",
+		},
+		{
+			name:          "invalid values",
+			kustomization: "helmCharts:\n- name: web\n  valuesInline:\n    replicas: 0\n",
+			wantErr:       "values don't meet the specifications of the schema",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			req := require.New(t)
+			fs := helmFileSystem(t)
+			req.NoError(fs.WriteFile("/config/kustomization.yaml", []byte(tt.kustomization)))
+
+			_, err := kustomize.BuildOnFileSystem(fs, "/config")
+			req.ErrorContains(err, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,330 @@
+/*
+Copyright © 2025 Antoine Martin <antoine@openance.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package kustomize
+
+// cSpell: words filesys kyaml konfig tgz
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	chart "helm.sh/helm/v4/pkg/chart/v2"
+	"sigs.k8s.io/kustomize/api/konfig"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+	"sigs.k8s.io/yaml"
+
+	"github.com/kaweezle/iknite/pkg/constants"
+)
+
+const (
+	helmChartsField     = "helmCharts"
+	helmGlobalsField    = "helmGlobals"
+	defaultChartHome    = "charts"
+	renderedChartPrefix = ".iknite-helm-"
+)
+
+// helmFileSystem renders the local Helm charts of the kustomizations in process with the Helm library, without the
+// helm command. When reading a kustomization file, the charts of its helmCharts field that are available locally are
+// replaced by resources pointing to virtual files containing the rendered charts. The charts that are not available locally are left to the kustomize Helm plugin.
+// As kustomize ignores the errors of the kustomization files reads, the rendering errors are collected in errs.
+type helmFileSystem struct {
+	filesys.FileSystem
+	rendered map[string][]byte
+	errs     []error
+	mu       sync.Mutex
+}
+
+func newHelmFileSystem(fs filesys.FileSystem) *helmFileSystem {
+	return &helmFileSystem{FileSystem: fs, rendered: map[string][]byte{}}
+}
+
+// ReadFile returns the rendered charts for the virtual files and the rewritten kustomization files.
+func (h *helmFileSystem) ReadFile(name string) ([]byte, error) {
+	h.mu.Lock()
+	content, ok := h.rendered[name]
+	h.mu.Unlock()
+	if ok {
+		return content, nil
+	}
+	content, err := h.FileSystem.ReadFile(name)
+	if err != nil {
+		return nil, err //nolint:wrapcheck // returned as is to kustomize
+	}
+	if !slices.Contains(konfig.RecognizedKustomizationFileNames(), filepath.Base(name)) ||
+		!bytes.Contains(content, []byte(helmChartsField)) {
+		return content, nil
+	}
+	rendered, err := h.renderKustomization(filepath.Dir(name), content)
+	if err != nil {
+		h.mu.Lock()
+		h.errs = append(h.errs, err)
+		h.mu.Unlock()
+		return nil, err
+	}
+	return rendered, nil
+}
+
+// Err returns the rendering errors.
+func (h *helmFileSystem) Err() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return errors.Join(h.errs...)
+}
+
+// Exists returns true for the virtual files.
+func (h *helmFileSystem) Exists(name string) bool {
+	h.mu.Lock()
+	_, ok := h.rendered[name]
+	h.mu.Unlock()
+	return ok || h.FileSystem.Exists(name)
+}
+
+func (h *helmFileSystem) renderKustomization(dir string, content []byte) ([]byte, error) {
+	node, err := kyaml.Parse(string(content))
+	if err != nil {
+		// Let kustomize report the error
+		return content, nil //nolint:nilerr // see above
+	}
+	chartsField := node.Field(helmChartsField)
+	if chartsField == nil {
+		return content, nil
+	}
+	var charts []types.HelmChart
+	if err = decodeField(chartsField.Value, &charts); err != nil {
+		return nil, fmt.Errorf("while decoding %s of %s: %w", helmChartsField, dir, err)
+	}
+	globals := types.HelmGlobals{}
+	if globalsField := node.Field(helmGlobalsField); globalsField != nil {
+		if err = decodeField(globalsField.Value, &globals); err != nil {
+			return nil, fmt.Errorf("while decoding %s of %s: %w", helmGlobalsField, dir, err)
+		}
+	}
+	chartHome := globals.ChartHome
+	if chartHome == "" {
+		chartHome = defaultChartHome
+	}
+	if !filepath.IsAbs(chartHome) {
+		chartHome = filepath.Join(dir, chartHome)
+	}
+
+	remaining := kyaml.NewListRNode()
+	resources := []string{}
+	for i := range charts {
+		helmChart := &charts[i]
+		loaded, err := h.findChart(chartHome, helmChart)
+		if err != nil {
+			return nil, fmt.Errorf("while loading chart %s: %w", helmChart.Name, err)
+		}
+		if loaded == nil {
+			if helmChart.Repo == "" {
+				return nil, fmt.Errorf("chart %s not found in %s", helmChart.Name, chartHome)
+			}
+			// Leave the remote chart to the kustomize Helm plugin
+			if err = remaining.PipeE(kyaml.Append(chartsField.Value.Content()[i])); err != nil {
+				return nil, fmt.Errorf("while keeping chart %s: %w", helmChart.Name, err)
+			}
+			continue
+		}
+		values, err := h.chartValues(dir, helmChart)
+		if err != nil {
+			return nil, fmt.Errorf("while computing values of chart %s: %w", helmChart.Name, err)
+		}
+		rendered, err := renderChart(loaded, values, helmChart)
+		if err != nil {
+			return nil, fmt.Errorf("while rendering chart %s: %w", helmChart.Name, err)
+		}
+		resource := fmt.Sprintf("%s%d-%s.yaml", renderedChartPrefix, i, helmChart.Name)
+		h.mu.Lock()
+		h.rendered[filepath.Join(dir, resource)] = []byte(rendered)
+		h.mu.Unlock()
+		resources = append(resources, resource)
+	}
+
+	if len(remaining.Content()) == 0 {
+		err = node.PipeE(kyaml.Clear(helmChartsField))
+		if err == nil {
+			err = node.PipeE(kyaml.Clear(helmGlobalsField))
+		}
+	} else {
+		err = node.PipeE(kyaml.SetField(helmChartsField, remaining))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("while updating %s of %s: %w", helmChartsField, dir, err)
+	}
+	if len(resources) > 0 {
+		resourcesNode, err := node.Pipe(kyaml.LookupCreate(kyaml.SequenceNode, "resources"))
+		if err != nil {
+			return nil, fmt.Errorf("while updating resources of %s: %w", dir, err)
+		}
+		for _, resource := range resources {
+			if err = resourcesNode.PipeE(kyaml.Append(kyaml.NewScalarRNode(resource).YNode())); err != nil {
+				return nil, fmt.Errorf("while adding %s to resources of %s: %w", resource, dir, err)
+			}
+		}
+	}
+	result, err := node.String()
+	if err != nil {
+		return nil, fmt.Errorf("while serializing kustomization of %s: %w", dir, err)
+	}
+	return []byte(result), nil
+}
+
+func decodeField(node *kyaml.RNode, target any) error {
+	content, err := node.String()
+	if err != nil {
+		return fmt.Errorf("while serializing field: %w", err)
+	}
+	if err = yaml.Unmarshal([]byte(content), target); err != nil {
+		return fmt.Errorf("while parsing field: %w", err)
+	}
+	return nil
+}
+
+// findChart looks for the chart in the chart home, as a directory or as an archive, and then in the shared chart
+// cache directory. It returns nil if the chart is not found.
+func (h *helmFileSystem) findChart(chartHome string, helmChart *types.HelmChart) (*chart.Chart, error) {
+	candidates := []string{filepath.Join(chartHome, helmChart.Name)}
+	archives := []string{}
+	for _, home := range []string{chartHome, constants.HelmChartCacheDir} {
+		if helmChart.Version != "" {
+			candidates = append(candidates,
+				filepath.Join(home, fmt.Sprintf("%s-%s", helmChart.Name, helmChart.Version), helmChart.Name))
+			archives = append(archives, filepath.Join(home, fmt.Sprintf("%s-%s.tgz", helmChart.Name, helmChart.Version)))
+		}
+		archives = append(archives, filepath.Join(home, helmChart.Name+".tgz"))
+	}
+
+	for _, candidate := range candidates {
+		if !h.FileSystem.Exists(filepath.Join(candidate, chartFileName)) {
+			continue
+		}
+		files, err := h.readChartDirectory(candidate)
+		if err != nil {
+			return nil, err
+		}
+		return loadChart(files)
+	}
+	for _, archive := range archives {
+		if !h.FileSystem.Exists(archive) {
+			continue
+		}
+		content, err := h.FileSystem.ReadFile(archive)
+		if err != nil {
+			return nil, fmt.Errorf("while reading %s: %w", archive, err)
+		}
+		return loadChartArchive(content)
+	}
+	return nil, nil //nolint:nilnil // not found
+}
+
+func (h *helmFileSystem) readChartDirectory(dir string) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	err := h.FileSystem.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		relative, err := filepath.Rel(dir, path)
+		if err != nil {
+			return fmt.Errorf("while computing path of %s: %w", path, err)
+		}
+		content, err := h.FileSystem.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("while reading %s: %w", path, err)
+		}
+		files[filepath.ToSlash(relative)] = content
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("while reading chart directory %s: %w", dir, err)
+	}
+	return files, nil
+}
+
+// mergeValues merges override into base recursively and returns base. The keys set to null in override are kept so
+// that they remove the defaults of the chart and of its sub charts when rendering.
+func mergeValues(base, override map[string]any) map[string]any {
+	for key, value := range override {
+		overrideMap, isOverrideMap := value.(map[string]any)
+		baseMap, isBaseMap := base[key].(map[string]any)
+		if isOverrideMap && isBaseMap {
+			base[key] = mergeValues(baseMap, overrideMap)
+			continue
+		}
+		base[key] = value
+	}
+	return base
+}
+
+// copyValues returns a deep copy of values.
+func copyValues(values map[string]any) map[string]any {
+	result := make(map[string]any, len(values))
+	for key, value := range values {
+		if valueMap, ok := value.(map[string]any); ok {
+			value = copyValues(valueMap)
+		}
+		result[key] = value
+	}
+	return result
+}
+
+// chartValues computes the user values of the chart from the values files and the inline values, following the
+// valuesMerge strategy of the chart. The defaults of the chart are merged by helm when rendering.
+func (h *helmFileSystem) chartValues(dir string, helmChart *types.HelmChart) (map[string]any, error) {
+	fileValues := map[string]any{}
+	valuesFiles := slices.Concat([]string{helmChart.ValuesFile}, helmChart.AdditionalValuesFiles)
+	for _, valuesFile := range valuesFiles {
+		if valuesFile == "" {
+			continue
+		}
+		if !filepath.IsAbs(valuesFile) {
+			valuesFile = filepath.Join(dir, valuesFile)
+		}
+		content, err := h.FileSystem.ReadFile(valuesFile)
+		if err != nil {
+			return nil, fmt.Errorf("while reading values file %s: %w", valuesFile, err)
+		}
+		values := map[string]any{}
+		if err = yaml.Unmarshal(content, &values); err != nil {
+			return nil, fmt.Errorf("while parsing values file %s: %w", valuesFile, err)
+		}
+		fileValues = mergeValues(fileValues, values)
+	}
+
+	inlineValues := copyValues(helmChart.ValuesInline)
+	var values map[string]any
+	switch strings.ToLower(helmChart.ValuesMerge) {
+	case "", "override":
+		values = mergeValues(fileValues, inlineValues)
+	case "merge":
+		values = mergeValues(inlineValues, fileValues)
+	case "replace":
+		values = inlineValues
+	default:
+		return nil, fmt.Errorf("invalid valuesMerge %q", helmChart.ValuesMerge)
+	}
+	return values, nil
+}
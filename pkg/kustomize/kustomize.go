@@ -34,7 +34,8 @@ import (
 	"github.com/kaweezle/iknite/pkg/host"
 )
 
-// EnablePlugins configures kustomize options with plugins and exec enabled.
+// EnablePlugins configures kustomize options with plugins and exec enabled. The helm command is only used for the
+// charts that BuildOnFileSystem cannot render natively, i.e. the charts that are not available locally.
 func EnablePlugins(opts *krusty.Options) *krusty.Options {
 	opts.PluginConfig = types.EnabledPluginConfig(
 		types.BploUseStaticallyLinked,
@@ -47,11 +48,16 @@ func EnablePlugins(opts *krusty.Options) *krusty.Options {
 }
 
 // BuildOnFileSystem runs kustomize on the given directory using the provided file system and returns the resulting
-// resource map.
+// resource map. The Helm charts of the kustomizations available in their chart home, as directories or archives, are
+// rendered without the helm command.
 func BuildOnFileSystem(fs filesys.FileSystem, dir string) (resmap.ResMap, error) {
 	opts := EnablePlugins(krusty.MakeDefaultOptions())
 	k := krusty.MakeKustomizer(opts)
-	resources, err := k.Run(fs, dir)
+	helmFs := newHelmFileSystem(fs)
+	resources, err := k.Run(helmFs, dir)
+	if helmErr := helmFs.Err(); helmErr != nil {
+		return nil, fmt.Errorf("failed to render helm charts of %s: %w", dir, helmErr)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to run kustomize on %s: %w", dir, err)
 	}
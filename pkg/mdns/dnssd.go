@@ -0,0 +1,574 @@
+/*
+Copyright © 2021 Antoine Martin <antoine@openance.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mdns
+
+// cSpell: words dnssd dnsmessage
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/net/ipv4"
+
+	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
+	"github.com/kaweezle/iknite/pkg/constants"
+)
+
+const (
+	// KubernetesServiceType is the DNS-SD service type of the Kubernetes API server.
+	KubernetesServiceType = "_kubernetes._tcp"
+	// IkniteServiceType is the DNS-SD service type of the iknite status server.
+	IkniteServiceType = "_iknite._tcp"
+
+	// ClusterTextKey is the TXT record key containing the name of the cluster.
+	ClusterTextKey = "cluster"
+	// VersionTextKey is the TXT record key containing the Kubernetes version of the cluster.
+	VersionTextKey = "version"
+	// StateTextKey is the TXT record key containing the state of the cluster.
+	StateTextKey = "state"
+
+	localDomain             = "local."
+	servicesEnumerationName = "_services._dns-sd._udp.local."
+	mdnsPort                = 5353
+	recordTTL               = 120
+	legacyUnicastTTL        = 10
+	// cacheFlushBit is the top bit of the class. It is the cache flush bit of the records and the unicast response
+	// bit of the questions (RFC 6762 sections 10.2 and 5.4).
+	cacheFlushBit = dnsmessage.Class(1 << 15)
+	maxPacketSize = 9000
+)
+
+var (
+	mdnsGroupIPv4 = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: mdnsPort}
+
+	// browseInterval is the interval between the queries sent while browsing. It is replaced in tests.
+	browseInterval = time.Second
+)
+
+// Service is an instance of a DNS-SD service.
+type Service struct {
+	Text     map[string]string
+	Instance string
+	Type     string
+	Host     string
+	IPs      []net.IP
+	Port     uint16
+}
+
+func (s *Service) typeName() string {
+	return s.Type + "." + localDomain
+}
+
+func (s *Service) instanceName() string {
+	return s.Instance + "." + s.typeName()
+}
+
+func (s *Service) hostName() string {
+	return strings.TrimSuffix(s.Host, ".") + "."
+}
+
+func (s *Service) textRecords() []string {
+	keys := slices.Sorted(maps.Keys(s.Text))
+	records := make([]string, 0, len(keys))
+	for _, key := range keys {
+		records = append(records, key+"="+s.Text[key])
+	}
+	if len(records) == 0 {
+		// A TXT record must contain at least one string (RFC 6763 section 6.1)
+		records = append(records, "")
+	}
+	return records
+}
+
+// ClusterServices returns the services advertising the API server and the status server of cluster. The services
+// target the published mDNS name of the cluster with the IP of the cluster and ips, usually the addresses of its
+// network interface.
+func ClusterServices(cluster *v1alpha1.IkniteCluster, ips ...net.IP) []*Service {
+	spec := &cluster.Spec
+	host := cluster.Status.MDNS.Name
+	if host == "" {
+		host = spec.DomainName
+	}
+	if host == "" {
+		host = spec.ClusterName + ".local"
+	}
+	if spec.Ip != nil && !slices.ContainsFunc(ips, spec.Ip.Equal) {
+		ips = append([]net.IP{spec.Ip}, ips...)
+	}
+	text := map[string]string{
+		ClusterTextKey: spec.ClusterName,
+		VersionTextKey: spec.KubernetesVersion,
+		StateTextKey:   cluster.Status.State.String(),
+	}
+	return []*Service{
+		{
+			Instance: spec.ClusterName,
+			Type:     KubernetesServiceType,
+			Host:     host,
+			Port:     constants.KubernetesAPIServerPort,
+			Text:     text,
+			IPs:      ips,
+		},
+		{
+			Instance: spec.ClusterName,
+			Type:     IkniteServiceType,
+			Host:     host,
+			Port:     uint16(spec.StatusServerPort), //nolint:gosec // port number
+			Text:     maps.Clone(text),
+			IPs:      ips,
+		},
+	}
+}
+
+func newResource(name string, ttl uint32, flush bool, body dnsmessage.ResourceBody) (dnsmessage.Resource, error) {
+	resourceName, err := dnsmessage.NewName(name)
+	if err != nil {
+		return dnsmessage.Resource{}, fmt.Errorf("invalid name %q: %w", name, err)
+	}
+	class := dnsmessage.ClassINET
+	if flush {
+		class |= cacheFlushBit
+	}
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: resourceName, Class: class, TTL: ttl},
+		Body:   body,
+	}, nil
+}
+
+func pointer(name, target string, ttl uint32) []dnsmessage.Resource {
+	targetName, err := dnsmessage.NewName(target)
+	if err != nil {
+		return nil
+	}
+	resource, err := newResource(name, ttl, false, &dnsmessage.PTRResource{PTR: targetName})
+	if err != nil {
+		return nil
+	}
+	return []dnsmessage.Resource{resource}
+}
+
+func (s *Service) srv(ttl uint32, flush bool) []dnsmessage.Resource {
+	target, err := dnsmessage.NewName(s.hostName())
+	if err != nil {
+		return nil
+	}
+	resource, err := newResource(s.instanceName(), ttl, flush, &dnsmessage.SRVResource{Port: s.Port, Target: target})
+	if err != nil {
+		return nil
+	}
+	return []dnsmessage.Resource{resource}
+}
+
+func (s *Service) txt(ttl uint32, flush bool) []dnsmessage.Resource {
+	resource, err := newResource(s.instanceName(), ttl, flush, &dnsmessage.TXTResource{TXT: s.textRecords()})
+	if err != nil {
+		return nil
+	}
+	return []dnsmessage.Resource{resource}
+}
+
+func (s *Service) addresses(ttl uint32, flush bool) []dnsmessage.Resource {
+	return addressRecords(s.hostName(), s.IPs, ttl, flush)
+}
+
+// records returns all the records of the service, as announced.
+func (s *Service) records(ttl uint32) []dnsmessage.Resource {
+	return slices.Concat(
+		pointer(servicesEnumerationName, s.typeName(), ttl),
+		pointer(s.typeName(), s.instanceName(), ttl),
+		s.srv(ttl, true),
+		s.txt(ttl, true),
+		s.addresses(ttl, true),
+	)
+}
+
+// answerQuestion returns the answers and the additional records of question.
+func answerQuestion(
+	services []*Service,
+	question dnsmessage.Question,
+	ttl uint32,
+	flush bool,
+) ([]dnsmessage.Resource, []dnsmessage.Resource) {
+	var answers, additionals []dnsmessage.Resource
+	name := strings.ToLower(question.Name.String())
+	matches := func(t dnsmessage.Type) bool {
+		return question.Type == t || question.Type == dnsmessage.TypeALL
+	}
+	for _, service := range services {
+		switch name {
+		case servicesEnumerationName:
+			if matches(dnsmessage.TypePTR) {
+				answers = append(answers, pointer(servicesEnumerationName, service.typeName(), ttl)...)
+			}
+		case strings.ToLower(service.typeName()):
+			if matches(dnsmessage.TypePTR) {
+				answers = append(answers, pointer(service.typeName(), service.instanceName(), ttl)...)
+				additionals = slices.Concat(additionals, service.srv(ttl, flush), service.txt(ttl, flush),
+					service.addresses(ttl, flush))
+			}
+		case strings.ToLower(service.instanceName()):
+			if matches(dnsmessage.TypeSRV) {
+				answers = append(answers, service.srv(ttl, flush)...)
+				additionals = append(additionals, service.addresses(ttl, flush)...)
+			}
+			if matches(dnsmessage.TypeTXT) {
+				answers = append(answers, service.txt(ttl, flush)...)
+			}
+		}
+	}
+	return answers, additionals
+}
+
+// uniqueResources removes the duplicate records of resources as well as the ones already present in existing.
+func uniqueResources(resources []dnsmessage.Resource, existing ...dnsmessage.Resource) []dnsmessage.Resource {
+	seen := map[string]bool{}
+	for _, resource := range existing {
+		seen[resource.GoString()] = true
+	}
+	result := []dnsmessage.Resource{}
+	for _, resource := range resources {
+		key := resource.GoString()
+		if !seen[key] {
+			seen[key] = true
+			result = append(result, resource)
+		}
+	}
+	return result
+}
+
+// respond returns the response to query, or nil if there is nothing to answer, and whether it should be sent to
+// src instead of the multicast group. Legacy unicast queries, sent from another port than the mDNS one, are answered
+// to their source as classic DNS responses (RFC 6762 section 6.7).
+func respond(services []*Service, query *dnsmessage.Message, src net.Addr) (*dnsmessage.Message, bool) {
+	udpAddr, ok := src.(*net.UDPAddr)
+	legacy := ok && udpAddr.Port != mdnsPort
+	ttl := uint32(recordTTL)
+	if legacy {
+		ttl = legacyUnicastTTL
+	}
+
+	response := &dnsmessage.Message{Header: dnsmessage.Header{Response: true, Authoritative: true}}
+	if legacy {
+		response.ID = query.ID
+		response.Questions = query.Questions
+	}
+	unicast := legacy
+	for _, question := range query.Questions {
+		answers, additionals := answerQuestion(services, question, ttl, !legacy)
+		if len(answers) > 0 && question.Class&cacheFlushBit != 0 {
+			unicast = true
+		}
+		response.Answers = append(response.Answers, answers...)
+		response.Additionals = append(response.Additionals, additionals...)
+	}
+	if len(response.Answers) == 0 {
+		return nil, false
+	}
+	response.Answers = uniqueResources(response.Answers)
+	response.Additionals = uniqueResources(response.Additionals, response.Answers...)
+	return response, unicast
+}
+
+// Advertiser advertises DNS-SD services. It answers the queries received on its connection and announces the
+// services each time they change.
+type Advertiser struct {
+	conn     net.PacketConn
+	group    net.Addr
+	done     chan struct{}
+	services []*Service
+	mu       sync.Mutex
+}
+
+// NewAdvertiser creates an advertiser answering the queries received on conn. The announcements and the multicast
+// responses are sent to group.
+func NewAdvertiser(conn net.PacketConn, group net.Addr) *Advertiser {
+	advertiser := &Advertiser{conn: conn, group: group, done: make(chan struct{})}
+	go advertiser.serve()
+	return advertiser
+}
+
+// ListenAdvertiser creates an advertiser listening on the mDNS port of the IPv4 multicast interfaces.
+func ListenAdvertiser() (*Advertiser, error) {
+	conn, err := listenMulticast()
+	if err != nil {
+		return nil, err
+	}
+	return NewAdvertiser(conn, mdnsGroupIPv4), nil
+}
+
+// SetServices advertises services instead of the current ones. The services are announced if they changed.
+func (a *Advertiser) SetServices(services ...*Service) error {
+	a.mu.Lock()
+	if reflect.DeepEqual(services, a.services) {
+		a.mu.Unlock()
+		return nil
+	}
+	a.services = services
+	a.mu.Unlock()
+	return a.announce(services, recordTTL)
+}
+
+func (a *Advertiser) announce(services []*Service, ttl uint32) error {
+	if len(services) == 0 {
+		return nil
+	}
+	message := &dnsmessage.Message{Header: dnsmessage.Header{Response: true, Authoritative: true}}
+	for _, service := range services {
+		message.Answers = append(message.Answers, service.records(ttl)...)
+	}
+	message.Answers = uniqueResources(message.Answers)
+	packed, err := message.Pack()
+	if err != nil {
+		return fmt.Errorf("while packing the DNS-SD announcement: %w", err)
+	}
+	if _, err = a.conn.WriteTo(packed, a.group); err != nil {
+		return fmt.Errorf("while sending the DNS-SD announcement: %w", err)
+	}
+	return nil
+}
+
+func (a *Advertiser) serve() {
+	defer close(a.done)
+	buffer := make([]byte, maxPacketSize)
+	for {
+		n, src, err := a.conn.ReadFrom(buffer)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		var query dnsmessage.Message
+		if query.Unpack(buffer[:n]) != nil || query.Response {
+			continue
+		}
+		a.mu.Lock()
+		services := a.services
+		a.mu.Unlock()
+
+		response, unicast := respond(services, &query, src)
+		if response == nil {
+			continue
+		}
+		packed, err := response.Pack()
+		if err != nil {
+			continue
+		}
+		destination := a.group
+		if unicast {
+			destination = src
+		}
+		_, _ = a.conn.WriteTo(packed, destination) //nolint:errcheck // the query will be sent again
+	}
+}
+
+// Close sends a goodbye for the advertised services and stops the advertiser.
+func (a *Advertiser) Close() error {
+	a.mu.Lock()
+	services := a.services
+	a.services = nil
+	a.mu.Unlock()
+
+	err := a.announce(services, 0)
+	if closeErr := a.conn.Close(); closeErr != nil {
+		err = errors.Join(err, fmt.Errorf("while closing the DNS-SD connection: %w", closeErr))
+	}
+	<-a.done
+	return err
+}
+
+// reuseAddress allows several mDNS servers to share the mDNS port. On Linux, all the sockets bound to the port receive
+// the multicast packets.
+func reuseAddress(_, _ string, rawConn syscall.RawConn) error {
+	var sockErr error
+	err := rawConn.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+	})
+	if err != nil {
+		return fmt.Errorf("while accessing the socket: %w", err)
+	}
+	if sockErr != nil {
+		return fmt.Errorf("while setting the socket options: %w", sockErr)
+	}
+	return nil
+}
+
+func listenMulticast() (net.PacketConn, error) {
+	listenConfig := net.ListenConfig{Control: reuseAddress}
+	conn, err := listenConfig.ListenPacket(context.Background(), "udp4", fmt.Sprintf("0.0.0.0:%d", mdnsPort))
+	if err != nil {
+		return nil, fmt.Errorf("cannot listen on the mDNS port: %w", err)
+	}
+
+	packetConn := ipv4.NewPacketConn(conn)
+	interfaces, err := net.Interfaces()
+	if err != nil { // nocov -- should not happen on supported platforms
+		_ = conn.Close() //nolint:errcheck // best effort cleanup
+		return nil, fmt.Errorf("cannot list the network interfaces: %w", err)
+	}
+	joined := 0
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagMulticast == 0 {
+			continue
+		}
+		if packetConn.JoinGroup(&iface, &net.UDPAddr{IP: mdnsGroupIPv4.IP}) == nil {
+			joined++
+		}
+	}
+	if joined == 0 {
+		_ = conn.Close() //nolint:errcheck // best effort cleanup
+		return nil, errors.New("no multicast network interface available")
+	}
+	_ = packetConn.SetMulticastLoopback(true) //nolint:errcheck // local browsing only
+	return conn, nil
+}
+
+// Browse queries the instances of the serviceTypes until ctx is done and returns the services discovered.
+func Browse(ctx context.Context, serviceTypes ...string) ([]*Service, error) {
+	return browse(ctx, mdnsGroupIPv4, serviceTypes...)
+}
+
+func browse(ctx context.Context, destination net.Addr, serviceTypes ...string) ([]*Service, error) {
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return nil, fmt.Errorf("cannot create the browsing socket: %w", err)
+	}
+	defer conn.Close() //nolint:errcheck // should not fail.
+
+	query := &dnsmessage.Message{}
+	for _, serviceType := range serviceTypes {
+		name, nameErr := dnsmessage.NewName(serviceType + "." + localDomain)
+		if nameErr != nil {
+			return nil, fmt.Errorf("invalid service type %q: %w", serviceType, nameErr)
+		}
+		query.Questions = append(query.Questions,
+			dnsmessage.Question{Name: name, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET})
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("while packing the DNS-SD query: %w", err)
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetReadDeadline(time.Unix(1, 0)) //nolint:errcheck // unblocks the reads
+	})
+	defer stop()
+	go func() {
+		ticker := time.NewTicker(browseInterval)
+		defer ticker.Stop()
+		for {
+			if _, writeErr := conn.WriteTo(packed, destination); writeErr != nil {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	var records []dnsmessage.Resource
+	buffer := make([]byte, maxPacketSize)
+	for {
+		n, _, readErr := conn.ReadFrom(buffer)
+		if readErr != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return nil, fmt.Errorf("while reading the DNS-SD responses: %w", readErr)
+		}
+		var response dnsmessage.Message
+		if response.Unpack(buffer[:n]) != nil || !response.Response {
+			continue
+		}
+		records = slices.Concat(records, response.Answers, response.Additionals)
+	}
+	return servicesFromRecords(records, serviceTypes...), nil
+}
+
+// servicesFromRecords returns the instances of the serviceTypes described by records, sorted by type and instance.
+func servicesFromRecords(records []dnsmessage.Resource, serviceTypes ...string) []*Service {
+	types := map[string]string{}
+	for _, serviceType := range serviceTypes {
+		types[strings.ToLower(serviceType+"."+localDomain)] = serviceType
+	}
+	instances := map[string]*Service{}
+	hosts := map[string][]net.IP{}
+	for _, record := range records {
+		name := strings.ToLower(record.Header.Name.String())
+		switch body := record.Body.(type) {
+		case *dnsmessage.PTRResource:
+			serviceType, ok := types[name]
+			target := body.PTR.String()
+			if !ok || len(target) <= len(name)+1 || !strings.EqualFold(target[len(target)-len(name):], name) {
+				continue
+			}
+			key := strings.ToLower(target)
+			if record.Header.TTL == 0 {
+				delete(instances, key)
+				continue
+			}
+			if _, exists := instances[key]; !exists {
+				instances[key] = &Service{
+					Instance: target[:len(target)-len(name)-1],
+					Type:     serviceType,
+					Text:     map[string]string{},
+				}
+			}
+		case *dnsmessage.AResource, *dnsmessage.AAAAResource:
+			ip := recordIP(&record)
+			if !slices.ContainsFunc(hosts[name], ip.Equal) {
+				hosts[name] = append(hosts[name], ip)
+			}
+		}
+	}
+	for _, record := range records {
+		service, ok := instances[strings.ToLower(record.Header.Name.String())]
+		if !ok {
+			continue
+		}
+		switch body := record.Body.(type) {
+		case *dnsmessage.SRVResource:
+			service.Host = strings.TrimSuffix(body.Target.String(), ".")
+			service.Port = body.Port
+		case *dnsmessage.TXTResource:
+			for _, text := range body.TXT {
+				if key, value, found := strings.Cut(text, "="); found && key != "" {
+					service.Text[key] = value
+				}
+			}
+		}
+	}
+
+	services := slices.Collect(maps.Values(instances))
+	for _, service := range services {
+		service.IPs = hosts[strings.ToLower(service.Host+".")]
+	}
+	slices.SortFunc(services, func(a, b *Service) int {
+		return strings.Compare(a.Type+"/"+a.Instance, b.Type+"/"+b.Instance)
+	})
+	return services
+}
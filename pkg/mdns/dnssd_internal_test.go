@@ -0,0 +1,114 @@
+// cSpell: words dnssd dnsmessage
+package mdns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+
+	ikniteApi "github.com/kaweezle/iknite/pkg/apis/iknite"
+	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
+)
+
+func testCluster() *v1alpha1.IkniteCluster {
+	cluster := v1alpha1.NewDefaultIkniteCluster()
+	cluster.Spec.ClusterName = "kaweezle"
+	cluster.Spec.DomainName = "kaweezle.local"
+	cluster.Spec.Ip = net.ParseIP("192.168.99.2")
+	cluster.Status.State = ikniteApi.Running
+	return cluster
+}
+
+func TestAdvertiser_Browse(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	req.NoError(err)
+	group, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	req.NoError(err)
+	defer group.Close() //nolint:errcheck // test cleanup
+
+	advertiser := NewAdvertiser(conn, group.LocalAddr())
+	req.NoError(advertiser.SetServices(ClusterServices(testCluster())...))
+
+	// The services are announced to the group
+	buffer := make([]byte, maxPacketSize)
+	req.NoError(group.SetReadDeadline(time.Now().Add(5 * time.Second)))
+	n, _, err := group.ReadFrom(buffer)
+	req.NoError(err)
+	var announcement dnsmessage.Message
+	req.NoError(announcement.Unpack(buffer[:n]))
+	req.True(announcement.Response)
+	req.Len(servicesFromRecords(announcement.Answers, KubernetesServiceType, IkniteServiceType), 2)
+
+	// Unchanged services are not announced again
+	req.NoError(advertiser.SetServices(ClusterServices(testCluster())...))
+
+	ctx, cancel := context.WithTimeout(t.Context(), 300*time.Millisecond)
+	defer cancel()
+	services, err := browse(ctx, conn.LocalAddr(), KubernetesServiceType, IkniteServiceType)
+	req.NoError(err)
+	req.Len(services, 2)
+	req.Equal("kaweezle", services[0].Instance)
+	req.Equal(IkniteServiceType, services[0].Type)
+	req.Equal(uint16(11443), services[0].Port)
+	req.Equal(KubernetesServiceType, services[1].Type)
+	req.Equal(uint16(6443), services[1].Port)
+	req.Equal("kaweezle.local", services[1].Host)
+	req.Len(services[1].IPs, 1)
+	req.Equal("192.168.99.2", services[1].IPs[0].String())
+	req.Equal(map[string]string{
+		ClusterTextKey: "kaweezle",
+		VersionTextKey: testCluster().Spec.KubernetesVersion,
+		StateTextKey:   "Running",
+	}, services[1].Text)
+
+	// Goodbye on close
+	req.NoError(advertiser.Close())
+	n, _, err = group.ReadFrom(buffer)
+	req.NoError(err)
+	var goodbye dnsmessage.Message
+	req.NoError(goodbye.Unpack(buffer[:n]))
+	req.NotEmpty(goodbye.Answers)
+	for _, answer := range goodbye.Answers {
+		req.Zero(answer.Header.TTL)
+	}
+	req.Empty(servicesFromRecords(append(announcement.Answers, goodbye.Answers...), KubernetesServiceType))
+}
+
+func TestRespond(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	services := ClusterServices(testCluster())
+	mdnsSource := &net.UDPAddr{IP: net.ParseIP("192.168.99.1"), Port: mdnsPort}
+	question := func(name string, qType dnsmessage.Type, class dnsmessage.Class) *dnsmessage.Message {
+		return &dnsmessage.Message{Questions: []dnsmessage.Question{
+			{Name: dnsmessage.MustNewName(name), Type: qType, Class: class},
+		}}
+	}
+
+	response, unicast := respond(services, question(servicesEnumerationName, dnsmessage.TypePTR,
+		dnsmessage.ClassINET), mdnsSource)
+	req.NotNil(response)
+	req.False(unicast)
+	req.Len(response.Answers, 2)
+	req.Empty(response.Questions)
+
+	response, unicast = respond(services, question("Kaweezle._iknite._tcp.local.", dnsmessage.TypeSRV,
+		dnsmessage.ClassINET|cacheFlushBit), mdnsSource)
+	req.NotNil(response)
+	req.True(unicast, "unicast response requested")
+	req.Len(response.Answers, 1)
+	req.Equal(dnsmessage.ClassINET|cacheFlushBit, response.Answers[0].Header.Class)
+	req.Len(response.Additionals, 1)
+
+	response, _ = respond(services, question("_ssh._tcp.local.", dnsmessage.TypePTR, dnsmessage.ClassINET),
+		mdnsSource)
+	req.Nil(response)
+}
@@ -0,0 +1,244 @@
+/*
+Copyright © 2021 Antoine Martin <antoine@openance.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mdns
+
+// cSpell: words dnsmessage
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
+	"github.com/kaweezle/iknite/pkg/utils"
+)
+
+const (
+	probeCount = 3
+	// maxRenameAttempts is the number of renamed candidates probed after a conflict.
+	maxRenameAttempts = 10
+)
+
+// probeInterval is the interval between the probe queries (RFC 6762 section 8.1). It is replaced in tests.
+var probeInterval = 250 * time.Millisecond
+
+// ProbeFunc returns true if another host answers for name. The answers giving one of ips come from this host.
+type ProbeFunc func(ctx context.Context, name string, ips []net.IP) (bool, error)
+
+// Probe checks that no other host on the network answers for name before it is announced. It sends three probe
+// queries 250 milliseconds apart, as described in RFC 6762 section 8.1, and returns true if another host answered
+// for name or probed it simultaneously with different records and won the tie-break.
+func Probe(ctx context.Context, name string, ips []net.IP) (bool, error) {
+	conn, err := listenMulticast()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close() //nolint:errcheck // should not fail.
+	return probe(ctx, conn, mdnsGroupIPv4, name, ips)
+}
+
+func addressRecords(name string, ips []net.IP, ttl uint32, flush bool) []dnsmessage.Resource {
+	resources := []dnsmessage.Resource{}
+	for _, ip := range ips {
+		var body dnsmessage.ResourceBody
+		if ip4 := ip.To4(); ip4 != nil {
+			body = &dnsmessage.AResource{A: [4]byte(ip4)}
+		} else if ip16 := ip.To16(); ip16 != nil {
+			body = &dnsmessage.AAAAResource{AAAA: [16]byte(ip16)}
+		} else {
+			continue
+		}
+		if resource, err := newResource(name, ttl, flush, body); err == nil {
+			resources = append(resources, resource)
+		}
+	}
+	return resources
+}
+
+func recordIP(resource *dnsmessage.Resource) net.IP {
+	switch body := resource.Body.(type) {
+	case *dnsmessage.AResource:
+		return net.IP(body.A[:])
+	case *dnsmessage.AAAAResource:
+		return net.IP(body.AAAA[:])
+	default:
+		return nil
+	}
+}
+
+// lowestIP returns the lexicographically lowest address of ips, used for the tie-break of simultaneous probes.
+func lowestIP(ips []net.IP) net.IP {
+	var lowest net.IP
+	for _, ip := range ips {
+		if ip16 := ip.To16(); lowest == nil || bytes.Compare(ip16, lowest) < 0 {
+			lowest = ip16
+		}
+	}
+	return lowest
+}
+
+// isConflict returns true if message, received while probing name with ips, shows that another host uses name.
+func isConflict(message *dnsmessage.Message, name string, ips []net.IP) bool {
+	matches := func(resource *dnsmessage.Resource) bool {
+		return strings.EqualFold(resource.Header.Name.String(), name)
+	}
+	if message.Response {
+		for _, resource := range slices.Concat(message.Answers, message.Additionals) {
+			if ip := recordIP(&resource); ip != nil && matches(&resource) && !slices.ContainsFunc(ips, ip.Equal) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Simultaneous probe: the host with the lexicographically later records wins (RFC 6762 section 8.2)
+	theirs := []net.IP{}
+	for _, resource := range message.Authorities {
+		if ip := recordIP(&resource); ip != nil && matches(&resource) {
+			theirs = append(theirs, ip)
+		}
+	}
+	if len(theirs) == 0 {
+		return false
+	}
+	return bytes.Compare(lowestIP(theirs), lowestIP(ips)) > 0
+}
+
+func probe(ctx context.Context, conn net.PacketConn, group net.Addr, name string, ips []net.IP) (bool, error) {
+	fqdn := strings.TrimSuffix(name, ".") + "."
+	questionName, err := dnsmessage.NewName(fqdn)
+	if err != nil {
+		return false, fmt.Errorf("invalid name %q: %w", name, err)
+	}
+	query := &dnsmessage.Message{
+		Questions: []dnsmessage.Question{
+			{Name: questionName, Type: dnsmessage.TypeALL, Class: dnsmessage.ClassINET | cacheFlushBit},
+		},
+		Authorities: addressRecords(fqdn, ips, recordTTL, false),
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return false, fmt.Errorf("while packing the probe of %s: %w", name, err)
+	}
+
+	buffer := make([]byte, maxPacketSize)
+	for range probeCount {
+		if _, err = conn.WriteTo(packed, group); err != nil {
+			return false, fmt.Errorf("while probing %s: %w", name, err)
+		}
+		if err = conn.SetReadDeadline(time.Now().Add(probeInterval)); err != nil {
+			return false, fmt.Errorf("while probing %s: %w", name, err)
+		}
+		for {
+			if ctx.Err() != nil {
+				return false, fmt.Errorf("while probing %s: %w", name, ctx.Err())
+			}
+			n, _, readErr := conn.ReadFrom(buffer)
+			var netErr net.Error
+			if errors.As(readErr, &netErr) && netErr.Timeout() {
+				break
+			}
+			if readErr != nil {
+				return false, fmt.Errorf("while probing %s: %w", name, readErr)
+			}
+			var message dnsmessage.Message
+			if message.Unpack(buffer[:n]) == nil && isConflict(&message, fqdn, ips) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// LenientProbe returns a probe function that considers that there is no conflict when probeFn fails, for instance
+// because there is no multicast interface. The failure is logged.
+func LenientProbe(probeFn ProbeFunc, logger *slog.Logger) ProbeFunc {
+	return func(ctx context.Context, name string, ips []net.IP) (bool, error) {
+		conflict, err := probeFn(ctx, name, ips)
+		if err != nil {
+			logger.Warn("Cannot probe the mdns name, publishing it without probing", "name", name,
+				utils.ErrorKey, err)
+			return false, nil
+		}
+		return conflict, nil
+	}
+}
+
+// RenameCandidate returns the candidate name of the given attempt after a conflict on name. The attempt number is
+// appended to the first label: cluster.iknite becomes cluster-2.iknite.
+func RenameCandidate(name string, attempt int) string {
+	label, rest, found := strings.Cut(name, ".")
+	candidate := label + "-" + strconv.Itoa(attempt)
+	if found {
+		candidate += "." + rest
+	}
+	return candidate
+}
+
+// ResolveName probes name and returns the name to publish and whether the requested name was in conflict. With the
+// rename policy, the name is renamed with RenameCandidate until a candidate without conflict is found. With the fail
+// policy, a conflict is an error.
+func ResolveName(ctx context.Context, probeFn ProbeFunc, name, policy string, ips []net.IP) (string, bool, error) {
+	if policy != "" && policy != v1alpha1.MDNSConflictRename && policy != v1alpha1.MDNSConflictFail {
+		return "", false, fmt.Errorf("invalid mDNS conflict policy %q", policy)
+	}
+	conflict, err := probeFn(ctx, name, ips)
+	if err != nil {
+		return "", false, err
+	}
+	if !conflict {
+		return name, false, nil
+	}
+	if policy == v1alpha1.MDNSConflictFail {
+		return "", true, fmt.Errorf("%s is already used by another host on the network", name)
+	}
+	for attempt := 2; attempt < maxRenameAttempts+2; attempt++ {
+		candidate := RenameCandidate(name, attempt)
+		if conflict, err = probeFn(ctx, candidate, ips); err != nil {
+			return "", true, err
+		}
+		if !conflict {
+			return candidate, true, nil
+		}
+	}
+	return "", true, fmt.Errorf("%s and its %d renamed candidates are used by other hosts", name, maxRenameAttempts)
+}
+
+// InterfaceAddresses returns the global unicast IPv4 and IPv6 addresses of the network interface name, or of all the
+// interfaces if name is empty or does not exist.
+func InterfaceAddresses(name string) []net.IP {
+	var addrs []net.Addr
+	if iface, err := net.InterfaceByName(name); err == nil && name != "" {
+		addrs, _ = iface.Addrs() //nolint:errcheck // no address
+	} else {
+		addrs, _ = net.InterfaceAddrs() //nolint:errcheck // no address
+	}
+	ips := []net.IP{}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.IsGlobalUnicast() {
+			ips = append(ips, ipNet.IP)
+		}
+	}
+	return ips
+}
@@ -0,0 +1,169 @@
+// cSpell: words dnsmessage
+package mdns
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
+)
+
+// answerProbes answers the probes received on group with an A record of name giving ip.
+func answerProbes(t *testing.T, group net.PacketConn, name string, ip net.IP) {
+	t.Helper()
+	buffer := make([]byte, maxPacketSize)
+	for {
+		n, src, err := group.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+		var query dnsmessage.Message
+		if query.Unpack(buffer[:n]) != nil {
+			continue
+		}
+		response := &dnsmessage.Message{
+			Header:  dnsmessage.Header{Response: true, Authoritative: true},
+			Answers: addressRecords(name, []net.IP{ip}, recordTTL, true),
+		}
+		packed, err := response.Pack()
+		if err != nil {
+			return
+		}
+		_, _ = group.WriteTo(packed, src) //nolint:errcheck // test responder
+	}
+}
+
+func TestProbe(t *testing.T) {
+	t.Parallel()
+
+	ours := []net.IP{net.ParseIP("192.168.99.2"), net.ParseIP("fd00::2")}
+	tests := []struct {
+		name     string
+		answerIP net.IP
+		want     bool
+	}{
+		{name: "conflict", answerIP: net.ParseIP("192.168.99.3"), want: true},
+		{name: "own address", answerIP: net.ParseIP("192.168.99.2"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			req := require.New(t)
+
+			conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+			req.NoError(err)
+			defer conn.Close() //nolint:errcheck // test cleanup
+			group, err := net.ListenPacket("udp4", "127.0.0.1:0")
+			req.NoError(err)
+			defer group.Close() //nolint:errcheck // test cleanup
+			go answerProbes(t, group, "kaweezle.local.", tt.answerIP)
+
+			conflict, err := probe(t.Context(), conn, group.LocalAddr(), "kaweezle.local", ours)
+			req.NoError(err)
+			req.Equal(tt.want, conflict)
+		})
+	}
+}
+
+func TestIsConflict(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	ours := []net.IP{net.ParseIP("192.168.99.2")}
+	probeOf := func(ip string) *dnsmessage.Message {
+		return &dnsmessage.Message{
+			Authorities: addressRecords("kaweezle.local.", []net.IP{net.ParseIP(ip)}, recordTTL, false),
+		}
+	}
+	// Simultaneous probes: the lexicographically later records win
+	req.True(isConflict(probeOf("192.168.99.3"), "kaweezle.local.", ours))
+	req.False(isConflict(probeOf("192.168.99.1"), "kaweezle.local.", ours))
+	// Our own probe
+	req.False(isConflict(probeOf("192.168.99.2"), "kaweezle.local.", ours))
+	// Other names are ignored
+	req.False(isConflict(probeOf("192.168.99.3"), "other.local.", ours))
+
+	aaaa := &dnsmessage.Message{
+		Header:  dnsmessage.Header{Response: true},
+		Answers: addressRecords("KAWEEZLE.local.", []net.IP{net.ParseIP("fd00::3")}, recordTTL, true),
+	}
+	req.True(isConflict(aaaa, "kaweezle.local.", ours))
+}
+
+func TestRenameCandidate(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	req.Equal("kaweezle-2.local", RenameCandidate("kaweezle.local", 2))
+	req.Equal("iknite-3", RenameCandidate("iknite", 3))
+}
+
+func TestResolveName(t *testing.T) {
+	t.Parallel()
+
+	taken := func(names ...string) ProbeFunc {
+		return func(_ context.Context, name string, _ []net.IP) (bool, error) {
+			for _, n := range names {
+				if n == name {
+					return true, nil
+				}
+			}
+			return false, nil
+		}
+	}
+	failing := func(context.Context, string, []net.IP) (bool, error) {
+		return false, errors.New("no multicast interface")
+	}
+
+	tests := []struct {
+		name         string
+		probeFn      ProbeFunc
+		policy       string
+		wantName     string
+		wantConflict bool
+		wantErr      bool
+	}{
+		{name: "no conflict", probeFn: taken(), wantName: "kaweezle.local"},
+		{
+			name:         "rename",
+			probeFn:      taken("kaweezle.local", "kaweezle-2.local"),
+			policy:       v1alpha1.MDNSConflictRename,
+			wantName:     "kaweezle-3.local",
+			wantConflict: true,
+		},
+		{
+			name:         "fail",
+			probeFn:      taken("kaweezle.local"),
+			policy:       v1alpha1.MDNSConflictFail,
+			wantConflict: true,
+			wantErr:      true,
+		},
+		{name: "invalid policy", probeFn: taken(), policy: "ignore", wantErr: true},
+		{name: "probe error", probeFn: failing, wantErr: true},
+		{name: "lenient probe error", probeFn: LenientProbe(failing, slog.Default()), wantName: "kaweezle.local"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			req := require.New(t)
+
+			ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+			defer cancel()
+			name, conflict, err := ResolveName(ctx, tt.probeFn, "kaweezle.local", tt.policy, nil)
+			if tt.wantErr {
+				req.Error(err)
+			} else {
+				req.NoError(err)
+			}
+			req.Equal(tt.wantName, name)
+			req.Equal(tt.wantConflict, conflict)
+		})
+	}
+}
@@ -0,0 +1,182 @@
+/*
+Copyright © 2021 Antoine Martin <antoine@openance.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Package mdns publishes the names of the cluster with multicast DNS.
+package mdns
+
+// cSpell: words pion
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/pion/mdns/v2"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// LocalSuffix is the suffix of the names resolved with mDNS.
+const LocalSuffix = ".local"
+
+// ServerFactory creates a mDNS server answering for the names of cfg.
+type ServerFactory func(cfg *mdns.Config) (io.Closer, error)
+
+// Listen creates a mDNS server listening on the default IPv4 and IPv6 mDNS addresses. The port is shared with the
+// DNS-SD advertiser.
+func Listen(cfg *mdns.Config) (*mdns.Conn, net.Addr, net.Addr, error) {
+	listenConfig := net.ListenConfig{Control: reuseAddress}
+	addr4, err := net.ResolveUDPAddr("udp", mdns.DefaultAddressIPv4)
+	if err != nil { // nocov -- should not happen on supported platforms
+		return nil, nil, nil, fmt.Errorf("cannot resolve default address: %w", err)
+	}
+
+	l4, err := listenConfig.ListenPacket(context.Background(), "udp4", addr4.String())
+	if err != nil { // nocov -- should not happen on supported platforms
+		return nil, nil, nil, fmt.Errorf("cannot listen on default address: %w", err)
+	}
+
+	addr6, err := net.ResolveUDPAddr("udp6", mdns.DefaultAddressIPv6)
+	if err != nil { // nocov -- should not happen on supported platforms
+		_ = l4.Close() //nolint:errcheck // best effort cleanup
+		return nil, nil, nil, fmt.Errorf("cannot resolve default address: %w", err)
+	}
+
+	l6, err := listenConfig.ListenPacket(context.Background(), "udp6", addr6.String())
+	if err != nil { // nocov -- should not happen on supported platforms
+		_ = l4.Close() //nolint:errcheck // best effort cleanup
+		return nil, nil, nil, fmt.Errorf("cannot listen on default address: %w", err)
+	}
+
+	conn, err := mdns.Server(ipv4.NewPacketConn(l4), ipv6.NewPacketConn(l6), cfg)
+	if err != nil {
+		_ = l4.Close() //nolint:errcheck // best effort cleanup
+		_ = l6.Close() //nolint:errcheck // best effort cleanup
+		return nil, nil, nil, fmt.Errorf("cannot create server: %w", err)
+	}
+
+	return conn, addr4, addr6, nil
+}
+
+// DefaultServerFactory creates the servers with Listen.
+func DefaultServerFactory(cfg *mdns.Config) (io.Closer, error) {
+	conn, _, _, err := Listen(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Responder answers the mDNS queries for a set of names that can change over time. The pion server cannot change
+// the names it answers for, so it is restarted each time the set changes.
+type Responder struct {
+	factory ServerFactory
+	server  io.Closer
+	names   []string
+	mu      sync.Mutex
+}
+
+// NewResponder creates a responder creating its servers with factory. The server is started by the first call to
+// SetNames.
+func NewResponder(factory ServerFactory) *Responder {
+	if factory == nil {
+		factory = DefaultServerFactory
+	}
+	return &Responder{factory: factory}
+}
+
+// NormalizeNames returns the lower case names without trailing dot, sorted and without duplicates nor empty names.
+func NormalizeNames(names ...string) []string {
+	result := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+		if name != "" {
+			result = append(result, name)
+		}
+	}
+	slices.Sort(result)
+	return slices.Compact(result)
+}
+
+// IsLocalName returns true if name can be resolved with mDNS, i.e. it is a non wildcard name ending with .local.
+func IsLocalName(name string) bool {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	return strings.HasSuffix(name, LocalSuffix) && len(name) > len(LocalSuffix) && !strings.Contains(name, "*")
+}
+
+// LocalNames returns the names that can be resolved with mDNS among names.
+func LocalNames(names ...string) []string {
+	return slices.DeleteFunc(slices.Clone(names), func(name string) bool { return !IsLocalName(name) })
+}
+
+// HostsHandler returns a callback for k8s.RouteWatcher making the responder answer for the .local hostnames of the
+// routes in addition to names.
+func (r *Responder) HostsHandler(names ...string) func(context.Context, map[string]net.IP) error {
+	return func(_ context.Context, hosts map[string]net.IP) error {
+		return r.SetNames(append(LocalNames(slices.Collect(maps.Keys(hosts))...), names...)...)
+	}
+}
+
+// SetNames makes the responder answer for names. The server is only restarted if the set of names changes.
+func (r *Responder) SetNames(names ...string) error {
+	names = NormalizeNames(names...)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.server != nil && slices.Equal(names, r.names) {
+		return nil
+	}
+	if err := r.closeServer(); err != nil {
+		return err
+	}
+	server, err := r.factory(&mdns.Config{LocalNames: names})
+	if err != nil {
+		return fmt.Errorf("while starting the mDNS server for %v: %w", names, err)
+	}
+	r.server = server
+	r.names = names
+	return nil
+}
+
+// Names returns the names the responder answers for.
+func (r *Responder) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.names)
+}
+
+func (r *Responder) closeServer() error {
+	if r.server == nil {
+		return nil
+	}
+	server := r.server
+	r.server = nil
+	r.names = nil
+	if err := server.Close(); err != nil {
+		return fmt.Errorf("while stopping the mDNS server: %w", err)
+	}
+	return nil
+}
+
+// Close stops the server of the responder.
+func (r *Responder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closeServer()
+}
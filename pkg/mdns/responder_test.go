@@ -0,0 +1,80 @@
+package mdns_test
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/pion/mdns/v2"
+	"github.com/stretchr/testify/require"
+
+	ikniteMdns "github.com/kaweezle/iknite/pkg/mdns"
+)
+
+type fakeServer struct {
+	closed bool
+}
+
+func (s *fakeServer) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestResponder(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	var servers []*fakeServer
+	var configs []*mdns.Config
+	responder := ikniteMdns.NewResponder(func(cfg *mdns.Config) (io.Closer, error) {
+		server := &fakeServer{}
+		servers = append(servers, server)
+		configs = append(configs, cfg)
+		return server, nil
+	})
+
+	req.NoError(responder.SetNames("iknite.local"))
+	req.Len(servers, 1)
+	req.Equal([]string{"iknite.local"}, configs[0].LocalNames)
+
+	// Same names, no restart
+	req.NoError(responder.SetNames("Iknite.local.", "iknite.local", ""))
+	req.Len(servers, 1)
+
+	handler := responder.HostsHandler("iknite.local")
+	req.NoError(handler(t.Context(), map[string]net.IP{
+		"myapp.local":      net.ParseIP("192.168.99.16"),
+		"myapp.iknite.dev": net.ParseIP("192.168.99.16"),
+	}))
+	req.Len(servers, 2)
+	req.True(servers[0].closed)
+	req.Equal([]string{"iknite.local", "myapp.local"}, responder.Names())
+
+	req.NoError(responder.Close())
+	req.True(servers[1].closed)
+	req.Empty(responder.Names())
+}
+
+func TestResponder_FactoryError(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	responder := ikniteMdns.NewResponder(func(*mdns.Config) (io.Closer, error) {
+		return nil, errors.New("address in use")
+	})
+	req.ErrorContains(responder.SetNames("iknite.local"), "address in use")
+	req.NoError(responder.Close())
+}
+
+func TestIsLocalName(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	req.True(ikniteMdns.IsLocalName("myapp.local"))
+	req.True(ikniteMdns.IsLocalName("MyApp.Local."))
+	req.False(ikniteMdns.IsLocalName(".local"))
+	req.False(ikniteMdns.IsLocalName("*.local"))
+	req.False(ikniteMdns.IsLocalName("myapp.localhost"))
+	req.Equal([]string{"a.local"}, ikniteMdns.LocalNames("a.local", "b.dev"))
+}
@@ -0,0 +1,426 @@
+/*
+Copyright © 2021 Antoine Martin <antoine@openance.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Package notify sends the lifecycle events of the cluster to webhooks and local commands.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	ikniteApi "github.com/kaweezle/iknite/pkg/apis/iknite"
+	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
+	"github.com/kaweezle/iknite/pkg/host"
+	"github.com/kaweezle/iknite/pkg/utils"
+)
+
+const (
+	// EventState is sent when the state of the cluster changes.
+	EventState = "state"
+	// EventWorkloads is sent when the set of unready workloads changes.
+	EventWorkloads = "workloads"
+
+	defaultRetries              = 3
+	defaultRetryIntervalSeconds = 5
+	defaultMinIntervalSeconds   = 1
+	defaultTimeoutSeconds       = 10
+
+	// maxPendingEvents is the number of events a notifier keeps while it is rate limited or retrying.
+	maxPendingEvents = 32
+	// flushTimeout is the time given to the notifiers to send their pending events when they are stopped.
+	flushTimeout = 10 * time.Second
+)
+
+// EventTypes are the types of events sent by the notifiers.
+var EventTypes = []string{EventState, EventWorkloads}
+
+// Event is the JSON payload sent to the notifiers.
+type Event struct {
+	Time          time.Time              `json:"time"`
+	Type          string                 `json:"type"`
+	Cluster       string                 `json:"cluster"`
+	Domain        string                 `json:"domain,omitempty"`
+	Phase         string                 `json:"phase"`
+	Unready       []string               `json:"unready"`
+	State         ikniteApi.ClusterState `json:"state"`
+	PreviousState ikniteApi.ClusterState `json:"previousState"`
+	ReadyCount    int                    `json:"readyCount"`
+	UnreadyCount  int                    `json:"unreadyCount"`
+}
+
+// NormalizeNotifier returns config with its defaults and validates it.
+func NormalizeNotifier(config v1alpha1.NotifierConfig) (v1alpha1.NotifierConfig, error) {
+	switch {
+	case config.URL != "" && len(config.Command) > 0:
+		return config, fmt.Errorf("notifier %q has both a URL and a command", config.Name)
+	case config.URL != "":
+		u, err := url.Parse(config.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return config, fmt.Errorf("invalid URL %q for notifier %q", config.URL, config.Name)
+		}
+		if config.Name == "" {
+			config.Name = config.URL
+		}
+	case len(config.Command) > 0:
+		if config.Name == "" {
+			config.Name = strings.Join(config.Command, " ")
+		}
+	default:
+		return config, fmt.Errorf("notifier %q has neither a URL nor a command", config.Name)
+	}
+
+	for _, event := range config.Events {
+		if !slices.Contains(EventTypes, event) {
+			return config, fmt.Errorf("unknown event %q for notifier %s", event, config.Name)
+		}
+	}
+	if len(config.Events) == 0 {
+		config.Events = slices.Clone(EventTypes)
+	}
+	switch {
+	case config.Retries == nil:
+		retries := defaultRetries
+		config.Retries = &retries
+	case *config.Retries < 0:
+		return config, fmt.Errorf("invalid retries %d for notifier %s", *config.Retries, config.Name)
+	}
+	if config.RetryIntervalSeconds <= 0 {
+		config.RetryIntervalSeconds = defaultRetryIntervalSeconds
+	}
+	if config.MinIntervalSeconds <= 0 {
+		config.MinIntervalSeconds = defaultMinIntervalSeconds
+	}
+	if config.TimeoutSeconds <= 0 {
+		config.TimeoutSeconds = defaultTimeoutSeconds
+	}
+	return config, nil
+}
+
+// NormalizeNotifiers normalizes configs and checks that their names are unique.
+func NormalizeNotifiers(configs []v1alpha1.NotifierConfig) ([]v1alpha1.NotifierConfig, error) {
+	result := make([]v1alpha1.NotifierConfig, 0, len(configs))
+	seen := make(map[string]struct{}, len(configs))
+	for _, config := range configs {
+		normalized, err := NormalizeNotifier(config)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := seen[normalized.Name]; ok {
+			return nil, fmt.Errorf("duplicate notifier %s", normalized.Name)
+		}
+		seen[normalized.Name] = struct{}{}
+		result = append(result, normalized)
+	}
+	return result, nil
+}
+
+// notifier sends the events it receives one after the other, retrying the failed ones.
+type notifier struct {
+	config v1alpha1.NotifierConfig
+	events chan *Event
+	done   chan struct{}
+	cancel context.CancelFunc
+}
+
+// accepts returns true if the notifier sends the events of type eventType.
+func (n *notifier) accepts(eventType string) bool {
+	return slices.Contains(n.config.Events, eventType)
+}
+
+// stop lets the notifier send its pending events for at most timeout and waits for it to end.
+func (n *notifier) stop(timeout time.Duration) {
+	close(n.events)
+	select {
+	case <-n.done:
+	case <-time.After(timeout):
+		n.cancel()
+		<-n.done
+	}
+	n.cancel()
+}
+
+// Manager sends the lifecycle events of the cluster to a set of notifiers. Each notifier sends its events in order,
+// at most once every MinIntervalSeconds, and retries the failed ones.
+type Manager struct {
+	utils.LogEnabled
+	executor  host.Executor
+	client    *http.Client
+	notifiers map[string]*notifier
+	desired   []v1alpha1.NotifierConfig
+	unready   []string
+	state     ikniteApi.ClusterState
+	second    time.Duration
+	seen      bool
+	closed    bool
+	mu        sync.Mutex
+}
+
+// NewManager creates a manager running the notifier commands with executor.
+func NewManager(executor host.Executor, logger *slog.Logger) *Manager {
+	return &Manager{
+		LogEnabled: utils.LogEnabled{LogEntry: logger},
+		executor:   executor,
+		client:     &http.Client{},
+		notifiers:  map[string]*notifier{},
+		second:     time.Second,
+	}
+}
+
+// Apply makes the manager send the events to the notifiers of configs. The unchanged notifiers keep their pending
+// events. Applying the same configuration again does nothing.
+func (m *Manager) Apply(configs []v1alpha1.NotifierConfig) error {
+	configs, err := NormalizeNotifiers(configs)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	if m.closed || (m.desired != nil && reflect.DeepEqual(configs, m.desired)) {
+		m.mu.Unlock()
+		return nil
+	}
+	var stopped []*notifier
+	wanted := make(map[string]v1alpha1.NotifierConfig, len(configs))
+	for _, config := range configs {
+		wanted[config.Name] = config
+	}
+	for name, n := range m.notifiers {
+		if config, ok := wanted[name]; !ok || !reflect.DeepEqual(config, n.config) {
+			stopped = append(stopped, n)
+			delete(m.notifiers, name)
+		}
+	}
+	for _, config := range configs {
+		if _, ok := m.notifiers[config.Name]; !ok {
+			m.notifiers[config.Name] = m.start(config)
+		}
+	}
+	m.desired = configs
+	m.mu.Unlock()
+
+	for _, n := range stopped {
+		n.stop(flushTimeout)
+	}
+	return nil
+}
+
+// start starts the notifier of config.
+func (m *Manager) start(config v1alpha1.NotifierConfig) *notifier {
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &notifier{
+		config: config,
+		events: make(chan *Event, maxPendingEvents),
+		done:   make(chan struct{}),
+		cancel: cancel,
+	}
+	go m.run(ctx, n)
+	return n
+}
+
+// run sends the events of n until its events channel is closed or ctx is done.
+func (m *Manager) run(ctx context.Context, n *notifier) {
+	defer close(n.done)
+	logger := m.Logger().With("notifier", n.config.Name)
+	minInterval := time.Duration(n.config.MinIntervalSeconds) * m.second
+	var last time.Time
+	for event := range n.events {
+		if wait := time.Until(last.Add(minInterval)); wait > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+		}
+		last = time.Now()
+		if err := m.deliver(ctx, n.config, event); err != nil {
+			logger.Warn("Failed to send the notification", "event", event.Type, "state", event.State.String(),
+				utils.ErrorKey, err)
+			continue
+		}
+		logger.Debug("Notification sent", "event", event.Type, "state", event.State.String())
+	}
+}
+
+// deliver sends event with the notifier of config, retrying with an exponential backoff.
+func (m *Manager) deliver(ctx context.Context, config v1alpha1.NotifierConfig, event *Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil { // nocov -- events are always serializable
+		return fmt.Errorf("while serializing the event: %w", err)
+	}
+	interval := time.Duration(config.RetryIntervalSeconds) * m.second
+	for attempt := 1; ; attempt++ {
+		err = m.send(ctx, config, event, payload)
+		if err == nil {
+			return nil
+		}
+		if attempt > *config.Retries {
+			return fmt.Errorf("after %d attempts: %w", attempt, err)
+		}
+		m.Logger().Debug("Notification failed, retrying", "notifier", config.Name, "attempt", attempt,
+			"interval", interval, utils.ErrorKey, err)
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(interval):
+		}
+		interval *= 2
+	}
+}
+
+// send makes a single attempt to send event with the notifier of config.
+func (m *Manager) send(ctx context.Context, config v1alpha1.NotifierConfig, event *Event, payload []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(config.TimeoutSeconds)*m.second)
+	defer cancel()
+
+	if config.URL != "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.URL, bytes.NewReader(payload))
+		if err != nil {
+			return fmt.Errorf("while creating the request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		for key, value := range config.Headers {
+			req.Header.Set(key, value)
+		}
+		resp, err := m.client.Do(req)
+		if err != nil {
+			return fmt.Errorf("while posting the event: %w", err)
+		}
+		defer resp.Body.Close()                                      //nolint:errcheck // read only
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16)) //nolint:errcheck // drain for reuse
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("webhook answered with status %s", resp.Status)
+		}
+		return nil
+	}
+
+	var output bytes.Buffer
+	err := m.executor.RunCommand(ctx, &host.CommandOptions{
+		Cmd:   config.Command[0],
+		Args:  config.Command[1:],
+		Stdin: bytes.NewReader(payload),
+		Env: append(os.Environ(),
+			"IKNITE_EVENT="+event.Type,
+			"IKNITE_STATE="+event.State.String(),
+			"IKNITE_PREVIOUS_STATE="+event.PreviousState.String(),
+			"IKNITE_PHASE="+event.Phase,
+			"IKNITE_CLUSTER="+event.Cluster,
+		),
+		Stdout: &output,
+		Stderr: &output,
+	})
+	if err != nil {
+		return fmt.Errorf("command %s failed: %w: %s", config.Command[0], err, strings.TrimSpace(output.String()))
+	}
+	return nil
+}
+
+// unreadyNames returns the sorted namespace/name of the unready workloads of cluster.
+func unreadyNames(cluster *v1alpha1.IkniteCluster) []string {
+	names := make([]string, 0, len(cluster.Status.WorkloadsState.Unready))
+	for _, state := range cluster.Status.WorkloadsState.Unready {
+		names = append(names, state.Namespace+"/"+state.Name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Notify sends the events of the change of the cluster since the previous call to the notifiers. The first call only
+// records the cluster. The updates without workloads, like the ones of the phases, do not change the unready
+// workloads.
+func (m *Manager) Notify(cluster *v1alpha1.IkniteCluster) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return
+	}
+
+	newEvent := func(eventType string) *Event {
+		return &Event{
+			Time:          time.Now().UTC(),
+			Type:          eventType,
+			Cluster:       cluster.Spec.ClusterName,
+			Domain:        cluster.Spec.DomainName,
+			Phase:         cluster.Status.CurrentPhase,
+			State:         cluster.Status.State,
+			PreviousState: m.state,
+			Unready:       unreadyNames(cluster),
+			ReadyCount:    cluster.Status.WorkloadsState.ReadyCount,
+			UnreadyCount:  cluster.Status.WorkloadsState.UnreadyCount,
+		}
+	}
+	var events []*Event
+	if m.seen && cluster.Status.State != m.state {
+		events = append(events, newEvent(EventState))
+	}
+	if cluster.Status.WorkloadsState.Count > 0 {
+		unready := unreadyNames(cluster)
+		if m.unready != nil && !slices.Equal(unready, m.unready) {
+			events = append(events, newEvent(EventWorkloads))
+		}
+		m.unready = unready
+	}
+	m.state = cluster.Status.State
+	m.seen = true
+
+	for _, event := range events {
+		for _, n := range m.notifiers {
+			if !n.accepts(event.Type) {
+				continue
+			}
+			select {
+			case n.events <- event:
+			default:
+				m.Logger().Warn("Too many pending notifications, dropping the event", "notifier", n.config.Name,
+					"event", event.Type, "state", event.State.String())
+			}
+		}
+	}
+}
+
+// Close stops the notifiers after giving them some time to send their pending events.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil
+	}
+	m.closed = true
+	notifiers := make([]*notifier, 0, len(m.notifiers))
+	for _, n := range m.notifiers {
+		notifiers = append(notifiers, n)
+	}
+	m.notifiers = map[string]*notifier{}
+	m.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, n := range notifiers {
+		wg.Go(func() { n.stop(flushTimeout) })
+	}
+	wg.Wait()
+	return nil
+}
@@ -0,0 +1,294 @@
+// cSpell: words testutil httptest
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	ikniteApi "github.com/kaweezle/iknite/pkg/apis/iknite"
+	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
+	"github.com/kaweezle/iknite/pkg/constants"
+	"github.com/kaweezle/iknite/pkg/host"
+	"github.com/kaweezle/iknite/pkg/testutil"
+)
+
+// webhook records the events posted to it. The first failures requests are answered with an error.
+type webhook struct {
+	server   *httptest.Server
+	events   []*Event
+	times    []time.Time
+	headers  []http.Header
+	failures int32
+	requests atomic.Int32
+	mu       sync.Mutex
+}
+
+func newWebhook(t *testing.T, failures int32) *webhook {
+	t.Helper()
+	w := &webhook{failures: failures}
+	w.server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if w.requests.Add(1) <= w.failures {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var event Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		w.events = append(w.events, &event)
+		w.times = append(w.times, time.Now())
+		w.headers = append(w.headers, r.Header.Clone())
+	}))
+	t.Cleanup(w.server.Close)
+	return w
+}
+
+func (w *webhook) received() []*Event {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]*Event{}, w.events...)
+}
+
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	m := NewManager(host.NewDefaultExecutor(), testutil.TestLogger(t))
+	m.second = 10 * time.Millisecond
+	t.Cleanup(func() { require.NoError(t, m.Close()) })
+	return m
+}
+
+func testCluster(state ikniteApi.ClusterState, phase string, unready ...string) *v1alpha1.IkniteCluster {
+	cluster := v1alpha1.NewDefaultIkniteCluster()
+	var unreadyStates []*v1alpha1.WorkloadState
+	for _, name := range unready {
+		unreadyStates = append(unreadyStates, &v1alpha1.WorkloadState{Namespace: "default", Name: name})
+	}
+	ready := []*v1alpha1.WorkloadState{{Namespace: "kube-system", Name: "deployments/coredns", Ok: true}}
+	cluster.Update(state, phase, ready, unreadyStates)
+	return cluster
+}
+
+func TestNormalizeNotifiers(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		wantErr string
+		configs []v1alpha1.NotifierConfig
+		want    []v1alpha1.NotifierConfig
+	}{
+		{
+			name: "defaults",
+			configs: []v1alpha1.NotifierConfig{
+				{URL: "https://hooks.example.com/iknite"},
+				{Command: []string{"logger", "-t", "iknite"}},
+			},
+			want: []v1alpha1.NotifierConfig{
+				{
+					Name: "https://hooks.example.com/iknite", URL: "https://hooks.example.com/iknite",
+					Events: EventTypes, Retries: new(3), RetryIntervalSeconds: 5, MinIntervalSeconds: 1, TimeoutSeconds: 10,
+				},
+				{
+					Name: "logger -t iknite", Command: []string{"logger", "-t", "iknite"},
+					Events: EventTypes, Retries: new(3), RetryIntervalSeconds: 5, MinIntervalSeconds: 1, TimeoutSeconds: 10,
+				},
+			},
+		},
+		{
+			name: "explicit values",
+			configs: []v1alpha1.NotifierConfig{{
+				Name: "chat", URL: "http://chat:8080/hook", Events: []string{EventState}, Retries: new(0),
+				RetryIntervalSeconds: 2, MinIntervalSeconds: 30, TimeoutSeconds: 3,
+			}},
+			want: []v1alpha1.NotifierConfig{{
+				Name: "chat", URL: "http://chat:8080/hook", Events: []string{EventState}, Retries: new(0),
+				RetryIntervalSeconds: 2, MinIntervalSeconds: 30, TimeoutSeconds: 3,
+			}},
+		},
+		{
+			name:    "no target",
+			configs: []v1alpha1.NotifierConfig{{Name: "empty"}},
+			wantErr: `notifier "empty" has neither a URL nor a command`,
+		},
+		{
+			name:    "both targets",
+			configs: []v1alpha1.NotifierConfig{{URL: "https://example.com", Command: []string{"true"}}},
+			wantErr: "has both a URL and a command",
+		},
+		{
+			name:    "invalid URL",
+			configs: []v1alpha1.NotifierConfig{{URL: "ftp://example.com"}},
+			wantErr: `invalid URL "ftp://example.com"`,
+		},
+		{
+			name:    "unknown event",
+			configs: []v1alpha1.NotifierConfig{{Command: []string{"true"}, Events: []string{"phase"}}},
+			wantErr: `unknown event "phase" for notifier true`,
+		},
+		{
+			name:    "negative retries",
+			configs: []v1alpha1.NotifierConfig{{Command: []string{"true"}, Retries: new(-1)}},
+			wantErr: "invalid retries -1 for notifier true",
+		},
+		{
+			name:    "duplicate",
+			configs: []v1alpha1.NotifierConfig{{Command: []string{"true"}}, {Command: []string{"true"}}},
+			wantErr: "duplicate notifier true",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			req := require.New(t)
+			got, err := NormalizeNotifiers(tt.configs)
+			if tt.wantErr != "" {
+				req.ErrorContains(err, tt.wantErr)
+				return
+			}
+			req.NoError(err)
+			req.Equal(tt.want, got)
+		})
+	}
+}
+
+func TestManager_Events(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	hook := newWebhook(t, 0)
+	m := newTestManager(t)
+	req.NoError(m.Apply([]v1alpha1.NotifierConfig{{
+		URL: hook.server.URL, Headers: map[string]string{"Authorization": "Bearer token"}, MinIntervalSeconds: 5,
+	}}))
+
+	// The first cluster is the reference
+	m.Notify(testCluster(ikniteApi.Stabilizing, "workloads", "deployments/web"))
+	// The updates of the phases do not change the workloads
+	phaseUpdate := v1alpha1.NewDefaultIkniteCluster()
+	phaseUpdate.Update(ikniteApi.Stabilizing, "publish-hosts", nil, nil)
+	m.Notify(phaseUpdate)
+	m.Notify(testCluster(ikniteApi.Stabilizing, "daemonize"))
+	m.Notify(testCluster(ikniteApi.Running, "daemonize"))
+	m.Notify(testCluster(ikniteApi.Running, "daemonize", "deployments/web", "deployments/api"))
+	m.Notify(testCluster(ikniteApi.Failed, "daemonize", "deployments/web", "deployments/api"))
+
+	req.Eventually(func() bool { return len(hook.received()) == 4 }, 5*time.Second, 10*time.Millisecond)
+	events := hook.received()
+	req.Equal(EventWorkloads, events[0].Type)
+	req.Equal(ikniteApi.Stabilizing, events[0].State)
+	req.Empty(events[0].Unready)
+
+	req.Equal(EventState, events[1].Type)
+	req.Equal(ikniteApi.Stabilizing, events[1].PreviousState)
+	req.Equal(ikniteApi.Running, events[1].State)
+	req.Equal("daemonize", events[1].Phase)
+	req.Equal(constants.DefaultClusterName, events[1].Cluster)
+
+	req.Equal(EventWorkloads, events[2].Type)
+	req.Equal(ikniteApi.Running, events[2].State)
+	req.Equal([]string{"default/deployments/api", "default/deployments/web"}, events[2].Unready)
+	req.Equal(2, events[2].UnreadyCount)
+	req.Equal(1, events[2].ReadyCount)
+
+	req.Equal(EventState, events[3].Type)
+	req.Equal(ikniteApi.Failed, events[3].State)
+	req.Equal(ikniteApi.Running, events[3].PreviousState)
+
+	hook.mu.Lock()
+	defer hook.mu.Unlock()
+	req.Equal("Bearer token", hook.headers[0].Get("Authorization"))
+	req.Equal("application/json", hook.headers[0].Get("Content-Type"))
+	// The notifications are rate limited to one every 50ms
+	for i := 1; i < len(hook.times); i++ {
+		req.GreaterOrEqual(hook.times[i].Sub(hook.times[i-1]), 40*time.Millisecond)
+	}
+}
+
+func TestManager_Retries(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	hook := newWebhook(t, 2)
+	failing := newWebhook(t, 100)
+	m := newTestManager(t)
+	req.NoError(m.Apply([]v1alpha1.NotifierConfig{
+		{Name: "flaky", URL: hook.server.URL, RetryIntervalSeconds: 1},
+		{Name: "down", URL: failing.server.URL, RetryIntervalSeconds: 1, Retries: new(1)},
+		{Name: "workloads", URL: failing.server.URL, Events: []string{EventWorkloads}},
+	}))
+
+	m.Notify(testCluster(ikniteApi.Stabilizing, "workloads"))
+	m.Notify(testCluster(ikniteApi.Running, "daemonize"))
+
+	req.Eventually(func() bool { return len(hook.received()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	req.Equal(int32(3), hook.requests.Load())
+	req.Equal(ikniteApi.Running, hook.received()[0].State)
+	// The failing notifier gives up after its retries, the workloads one does not receive the state events
+	req.Eventually(func() bool { return failing.requests.Load() == 2 }, 5*time.Second, 10*time.Millisecond)
+	req.Never(func() bool { return failing.requests.Load() > 2 }, 200*time.Millisecond, 10*time.Millisecond)
+}
+
+func TestManager_Command(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	output := filepath.Join(t.TempDir(), "event.json")
+	m := newTestManager(t)
+	req.NoError(m.Apply([]v1alpha1.NotifierConfig{{
+		Command: []string{
+			"/bin/sh", "-c", `cat > "$0" && echo "$IKNITE_EVENT $IKNITE_PREVIOUS_STATE $IKNITE_STATE" >> "$0"`, output,
+		},
+	}}))
+
+	m.Notify(testCluster(ikniteApi.Initializing, "kubelet-start"))
+	m.Notify(testCluster(ikniteApi.Failed, "kubelet-start"))
+	// Closing the manager sends the pending events
+	req.NoError(m.Close())
+
+	content, err := os.ReadFile(output)
+	req.NoError(err)
+	var event Event
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	req.NoError(decoder.Decode(&event))
+	req.Equal(ikniteApi.Failed, event.State)
+	req.Contains(string(content), "state Initializing Failed\n")
+
+	// A closed manager ignores the updates
+	m.Notify(testCluster(ikniteApi.Running, "daemonize"))
+	req.NoError(m.Apply(nil))
+}
+
+func TestManager_Apply(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	first := newWebhook(t, 0)
+	second := newWebhook(t, 0)
+	m := newTestManager(t)
+	req.NoError(m.Apply([]v1alpha1.NotifierConfig{{Name: "hook", URL: first.server.URL}}))
+	req.NoError(m.Apply([]v1alpha1.NotifierConfig{{Name: "hook", URL: first.server.URL}}))
+	req.ErrorContains(m.Apply([]v1alpha1.NotifierConfig{{Name: "hook"}}), "neither a URL nor a command")
+
+	m.Notify(testCluster(ikniteApi.Stabilizing, "workloads"))
+	m.Notify(testCluster(ikniteApi.Running, "daemonize"))
+	req.Eventually(func() bool { return len(first.received()) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// The changed notifiers are replaced
+	req.NoError(m.Apply([]v1alpha1.NotifierConfig{{Name: "hook", URL: second.server.URL}}))
+	m.Notify(testCluster(ikniteApi.Stopping, "stop"))
+	req.Eventually(func() bool { return len(second.received()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	req.Len(first.received(), 1)
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package provision
 
 import (
+	"context"
 	"embed"
 	"fmt"
 	"log/slog"
@@ -26,6 +27,7 @@ import (
 	"sigs.k8s.io/kustomize/api/resmap"
 	"sigs.k8s.io/kustomize/kyaml/filesys"
 
+	"github.com/kaweezle/iknite/pkg/constants"
 	"github.com/kaweezle/iknite/pkg/host"
 	"github.com/kaweezle/iknite/pkg/kustomize"
 )
@@ -45,8 +47,22 @@ func createTempKustomizeDirectory(
 	if err != nil {
 		return fmt.Errorf("while reading files of %s: %w", inDir, err)
 	}
+	if err = fs.MkdirAll(outDir); err != nil {
+		return fmt.Errorf("while creating directory %s: %w", outDir, err)
+	}
 	for _, entry := range files {
 		if entry.IsDir() {
+			// Vendored resources are stored in sub directories
+			err = createTempKustomizeDirectory(
+				content,
+				fs,
+				fmt.Sprintf("%s/%s", outDir, entry.Name()),
+				fmt.Sprintf("%s/%s", inDir, entry.Name()),
+				logger,
+			)
+			if err != nil {
+				return err
+			}
 			continue
 		}
 
@@ -84,17 +100,26 @@ func isBaseKustomizationAvailable(fs host.FileSystem, dirname string) (bool, err
 	return exists, nil
 }
 
-// GetBaseKustomizationResources applies the kustomizations located in the specified
-// directory if available, otherwise returns the embedded kustomizations.
-func GetBaseKustomizationResources(
+// kustomizationFileSystem returns the file system and the directory containing the kustomization to apply. If the
+// kustomization is not available in dirname or if forceEmbedded is true, the embedded kustomization is returned. OCI
+// and git sources are fetched into the cache directory.
+func kustomizationFileSystem(
 	fs host.FileSystem,
 	dirname string,
 	forceEmbedded bool,
 	logger *slog.Logger,
-) (resmap.ResMap, error) {
+) (filesys.FileSystem, string, error) {
 	ok, err := isBaseKustomizationAvailable(fs, dirname)
 	if err != nil {
-		return nil, fmt.Errorf("while checking for base kustomization: %w", err)
+		return nil, "", fmt.Errorf("while checking for base kustomization: %w", err)
+	}
+	if ok && !forceEmbedded && IsSource(dirname) {
+		ctx, cancel := context.WithTimeout(context.Background(), sourceFetchTimeout)
+		defer cancel()
+		dirname, err = FetchSource(ctx, fs, dirname, constants.KustomizationCacheDir, logger)
+		if err != nil {
+			return nil, "", fmt.Errorf("while fetching kustomization source: %w", err)
+		}
 	}
 	kustomizeFs := host.NewKustomizeFSWrapper(fs)
 	if !ok || forceEmbedded {
@@ -104,10 +129,44 @@ func GetBaseKustomizationResources(
 		dirname = "base"
 		err = createTempKustomizeDirectory(&content, kustomizeFs, dirname, dirname, logger)
 		if err != nil {
-			return nil, fmt.Errorf("while creating temporary kustomization directory: %w", err)
+			return nil, "", fmt.Errorf("while creating temporary kustomization directory: %w", err)
 		}
 	} else {
 		logger.Debug("Base kustomization found, applying it...", "directory", dirname)
 	}
-	return kustomize.BuildOnFileSystem(kustomizeFs, dirname) //nolint:wrapcheck // No need to wrap here.
+	return kustomizeFs, dirname, nil
+}
+
+// GetBaseKustomizationResources applies the kustomizations located in the specified
+// directory if available, otherwise returns the embedded kustomizations. If substitute
+// is not nil, the ${VAR} placeholders of the resources are replaced.
+func GetBaseKustomizationResources(
+	fs host.FileSystem,
+	dirname string,
+	forceEmbedded bool,
+	substitute *SubstituteOptions,
+	logger *slog.Logger,
+) (resmap.ResMap, error) {
+	kustomizeFs, dirname, err := kustomizationFileSystem(fs, dirname, forceEmbedded, logger)
+	if err != nil {
+		return nil, err
+	}
+	if err = verifyVendorLock(kustomizeFs, dirname); err != nil {
+		return nil, err
+	}
+	resources, err := kustomize.BuildOnFileSystem(kustomizeFs, dirname)
+	if err != nil {
+		return nil, err //nolint:wrapcheck // No need to wrap here.
+	}
+	if substitute != nil {
+		if err = SubstituteResources(resources, substitute); err != nil {
+			return nil, err
+		}
+	}
+	return resources, nil
+}
+
+// WriteEmbeddedKustomization writes the embedded kustomization into dirname.
+func WriteEmbeddedKustomization(fs host.FileSystem, dirname string, logger *slog.Logger) error {
+	return createTempKustomizeDirectory(&content, host.NewKustomizeFSWrapper(fs), dirname, "base", logger)
 }
@@ -124,7 +124,7 @@ func TestGetBaseKustomizationResources(t *testing.T) {
 
 			fs := host.NewMemMapFS()
 			logger := testutil.TestLogger(t)
-			resources, err := GetBaseKustomizationResources(fs, tt.prepare(req, fs), tt.forceEmbedded, logger)
+			resources, err := GetBaseKustomizationResources(fs, tt.prepare(req, fs), tt.forceEmbedded, nil, logger)
 			req.NoError(err)
 			req.NotNil(resources)
 			req.Positive(resources.Size())
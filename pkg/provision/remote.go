@@ -0,0 +1,130 @@
+/*
+Copyright © 2021 Antoine Martin <antoine@openance.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// cSpell: words filesys konfig
+package provision
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/kustomize/api/konfig"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+
+	"github.com/kaweezle/iknite/pkg/constants"
+	"github.com/kaweezle/iknite/pkg/host"
+)
+
+// remoteHostPrefixes are the host shorthands that kustomize resolves as remote git repositories.
+var remoteHostPrefixes = []string{"git@", "github.com/", "gitlab.com/", "bitbucket.org/"}
+
+// IsRemoteResource returns true if the kustomization entry needs network access to be fetched.
+func IsRemoteResource(entry string) bool {
+	u, err := url.Parse(entry)
+	if err == nil && u.Scheme != "" && u.Host != "" {
+		return true
+	}
+	return slices.ContainsFunc(remoteHostPrefixes, func(prefix string) bool {
+		return strings.HasPrefix(entry, prefix)
+	})
+}
+
+// FindRemoteResources returns the remote resources referenced by the kustomization located in dirname, or by the
+// embedded kustomization if it is not available or if forceEmbedded is true. Local directories referenced by the
+// kustomization are inspected recursively. Each returned entry has the form "<kustomization file>: <resource>". An
+// OCI or git source is returned as is unless it is pinned and already in the cache, in which case its cached
+// kustomization is inspected.
+func FindRemoteResources(
+	fs host.FileSystem,
+	dirname string,
+	forceEmbedded bool,
+	logger *slog.Logger,
+) ([]string, error) {
+	if !forceEmbedded && IsSource(dirname) {
+		// Pinned sources already in the cache are used without network access
+		cached, err := CachedSource(fs, dirname, constants.KustomizationCacheDir)
+		if err != nil {
+			return nil, err
+		}
+		if cached == "" {
+			return []string{dirname}, nil
+		}
+		dirname = cached
+	} else if !forceEmbedded && IsRemoteResource(dirname) {
+		return []string{dirname}, nil
+	}
+	kustomizeFs, dirname, err := kustomizationFileSystem(fs, dirname, forceEmbedded, logger)
+	if err != nil {
+		return nil, err
+	}
+	return findRemoteResources(kustomizeFs, dirname, map[string]bool{})
+}
+
+// findKustomizationFile returns the path of the kustomization file in dirname or an empty string if there is none.
+func findKustomizationFile(fs filesys.FileSystem, dirname string) string {
+	for _, name := range konfig.RecognizedKustomizationFileNames() {
+		candidate := filepath.Join(dirname, name)
+		if fs.Exists(candidate) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+func findRemoteResources(fs filesys.FileSystem, dirname string, visited map[string]bool) ([]string, error) {
+	if visited[dirname] {
+		return nil, nil
+	}
+	visited[dirname] = true
+
+	kustomizationPath := findKustomizationFile(fs, dirname)
+	if kustomizationPath == "" {
+		return nil, nil
+	}
+
+	content, err := fs.ReadFile(kustomizationPath)
+	if err != nil {
+		return nil, fmt.Errorf("while reading %s: %w", kustomizationPath, err)
+	}
+	kustomization := &types.Kustomization{}
+	if err = kustomization.Unmarshal(content); err != nil {
+		return nil, fmt.Errorf("while parsing %s: %w", kustomizationPath, err)
+	}
+	kustomization.FixKustomization()
+
+	result := []string{}
+	entries := slices.Concat(kustomization.Resources, kustomization.Components, kustomization.Crds)
+	for _, entry := range entries {
+		if IsRemoteResource(entry) {
+			result = append(result, fmt.Sprintf("%s: %s", kustomizationPath, entry))
+			continue
+		}
+		local := filepath.Join(dirname, entry)
+		if !fs.IsDir(local) {
+			continue
+		}
+		remote, err := findRemoteResources(fs, local, visited)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, remote...)
+	}
+	return result, nil
+}
@@ -0,0 +1,137 @@
+// cSpell: words testutil
+package provision
+
+import (
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kaweezle/iknite/pkg/constants"
+	"github.com/kaweezle/iknite/pkg/host"
+	"github.com/kaweezle/iknite/pkg/testutil"
+)
+
+func TestIsRemoteResource(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	req.True(IsRemoteResource("https://github.com/kubernetes-sigs/metrics-server/releases/latest/download/x.yaml"))
+	req.True(IsRemoteResource("http://example.com/x.yaml"))
+	req.True(IsRemoteResource("github.com/kaweezle/iknite//deploy?ref=main"))
+	req.True(IsRemoteResource("git@github.com:kaweezle/iknite.git"))
+	req.False(IsRemoteResource("./coredns.yaml"))
+	req.False(IsRemoteResource("../base"))
+}
+
+func TestFindRemoteResources(t *testing.T) {
+	t.Parallel()
+	const pinnedCommit = "0123456789abcdef0123456789abcdef01234567"
+
+	writeFile := func(req *require.Assertions, fs host.FileSystem, path, content string) {
+		req.NoError(fs.MkdirAll(filepath.Dir(path), 0o755))
+		req.NoError(fs.WriteFile(path, []byte(content), 0o600))
+	}
+
+	tests := []struct {
+		prepare       func(req *require.Assertions, fs host.FileSystem) string
+		name          string
+		want          []string
+		forceEmbedded bool
+		wantErr       bool
+	}{
+		{
+			name:          "embedded kustomization",
+			forceEmbedded: true,
+			prepare: func(_ *require.Assertions, _ host.FileSystem) string {
+				return "/etc/iknite.d"
+			},
+			want: []string{
+				"base/kustomization.yaml: " +
+					"https://raw.githubusercontent.com/rancher/local-path-provisioner/v0.0.35/deploy/local-path-storage.yaml",
+				"base/kustomization.yaml: " +
+					"https://github.com/kubernetes-sigs/metrics-server/releases/latest/download/components.yaml",
+				"base/kustomization.yaml: " +
+					"https://github.com/kubernetes-sigs/gateway-api/releases/download/v1.5.1/standard-install.yaml",
+			},
+		},
+		{
+			name: "remote kustomization location",
+			prepare: func(_ *require.Assertions, _ host.FileSystem) string {
+				return "https://github.com/kaweezle/iknite-config"
+			},
+			want: []string{"https://github.com/kaweezle/iknite-config"},
+		},
+		{
+			name: "unpinned source",
+			prepare: func(_ *require.Assertions, _ host.FileSystem) string {
+				return "oci://ghcr.io/kaweezle/config:v1"
+			},
+			want: []string{"oci://ghcr.io/kaweezle/config:v1"},
+		},
+		{
+			name: "pinned source not in the cache",
+			prepare: func(_ *require.Assertions, _ host.FileSystem) string {
+				return "git+https://github.com/kaweezle/config.git//clusters?ref=" + pinnedCommit
+			},
+			want: []string{"git+https://github.com/kaweezle/config.git//clusters?ref=" + pinnedCommit},
+		},
+		{
+			name: "pinned source in the cache",
+			prepare: func(req *require.Assertions, fs host.FileSystem) string {
+				dir := path.Join(constants.KustomizationCacheDir, "git", pinnedCommit)
+				writeFile(req, fs, path.Join(dir, sourceCompleteMarker), "")
+				writeFile(req, fs, path.Join(dir, "clusters/kustomization.yaml"),
+					"resources:\n- ./app.yaml\n- https://example.com/remote.yaml\n")
+				return "git+https://github.com/kaweezle/config.git//clusters?ref=" + pinnedCommit
+			},
+			want: []string{path.Join(constants.KustomizationCacheDir, "git", pinnedCommit, "clusters/kustomization.yaml") +
+				": https://example.com/remote.yaml"},
+		},
+		{
+			name: "local kustomization with nested remote resources",
+			prepare: func(req *require.Assertions, fs host.FileSystem) string {
+				writeFile(req, fs, "/config/kustomization.yaml", "resources:\n- ./app.yaml\n- ./base\n")
+				writeFile(req, fs, "/config/app.yaml", "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: app\n")
+				writeFile(req, fs, "/config/base/kustomization.yml",
+					"bases:\n- github.com/kaweezle/iknite//deploy?ref=main\ncomponents:\n- ../base\n")
+				return "/config"
+			},
+			want: []string{"/config/base/kustomization.yml: github.com/kaweezle/iknite//deploy?ref=main"},
+		},
+		{
+			name: "local kustomization without remote resources",
+			prepare: func(req *require.Assertions, fs host.FileSystem) string {
+				writeFile(req, fs, "/config/kustomization.yaml", "resources:\n- ./app.yaml\n")
+				return "/config"
+			},
+			want: []string{},
+		},
+		{
+			name: "invalid kustomization",
+			prepare: func(req *require.Assertions, fs host.FileSystem) string {
+				writeFile(req, fs, "/config/kustomization.yaml", "resources: [\n")
+				return "/config"
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			req := require.New(t)
+			fs := host.NewMemMapFS()
+			dirname := tt.prepare(req, fs)
+
+			got, err := FindRemoteResources(fs, dirname, tt.forceEmbedded, testutil.TestLogger(t))
+			if tt.wantErr {
+				req.Error(err)
+				return
+			}
+			req.NoError(err)
+			req.Equal(tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,505 @@
+/*
+Copyright © 2021 Antoine Martin <antoine@openance.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// cSpell: words oras ocispec memfs billy gzip opencontainers
+package provision
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	billyUtil "github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	gitConfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2"
+	orasContent "oras.land/oras-go/v2/content"
+	"oras.land/oras-go/v2/registry"
+	"oras.land/oras-go/v2/registry/remote"
+	"oras.land/oras-go/v2/registry/remote/auth"
+	"oras.land/oras-go/v2/registry/remote/credentials"
+	"oras.land/oras-go/v2/registry/remote/retry"
+
+	"github.com/kaweezle/iknite/pkg/host"
+)
+
+const (
+	// OCISourcePrefix is the prefix of the kustomizations stored as OCI artifacts, as in
+	// oci://ghcr.io/org/config:v1 or oci://ghcr.io/org/config@sha256:<digest>.
+	OCISourcePrefix = "oci://"
+	// GitSourcePrefix is the prefix of the kustomizations stored in git repositories, as in
+	// git+https://github.com/org/config.git//clusters/iknite?ref=<commit>.
+	GitSourcePrefix = "git+"
+
+	// sourceCompleteMarker is written in the cache directory of a source once it has been completely fetched.
+	sourceCompleteMarker = ".iknite-source-complete"
+)
+
+var (
+	// sourceFetchTimeout is the maximum time to fetch a source.
+	sourceFetchTimeout = 5 * time.Minute
+	// newOCITargetFn returns the target from which the OCI artifacts are pulled. It is replaced in tests.
+	newOCITargetFn = newRemoteRepository
+)
+
+// IsSource returns true if dirname designates an OCI artifact or a git repository that needs to be fetched.
+func IsSource(dirname string) bool {
+	return strings.HasPrefix(dirname, OCISourcePrefix) || strings.HasPrefix(dirname, GitSourcePrefix)
+}
+
+// FetchSource fetches the OCI artifact or the git repository designated by source into cacheDir if not already
+// present and returns the directory containing the kustomization.
+func FetchSource(
+	ctx context.Context,
+	fs host.FileSystem,
+	source, cacheDir string,
+	logger *slog.Logger,
+) (string, error) {
+	switch {
+	case strings.HasPrefix(source, OCISourcePrefix):
+		return fetchOCISource(ctx, fs, strings.TrimPrefix(source, OCISourcePrefix), cacheDir, logger)
+	case strings.HasPrefix(source, GitSourcePrefix):
+		return fetchGitSource(ctx, fs, strings.TrimPrefix(source, GitSourcePrefix), cacheDir, logger)
+	default:
+		return "", fmt.Errorf("unsupported source %s", source)
+	}
+}
+
+// CachedSource returns the directory containing the kustomization of source if source is pinned, by digest or by
+// commit hash, and has already been fetched into cacheDir. Otherwise, fetching source needs network access and an
+// empty string is returned.
+func CachedSource(fs host.FileSystem, source, cacheDir string) (string, error) {
+	switch {
+	case strings.HasPrefix(source, OCISourcePrefix):
+		reference := strings.TrimPrefix(source, OCISourcePrefix)
+		ref, err := registry.ParseReference(reference)
+		if err != nil {
+			return "", fmt.Errorf("invalid OCI reference %s: %w", reference, err)
+		}
+		pinned, err := ref.Digest()
+		if err != nil {
+			return "", nil //nolint:nilerr // not pinned by digest
+		}
+		return cachedSourceDirectory(fs, ociCacheDirectory(cacheDir, pinned), "")
+	case strings.HasPrefix(source, GitSourcePrefix):
+		_, subDir, ref, err := parseGitSource(strings.TrimPrefix(source, GitSourcePrefix))
+		if err != nil {
+			return "", err
+		}
+		if !plumbing.IsHash(ref) {
+			return "", nil
+		}
+		return cachedSourceDirectory(fs, path.Join(cacheDir, "git", ref), subDir)
+	default:
+		return "", fmt.Errorf("unsupported source %s", source)
+	}
+}
+
+// SourceDigest returns the digest of the content currently designated by source, without fetching it: the manifest
+// digest of an OCI artifact or the commit hash of a git reference. It changes each time the tag or the branch of
+// source is moved.
+func SourceDigest(ctx context.Context, source string) (string, error) {
+	switch {
+	case strings.HasPrefix(source, OCISourcePrefix):
+		reference := strings.TrimPrefix(source, OCISourcePrefix)
+		ref, err := registry.ParseReference(reference)
+		if err != nil {
+			return "", fmt.Errorf("invalid OCI reference %s: %w", reference, err)
+		}
+		if pinned, err := ref.Digest(); err == nil {
+			return pinned.String(), nil
+		}
+		target, err := newOCITargetFn(reference)
+		if err != nil {
+			return "", err
+		}
+		descriptor, err := target.Resolve(ctx, ref.ReferenceOrDefault())
+		if err != nil {
+			return "", fmt.Errorf("while resolving %s: %w", reference, err)
+		}
+		return descriptor.Digest.String(), nil
+	case strings.HasPrefix(source, GitSourcePrefix):
+		repositoryURL, _, ref, err := parseGitSource(strings.TrimPrefix(source, GitSourcePrefix))
+		if err != nil {
+			return "", err
+		}
+		if plumbing.IsHash(ref) {
+			return ref, nil
+		}
+		return gitRemoteReference(ctx, repositoryURL, ref)
+	default:
+		return "", fmt.Errorf("unsupported source %s", source)
+	}
+}
+
+// gitRemoteReference returns the hash the branch or the tag ref points to in the remote repository, or the hash of
+// its HEAD if ref is empty.
+func gitRemoteReference(ctx context.Context, repositoryURL, ref string) (string, error) {
+	remoteRepository := git.NewRemote(memory.NewStorage(), &gitConfig.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{repositoryURL},
+	})
+	references, err := remoteRepository.ListContext(ctx, &git.ListOptions{})
+	if err != nil {
+		return "", fmt.Errorf("while listing references of %s: %w", repositoryURL, err)
+	}
+	names := []plumbing.ReferenceName{plumbing.NewBranchReferenceName(ref), plumbing.NewTagReferenceName(ref)}
+	if ref == "" {
+		names = []plumbing.ReferenceName{plumbing.HEAD}
+	}
+	byName := make(map[plumbing.ReferenceName]*plumbing.Reference, len(references))
+	for _, reference := range references {
+		byName[reference.Name()] = reference
+	}
+	for _, name := range names {
+		reference, found := byName[name]
+		if found && reference.Type() == plumbing.SymbolicReference {
+			reference, found = byName[reference.Target()]
+		}
+		if found {
+			return reference.Hash().String(), nil
+		}
+	}
+	return "", fmt.Errorf("reference %q not found in %s", ref, repositoryURL)
+}
+
+// cachedSourceDirectory returns subDir in the cache directory dir if the source has been completely fetched into it,
+// or an empty string.
+func cachedSourceDirectory(fs host.FileSystem, dir, subDir string) (string, error) {
+	complete, err := isSourceComplete(fs, dir)
+	if err != nil || !complete {
+		return "", err
+	}
+	return path.Join(dir, subDir), nil
+}
+
+func isSourceComplete(fs host.FileSystem, dir string) (bool, error) {
+	complete, err := fs.Exists(path.Join(dir, sourceCompleteMarker))
+	if err != nil {
+		return false, fmt.Errorf("while checking cache directory %s: %w", dir, err)
+	}
+	return complete, nil
+}
+
+// prepareSourceDirectory empties dir, that may contain a partially fetched source.
+func prepareSourceDirectory(fs host.FileSystem, dir string) error {
+	if err := fs.RemoveAll(dir); err != nil {
+		return fmt.Errorf("while cleaning cache directory %s: %w", dir, err)
+	}
+	if err := fs.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("while creating cache directory %s: %w", dir, err)
+	}
+	return nil
+}
+
+func completeSource(fs host.FileSystem, dir string) error {
+	if err := fs.WriteFile(path.Join(dir, sourceCompleteMarker), []byte{}, 0o644); err != nil {
+		return fmt.Errorf("while completing cache directory %s: %w", dir, err)
+	}
+	return nil
+}
+
+// sourceRelativePath cleans name, a path relative to the directory of a source, and rejects it if it designates a
+// location outside of the directory.
+func sourceRelativePath(name string) (string, error) {
+	cleaned := filepath.Clean(name)
+	if filepath.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("invalid path %s in source", name)
+	}
+	return cleaned, nil
+}
+
+// writeSourceFile writes a file of a source into dir, refusing to write outside of it.
+func writeSourceFile(fs host.FileSystem, dir, name string, data []byte) error {
+	cleaned, err := sourceRelativePath(name)
+	if err != nil {
+		return err
+	}
+	target := path.Join(dir, cleaned)
+	if err := fs.MkdirAll(path.Dir(target), 0o755); err != nil {
+		return fmt.Errorf("while creating directory of %s: %w", target, err)
+	}
+	if err := fs.WriteFile(target, data, 0o644); err != nil {
+		return fmt.Errorf("while writing %s: %w", target, err)
+	}
+	return nil
+}
+
+func newRemoteRepository(reference string) (oras.ReadOnlyTarget, error) {
+	repository, err := remote.NewRepository(reference)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OCI reference %s: %w", reference, err)
+	}
+	store, err := credentials.NewStoreFromDocker(credentials.StoreOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("while loading registry credentials: %w", err)
+	}
+	repository.Client = &auth.Client{
+		Client:     retry.DefaultClient,
+		Cache:      auth.NewCache(),
+		Credential: credentials.Credential(store),
+	}
+	return repository, nil
+}
+
+// fetchOCISource pulls the artifact designated by reference into a cache directory named after its manifest
+// digest. When reference is pinned by digest, the cached artifact is used without accessing the registry.
+func fetchOCISource(
+	ctx context.Context,
+	fs host.FileSystem,
+	reference, cacheDir string,
+	logger *slog.Logger,
+) (string, error) {
+	ref, err := registry.ParseReference(reference)
+	if err != nil {
+		return "", fmt.Errorf("invalid OCI reference %s: %w", reference, err)
+	}
+	pinned, pinnedErr := ref.Digest()
+	if pinnedErr == nil {
+		dir, err := cachedSourceDirectory(fs, ociCacheDirectory(cacheDir, pinned), "")
+		if err != nil {
+			return "", err
+		}
+		if dir != "" {
+			logger.Debug("Using cached OCI artifact", "reference", reference, "directory", dir)
+			return dir, nil
+		}
+	}
+
+	target, err := newOCITargetFn(reference)
+	if err != nil {
+		return "", err
+	}
+	manifestDescriptor, err := target.Resolve(ctx, ref.ReferenceOrDefault())
+	if err != nil {
+		return "", fmt.Errorf("while resolving %s: %w", reference, err)
+	}
+	if pinnedErr == nil && manifestDescriptor.Digest != pinned {
+		return "", fmt.Errorf("digest mismatch for %s: got %s", reference, manifestDescriptor.Digest)
+	}
+
+	dir := ociCacheDirectory(cacheDir, manifestDescriptor.Digest)
+	complete, err := isSourceComplete(fs, dir)
+	if err != nil {
+		return "", err
+	}
+	if complete {
+		logger.Debug("Using cached OCI artifact", "reference", reference, "directory", dir)
+		return dir, nil
+	}
+
+	logger.Info("Pulling OCI artifact", "reference", reference, "digest", manifestDescriptor.Digest)
+	// FetchAll verifies the size and the digest of the fetched content
+	manifestContent, err := orasContent.FetchAll(ctx, target, manifestDescriptor)
+	if err != nil {
+		return "", fmt.Errorf("while fetching manifest of %s: %w", reference, err)
+	}
+	var manifest ocispec.Manifest
+	if err = json.Unmarshal(manifestContent, &manifest); err != nil {
+		return "", fmt.Errorf("while parsing manifest of %s: %w", reference, err)
+	}
+	if err = prepareSourceDirectory(fs, dir); err != nil {
+		return "", err
+	}
+	for _, layer := range manifest.Layers {
+		layerContent, err := orasContent.FetchAll(ctx, target, layer)
+		if err != nil {
+			return "", fmt.Errorf("while fetching layer %s of %s: %w", layer.Digest, reference, err)
+		}
+		if err = extractLayer(fs, dir, layer, layerContent); err != nil {
+			return "", fmt.Errorf("while extracting layer %s of %s: %w", layer.Digest, reference, err)
+		}
+	}
+	return dir, completeSource(fs, dir)
+}
+
+func ociCacheDirectory(cacheDir string, manifestDigest digest.Digest) string {
+	return path.Join(cacheDir, "oci", manifestDigest.Algorithm().String(), manifestDigest.Encoded())
+}
+
+// extractLayer extracts the content of an OCI artifact layer into dir. Tar layers, compressed or not, are unpacked.
+// Other layers are written in the file named after their title annotation, as pushed by oras.
+func extractLayer(fs host.FileSystem, dir string, layer ocispec.Descriptor, data []byte) error {
+	var reader io.Reader = bytes.NewReader(data)
+	switch {
+	case strings.HasSuffix(layer.MediaType, "tar+gzip"):
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return fmt.Errorf("while decompressing layer: %w", err)
+		}
+		defer gzipReader.Close() //nolint:errcheck // read only
+		return extractTar(fs, dir, gzipReader)
+	case strings.HasSuffix(layer.MediaType, ".tar"):
+		return extractTar(fs, dir, reader)
+	case layer.Annotations[ocispec.AnnotationTitle] != "":
+		return writeSourceFile(fs, dir, layer.Annotations[ocispec.AnnotationTitle], data)
+	default:
+		return fmt.Errorf("unsupported layer media type %s", layer.MediaType)
+	}
+}
+
+func extractTar(fs host.FileSystem, dir string, reader io.Reader) error {
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("while reading archive: %w", err)
+		}
+		// Links are ignored as they could point outside of the directory
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tarReader)
+		if err != nil {
+			return fmt.Errorf("while reading %s from archive: %w", header.Name, err)
+		}
+		if err = writeSourceFile(fs, dir, header.Name, data); err != nil {
+			return err
+		}
+	}
+}
+
+// parseGitSource splits a git source in the URL of the repository, the directory of the kustomization inside the
+// repository and the reference to check out. The directory of the kustomization must be inside the repository.
+func parseGitSource(source string) (repositoryURL, subDir, ref string, err error) {
+	parsed, err := url.Parse(source)
+	if err != nil {
+		return "", "", "", fmt.Errorf("invalid git source %s: %w", source, err)
+	}
+	ref = parsed.Query().Get("ref")
+	parsed.RawQuery = ""
+	if before, after, found := strings.Cut(parsed.Path, "//"); found {
+		parsed.Path = before
+		if subDir, err = sourceRelativePath(after); err != nil {
+			return "", "", "", fmt.Errorf("invalid git source %s: %w", source, err)
+		}
+	}
+	return parsed.String(), subDir, ref, nil
+}
+
+// resolveGitReference returns the commit designated by ref, that can be a commit hash, a tag or a branch. The
+// default branch is used if ref is empty.
+func resolveGitReference(repository *git.Repository, ref string) (plumbing.Hash, error) {
+	if ref == "" {
+		head, err := repository.Head()
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("while resolving HEAD: %w", err)
+		}
+		return head.Hash(), nil
+	}
+	var err error
+	for _, revision := range []string{ref, "origin/" + ref} {
+		var hash *plumbing.Hash
+		hash, err = repository.ResolveRevision(plumbing.Revision(revision))
+		if err == nil {
+			return *hash, nil
+		}
+	}
+	return plumbing.ZeroHash, fmt.Errorf("while resolving %s: %w", ref, err)
+}
+
+// fetchGitSource clones the repository designated by source and copies the files of the resolved commit into a
+// cache directory named after the commit hash. When the reference is a commit hash, the cached files are used
+// without accessing the repository.
+func fetchGitSource(
+	ctx context.Context,
+	fs host.FileSystem,
+	source, cacheDir string,
+	logger *slog.Logger,
+) (string, error) {
+	repositoryURL, subDir, ref, err := parseGitSource(source)
+	if err != nil {
+		return "", err
+	}
+	if plumbing.IsHash(ref) {
+		dir, err := cachedSourceDirectory(fs, path.Join(cacheDir, "git", ref), subDir)
+		if err != nil {
+			return "", err
+		}
+		if dir != "" {
+			logger.Debug("Using cached git repository", "repository", repositoryURL, "directory", dir)
+			return dir, nil
+		}
+	}
+
+	logger.Info("Cloning git repository", "repository", repositoryURL, "ref", ref)
+	worktreeFs := memfs.New()
+	repository, err := git.CloneContext(ctx, memory.NewStorage(), worktreeFs, &git.CloneOptions{
+		URL:        repositoryURL,
+		NoCheckout: true,
+		Tags:       git.AllTags,
+	})
+	if err != nil {
+		return "", fmt.Errorf("while cloning %s: %w", repositoryURL, err)
+	}
+	hash, err := resolveGitReference(repository, ref)
+	if err != nil {
+		return "", fmt.Errorf("in repository %s: %w", repositoryURL, err)
+	}
+	if plumbing.IsHash(ref) && hash.String() != ref {
+		return "", fmt.Errorf("commit mismatch for %s: got %s", source, hash)
+	}
+	worktree, err := repository.Worktree()
+	if err != nil {
+		return "", fmt.Errorf("while getting worktree of %s: %w", repositoryURL, err)
+	}
+	if err = worktree.Checkout(&git.CheckoutOptions{Hash: hash, Force: true}); err != nil {
+		return "", fmt.Errorf("while checking out %s in %s: %w", hash, repositoryURL, err)
+	}
+
+	dir := path.Join(cacheDir, "git", hash.String())
+	if err = prepareSourceDirectory(fs, dir); err != nil {
+		return "", err
+	}
+	if err = copyWorktree(worktreeFs, fs, dir); err != nil {
+		return "", fmt.Errorf("while copying %s: %w", repositoryURL, err)
+	}
+	return path.Join(dir, subDir), completeSource(fs, dir)
+}
+
+func copyWorktree(worktreeFs billy.Filesystem, fs host.FileSystem, dir string) error {
+	walkFn := func(name string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		data, err := billyUtil.ReadFile(worktreeFs, name)
+		if err != nil {
+			return fmt.Errorf("while reading %s: %w", name, err)
+		}
+		return writeSourceFile(fs, dir, strings.TrimPrefix(name, "/"), data)
+	}
+	return billyUtil.Walk(worktreeFs, "/", walkFn) //nolint:wrapcheck // errors are wrapped by the caller
+}
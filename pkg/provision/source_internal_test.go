@@ -0,0 +1,225 @@
+// cSpell: words oras ocispec gzip paralleltest testutil
+package provision
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content/memory"
+
+	"github.com/kaweezle/iknite/pkg/host"
+	"github.com/kaweezle/iknite/pkg/testutil"
+)
+
+const sourceKustomization = "resources:\n- namespace.yaml\n"
+
+const sourceNamespace = "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: from-source\n"
+
+func tarGzip(req *require.Assertions, files map[string]string) []byte {
+	var buffer bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buffer)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for name, content := range files {
+		req.NoError(tarWriter.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0o644,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		}))
+		_, err := tarWriter.Write([]byte(content))
+		req.NoError(err)
+	}
+	req.NoError(tarWriter.Close())
+	req.NoError(gzipWriter.Close())
+	return buffer.Bytes()
+}
+
+// pushArtifact pushes an artifact made of the files in the store, standing in for a registry, and returns the
+// digest of its manifest.
+func pushArtifact(
+	ctx context.Context,
+	req *require.Assertions,
+	store *memory.Store,
+	files map[string]string,
+) digest.Digest {
+	layerContent := tarGzip(req, files)
+	layer := ocispec.Descriptor{
+		MediaType: "application/vnd.cncf.flux.content.v1.tar+gzip",
+		Digest:    digest.FromBytes(layerContent),
+		Size:      int64(len(layerContent)),
+	}
+	req.NoError(store.Push(ctx, layer, bytes.NewReader(layerContent)))
+	manifest, err := oras.PackManifest(ctx, store, oras.PackManifestVersion1_1, "application/vnd.iknite.config",
+		oras.PackManifestOptions{Layers: []ocispec.Descriptor{layer}})
+	req.NoError(err)
+	req.NoError(store.Tag(ctx, manifest, "v1"))
+	req.NoError(store.Tag(ctx, manifest, manifest.Digest.String()))
+	return manifest.Digest
+}
+
+//nolint:paralleltest // modifies newOCITargetFn
+func TestFetchSource_OCI(t *testing.T) {
+	req := require.New(t)
+	ctx := t.Context()
+	logger := testutil.TestLogger(t)
+	store := memory.New()
+	manifestDigest := pushArtifact(ctx, req, store, map[string]string{
+		"kustomization.yaml": sourceKustomization,
+		"namespace.yaml":     sourceNamespace,
+	})
+	newOCITargetFn = func(string) (oras.ReadOnlyTarget, error) { return store, nil }
+	defer func() { newOCITargetFn = newRemoteRepository }()
+
+	fs := host.NewMemMapFS()
+	dir, err := FetchSource(ctx, fs, "oci://registry.local/config:v1", "/cache", logger)
+	req.NoError(err)
+	req.Equal("/cache/oci/sha256/"+manifestDigest.Encoded(), dir)
+	content, err := fs.ReadFile(path.Join(dir, "namespace.yaml"))
+	req.NoError(err)
+	req.Equal(sourceNamespace, string(content))
+
+	resources, err := GetBaseKustomizationResources(fs, "oci://registry.local/config:v1", false, nil, logger)
+	req.NoError(err)
+	req.Equal(1, resources.Size())
+
+	sourceDigest, err := SourceDigest(ctx, "oci://registry.local/config:v1")
+	req.NoError(err)
+	req.Equal(manifestDigest.String(), sourceDigest)
+
+	// A pinned artifact is taken from the cache without accessing the registry
+	newOCITargetFn = func(string) (oras.ReadOnlyTarget, error) { return nil, errors.New("offline") }
+	pinnedDir, err := FetchSource(ctx, fs, "oci://registry.local/config@"+manifestDigest.String(), "/cache", logger)
+	req.NoError(err)
+	req.Equal(dir, pinnedDir)
+
+	newOCITargetFn = func(string) (oras.ReadOnlyTarget, error) { return store, nil }
+	_, err = FetchSource(ctx, fs, "oci://registry.local/config@"+digest.FromString("other").String(), "/cache",
+		logger)
+	req.ErrorContains(err, "while resolving")
+}
+
+//nolint:paralleltest // modifies newOCITargetFn
+func TestFetchSource_OCIInvalidPath(t *testing.T) {
+	req := require.New(t)
+	ctx := t.Context()
+	store := memory.New()
+	pushArtifact(ctx, req, store, map[string]string{"../escape.yaml": sourceNamespace})
+	newOCITargetFn = func(string) (oras.ReadOnlyTarget, error) { return store, nil }
+	defer func() { newOCITargetFn = newRemoteRepository }()
+
+	_, err := FetchSource(ctx, host.NewMemMapFS(), "oci://registry.local/config:v1", "/cache",
+		testutil.TestLogger(t))
+	req.ErrorContains(err, "invalid path ../escape.yaml")
+}
+
+func createGitRepository(req *require.Assertions, dir string, files map[string]string) string {
+	repository, err := git.PlainInit(dir, false)
+	req.NoError(err)
+	worktree, err := repository.Worktree()
+	req.NoError(err)
+	for name, content := range files {
+		req.NoError(os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755))
+		req.NoError(os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+		_, err = worktree.Add(name)
+		req.NoError(err)
+	}
+	hash, err := worktree.Commit("configuration", &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	req.NoError(err)
+	_, err = repository.CreateTag("v1", hash, nil)
+	req.NoError(err)
+	return hash.String()
+}
+
+func TestFetchSource_Git(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+	ctx := t.Context()
+	logger := testutil.TestLogger(t)
+	repositoryDir := t.TempDir()
+	commit := createGitRepository(req, repositoryDir, map[string]string{
+		"clusters/iknite/kustomization.yaml": sourceKustomization,
+		"clusters/iknite/namespace.yaml":     sourceNamespace,
+	})
+
+	fs := host.NewMemMapFS()
+	dir, err := FetchSource(ctx, fs, "git+file://"+repositoryDir+"//clusters/iknite?ref=v1", "/cache", logger)
+	req.NoError(err)
+	req.Equal("/cache/git/"+commit+"/clusters/iknite", dir)
+	content, err := fs.ReadFile(path.Join(dir, "namespace.yaml"))
+	req.NoError(err)
+	req.Equal(sourceNamespace, string(content))
+
+	// A pinned commit is taken from the cache without accessing the repository
+	req.NoError(os.RemoveAll(repositoryDir))
+	pinnedDir, err := FetchSource(ctx, fs, "git+file://"+repositoryDir+"//clusters/iknite?ref="+commit, "/cache",
+		logger)
+	req.NoError(err)
+	req.Equal(dir, pinnedDir)
+
+	_, err = FetchSource(ctx, fs, "git+file://"+repositoryDir+"?ref=main", "/cache", logger)
+	req.ErrorContains(err, "while cloning")
+}
+
+func TestSourceDigest_Git(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+	ctx := t.Context()
+	repositoryDir := t.TempDir()
+	commit := createGitRepository(req, repositoryDir, map[string]string{"kustomization.yaml": sourceKustomization})
+
+	for _, ref := range []string{"v1", "master", ""} {
+		sourceDigest, err := SourceDigest(ctx, "git+file://"+repositoryDir+"?ref="+ref)
+		req.NoError(err, ref)
+		req.Equal(commit, sourceDigest, ref)
+	}
+
+	_, err := SourceDigest(ctx, "git+file://"+repositoryDir+"?ref=missing")
+	req.ErrorContains(err, `reference "missing" not found`)
+
+	// A pinned commit doesn't need the repository
+	req.NoError(os.RemoveAll(repositoryDir))
+	sourceDigest, err := SourceDigest(ctx, "git+file://"+repositoryDir+"?ref="+commit)
+	req.NoError(err)
+	req.Equal(commit, sourceDigest)
+}
+
+func TestParseGitSource(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+
+	repositoryURL, subDir, ref, err := parseGitSource("https://github.com/org/config.git//clusters/iknite?ref=v1")
+	req.NoError(err)
+	req.Equal("https://github.com/org/config.git", repositoryURL)
+	req.Equal("clusters/iknite", subDir)
+	req.Equal("v1", ref)
+
+	repositoryURL, subDir, ref, err = parseGitSource("https://github.com/org/config.git")
+	req.NoError(err)
+	req.Equal("https://github.com/org/config.git", repositoryURL)
+	req.Empty(subDir)
+	req.Empty(ref)
+
+	_, subDir, _, err = parseGitSource("https://github.com/org/config.git//clusters/../iknite/?ref=v1")
+	req.NoError(err)
+	req.Equal("iknite", subDir)
+
+	// The kustomization directory cannot be outside of the repository
+	_, _, _, err = parseGitSource("https://github.com/org/config.git//clusters/../../etc?ref=v1")
+	req.ErrorContains(err, "invalid path clusters/../../etc in source")
+}
@@ -0,0 +1,130 @@
+/*
+Copyright © 2021 Antoine Martin <antoine@openance.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// cSpell: words resmap
+package provision
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/kustomize/api/provider"
+	"sigs.k8s.io/kustomize/api/resmap"
+
+	"github.com/kaweezle/iknite/pkg/constants"
+)
+
+const (
+	// SubstituteAnnotation disables the substitution on a resource when set to SubstituteAnnotationDisabled.
+	SubstituteAnnotation         = "config.iknite.app/substitute"
+	SubstituteAnnotationDisabled = "disabled"
+)
+
+// DefaultSubstituteAllow is the default allowlist of substituted variables.
+var DefaultSubstituteAllow = []string{constants.DefaultSubstituteAllow}
+
+// placeholderRegexp matches ${VAR}, ${VAR:=default}, ${VAR:-default}, ${VAR=default} and ${VAR-default}. A leading
+// $ escapes the placeholder.
+var placeholderRegexp = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)(?:(:?[=-])([^}]*))?\}`)
+
+// SubstituteOptions controls the substitution of the ${VAR} placeholders of the rendered kustomization, in the same
+// way as the Flux postBuild substitution.
+type SubstituteOptions struct {
+	// Variables are the values of the variables.
+	Variables map[string]string
+	// Allow contains the patterns (as in path.Match) of the names of the substituted variables. The placeholders of
+	// the other variables are left untouched. If empty, DefaultSubstituteAllow is used.
+	Allow []string
+	// Strict makes the substitution fail on undefined variables without default value instead of replacing them with
+	// an empty string.
+	Strict bool
+}
+
+func (o *SubstituteOptions) allowed(name string) bool {
+	allow := o.Allow
+	if len(allow) == 0 {
+		allow = DefaultSubstituteAllow
+	}
+	return slices.ContainsFunc(allow, func(pattern string) bool {
+		matched, err := path.Match(pattern, name)
+		return err == nil && matched
+	})
+}
+
+// SubstituteString replaces the placeholders of the allowed variables in input.
+func SubstituteString(input string, options *SubstituteOptions) (string, error) {
+	var undefined []string
+	result := placeholderRegexp.ReplaceAllStringFunc(input, func(placeholder string) string {
+		if strings.HasPrefix(placeholder, "$$") {
+			return placeholder[1:]
+		}
+		match := placeholderRegexp.FindStringSubmatch(placeholder)
+		name, operator, defaultValue := match[1], match[2], match[3]
+		if !options.allowed(name) {
+			return placeholder
+		}
+		value, defined := options.Variables[name]
+		switch {
+		case defined && (value != "" || !strings.HasPrefix(operator, ":")):
+			return value
+		case operator != "":
+			return defaultValue
+		}
+		undefined = append(undefined, name)
+		return ""
+	})
+	if options.Strict && len(undefined) > 0 {
+		slices.Sort(undefined)
+		return "", fmt.Errorf("undefined variables: %s", strings.Join(slices.Compact(undefined), ", "))
+	}
+	return result, nil
+}
+
+// SubstituteResources replaces the placeholders of the allowed variables in resources. The resources annotated with
+// config.iknite.app/substitute: disabled are left untouched.
+func SubstituteResources(resources resmap.ResMap, options *SubstituteOptions) error {
+	factory := provider.NewDefaultDepProvider().GetResourceFactory()
+	var errs []error
+	for _, res := range resources.Resources() {
+		if res.GetAnnotations()[SubstituteAnnotation] == SubstituteAnnotationDisabled {
+			continue
+		}
+		content, err := res.AsYAML()
+		if err != nil {
+			return fmt.Errorf("while serializing %s: %w", res.CurId(), err)
+		}
+		substituted, err := SubstituteString(string(content), options)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", res.CurId(), err))
+			continue
+		}
+		if substituted == string(content) {
+			continue
+		}
+		replacement, err := factory.FromBytes([]byte(substituted))
+		if err != nil {
+			return fmt.Errorf("while parsing substituted %s: %w", res.CurId(), err)
+		}
+		res.ResetRNode(replacement)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("while substituting variables: %w", errors.Join(errs...))
+	}
+	return nil
+}
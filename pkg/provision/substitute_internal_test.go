@@ -0,0 +1,114 @@
+// cSpell: words testutil
+package provision
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kaweezle/iknite/pkg/host"
+	"github.com/kaweezle/iknite/pkg/testutil"
+)
+
+func TestSubstituteString(t *testing.T) {
+	t.Parallel()
+
+	variables := map[string]string{"IKNITE_IP": "192.168.99.2", "IKNITE_EMPTY": "", "OTHER": "other"}
+	tests := []struct {
+		options *SubstituteOptions
+		name    string
+		input   string
+		want    string
+		wantErr string
+	}{
+		{name: "defined", input: "ip: ${IKNITE_IP}", want: "ip: 192.168.99.2"},
+		{name: "default ignored", input: "${IKNITE_IP:=10.0.0.1}", want: "192.168.99.2"},
+		{name: "default", input: "${IKNITE_DOMAIN:=iknite.local}", want: "iknite.local"},
+		{name: "colon default on empty", input: "${IKNITE_EMPTY:-x}", want: "x"},
+		{name: "default only when unset", input: "${IKNITE_EMPTY-x}", want: ""},
+		{name: "escaped", input: "$${IKNITE_IP}", want: "${IKNITE_IP}"},
+		{name: "not allowed", input: "${OTHER} ${HOME}", want: "${OTHER} ${HOME}"},
+		{name: "undefined", input: "[${IKNITE_DOMAIN}]", want: "[]"},
+		{
+			name:    "allowlist",
+			options: &SubstituteOptions{Allow: []string{"OTHER"}},
+			input:   "${OTHER} ${IKNITE_IP}",
+			want:    "other ${IKNITE_IP}",
+		},
+		{
+			name:    "strict",
+			options: &SubstituteOptions{Strict: true},
+			input:   "${IKNITE_DOMAIN} ${IKNITE_ZONE} ${IKNITE_DOMAIN} ${IKNITE_NAME:=ok}",
+			wantErr: "undefined variables: IKNITE_DOMAIN, IKNITE_ZONE",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			req := require.New(t)
+			options := tt.options
+			if options == nil {
+				options = &SubstituteOptions{}
+			}
+			options.Variables = variables
+
+			got, err := SubstituteString(tt.input, options)
+			if tt.wantErr != "" {
+				req.ErrorContains(err, tt.wantErr)
+				return
+			}
+			req.NoError(err)
+			req.Equal(tt.want, got)
+		})
+	}
+}
+
+const substituteKustomization = `resources:
+- gateway.yaml
+- script.yaml
+`
+
+const substituteGateway = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: gateway
+data:
+  hostname: "gateway.${IKNITE_DOMAIN}"
+  address: ${IKNITE_IP}
+`
+
+const substituteScript = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: script
+  annotations:
+    config.iknite.app/substitute: disabled
+data:
+  run.sh: echo ${IKNITE_IP}
+`
+
+func TestGetBaseKustomizationResources_Substitute(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+	fs := host.NewMemMapFS()
+	writeTestFile(req, fs, "/config/kustomization.yaml", substituteKustomization)
+	writeTestFile(req, fs, "/config/gateway.yaml", substituteGateway)
+	writeTestFile(req, fs, "/config/script.yaml", substituteScript)
+
+	options := &SubstituteOptions{Variables: map[string]string{
+		"IKNITE_IP":     "192.168.99.2",
+		"IKNITE_DOMAIN": "iknite.local",
+	}}
+	resources, err := GetBaseKustomizationResources(fs, "/config", false, options, testutil.TestLogger(t))
+	req.NoError(err)
+	content, err := resources.AsYaml()
+	req.NoError(err)
+	req.Contains(string(content), "hostname: gateway.iknite.local")
+	req.Contains(string(content), "address: 192.168.99.2")
+	req.Contains(string(content), "run.sh: echo ${IKNITE_IP}")
+
+	options = &SubstituteOptions{Strict: true}
+	_, err = GetBaseKustomizationResources(fs, "/config", false, options, testutil.TestLogger(t))
+	req.ErrorContains(err, "undefined variables: IKNITE_DOMAIN, IKNITE_IP")
+	req.ErrorContains(err, "gateway")
+}
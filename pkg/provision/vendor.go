@@ -0,0 +1,342 @@
+/*
+Copyright © 2021 Antoine Martin <antoine@openance.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// cSpell: words filesys kyaml kio
+package provision
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/kio"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+	"sigs.k8s.io/yaml"
+
+	"github.com/kaweezle/iknite/pkg/host"
+)
+
+const (
+	// VendorLockFileName is the name of the file recording the digests of the vendored resources.
+	VendorLockFileName = "iknite-vendor.lock.yaml"
+	// VendorDirName is the name of the directory containing the vendored resources.
+	VendorDirName = "vendor"
+
+	// vendorQueryHashLength is the number of hex digits of the query digest added to the vendored file names.
+	vendorQueryHashLength = 12
+)
+
+// errNotManifests is returned when a downloaded resource doesn't contain kubernetes manifests, like the page of a git
+// repository.
+var errNotManifests = errors.New("does not contain kubernetes manifests")
+
+// kustomizationListFields are the kustomization fields that may reference remote resources.
+var kustomizationListFields = []string{"resources", "bases", "components", "crds"}
+
+// VendoredResource is a remote resource that has been downloaded locally.
+type VendoredResource struct {
+	// URL is the original location of the resource.
+	URL string `json:"url"`
+	// Path is the location of the local copy, relative to the directory of the lock file.
+	Path string `json:"path"`
+	// Sha256 is the hex encoded sha256 digest of the local copy.
+	Sha256 string `json:"sha256"`
+}
+
+// VendorLock records the resources vendored in a kustomization directory.
+type VendorLock struct {
+	Resources []VendoredResource `json:"resources"`
+}
+
+func sha256Digest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// readVendorLock reads the lock file of dirname. It returns nil if there is no lock file.
+func readVendorLock(fs filesys.FileSystem, dirname string) (*VendorLock, error) {
+	lockPath := filepath.Join(dirname, VendorLockFileName)
+	if !fs.Exists(lockPath) {
+		return nil, nil //nolint:nilnil // no lock file is not an error
+	}
+	content, err := fs.ReadFile(lockPath)
+	if err != nil {
+		return nil, fmt.Errorf("while reading %s: %w", lockPath, err)
+	}
+	lock := &VendorLock{}
+	if err = yaml.Unmarshal(content, lock); err != nil {
+		return nil, fmt.Errorf("while parsing %s: %w", lockPath, err)
+	}
+	return lock, nil
+}
+
+// verifyVendorLock checks that the vendored resources of dirname match the digests recorded in its lock file.
+func verifyVendorLock(fs filesys.FileSystem, dirname string) error {
+	lock, err := readVendorLock(fs, dirname)
+	if err != nil || lock == nil {
+		return err
+	}
+	for _, resource := range lock.Resources {
+		content, err := fs.ReadFile(filepath.Join(dirname, resource.Path))
+		if err != nil {
+			return fmt.Errorf("while reading vendored resource %s: %w", resource.Path, err)
+		}
+		if digest := sha256Digest(content); digest != resource.Sha256 {
+			return fmt.Errorf("vendored resource %s (%s) digest mismatch: expected %s, got %s",
+				resource.Path, resource.URL, resource.Sha256, digest)
+		}
+	}
+	return nil
+}
+
+// vendorPath returns the path of the local copy of the resource at u, relative to the directory of the lock file.
+// When u has a query, a digest of the query is added to the file name so that the resources differing only by their
+// query are vendored in different files. The URLs whose path goes above their host are rejected.
+func vendorPath(u *url.URL) (string, error) {
+	if u.Host == "" || u.Host == "." || u.Host == ".." || strings.ContainsAny(u.Host, `/\`) {
+		return "", fmt.Errorf("invalid host in resource %s", u)
+	}
+	resourcePath, err := sourceRelativePath(strings.TrimPrefix(u.Path, "/"))
+	if err != nil {
+		return "", fmt.Errorf("while vendoring %s: %w", u, err)
+	}
+	result := path.Join(VendorDirName, u.Host, resourcePath)
+	ext := path.Ext(result)
+	if ext != ".yaml" && ext != ".yml" && ext != ".json" {
+		result += ".yaml"
+		ext = ".yaml"
+	}
+	if u.RawQuery != "" {
+		result = strings.TrimSuffix(result, ext) + "-" + sha256Digest([]byte(u.RawQuery))[:vendorQueryHashLength] + ext
+	}
+	return result, nil
+}
+
+func downloadResource(ctx context.Context, client *http.Client, resourceURL string) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, resourceURL, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("while creating request for %s: %w", resourceURL, err)
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("while downloading %s: %w", resourceURL, err)
+	}
+	defer response.Body.Close() //nolint:errcheck // best effort
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("while downloading %s: unexpected status %s", resourceURL, response.Status)
+	}
+	content, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("while reading %s: %w", resourceURL, err)
+	}
+	// Git repositories URLs return HTML pages, not manifests
+	if nodes, err := kio.FromBytes(content); err != nil || len(nodes) == 0 {
+		return nil, fmt.Errorf("%s %w", resourceURL, errNotManifests)
+	}
+	return content, nil
+}
+
+type vendorer struct {
+	fs      filesys.FileSystem
+	client  *http.Client
+	lock    *VendorLock
+	logger  *slog.Logger
+	visited map[string]bool
+	// vendored contains the paths of the vendored resources, relative to root, by URL
+	vendored map[string]string
+	// root is the directory containing the lock file
+	root string
+}
+
+// reference returns the path of the vendored resource at relPath relative to dirname.
+func (v *vendorer) reference(dirname, relPath string) (string, error) {
+	destination := filepath.Join(v.root, relPath)
+	reference, err := filepath.Rel(dirname, destination)
+	if err != nil {
+		return "", fmt.Errorf("while computing relative path of %s: %w", destination, err)
+	}
+	return reference, nil
+}
+
+func (v *vendorer) vendorResource(ctx context.Context, dirname, entry string) (string, error) {
+	u, err := url.Parse(entry)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		v.logger.Warn("Only http resources can be vendored, leaving it unchanged", "resource", entry)
+		return entry, nil
+	}
+	if relPath, ok := v.vendored[entry]; ok {
+		return v.reference(dirname, relPath)
+	}
+	relPath, err := vendorPath(u)
+	if err != nil {
+		return "", err
+	}
+	destination := filepath.Join(v.root, relPath)
+	vendorDir := filepath.Join(v.root, VendorDirName)
+	if !strings.HasPrefix(destination, vendorDir+string(filepath.Separator)) {
+		return "", fmt.Errorf("vendored resource %s would be written outside of %s", entry, vendorDir)
+	}
+
+	v.logger.Info("Vendoring resource", "resource", entry)
+	content, err := downloadResource(ctx, v.client, entry)
+	if errors.Is(err, errNotManifests) {
+		v.logger.Warn("Not a manifest, probably a git repository, leaving it unchanged", "resource", entry)
+		return entry, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if err = v.fs.MkdirAll(filepath.Dir(destination)); err != nil {
+		return "", fmt.Errorf("while creating directory for %s: %w", destination, err)
+	}
+	if err = v.fs.WriteFile(destination, content); err != nil {
+		return "", fmt.Errorf("while writing %s: %w", destination, err)
+	}
+	v.lock.Resources = append(v.lock.Resources, VendoredResource{
+		URL:    entry,
+		Path:   relPath,
+		Sha256: sha256Digest(content),
+	})
+	v.vendored[entry] = relPath
+	return v.reference(dirname, relPath)
+}
+
+func (v *vendorer) vendorDirectory(ctx context.Context, dirname string) error {
+	if v.visited[dirname] {
+		return nil
+	}
+	v.visited[dirname] = true
+
+	kustomizationPath := findKustomizationFile(v.fs, dirname)
+	if kustomizationPath == "" {
+		return nil
+	}
+	content, err := v.fs.ReadFile(kustomizationPath)
+	if err != nil {
+		return fmt.Errorf("while reading %s: %w", kustomizationPath, err)
+	}
+	// The kustomization is modified as a node to keep its layout and comments
+	kustomization, err := kyaml.Parse(string(content))
+	if err != nil {
+		return fmt.Errorf("while parsing %s: %w", kustomizationPath, err)
+	}
+
+	changed := false
+	for _, field := range kustomizationListFields {
+		list := kustomization.Field(field)
+		if list == nil || list.Value.YNode().Kind != kyaml.SequenceNode {
+			continue
+		}
+		for _, item := range list.Value.YNode().Content {
+			entry := item.Value
+			if !IsRemoteResource(entry) {
+				local := filepath.Join(dirname, entry)
+				if v.fs.IsDir(local) {
+					if err = v.vendorDirectory(ctx, local); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			reference, err := v.vendorResource(ctx, dirname, entry)
+			if err != nil {
+				return err
+			}
+			if reference != entry {
+				item.Value = reference
+				changed = true
+			}
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+	output, err := kustomization.String()
+	if err != nil {
+		return fmt.Errorf("while serializing %s: %w", kustomizationPath, err)
+	}
+	if err = v.fs.WriteFile(kustomizationPath, []byte(output)); err != nil {
+		return fmt.Errorf("while writing %s: %w", kustomizationPath, err)
+	}
+	return nil
+}
+
+// VendorKustomization downloads the remote resources referenced by the kustomization in dirname (and in the local
+// kustomizations it references) into its vendor directory, and rewrites the kustomizations to use the local copies.
+// The digests of the vendored resources are recorded in the lock file of dirname. The resources vendored in a
+// previous run are kept in the lock file, and a resource referenced several times is only vendored once.
+func VendorKustomization(
+	ctx context.Context,
+	fs host.FileSystem,
+	dirname string,
+	client *http.Client,
+	logger *slog.Logger,
+) (*VendorLock, error) {
+	kustomizeFs := host.NewKustomizeFSWrapper(fs)
+	if findKustomizationFile(kustomizeFs, dirname) == "" {
+		return nil, fmt.Errorf("no kustomization found in %s", dirname)
+	}
+
+	lock, err := readVendorLock(kustomizeFs, dirname)
+	if err != nil {
+		return nil, err
+	}
+	if lock == nil {
+		lock = &VendorLock{}
+	}
+	previous := len(lock.Resources)
+	vendored := make(map[string]string, previous)
+	for _, resource := range lock.Resources {
+		vendored[resource.URL] = resource.Path
+	}
+
+	v := &vendorer{
+		fs:       kustomizeFs,
+		client:   client,
+		lock:     lock,
+		logger:   logger,
+		root:     dirname,
+		visited:  map[string]bool{},
+		vendored: vendored,
+	}
+	if err = v.vendorDirectory(ctx, dirname); err != nil {
+		return nil, err
+	}
+	if len(lock.Resources) == previous && previous > 0 {
+		logger.Info("No new remote resource to vendor", "directory", dirname)
+		return lock, nil
+	}
+
+	content, err := yaml.Marshal(lock)
+	if err != nil {
+		return nil, fmt.Errorf("while serializing vendor lock: %w", err)
+	}
+	lockPath := filepath.Join(dirname, VendorLockFileName)
+	if err = kustomizeFs.WriteFile(lockPath, content); err != nil {
+		return nil, fmt.Errorf("while writing %s: %w", lockPath, err)
+	}
+	return lock, nil
+}
@@ -0,0 +1,181 @@
+// cSpell: words testutil kustomizations
+package provision
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/yaml"
+
+	"github.com/kaweezle/iknite/pkg/host"
+	"github.com/kaweezle/iknite/pkg/testutil"
+)
+
+const testNamespaceManifest = "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: remote\n"
+
+func newManifestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/deploy/components.yaml", "/deploy/install":
+			manifest := testNamespaceManifest
+			if ref := r.URL.Query().Get("ref"); ref != "" {
+				manifest = strings.ReplaceAll(manifest, "remote", "remote-"+ref)
+			}
+			_, _ = w.Write([]byte(manifest)) //nolint:errcheck // test server
+		case "/repo":
+			_, _ = w.Write([]byte("<html><body>not yaml: [</body></html>")) //nolint:errcheck // test server
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func writeTestFile(req *require.Assertions, fs host.FileSystem, path, content string) {
+	req.NoError(fs.MkdirAll(filepath.Dir(path), 0o755))
+	req.NoError(fs.WriteFile(path, []byte(content), 0o600))
+}
+
+func TestVendorKustomization(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+	server := newManifestServer(t)
+	logger := testutil.TestLogger(t)
+	fs := host.NewMemMapFS()
+
+	serverHost := strings.TrimPrefix(server.URL, "http://")
+	writeTestFile(req, fs, "/config/kustomization.yaml",
+		"resources:\n"+
+			"  # The remote manifest\n"+
+			"  - "+server.URL+"/deploy/components.yaml\n"+
+			"  - ./nested\n"+
+			"  - github.com/kaweezle/iknite//deploy?ref=main\n"+
+			"  - "+server.URL+"/repo\n"+
+			"  - "+server.URL+"/deploy/components.yaml?ref=v1\n"+
+			"  - "+server.URL+"/deploy/components.yaml?ref=v2\n")
+	// The resources referenced several times are vendored once
+	writeTestFile(req, fs, "/config/nested/kustomization.yaml",
+		"resources:\n  - "+server.URL+"/deploy/install\n  - "+server.URL+"/deploy/components.yaml\n")
+
+	lock, err := VendorKustomization(t.Context(), fs, "/config", server.Client(), logger)
+	req.NoError(err)
+	req.Len(lock.Resources, 4)
+	req.Equal(server.URL+"/deploy/components.yaml", lock.Resources[0].URL)
+	req.Equal("vendor/"+serverHost+"/deploy/components.yaml", lock.Resources[0].Path)
+	req.Equal(sha256Digest([]byte(testNamespaceManifest)), lock.Resources[0].Sha256)
+	req.Equal("vendor/"+serverHost+"/deploy/install.yaml", lock.Resources[1].Path)
+	// The resources differing by their query are vendored in different files
+	req.Equal("vendor/"+serverHost+"/deploy/components-"+sha256Digest([]byte("ref=v1"))[:12]+".yaml",
+		lock.Resources[2].Path)
+	req.Equal("vendor/"+serverHost+"/deploy/components-"+sha256Digest([]byte("ref=v2"))[:12]+".yaml",
+		lock.Resources[3].Path)
+
+	content, err := fs.ReadFile("/config/kustomization.yaml")
+	req.NoError(err)
+	req.Contains(string(content), "# The remote manifest")
+	req.Contains(string(content), "- vendor/"+serverHost+"/deploy/components.yaml\n")
+	req.Contains(string(content), "- github.com/kaweezle/iknite//deploy?ref=main\n")
+	// Like the git resources, the pages that are not manifests are left unchanged
+	req.Contains(string(content), "- "+server.URL+"/repo\n")
+	content, err = fs.ReadFile("/config/nested/kustomization.yaml")
+	req.NoError(err)
+	req.Contains(string(content), "- ../vendor/"+serverHost+"/deploy/install.yaml\n")
+	req.Contains(string(content), "- ../vendor/"+serverHost+"/deploy/components.yaml\n")
+
+	content, err = fs.ReadFile("/config/" + VendorLockFileName)
+	req.NoError(err)
+	written := &VendorLock{}
+	req.NoError(yaml.Unmarshal(content, written))
+	req.Equal(lock, written)
+
+	// Running again keeps the lock
+	lock, err = VendorKustomization(t.Context(), fs, "/config", server.Client(), logger)
+	req.NoError(err)
+	req.Len(lock.Resources, 4)
+
+	// Once the git resources are removed, the vendored kustomization builds offline and is verified
+	content, err = fs.ReadFile("/config/kustomization.yaml")
+	req.NoError(err)
+	content = []byte(strings.ReplaceAll(string(content), "- github.com/kaweezle/iknite//deploy?ref=main\n", ""))
+	content = []byte(strings.ReplaceAll(string(content), "- "+server.URL+"/repo\n", ""))
+	req.NoError(fs.WriteFile("/config/kustomization.yaml", content, 0o600))
+	req.NoError(verifyVendorLock(host.NewKustomizeFSWrapper(fs), "/config"))
+	_, err = GetBaseKustomizationResources(fs, "/config", false, nil, logger)
+	req.NoError(err)
+}
+
+func TestVendorKustomization_Errors(t *testing.T) {
+	t.Parallel()
+	server := newManifestServer(t)
+
+	tests := []struct {
+		name          string
+		kustomization string
+		wantErr       string
+	}{
+		{name: "no kustomization", wantErr: "no kustomization found"},
+		{
+			name:          "not found",
+			kustomization: "resources:\n- " + server.URL + "/missing.yaml\n",
+			wantErr:       "unexpected status 404",
+		},
+		{name: "invalid kustomization", kustomization: "resources: [\n", wantErr: "while parsing"},
+		{
+			name:          "parent path",
+			kustomization: "resources:\n- " + server.URL + "/../../kustomization.yaml\n",
+			wantErr:       "invalid path",
+		},
+		{
+			name:          "parent host",
+			kustomization: "resources:\n- http://../kustomization.yaml\n",
+			wantErr:       "invalid host",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			req := require.New(t)
+			fs := host.NewMemMapFS()
+			if tt.kustomization != "" {
+				writeTestFile(req, fs, "/config/kustomization.yaml", tt.kustomization)
+			}
+			_, err := VendorKustomization(t.Context(), fs, "/config", server.Client(), testutil.TestLogger(t))
+			req.ErrorContains(err, tt.wantErr)
+		})
+	}
+}
+
+func TestGetBaseKustomizationResources_DigestMismatch(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+	fs := host.NewMemMapFS()
+	writeTestFile(req, fs, "/config/kustomization.yaml", "resources:\n- vendor/example.com/ns.yaml\n")
+	writeTestFile(req, fs, "/config/vendor/example.com/ns.yaml", testNamespaceManifest)
+	writeTestFile(req, fs, "/config/"+VendorLockFileName,
+		"resources:\n- url: https://example.com/ns.yaml\n  path: vendor/example.com/ns.yaml\n  sha256: deadbeef\n")
+
+	_, err := GetBaseKustomizationResources(fs, "/config", false, nil, testutil.TestLogger(t))
+	req.ErrorContains(err, "digest mismatch")
+
+	writeTestFile(req, fs, "/config/"+VendorLockFileName,
+		"resources:\n- url: https://example.com/ns.yaml\n  path: vendor/example.com/missing.yaml\n  sha256: deadbeef\n")
+	_, err = GetBaseKustomizationResources(fs, "/config", false, nil, testutil.TestLogger(t))
+	req.ErrorContains(err, "while reading vendored resource")
+}
+
+func TestWriteEmbeddedKustomization(t *testing.T) {
+	t.Parallel()
+	req := require.New(t)
+	fs := host.NewMemMapFS()
+
+	req.NoError(WriteEmbeddedKustomization(fs, "/etc/iknite.d", testutil.TestLogger(t)))
+	exists, err := fs.Exists("/etc/iknite.d/kustomization.yaml")
+	req.NoError(err)
+	req.True(exists)
+}
@@ -23,12 +23,14 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -39,6 +41,7 @@ import (
 
 	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
 	"github.com/kaweezle/iknite/pkg/constants"
+	"github.com/kaweezle/iknite/pkg/forward"
 	"github.com/kaweezle/iknite/pkg/host"
 	"github.com/kaweezle/iknite/pkg/k8s"
 	"github.com/kaweezle/iknite/pkg/pki"
@@ -54,10 +57,25 @@ type IkniteServer struct {
 	httpServer  *http.Server
 	spec        *v1alpha1.IkniteClusterSpec
 	clusterJSON []byte
+	forwarder   Forwarder
 	mu          sync.RWMutex
 	isShutDown  bool
 }
 
+// Forwarder manages the port forwarding rules served on /forwards. It is implemented by [forward.Manager].
+type Forwarder interface {
+	Status() []forward.RuleStatus
+	Add(rule v1alpha1.ForwardRule) error
+	Remove(name string) error
+}
+
+// SetForwarder sets the forwarder managing the rules served on /forwards.
+func (s *IkniteServer) SetForwarder(f Forwarder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.forwarder = f
+}
+
 // SetCluster serializes c to JSON and stores it under the write lock so that
 // subsequent /status requests serve the latest in-memory state.
 func (s *IkniteServer) SetCluster(c *v1alpha1.IkniteCluster) {
@@ -91,6 +109,58 @@ func (s *IkniteServer) statusHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// forwardsHandler lists the port forwarding rules with their metrics on GET and adds the rule in the body on POST.
+// DELETE /forwards/<name> removes a rule.
+func (s *IkniteServer) forwardsHandler(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	forwarder := s.forwarder
+	s.mu.RUnlock()
+	if forwarder == nil {
+		http.Error(w, "port forwarding not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/forwards"), "/")
+	var err error
+	status := http.StatusOK
+	switch {
+	case r.Method == http.MethodGet && name == "":
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(forwarder.Status())
+	case r.Method == http.MethodPost && name == "":
+		var rule v1alpha1.ForwardRule
+		if err = json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			http.Error(w, fmt.Sprintf("invalid forward rule: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err = forwarder.Add(rule); err != nil {
+			status = http.StatusBadRequest
+			if errors.Is(err, forward.ErrRuleExists) {
+				status = http.StatusConflict
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodDelete && name != "":
+		if err = forwarder.Remove(name); err != nil {
+			status = http.StatusInternalServerError
+			if errors.Is(err, forward.ErrRuleNotFound) {
+				status = http.StatusNotFound
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		s.Logger().Error("Failed to write forwards response", utils.ErrorKey, err)
+	}
+}
+
 // healthzHandler serves a simple liveness check. It always returns 200 OK with
 // the body "ok" so that clients can verify the server is reachable and the mTLS
 // handshake succeeds without parsing JSON.
@@ -310,6 +380,8 @@ func NewIkniteServer(
 	mux := http.NewServeMux()
 	mux.HandleFunc("/status", s.statusHandler)
 	mux.HandleFunc("/healthz", s.healthzHandler)
+	mux.HandleFunc("/forwards", s.forwardsHandler)
+	mux.HandleFunc("/forwards/", s.forwardsHandler)
 
 	addr := net.JoinHostPort("0.0.0.0", strconv.Itoa(spec.StatusServerPort))
 	s.httpServer = &http.Server{
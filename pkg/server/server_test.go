@@ -23,12 +23,14 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -39,6 +41,7 @@ import (
 
 	"github.com/kaweezle/iknite/pkg/apis/iknite/v1alpha1"
 	"github.com/kaweezle/iknite/pkg/constants"
+	"github.com/kaweezle/iknite/pkg/forward"
 	"github.com/kaweezle/iknite/pkg/host"
 	"github.com/kaweezle/iknite/pkg/k8s"
 	"github.com/kaweezle/iknite/pkg/pki"
@@ -496,3 +499,80 @@ func TestStartIkniteServer(t *testing.T) {
 	err = server.ShutdownServer(srv)
 	require.NoError(t, err)
 }
+
+type fakeForwarder struct {
+	rules []v1alpha1.ForwardRule
+}
+
+func (f *fakeForwarder) Status() []forward.RuleStatus {
+	result := make([]forward.RuleStatus, 0, len(f.rules))
+	for _, rule := range f.rules {
+		result = append(result, forward.RuleStatus{ForwardRule: rule, TotalConnections: 1})
+	}
+	return result
+}
+
+func (f *fakeForwarder) Add(rule v1alpha1.ForwardRule) error {
+	for _, r := range f.rules {
+		if r.Name == rule.Name {
+			return fmt.Errorf("%w: %s", forward.ErrRuleExists, rule.Name)
+		}
+	}
+	f.rules = append(f.rules, rule)
+	return nil
+}
+
+func (f *fakeForwarder) Remove(name string) error {
+	for i, r := range f.rules {
+		if r.Name == name {
+			f.rules = append(f.rules[:i], f.rules[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", forward.ErrRuleNotFound, name)
+}
+
+func TestForwardsEndpoint(t *testing.T) {
+	t.Parallel()
+	fs := host.NewMemMapFS()
+	createTestCA(t, fs, pkiDir)
+
+	spec := makeTestSpec(0)
+	logger := testutil.TestLogger(t)
+	require.NoError(t, server.EnsureServerCertAndKey(fs, pkiDir, []string{"iknite.local"}, []net.IP{spec.Ip}, logger))
+
+	iSrv, err := server.NewIkniteServer(fs, pkiDir, spec, logger)
+	require.NoError(t, err)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req, reqErr := http.NewRequestWithContext(context.Background(), method, path, strings.NewReader(body))
+		require.NoError(t, reqErr)
+		rec := httptest.NewRecorder()
+		iSrv.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Not available before the forwarder is set
+	require.Equal(t, http.StatusServiceUnavailable, do(http.MethodGet, "/forwards", "").Code)
+
+	iSrv.SetForwarder(&fakeForwarder{})
+	rule := `{"name":"web","port":8080,"target":"10.0.0.5:80"}`
+	require.Equal(t, http.StatusCreated, do(http.MethodPost, "/forwards", rule).Code)
+	require.Equal(t, http.StatusConflict, do(http.MethodPost, "/forwards", rule).Code)
+	require.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/forwards", "{").Code)
+
+	rec := do(http.MethodGet, "/forwards", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var statuses []forward.RuleStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &statuses))
+	require.Len(t, statuses, 1)
+	require.Equal(t, "web", statuses[0].Name)
+	require.Equal(t, 8080, statuses[0].Port)
+	require.Equal(t, int64(1), statuses[0].TotalConnections)
+
+	require.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/forwards/web", "").Code)
+	require.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/forwards/web", "").Code)
+	require.Equal(t, http.StatusMethodNotAllowed, do(http.MethodDelete, "/forwards", "").Code)
+	require.Equal(t, http.StatusMethodNotAllowed, do(http.MethodPut, "/forwards", "").Code)
+}
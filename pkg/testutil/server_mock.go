@@ -199,6 +199,36 @@ func FailOverrideHandler(
 	return true
 }
 
+// WatchOverrideHandler lets informers use the test server. The watch requests are kept open until the client closes
+// them and the other requests are left to the default handler. The watch list requests are rejected so that the
+// informers fall back to listing the resources.
+func WatchOverrideHandler(
+	path string,
+	w http.ResponseWriter,
+	r *http.Request,
+	log *RequestLog,
+	_ embed.FS,
+	logger *slog.Logger,
+) bool {
+	if r.URL.Query().Get("watch") != "true" {
+		return false
+	}
+	if r.URL.Query().Get("sendInitialEvents") == "true" {
+		logger.Info("Rejecting watch list request", "path", path)
+		log.StatusCode = http.StatusBadRequest
+		w.WriteHeader(http.StatusBadRequest)
+		return true
+	}
+	w.Header().Set("Content-Type", "application/json")
+	log.StatusCode = http.StatusOK
+	w.WriteHeader(http.StatusOK)
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	<-r.Context().Done()
+	return true
+}
+
 type TestServerOptions struct {
 	Entry     *slog.Logger
 	Overrides map[string]HandlerOverrideFunc
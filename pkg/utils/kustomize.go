@@ -25,9 +25,16 @@ import (
 )
 
 type KustomizeOptions struct {
-	Kustomization string
-	ForceConfig   bool
-	ForceEmbedded bool
+	// Variables are substituted in the rendered kustomization. They are computed from the cluster configuration.
+	Variables       map[string]string
+	Kustomization   string
+	SubstituteAllow []string
+	ApplyRetries    int
+	ForceConfig     bool
+	ForceEmbedded   bool
+	Prune           bool
+	// SubstituteStrict makes the rendering fail on undefined variables.
+	SubstituteStrict bool
 }
 
 func NewKustomizeOptions() *KustomizeOptions {
@@ -35,6 +42,11 @@ func NewKustomizeOptions() *KustomizeOptions {
 		Kustomization: constants.DefaultKustomization,
 		ForceConfig:   false,
 		ForceEmbedded: false,
+		ApplyRetries:  constants.DefaultApplyRetries,
+		Variables:     map[string]string{},
+		SubstituteAllow: []string{
+			constants.DefaultSubstituteAllow,
+		},
 	}
 	return result
 }
@@ -54,6 +66,30 @@ func AddKustomizeOptionsFlags(flagSet *flag.FlagSet, kustomizeConfig *KustomizeO
 		kustomizeConfig.ForceEmbedded,
 		"Force use of embedded kustomization even if a custom one is available",
 	)
+	flagSet.BoolVar(
+		&kustomizeConfig.Prune,
+		options.Prune,
+		kustomizeConfig.Prune,
+		"Delete the resources of the previously applied kustomization that are not rendered anymore",
+	)
+	flagSet.IntVar(
+		&kustomizeConfig.ApplyRetries,
+		options.ApplyRetries,
+		kustomizeConfig.ApplyRetries,
+		"Number of attempts to apply each resource of the kustomization",
+	)
+	flagSet.StringSliceVar(
+		&kustomizeConfig.SubstituteAllow,
+		options.SubstituteAllow,
+		kustomizeConfig.SubstituteAllow,
+		"Patterns of the variables substituted in the kustomization",
+	)
+	flagSet.BoolVar(
+		&kustomizeConfig.SubstituteStrict,
+		options.SubstituteStrict,
+		kustomizeConfig.SubstituteStrict,
+		"Fail if the kustomization references an undefined variable",
+	)
 
 	existing := flagSet.Lookup(options.Kustomization)
 	if existing == nil {
@@ -61,7 +97,7 @@ func AddKustomizeOptionsFlags(flagSet *flag.FlagSet, kustomizeConfig *KustomizeO
 			&kustomizeConfig.Kustomization,
 			options.Kustomization,
 			kustomizeConfig.Kustomization,
-			"Kustomization location (URL or directory)",
+			"Kustomization location (directory, URL, oci:// artifact or git+ repository)",
 		)
 	} else {
 		AddStringFlagDestination(existing, &kustomizeConfig.Kustomization)
@@ -24,9 +24,12 @@ func TestKustomizeOptions_DefaultsAndFlags(t *testing.T) {
 
 	flags := pflag.NewFlagSet("kustomize", pflag.ContinueOnError)
 	utils.AddKustomizeOptionsFlags(flags, kOpts)
-	err := flags.Parse([]string{"--force-config", "--force-embedded", "--kustomization=custom"})
+	err := flags.Parse([]string{"--force-config", "--force-embedded", "--prune", "--apply-retries=2",
+		"--kustomization=custom"})
 	req.NoError(err)
 
+	req.True(kOpts.Prune)
+	req.Equal(2, kOpts.ApplyRetries)
 	req.True(kOpts.ForceConfig)
 	req.True(kOpts.ForceEmbedded)
 	req.Equal("custom", kOpts.Kustomization)